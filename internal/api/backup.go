@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"products-api/internal/db"
+	"products-api/internal/models"
+)
+
+// ExportBackup handles GET /api/v1/admin/export
+//
+// Returns a backup of the entire catalog: all of the products (ordered by
+// ID) and the IDs of deleted products, which may be restored by
+// POST /api/v1/admin/import.
+func (h *Handler) ExportBackup(w http.ResponseWriter, r *http.Request) {
+	backup, err := h.db.ExportAll(r.Context())
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to export products", err.Error())
+		return
+	}
+
+	h.writeResponse(w, r, http.StatusOK, backup)
+}
+
+// ImportBackup handles POST /api/v1/admin/import
+//
+// Restores a backup, as returned by GET /api/v1/admin/export, merging it
+// into the catalog (the backup taking precedence for the IDs it includes)
+// or, with ?replace=true, replacing the catalog.  The backup is restored
+// entirely or not at all.
+func (h *Handler) ImportBackup(w http.ResponseWriter, r *http.Request) {
+	var replace bool
+	if r.URL.Query().Has("replace") {
+		switch s := r.URL.Query().Get("replace"); strings.ToLower(s) {
+		case "true":
+			replace = true
+		case "false":
+		default:
+			h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", fmt.Sprintf("invalid replace value: %s", s))
+			return
+		}
+	}
+
+	if !h.requireContentType(w, r, "application/json") {
+		return
+	}
+
+	var backup models.Backup
+	if err := json.NewDecoder(r.Body).Decode(&backup); err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidJSON, cInvalidJSON, err.Error())
+		return
+	}
+	if !h.validateRequest(w, r, &backup) {
+		return
+	}
+
+	err := h.db.ImportAll(r.Context(), backup, replace)
+	switch {
+	case errors.Is(err, db.ErrInvalidBackup):
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidImport, "Invalid backup", err.Error())
+		return
+
+	case errors.Is(err, db.ErrDuplicateSKU):
+		h.writeErrorResponse(w, r, http.StatusConflict, models.CodeDuplicateSKU, cDuplicateSKU, err.Error())
+		return
+
+	case err != nil:
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to import products", err.Error())
+		return
+	}
+
+	total, err := h.db.CountProducts(r.Context())
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to count products", err.Error())
+		return
+	}
+
+	h.logger.LogAttrs(r.Context(), slog.LevelInfo, "backup restored",
+		slog.String("request_id", RequestIDFromContext(r.Context())),
+		slog.Bool("replace", replace),
+		slog.Int("restored", len(backup.Products)),
+		slog.Int("total", total),
+	)
+
+	h.writeResponse(w, r, http.StatusOK, models.RestoreResponse{Restored: len(backup.Products), Total: total})
+}
@@ -0,0 +1,158 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"products-api/internal/api"
+	"products-api/internal/db"
+	"products-api/internal/models"
+)
+
+func TestBackup(t *testing.T) {
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil, api.WithAdminEndpoints()).SetupRoutes()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newJSONRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+
+	// export returns a backup of the catalog, failing the test if it cannot
+	// be exported
+	export := func(t *testing.T) models.Backup {
+		t.Helper()
+		rr := serve("GET", "/api/v1/admin/export", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		var backup models.Backup
+		if err := json.Unmarshal(rr.Body.Bytes(), &backup); err != nil {
+			t.Fatalf("Failed to unmarshal backup: %v", err)
+		}
+		return backup
+	}
+
+	// restore imports a backup, failing the test if it cannot be restored
+	restore := func(t *testing.T, backup models.Backup, query string) models.RestoreResponse {
+		t.Helper()
+		body, err := json.Marshal(backup)
+		if err != nil {
+			t.Fatalf("Failed to marshal backup: %v", err)
+		}
+		rr := serve("POST", "/api/v1/admin/import"+query, string(body))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		var response models.RestoreResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		return response
+	}
+
+	t.Run("Export, clear and import", func(t *testing.T) {
+		if rr := serve("DELETE", "/api/v1/products/3", ""); rr.Code != http.StatusNoContent {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+		}
+		backup := export(t)
+		if len(backup.Products) != 4 || !reflect.DeepEqual(backup.DeletedIDs, []int{3}) {
+			t.Fatalf("Expected 4 products and deleted IDs [3], got %d products and deleted IDs %v", len(backup.Products), backup.DeletedIDs)
+		}
+
+		if response := restore(t, models.Backup{}, "?replace=true"); response.Restored != 0 || response.Total != 0 {
+			t.Fatalf("Expected an empty catalog, got %+v", response)
+		}
+		if rr := serve("GET", "/api/v1/products/1", ""); rr.Code != http.StatusNotFound {
+			t.Fatalf("Expected status code %d once cleared, got %d", http.StatusNotFound, rr.Code)
+		}
+
+		if response := restore(t, backup, "?replace=true"); response.Restored != 4 || response.Total != 4 {
+			t.Errorf("Expected 4 products restored and in the catalog, got %+v", response)
+		}
+		if restored := export(t); !reflect.DeepEqual(restored, backup) {
+			t.Errorf("Expected the restored backup to equal the export\nexpected %+v\ngot      %+v", backup, restored)
+		}
+		if rr := serve("GET", "/api/v1/products/3", ""); rr.Code != http.StatusGone {
+			t.Errorf("Expected status code %d for a deleted product, got %d", http.StatusGone, rr.Code)
+		}
+
+		// a product created after the restore does not collide with a
+		// restored product
+		rr := serve("POST", "/api/v1/products", `{"name":"Desk Lamp","price":39.99,"category":"Furniture"}`)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		var product models.Product
+		if err := json.Unmarshal(rr.Body.Bytes(), &product); err != nil {
+			t.Fatalf("Failed to unmarshal product: %v", err)
+		}
+		if product.ID != 6 {
+			t.Errorf("Expected ID 6, got %d", product.ID)
+		}
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		response := restore(t, models.Backup{Products: []models.Product{{ID: 20, Name: "Stapler", Price: 9.99, Category: "Office Supplies"}}}, "")
+		if response.Restored != 1 || response.Total != 6 {
+			t.Errorf("Expected 1 product restored and 6 in the catalog, got %+v", response)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		for _, tt := range []struct {
+			name, query, body string
+			expectedStatus    int
+			expectedCode      string
+		}{
+			{name: "Invalid replace", query: "?replace=maybe", body: `{}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeInvalidQuery},
+			{name: "Invalid JSON", body: `{`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeInvalidJSON},
+			{name: "Invalid product", body: `{"products":[{"id":30,"name":"","price":1}]}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+			{name: "Invalid ID", body: `{"products":[{"id":0,"name":"Pen","price":1}]}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeInvalidImport},
+			{name: "Duplicate SKU", body: `{"products":[{"id":30,"sku":"LAP-001","name":"Pen","price":1}]}`, expectedStatus: http.StatusConflict, expectedCode: models.CodeDuplicateSKU},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				rr := serve("POST", "/api/v1/admin/import"+tt.query, tt.body)
+				if rr.Code != tt.expectedStatus {
+					t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+				}
+
+				var response models.ErrorResponse
+				if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if response.Code != tt.expectedCode {
+					t.Errorf("Expected code %s, got %s", tt.expectedCode, response.Code)
+				}
+			})
+		}
+	})
+
+	// any client could otherwise dump or replace the catalog
+	t.Run("Admin endpoints not enabled", func(t *testing.T) {
+		database := db.NewInMemoryDB(db.WithSampleData())
+		router := api.NewHandler(database, nil).SetupRoutes()
+
+		for _, rq := range []struct{ method, path, body string }{
+			{"GET", "/api/v1/admin/export", ""},
+			{"POST", "/api/v1/admin/import?replace=true", `{"products":[]}`},
+		} {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newJSONRequest(rq.method, rq.path, strings.NewReader(rq.body)))
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("%s %s: expected status code %d, got %d", rq.method, rq.path, http.StatusNotFound, rr.Code)
+			}
+		}
+
+		if n, _ := database.CountProducts(context.Background()); n != 5 {
+			t.Errorf("Expected the catalog to be unchanged, got %d products", n)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"products-api/internal/db"
+	"products-api/internal/models"
+)
+
+// BulkUpdateProducts handles POST /api/v1/products/bulk-update
+//
+// Applies an update and/or a price multiplier to all products matching a
+// filter, responding with the number of products updated.  The filter is
+// required and must specify at least one filter, so that all products cannot
+// be updated by accident.  The update is validated as for an update of a
+// single product, and is applied to all of the products or to none of them.
+func (h *Handler) BulkUpdateProducts(w http.ResponseWriter, r *http.Request) {
+	var req models.BulkUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidJSON, cInvalidJSON, err.Error())
+		return
+	}
+
+	query, err := filterQuery(req.Filter)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeValidationFailed, cValidationFailed, err.Error())
+		return
+	}
+
+	filters, err := h.productFilters(query)
+	if err == nil && len(filters) == 0 {
+		err = errors.New("filter must specify at least one filter")
+	}
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeValidationFailed, cValidationFailed, err.Error())
+		return
+	}
+
+	var update models.UpdateProductRequest
+	if req.Update != nil {
+		update = *req.Update
+	}
+	update.TrimSpace()
+	update.PriceMultiplier = req.PriceMultiplier
+
+	switch {
+	case req.Update == nil && req.PriceMultiplier == nil:
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeValidationFailed, cValidationFailed, "update or price_multiplier is required")
+		return
+
+	case update.Price != nil && update.PriceMultiplier != nil:
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeValidationFailed, cValidationFailed, "price and price_multiplier cannot both be specified")
+		return
+	}
+
+	if !h.validateRequest(w, r, &update) {
+		return
+	}
+	if update.Category != nil && !h.validateCategory(w, r, *update.Category) {
+		return
+	}
+
+	updated, err := h.db.UpdateWhere(r.Context(), filters, update)
+	switch {
+	case errors.Is(err, db.ErrDuplicateSKU):
+		h.writeErrorResponse(w, r, http.StatusConflict, models.CodeDuplicateSKU, cDuplicateSKU, "")
+		return
+
+	case errors.Is(err, db.ErrTooManyCategories):
+		h.writeErrorResponse(w, r, http.StatusUnprocessableEntity, models.CodeTooManyCategories, cTooManyCategories, "")
+		return
+
+	case err != nil:
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to update products", err.Error())
+		return
+	}
+
+	h.logger.Info("bulk update", "updated", updated, "request_id", RequestIDFromContext(r.Context()))
+	h.writeResponse(w, r, http.StatusOK, models.BulkUpdateResponse{Updated: updated})
+}
+
+// filterQuery returns the query parameters equivalent to the filter of a
+// bulk update.  Strings, numbers and booleans are the values of parameters
+// and a list gives a parameter multiple values; any other value is an error,
+// as is a name that is not a filter parameter (which would otherwise be
+// ignored, widening the update).
+func filterQuery(filter map[string]any) (url.Values, error) {
+	query := url.Values{}
+
+	isFilter := func(param string) bool {
+		return param == "match" || slices.ContainsFunc(filterSuggestions, func(f struct{ param, suggestion string }) bool {
+			return f.param == param
+		})
+	}
+
+	value := func(param string, v any) (string, error) {
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		default:
+			return "", fmt.Errorf("invalid filter value for %s: %v", param, v)
+		}
+	}
+
+	for _, param := range slices.Sorted(maps.Keys(filter)) {
+		if !isFilter(param) {
+			return nil, fmt.Errorf("unknown filter: %s", param)
+		}
+
+		v := filter[param]
+		values, isList := v.([]any)
+		if !isList {
+			values = []any{v}
+		}
+		for _, v := range values {
+			s, err := value(param, v)
+			if err != nil {
+				return nil, err
+			}
+			query.Add(param, s)
+		}
+	}
+	return query, nil
+}
@@ -0,0 +1,97 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"products-api/internal/api"
+	"products-api/internal/db"
+	"products-api/internal/models"
+)
+
+func TestBulkUpdateProducts(t *testing.T) {
+	tests := []struct {
+		name            string
+		body            string
+		expectedStatus  int
+		expectedCode    string
+		expectedUpdated int
+		expectedPrices  map[int]float64 // by product ID; other products are untouched
+		expectedInStock map[int]bool
+	}{
+		{name: "Price multiplier", body: `{"filter":{"category":"electronics"},"price_multiplier":0.9}`, expectedStatus: http.StatusOK, expectedUpdated: 3, expectedPrices: map[int]float64{1: 1169.99, 2: 26.99, 5: 809.99}},
+		{name: "Update", body: `{"filter":{"category":"Electronics","price_max":100},"update":{"in_stock":false}}`, expectedStatus: http.StatusOK, expectedUpdated: 1, expectedInStock: map[int]bool{2: false}},
+		{name: "Update and price multiplier", body: `{"filter":{"in_stock":false},"update":{"in_stock":true},"price_multiplier":2}`, expectedStatus: http.StatusOK, expectedUpdated: 1, expectedPrices: map[int]float64{3: 25}, expectedInStock: map[int]bool{3: true}},
+		{name: "Any filter", body: `{"filter":{"category":"Furniture","in_stock":"false","match":"any"},"update":{"price":10}}`, expectedStatus: http.StatusOK, expectedUpdated: 2, expectedPrices: map[int]float64{3: 10, 4: 10}},
+		{name: "No matching products", body: `{"filter":{"category":"Toys"},"update":{"price":10}}`, expectedStatus: http.StatusOK},
+		{name: "SKU of several products", body: `{"filter":{"category":"Electronics"},"update":{"sku":"NEW-001"}}`, expectedStatus: http.StatusConflict, expectedCode: models.CodeDuplicateSKU},
+		{name: "Missing filter", body: `{"update":{"price":10}}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+		{name: "No filters", body: `{"filter":{"match":"any","category":""},"update":{"price":10}}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+		{name: "Unknown filter", body: `{"filter":{"categroy":"Electronics"},"update":{"price":10}}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+		{name: "Invalid filter", body: `{"filter":{"price_min":"cheap"},"update":{"price":10}}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+		{name: "Invalid filter value", body: `{"filter":{"category":{"name":"Electronics"}},"update":{"price":10}}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+		{name: "Missing update", body: `{"filter":{"category":"Electronics"}}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+		{name: "Price and price multiplier", body: `{"filter":{"category":"Electronics"},"update":{"price":10},"price_multiplier":0.9}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+		{name: "Invalid update", body: `{"filter":{"category":"Electronics"},"update":{"price":-1}}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+		{name: "Invalid price multiplier", body: `{"filter":{"category":"Electronics"},"price_multiplier":-1}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+		{name: "Invalid JSON", body: `invalid json`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeInvalidJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := db.NewInMemoryDB(db.WithSampleData())
+			before, _ := database.ListProducts(context.Background())
+			router := api.NewHandler(database, nil).SetupRoutes()
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/products/bulk-update", strings.NewReader(tt.body)))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+
+			if tt.expectedCode != "" {
+				var response models.ErrorResponse
+				if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if response.Code != tt.expectedCode {
+					t.Errorf("Expected code %q, got %q", tt.expectedCode, response.Code)
+				}
+			} else {
+				var response models.BulkUpdateResponse
+				if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if response.Updated != tt.expectedUpdated {
+					t.Errorf("Expected %d products updated, got %d", tt.expectedUpdated, response.Updated)
+				}
+			}
+
+			after, _ := database.ListProducts(context.Background())
+			for i, product := range after {
+				original := before[i]
+
+				expectedPrice, ok := tt.expectedPrices[product.ID]
+				if !ok {
+					expectedPrice = original.Price
+				}
+				expectedInStock, ok := tt.expectedInStock[product.ID]
+				if !ok {
+					expectedInStock = original.InStock
+				}
+
+				if product.Price != expectedPrice || product.InStock != expectedInStock {
+					t.Errorf("Product %d: expected price %v and in_stock %v, got %v and %v", product.ID, expectedPrice, expectedInStock, product.Price, product.InStock)
+				}
+				if product.SKU != original.SKU {
+					t.Errorf("Product %d: expected SKU %q, got %q", product.ID, original.SKU, product.SKU)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// defaultCapacityWarningThreshold is the percentage of the maximum number of
+// products at which a capacity warning is given, if not configured
+const defaultCapacityWarningThreshold = 90
+
+// capacityWarning returns a warning describing the number of products in the
+// catalog if a maximum number of products is configured and the catalog has
+// reached the warning threshold; otherwise an empty string is returned.
+//
+// The warning is also logged.  Failure to determine the number of products
+// is logged but otherwise ignored; the warning is advisory only.
+func (h *Handler) capacityWarning(r *http.Request) string {
+	if h.maxProducts <= 0 {
+		return ""
+	}
+
+	count, err := h.db.CountProducts(r.Context())
+	if err != nil {
+		h.logger.LogAttrs(r.Context(), slog.LevelError, "failed to determine product count",
+			slog.String("request_id", RequestIDFromContext(r.Context())),
+			slog.String("error", err.Error()),
+		)
+		return ""
+	}
+
+	if count*100 < h.maxProducts*h.capacityWarningThreshold {
+		return ""
+	}
+
+	h.logger.LogAttrs(r.Context(), slog.LevelWarn, "catalog approaching capacity",
+		slog.String("request_id", RequestIDFromContext(r.Context())),
+		slog.Int("product_count", count),
+		slog.Int("max_products", h.maxProducts),
+	)
+	return fmt.Sprintf("%d of %d products (%d%%)", count, h.maxProducts, count*100/h.maxProducts)
+}
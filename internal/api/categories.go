@@ -0,0 +1,34 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"products-api/internal/models"
+)
+
+// categoryError returns an error describing why a product may not be in a
+// category, or nil if it may be: if the Handler is configured with allowed
+// categories (see WithAllowedCategories) a category must be one of them,
+// compared case-insensitively.  A product need not be in a category.
+func (h *Handler) categoryError(category string) error {
+	if len(h.allowedCategories) == 0 || category == "" {
+		return nil
+	}
+	if slices.ContainsFunc(h.allowedCategories, func(allowed string) bool { return strings.EqualFold(allowed, category) }) {
+		return nil
+	}
+	return fmt.Errorf("%s is not an allowed category (allowed categories are %s)", category, strings.Join(h.allowedCategories, ", "))
+}
+
+// validateCategory reports whether a product may be in a category (see
+// categoryError), writing a 400 Bad Request response if it may not
+func (h *Handler) validateCategory(w http.ResponseWriter, r *http.Request, category string) bool {
+	if err := h.categoryError(category); err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidCategory, cInvalidCategory, err.Error())
+		return false
+	}
+	return true
+}
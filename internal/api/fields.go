@@ -0,0 +1,170 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"products-api/internal/models"
+)
+
+// productFields are the names of the fields of a product (as named in JSON
+// and XML), in the order in which they are marshalled
+var productFields = func() []string {
+	var fields []string
+	typ := reflect.TypeFor[models.Product]()
+	for i := range typ.NumField() {
+		if name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ","); name != "" && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}()
+
+// fieldsFromQuery returns the fields of products selected by the fields query
+// parameter (a comma-separated list of field names), or nil if no fields are
+// specified (i.e. all fields are selected).  An error is returned if any of
+// the fields is not a field of a product.
+func fieldsFromQuery(r *http.Request) ([]string, error) {
+	s := r.URL.Query().Get("fields")
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var fields []string
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if !slices.Contains(productFields, field) {
+			return nil, fmt.Errorf("invalid field: %q (valid fields are %s)", field, strings.Join(productFields, ", "))
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// productProjection is a product marshalled with only selected fields, in
+// the order in which the fields of a product are marshalled (regardless of
+// the order in which they were selected).  As for a product, empty fields
+// that are omitted when empty (e.g. sku) are omitted even if selected.
+type productProjection struct {
+	product *models.Product
+	fields  []string
+}
+
+// projectProducts returns projections of products with the selected fields
+func projectProducts(products []models.Product, fields []string) []productProjection {
+	projections := make([]productProjection, len(products))
+	for i := range products {
+		projections[i] = productProjection{product: &products[i], fields: fields}
+	}
+	return projections
+}
+
+// MarshalJSON marshals the selected fields of the product
+func (p productProjection) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(p.product)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for _, field := range productFields {
+		value, ok := values[field]
+		if !ok || !slices.Contains(p.fields, field) {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(field)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// MarshalXML marshals the selected fields of the product as a product
+// element (the name of the specified start element is derived from the type,
+// which is not the name of the element of a product)
+func (p productProjection) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	data, err := xml.Marshal(p.product)
+	if err != nil {
+		return err
+	}
+
+	start.Name = xml.Name{Local: "product"}
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	// copy the elements of the selected fields (the children of the root
+	// element of the product) with their content
+	d := xml.NewDecoder(bytes.NewReader(data))
+	depth, selected := 0, false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth++; depth == 1 {
+				continue // the root element is replaced by the start element
+			} else if depth == 2 {
+				selected = slices.Contains(p.fields, t.Name.Local)
+			}
+		case xml.EndElement:
+			if depth--; depth == 0 {
+				continue
+			}
+		default:
+			if depth < 2 {
+				continue
+			}
+		}
+
+		if selected {
+			if err := e.EncodeToken(xml.CopyToken(tok)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// sparsePaginatedResponse is a PaginatedResponse with products projected to
+// selected fields
+type sparsePaginatedResponse struct {
+	XMLName xml.Name `json:"-" xml:"products"`
+	models.PaginatedResponse
+	Data []productProjection `json:"data" xml:"data>product"`
+}
+
+// sparseProductsByIDsResponse is a ProductsByIDsResponse with products
+// projected to selected fields (marshalled before the missing IDs, as for a
+// ProductsByIDsResponse)
+type sparseProductsByIDsResponse struct {
+	XMLName xml.Name            `json:"-" xml:"products"`
+	Data    []productProjection `json:"data" xml:"data>product"`
+	models.ProductsByIDsResponse
+}
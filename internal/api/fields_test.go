@@ -0,0 +1,131 @@
+package api_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"products-api/internal/api"
+	"products-api/internal/db"
+	"products-api/internal/models"
+)
+
+func TestSparseFields(t *testing.T) {
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil).SetupRoutes()
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedKeys   []string
+	}{
+		{name: "Product", path: "/api/v1/products/1?fields=id,name,price", expectedStatus: http.StatusOK, expectedKeys: []string{"id", "name", "price"}},
+		{name: "Product by SKU", path: "/api/v1/products/LAP-001?fields=sku,%20tags", expectedStatus: http.StatusOK, expectedKeys: []string{"sku"}},
+		{name: "All fields", path: "/api/v1/products/1?fields=", expectedStatus: http.StatusOK, expectedKeys: []string{"id", "sku", "name", "description", "price", "currency", "category", "in_stock", "quantity", "created_at", "updated_at"}},
+		{name: "Unknown field", path: "/api/v1/products/1?fields=id,colour", expectedStatus: http.StatusBadRequest},
+		{name: "Listing", path: "/api/v1/products?fields=name,price&page_size=2", expectedStatus: http.StatusOK, expectedKeys: []string{"name", "price"}},
+		{name: "Listing unknown field", path: "/api/v1/products?fields=name,,price", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+
+			if rr.Code != http.StatusOK {
+				var response models.ErrorResponse
+				if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if response.Code != models.CodeInvalidQuery || !strings.Contains(response.Message, "valid fields are id, sku, name") {
+					t.Errorf("Expected %s listing valid fields, got %+v", models.CodeInvalidQuery, response)
+				}
+				return
+			}
+
+			var products []map[string]json.RawMessage
+			if strings.HasPrefix(tt.path, "/api/v1/products?") {
+				var response struct {
+					Data  []map[string]json.RawMessage `json:"data"`
+					Total int                          `json:"total"`
+				}
+				if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if len(response.Data) != 2 || response.Total != 5 {
+					t.Fatalf("Expected 2 of 5 products, got %d of %d", len(response.Data), response.Total)
+				}
+				products = response.Data
+			} else {
+				var product map[string]json.RawMessage
+				if err := json.Unmarshal(rr.Body.Bytes(), &product); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				products = append(products, product)
+			}
+
+			for _, product := range products {
+				keys := slices.Sorted(func(yield func(string) bool) {
+					for key := range product {
+						if !yield(key) {
+							return
+						}
+					}
+				})
+				if expected := slices.Sorted(slices.Values(tt.expectedKeys)); !slices.Equal(keys, expected) {
+					t.Errorf("Expected keys %v, got %v", expected, keys)
+				}
+			}
+		})
+	}
+
+	t.Run("Values", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/1?fields=price,name", nil))
+
+		// fields are in the order of a product, regardless of the order requested
+		if body := strings.TrimSpace(rr.Body.String()); body != `{"name":"Laptop","price":1299.99}` {
+			t.Errorf("Expected body %s, got %s", `{"name":"Laptop","price":1299.99}`, body)
+		}
+	})
+
+	t.Run("XML", func(t *testing.T) {
+		for _, path := range []string{"/api/v1/products/1?fields=name,tags", "/api/v1/products?fields=name,tags&page_size=1"} {
+			req := httptest.NewRequest("GET", path, nil)
+			req.Header.Set("Accept", "application/xml")
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if contentType := rr.Header().Get("Content-Type"); contentType != "application/xml" {
+				t.Fatalf("%s: expected Content-Type application/xml, got %s", path, contentType)
+			}
+
+			var product models.Product
+			var err error
+			if strings.HasPrefix(path, "/api/v1/products?") {
+				var response models.PaginatedResponse
+				if err = xml.Unmarshal(rr.Body.Bytes(), &response); err == nil && len(response.Data) == 1 {
+					product = response.Data[0]
+				}
+			} else {
+				err = xml.Unmarshal(rr.Body.Bytes(), &product)
+			}
+			if err != nil {
+				t.Fatalf("%s: failed to unmarshal response: %v", path, err)
+			}
+
+			if product.Name != "Laptop" || product.ID != 0 || product.Price != 0 || strings.Contains(rr.Body.String(), "<price>") {
+				t.Errorf("%s: expected only the name of the product, got %s", path, rr.Body.String())
+			}
+		}
+	})
+}
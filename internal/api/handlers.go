@@ -1,45 +1,191 @@
 package api
 
 import (
+	"cmp"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
+	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
 
 	"products-api/internal/db"
 	"products-api/internal/models"
 
+	"github.com/blugnu/time"
+	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
-	cInvalidJSON      = "Invalid JSON"
-	cInvalidProductId = "Invalid product ID"
-	cProductNotFound  = "Product not found"
-	cValidationFailed = "Validation failed"
+	cCapacityExceeded  = "Catalog is at capacity"
+	cDuplicateName     = "Name already exists"
+	cDuplicateSKU      = "SKU already exists"
+	cInternalError     = "Internal server error"
+	cInvalidCategory   = "Invalid category"
+	cInvalidCSV        = "Invalid CSV"
+	cInvalidJSON       = "Invalid JSON"
+	cInvalidProductId  = "Invalid product ID"
+	cMaintenance       = "Service under maintenance"
+	cMethodNotAllowed  = "Method not allowed"
+	cProductGone       = "Product has been deleted"
+	cProductNotFound   = "Product not found"
+	cRateLimited       = "Rate limit exceeded"
+	cRequestTimeout    = "Request timed out"
+	cTooManyCategories = "Too many categories"
+	cUnsupportedMedia  = "Unsupported media type"
+	cValidationFailed  = "Validation failed"
 )
 
 type RateLimiter interface {
 	Allow(rq *http.Request) bool
 }
 
+// WeightedRateLimiter may be implemented by a RateLimiter to allow requests
+// that count as more than one request (see WithWriteCost)
+type WeightedRateLimiter interface {
+	AllowN(rq *http.Request, cost int) bool
+}
+
+// RateLimitReporter may be implemented by a RateLimiter to report the limit
+// applied to clients and the requests remaining for the client making a
+// request (without counting the request), for rate limit headers (see
+// WithRateLimitHeaders).  A rate limiter that does not limit a client
+// reports ratelimiter.Unlimited.
+type RateLimitReporter interface {
+	Limit() int
+	Remaining(rq *http.Request) int
+}
+
+// BurstReporter may be implemented by a RateLimiter allowing requests from a
+// client in excess of its limit, to report the number of such requests
+// allowed and the number used by the client making a request (without
+// counting the request), for the X-RateLimit-Burst-Used header (see
+// WithRateLimitHeaders).  A rate limiter that does not limit a client
+// reports ratelimiter.Unlimited burst used.
+type BurstReporter interface {
+	Burst() int
+	BurstUsed(rq *http.Request) int
+}
+
+// RateLimitResetter may be implemented by a RateLimiter to reset the limit
+// of a client, identified by the client ID used by the rate limiter (e.g. an
+// IP address); see Handler.ResetRateLimit
+type RateLimitResetter interface {
+	Reset(clientID string)
+}
+
+// RetryAfterReporter may be implemented by a RateLimiter to report how long
+// the client making a request must wait before a request of a specified cost
+// (see WeightedRateLimiter) would be allowed, for the Retry-After header and
+// retry_after_seconds of a 429 Too Many Requests response
+type RetryAfterReporter interface {
+	RetryAfter(rq *http.Request, cost int) time.Duration
+}
+
 // Handler handles HTTP requests for the products API
 type Handler struct {
-	db          db.Database
-	rateLimiter RateLimiter
-	validator   *validator.Validate
+	adminEndpoints           bool
+	allowedCategories        []string
+	capacityWarningThreshold int // percentage of maxProducts
+	clock                    time.Clock
+	db                       db.Database
+	defaultOrder             db.ProductOrder // of a product listing with no sort
+	defaultPageSize          int
+	emptyResultHints         bool
+	hideInternalErrors       bool
+	importConcurrency        int
+	inFlight                 atomic.Int64 // number of requests being handled
+	logger                   *slog.Logger
+	maintenance              atomic.Bool
+	maxPageSize              int
+	maxProducts              int
+	metrics                  *metrics
+	metricsRegistry          *prometheus.Registry
+	quietPaths               map[string]bool
+	rateLimiter              RateLimiter
+	rateLimitHeaders         bool
+	redactedFields           map[string]bool
+	requestTimeout           time.Duration
+	reservationTTL           time.Duration
+	schemaValidation         bool
+	startTime                time.Time
+	translator               *ut.UniversalTranslator
+	uniqueNames              bool
+	validator                *validator.Validate
+	writeCost                int
+
+	randMutex sync.Mutex // guards rand, which is not safe for concurrent use
+	rand      *rand.Rand
 }
 
-// NewHandler creates a new API handler
-func NewHandler(database db.Database, rateLimiter RateLimiter) *Handler {
-	return &Handler{
-		db:          database,
-		rateLimiter: rateLimiter,
-		validator:   validator.New(),
+// NewHandler creates a new API handler, applying any specified options
+func NewHandler(database db.Database, rateLimiter RateLimiter, opts ...Option) *Handler {
+	h := &Handler{
+		capacityWarningThreshold: defaultCapacityWarningThreshold,
+		clock:                    time.SystemClock(),
+		db:                       database,
+		defaultPageSize:          db.DefaultPageSize,
+		importConcurrency:        defaultImportConcurrency,
+		logger:                   slog.New(slog.NewJSONHandler(os.Stdout, nil)),
+		maxPageSize:              defaultMaxPageSize,
+		quietPaths:               map[string]bool{"/health": true, "/ready": true},
+		rateLimiter:              rateLimiter,
+		reservationTTL:           defaultReservationTTL,
+		validator:                newValidator(),
+		writeCost:                defaultWriteCost,
+		rand:                     rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+	}
+
+	h.translator = newTranslator(h.validator)
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	h.startTime = h.clock.Now()
+
+	if h.metricsRegistry == nil {
+		h.metricsRegistry = prometheus.NewRegistry()
 	}
+	h.metrics = newMetrics(h.metricsRegistry)
+
+	return h
+}
+
+// InFlight returns the number of requests currently being handled
+func (h *Handler) InFlight() int {
+	return int(h.inFlight.Load())
+}
+
+const (
+	// apiBasePath is the path prefix of API routes
+	apiBasePath = "/api/v1"
+
+	// productsRoute is the route of the products collection (relative to
+	// apiBasePath); the route of a product is productsRoute/{id}
+	productsRoute = "/products"
+)
+
+// productLocation returns the path of the product with a specified ID
+func productLocation(id int) string {
+	return apiBasePath + productsRoute + "/" + strconv.Itoa(id)
 }
 
 // SetupRoutes configures the HTTP routes
@@ -47,55 +193,294 @@ func (h *Handler) SetupRoutes() *mux.Router {
 	router := mux.NewRouter()
 
 	// API routes
-	const productsRoute = "/products"
 	const productByIdRoute = "/products/{id:[0-9]+}"
+	const productByIdOrSkuRoute = "/products/{id:[0-9A-Za-z-]+}"
+	const productBySkuRoute = "/products/sku/{sku}"
+	const cloneProductRoute = "/products/{id:[0-9]+}/clone"
+	const productHistoryRoute = "/products/{id:[0-9]+}/history"
+	const reserveStockRoute = "/products/{id:[0-9]+}/reserve"
+	const randomProductsRoute = "/products/random"
+	const countProductsRoute = "/products/count"
+	const lowStockProductsRoute = "/products/low-stock"
+	const priceStatsRoute = "/products/stats"
+	const groupedProductsRoute = "/products/grouped"
+	const exportProductsRoute = "/products/export"
+	const streamProductsRoute = "/products/stream"
+	const exportProductsCSVRoute = "/products.csv"
+	const importProductsRoute = "/products/import"
+	const bulkUpdateProductsRoute = "/products/bulk-update"
+	const productSchemaRoute = "/products/schema"
+	const resetRateLimitRoute = "/admin/ratelimit/reset"
+	const exportBackupRoute = "/admin/export"
+	const importBackupRoute = "/admin/import"
+
+	api := router.PathPrefix(apiBasePath).Subrouter()
+	api.HandleFunc(randomProductsRoute, h.GetRandomProducts).Methods("GET")
+	api.HandleFunc(countProductsRoute, h.CountProducts).Methods("GET")
+	api.HandleFunc(lowStockProductsRoute, h.LowStockProducts).Methods("GET")
+	api.HandleFunc(priceStatsRoute, h.PriceStats).Methods("GET")
+	api.HandleFunc(groupedProductsRoute, h.GroupedProducts).Methods("GET")
+	api.HandleFunc(exportProductsRoute, h.ExportProducts).Methods("GET")
+	api.HandleFunc(streamProductsRoute, h.StreamProducts).Methods("GET")
+	api.HandleFunc(exportProductsCSVRoute, h.ExportProductsCSV).Methods("GET")
+	api.HandleFunc(importProductsRoute, h.ImportProducts).Methods("POST")
+	api.HandleFunc(bulkUpdateProductsRoute, h.BulkUpdateProducts).Methods("POST")
+	api.HandleFunc(productSchemaRoute, h.ProductSchema).Methods("GET")
 
-	api := router.PathPrefix("/api/v1").Subrouter()
 	api.HandleFunc(productsRoute, h.GetProducts).Methods("GET")
 	api.HandleFunc(productsRoute, h.CreateProduct).Methods("POST")
-	api.HandleFunc(productsRoute, nil).Methods("OPTIONS") // handled by CORS middleware
 
-	api.HandleFunc(productByIdRoute, h.GetProduct).Methods("GET")
+	// sub-resources of the products collection (e.g. random) would otherwise
+	// be matched as SKUs, including for methods they are not routed for
+	api.HandleFunc(productByIdOrSkuRoute, h.GetProduct).Methods("GET", "HEAD").
+		MatcherFunc(notPath(
+			randomProductsRoute,
+			countProductsRoute,
+			lowStockProductsRoute,
+			priceStatsRoute,
+			groupedProductsRoute,
+			exportProductsRoute,
+			streamProductsRoute,
+			importProductsRoute,
+			bulkUpdateProductsRoute,
+			productSchemaRoute,
+		))
 	api.HandleFunc(productByIdRoute, h.UpdateProduct).Methods("PUT")
+	api.HandleFunc(productByIdRoute, h.PatchProduct).Methods("PATCH")
 	api.HandleFunc(productByIdRoute, h.DeleteProduct).Methods("DELETE")
-	api.HandleFunc(productByIdRoute, nil).Methods("OPTIONS") // handled by CORS middleware
+	api.HandleFunc(productBySkuRoute, h.UpsertProduct).Methods("PUT")
+	api.HandleFunc(cloneProductRoute, h.CloneProduct).Methods("POST")
+	api.HandleFunc(productHistoryRoute, h.GetProductHistory).Methods("GET")
+	api.HandleFunc(reserveStockRoute, h.ReserveStock).Methods("POST")
 
-	// Health check endpoint
+	// administration endpoints are not authenticated, so are routed only
+	// if enabled (see WithAdminEndpoints)
+	if h.adminEndpoints {
+		api.HandleFunc(resetRateLimitRoute, h.ResetRateLimit).Methods("POST")
+		api.HandleFunc(maintenanceRoute, h.GetMaintenanceMode).Methods("GET")
+		api.HandleFunc(maintenanceRoute, h.SetMaintenanceMode).Methods("PUT")
+		api.HandleFunc(exportBackupRoute, h.ExportBackup).Methods("GET")
+		api.HandleFunc(importBackupRoute, h.ImportBackup).Methods("POST")
+	}
+
+	// Health check endpoints
 	router.HandleFunc("/health", h.HealthCheck).Methods("GET")
+	router.HandleFunc("/ready", h.ReadinessCheck).Methods("GET")
+
+	// Build metadata
+	router.HandleFunc("/version", h.GetVersion).Methods("GET")
+
+	// Metrics endpoint
+	router.Handle("/metrics", promhttp.HandlerFor(h.metricsRegistry, promhttp.HandlerOpts{})).Methods("GET")
+
+	// API description; routes added above must also be described by openAPISpec
+	router.HandleFunc("/openapi.json", h.OpenAPI).Methods("GET")
+
+	// preflight requests for every route added above
+	registerPreflightRoutes(router)
+
+	// requests not matching any route; the router does not reliably
+	// distinguish an unsupported method from an unknown path for routes in
+	// a subrouter, so both are handled by the same handler.  The middleware
+	// of the router is applied only to matched routes, so these requests are
+	// identified and logged by applying that middleware to the handler
+	router.MethodNotAllowedHandler = h.requestIDMiddleware(h.loggingMiddleware(h.routeNotMatched(router)))
+	router.NotFoundHandler = router.MethodNotAllowedHandler
 
 	// Add middleware
+	router.Use(h.recoveryMiddleware)
+	router.Use(h.inFlightMiddleware)
+	router.Use(h.requestIDMiddleware)
+	router.Use(h.timeoutMiddleware)
+	router.Use(h.metricsMiddleware)
 	if h.rateLimiter != nil {
 		router.Use(h.ratelimiterMiddleware)
 	}
 	router.Use(h.loggingMiddleware)
-	router.Use(h.corsMiddleware)
+	router.Use(h.corsMiddleware(router))
+	router.Use(h.maintenanceMiddleware)
 
 	return router
 }
 
+// notPath returns a matcher of requests for any path other than those of
+// routes (relative to apiBasePath)
+func notPath(routes ...string) mux.MatcherFunc {
+	return func(r *http.Request, _ *mux.RouteMatch) bool {
+		return !slices.Contains(routes, strings.TrimPrefix(r.URL.Path, apiBasePath))
+	}
+}
+
+// registerPreflightRoutes registers an OPTIONS route (handled by the CORS
+// middleware) for the path of each route of a router, so that a preflight
+// request for any route is answered with the methods allowed for it
+func registerPreflightRoutes(router *mux.Router) {
+	var paths []string
+	_ = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		// routes without methods (e.g. of a subrouter) are not routes of
+		// requests
+		if _, err := route.GetMethods(); err != nil {
+			return nil
+		}
+		if path, err := route.GetPathTemplate(); err == nil && !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+
+	for _, path := range paths {
+		router.HandleFunc(path, nil).Methods("OPTIONS") // handled by CORS middleware
+	}
+}
+
+// routeMethods are the methods for which routes may be registered, in the
+// order in which they are listed in an Allow header
+var routeMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// allowedMethods returns the methods for which the path of a request is
+// routed, in the order of routeMethods
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	var allowed []string
+	for _, method := range routeMethods {
+		var match mux.RouteMatch
+		rq := r.Clone(r.Context())
+		rq.Method = method
+		if router.Match(rq, &match) && match.MatchErr == nil {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// routeNotMatched returns a handler responding to requests that do not
+// match any route.  If the path is routed for other methods, the response is
+// 405 Method Not Allowed with an Allow header listing those methods;
+// otherwise the response is 404 Not Found.
+func (h *Handler) routeNotMatched(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := allowedMethods(router, r)
+		if len(allowed) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		h.writeErrorResponse(w, r, http.StatusMethodNotAllowed, models.CodeMethodNotAllowed, cMethodNotAllowed, fmt.Sprintf("%s is not supported; allowed methods are %s", r.Method, strings.Join(allowed, ", ")))
+	})
+}
+
+// defaultMaxPageSize is the maximum number of products in a page of a
+// product listing, if not configured (see WithMaxPageSize)
+const defaultMaxPageSize = 100
+
+// intFromQuery returns the value of an integer query parameter, or zero if
+// the parameter is not present.  An error is returned if the parameter is
+// present but is not an integer.
+func intFromQuery(r *http.Request, param string) (int, error) {
+	if !r.URL.Query().Has(param) {
+		return 0, nil
+	}
+	s := r.URL.Query().Get(param)
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value: %s", param, s)
+	}
+	return n, nil
+}
+
+// paginationLinks returns the links to the first, previous, next and last
+// pages of a listing.  The URL of each link is that of the request with the
+// page replaced, preserving any filters and sort order; a page_size in the
+// request is replaced by the page size of the listing.  An empty listing has
+// a single (first and last) page.
+func paginationLinks(r *http.Request, page, pageSize, totalPages int) models.PaginationLinks {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	query := r.URL.Query()
+	if query.Has("page_size") {
+		query.Set("page_size", strconv.Itoa(pageSize))
+	}
+
+	pageURL := func(page int) string {
+		query.Set("page", strconv.Itoa(page))
+		u := url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path, RawQuery: query.Encode()}
+		return u.String()
+	}
+
+	last := max(totalPages, 1)
+	links := models.PaginationLinks{
+		First: pageURL(1),
+		Last:  pageURL(last),
+	}
+	if page > 1 {
+		links.Prev = pageURL(min(page-1, last))
+	}
+	if page < last {
+		links.Next = pageURL(page + 1)
+	}
+	return links
+}
+
 // GetProducts handles GET /api/v1/products
+//
+// A page or page_size that is not an integer is a bad request.  Zero or
+// negative values are not rejected but, as for absent values, are replaced
+// by the default (page 1, or the default page size; see WithDefaultPageSize).
+// A page_size greater than the maximum page size is reduced to the maximum.
+//
+// If ids are specified, the products with those IDs are returned instead of
+// a page of products (see getProductsByIDs).
 func (h *Handler) GetProducts(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("ids") {
+		h.getProductsByIDs(w, r)
+		return
+	}
+
 	// Parse query parameters
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page, err := intFromQuery(r, "page")
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", err.Error())
+		return
+	}
 	if page < 1 {
 		page = 1
 	}
 
-	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 10
+	pageSize, err := intFromQuery(r, "page_size")
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", err.Error())
+		return
 	}
+	if pageSize < 1 {
+		pageSize = h.defaultPageSize
+	}
+	pageSize = min(pageSize, h.maxPageSize)
 
 	filters, err := h.productFiltersFromQuery(r)
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, "Invalid query string", err.Error())
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", err.Error())
+		return
+	}
+
+	order, err := h.productOrderFromQuery(r)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", err.Error())
+		return
+	}
+
+	fields, err := fieldsFromQuery(r)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", err.Error())
 		return
 	}
 
 	// Get products from database
-	products, total, err := h.db.GetProducts(page, pageSize, filters...)
+	products, total, err := h.db.GetProducts(r.Context(), page, pageSize, order, filters...)
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve products", err.Error())
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to retrieve products", err.Error())
 		return
 	}
 
@@ -108,240 +493,1195 @@ func (h *Handler) GetProducts(w http.ResponseWriter, r *http.Request) {
 		PageSize:   pageSize,
 		Total:      total,
 		TotalPages: totalPages,
+		Links:      paginationLinks(r, page, pageSize, totalPages),
+	}
+
+	if total == 0 && h.emptyResultHints {
+		response.AppliedFilters, response.Suggestions = emptyResultHints(r)
+	}
+
+	if fields != nil {
+		h.writeResponse(w, r, http.StatusOK, sparsePaginatedResponse{PaginatedResponse: response, Data: projectProducts(products, fields)})
+		return
+	}
+
+	h.writeResponse(w, r, http.StatusOK, response)
+}
+
+// getProductsByIDs handles GET /api/v1/products?ids=...
+//
+// Returns the products with the IDs in a comma-separated list, in the order
+// listed, together with the listed IDs that are not the ID of a product.  An
+// ID listed more than once is returned (or reported missing) once, at its
+// first position.  The list is limited to the maximum page size (of distinct
+// IDs) and cannot be combined with filters; any sort order or pagination is
+// ignored.
+func (h *Handler) getProductsByIDs(w http.ResponseWriter, r *http.Request) {
+	var ids []int
+	for _, s := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || id < 1 {
+			h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", fmt.Sprintf("invalid ids value: %q is not a product ID", s))
+			return
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > h.maxPageSize {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", fmt.Sprintf("too many ids: at most %d may be specified", h.maxPageSize))
+		return
+	}
+
+	filters, err := h.productFiltersFromQuery(r)
+	if err == nil && len(filters) > 0 {
+		err = errors.New("ids cannot be combined with filters")
+	}
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", err.Error())
+		return
+	}
+
+	fields, err := fieldsFromQuery(r)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", err.Error())
+		return
+	}
+
+	products, err := h.db.GetProductsByIDs(r.Context(), ids)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to retrieve products", err.Error())
+		return
+	}
+
+	response := models.ProductsByIDsResponse{Data: products, MissingIDs: []int{}}
+	for _, id := range ids {
+		if !slices.ContainsFunc(products, func(p models.Product) bool { return p.ID == id }) {
+			response.MissingIDs = append(response.MissingIDs, id)
+		}
+	}
+
+	if fields != nil {
+		h.writeResponse(w, r, http.StatusOK, sparseProductsByIDsResponse{ProductsByIDsResponse: response, Data: projectProducts(products, fields)})
+		return
+	}
+
+	h.writeResponse(w, r, http.StatusOK, response)
+}
+
+// CountProducts handles GET /api/v1/products/count
+//
+// Returns the number of products matching any filters.
+func (h *Handler) CountProducts(w http.ResponseWriter, r *http.Request) {
+	filters, err := h.productFiltersFromQuery(r)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", err.Error())
+		return
+	}
+
+	count, err := h.db.CountProducts(r.Context(), filters...)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to count products", err.Error())
+		return
+	}
+
+	h.writeResponse(w, r, http.StatusOK, models.CountResponse{Count: count})
+}
+
+// PriceStats handles GET /api/v1/products/stats
+//
+// Returns the number of products, and their minimum, maximum and average
+// price, in each category with products matching any filters.
+func (h *Handler) PriceStats(w http.ResponseWriter, r *http.Request) {
+	filters, err := h.productFiltersFromQuery(r)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", err.Error())
+		return
+	}
+
+	stats, err := h.db.PriceStats(r.Context(), filters...)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to compute price statistics", err.Error())
+		return
+	}
+
+	h.writeResponse(w, r, http.StatusOK, models.PriceStatsResponse{Categories: stats})
+}
+
+// GroupedProducts handles GET /api/v1/products/grouped
+//
+// Returns the products matching any filters grouped by category, each group
+// ordered by ID.  Categories are grouped case-insensitively, keyed by the
+// category of the first product in the group; products without a category
+// are grouped as models.UncategorizedGroup.
+func (h *Handler) GroupedProducts(w http.ResponseWriter, r *http.Request) {
+	filters, err := h.productFiltersFromQuery(r)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", err.Error())
+		return
+	}
+
+	products, err := h.db.ListProducts(r.Context(), filters...)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to retrieve products", err.Error())
+		return
+	}
+
+	h.writeResponse(w, r, http.StatusOK, groupByCategory(products))
+}
+
+// groupByCategory groups products by category (case-insensitively), in the
+// order of the products
+func groupByCategory(products []models.Product) models.GroupedProducts {
+	var (
+		groups = models.GroupedProducts{}
+		keys   = map[string]string{} // key of the group of each lowercase category
+	)
+	for _, product := range products {
+		category := strings.ToLower(product.Category)
+		key, ok := keys[category]
+		switch {
+		case ok:
+		case product.Category == "":
+			key = models.UncategorizedGroup
+		default:
+			key = product.Category
+		}
+		keys[category] = key
+		groups[key] = append(groups[key], product)
+	}
+	return groups
+}
+
+// GetRandomProducts handles GET /api/v1/products/random
+//
+// Returns a random sample (without replacement) of `count` products (default 1)
+// matching any filters.  If fewer products match than requested, all matching
+// products are returned.
+func (h *Handler) GetRandomProducts(w http.ResponseWriter, r *http.Request) {
+	count := 1
+	if r.URL.Query().Has("count") {
+		var err error
+		count, err = strconv.Atoi(r.URL.Query().Get("count"))
+		if err != nil || count < 1 {
+			h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", "count must be a positive integer")
+			return
+		}
+	}
+
+	filters, err := h.productFiltersFromQuery(r)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", err.Error())
+		return
+	}
+
+	products, err := h.db.ListProducts(r.Context(), filters...)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to retrieve products", err.Error())
+		return
+	}
+
+	// partial Fisher-Yates shuffle; the first count elements are the sample
+	count = min(count, len(products))
+	h.randMutex.Lock()
+	for i := range count {
+		j := i + h.rand.IntN(len(products)-i)
+		products[i], products[j] = products[j], products[i]
+	}
+	h.randMutex.Unlock()
+
+	h.writeResponse(w, r, http.StatusOK, models.ProductListResponse{Data: products[:count]})
+}
+
+// defaultLowStockThreshold is the threshold of a low stock report if no
+// threshold is specified
+const defaultLowStockThreshold = 10
+
+// LowStockProducts handles GET /api/v1/products/low-stock
+//
+// Returns the products matching any filters with a quantity at or below a
+// `threshold` (default 10), ordered by quantity (lowest first) and then by
+// ID.
+func (h *Handler) LowStockProducts(w http.ResponseWriter, r *http.Request) {
+	threshold := defaultLowStockThreshold
+	if r.URL.Query().Has("threshold") {
+		var err error
+		threshold, err = strconv.Atoi(r.URL.Query().Get("threshold"))
+		if err != nil || threshold < 0 {
+			h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", "threshold must be a non-negative integer")
+			return
+		}
+	}
+
+	filters, err := h.productFiltersFromQuery(r)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", err.Error())
+		return
+	}
+
+	products, err := h.db.ListProducts(r.Context(), append(filters, db.QuantityAtMost(threshold))...)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to retrieve products", err.Error())
+		return
+	}
+
+	slices.SortFunc(products, func(a, b models.Product) int {
+		return cmp.Or(cmp.Compare(a.Quantity, b.Quantity), cmp.Compare(a.ID, b.ID))
+	})
+
+	h.writeResponse(w, r, http.StatusOK, models.ProductListResponse{Data: products})
+}
+
+// ExportProducts handles GET /api/v1/products/export
+//
+// Streams all products matching any filters as newline-delimited JSON
+// (NDJSON), writing each product as it is read from the database rather than
+// buffering the complete result.
+func (h *Handler) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	h.streamProducts(w, r, true)
+}
+
+// StreamProducts handles GET /api/v1/products/stream
+//
+// Streams all products matching any filters as a JSON array or, if the
+// request prefers it (Accept: application/x-ndjson), as newline-delimited
+// JSON, writing each product as it is read from the database rather than
+// buffering the complete result.
+func (h *Handler) StreamProducts(w http.ResponseWriter, r *http.Request) {
+	h.streamProducts(w, r, prefersNDJSON(r))
+}
+
+// streamProducts writes the products matching the filters of a request as
+// they are read from the database, as newline-delimited JSON or as the
+// elements of a JSON array.  An error before the first product is written
+// is reported with a 500 Internal Server Error response; once the response
+// has started an error is logged and the response ends (leaving a JSON
+// array incomplete).
+func (h *Handler) streamProducts(w http.ResponseWriter, r *http.Request, ndjson bool) {
+	filters, err := h.productFiltersFromQuery(r)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", err.Error())
+		return
+	}
+
+	var (
+		rc      = http.NewResponseController(w)
+		enc     = json.NewEncoder(w)
+		written = 0
+	)
+
+	// start writes the response header and, for a JSON array, the start of
+	// the array
+	start := func() error {
+		if ndjson {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			return nil
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err := io.WriteString(w, "[")
+		return err
+	}
+
+	err = h.db.ScanProducts(r.Context(), func(product models.Product) error {
+		switch {
+		case written == 0:
+			if err := start(); err != nil {
+				return err
+			}
+		case !ndjson:
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		written++
+
+		if err := enc.Encode(product); err != nil {
+			return err
+		}
+		// flushing is best-effort; not all ResponseWriters support it
+		_ = rc.Flush()
+		return nil
+	}, filters...)
+	if err == nil && written == 0 {
+		err = start()
+	}
+	if err == nil && !ndjson {
+		_, err = io.WriteString(w, "]\n")
+	}
+
+	switch {
+	case err != nil && written == 0:
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to export products", err.Error())
+
+	case err != nil:
+		// the response has already started so the error cannot be reported
+		// to the client
+		h.logger.Error("export failed", "error", err, "written", written, "request_id", RequestIDFromContext(r.Context()))
+	}
+}
+
+// csvHeader is the header row of a CSV export, identifying the fields
+// written for each product by csvRecord
+var csvHeader = []string{"id", "sku", "name", "description", "price", "currency", "category", "in_stock", "quantity", "tags", "images", "created_at", "updated_at"}
+
+// csvRecord returns the fields of a product written to a CSV export; tags
+// are separated by semicolons and image URLs (which cannot contain spaces)
+// by spaces
+func csvRecord(product models.Product) []string {
+	return []string{
+		strconv.Itoa(product.ID),
+		product.SKU,
+		product.Name,
+		product.Description,
+		strconv.FormatFloat(product.Price, 'f', -1, 64),
+		product.Currency,
+		product.Category,
+		strconv.FormatBool(product.InStock),
+		strconv.Itoa(product.Quantity),
+		strings.Join(product.Tags, ";"),
+		strings.Join(product.Images, " "),
+		product.CreatedAt.UTC().Format(time.RFC3339Nano),
+		product.UpdatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+// ExportProductsCSV handles GET /api/v1/products.csv
+//
+// Streams all products matching any filters as CSV, with a header row,
+// writing each product as it is read from the database rather than buffering
+// the complete result.
+func (h *Handler) ExportProductsCSV(w http.ResponseWriter, r *http.Request) {
+	filters, err := h.productFiltersFromQuery(r)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", err.Error())
+		return
+	}
+
+	var (
+		rc      = http.NewResponseController(w)
+		cw      = csv.NewWriter(w)
+		started = false
+		written = 0
+	)
+
+	// the header row is written when the first product is read (or after
+	// the scan if there are none), so that an error before any product is
+	// read can still be reported to the client
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Type", "text/csv")
+		w.WriteHeader(http.StatusOK)
+		return cw.Write(csvHeader)
+	}
+
+	err = h.db.ScanProducts(r.Context(), func(product models.Product) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		written++
+
+		if err := cw.Write(csvRecord(product)); err != nil {
+			return err
+		}
+		cw.Flush()
+		// flushing is best-effort; not all ResponseWriters support it
+		_ = rc.Flush()
+		return cw.Error()
+	}, filters...)
+
+	switch {
+	case err != nil && !started:
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to export products", err.Error())
+		return
+
+	case !started:
+		err = start()
 	}
 
-	h.writeJSONResponse(w, http.StatusOK, response)
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	if err != nil {
+		// the response has already started so the error cannot be reported
+		// to the client
+		h.logger.Error("export failed", "error", err, "written", written, "request_id", RequestIDFromContext(r.Context()))
+	}
 }
 
-// GetProduct handles GET /api/v1/products/{id}
+// GetProduct handles GET and HEAD /api/v1/products/{id}
+//
+// A numeric {id} identifies a product by ID; any other value identifies a
+// product by SKU.  A product that has been deleted is 410 Gone, rather than
+// 404 Not Found.  The response to a HEAD request has the status and headers
+// of the response to a GET but no body.
 func (h *Handler) GetProduct(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.Atoi(vars["id"])
+	if r.Method == http.MethodHead {
+		w = bodylessResponseWriter{w}
+	}
+
+	fields, err := fieldsFromQuery(r)
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, cInvalidProductId, "")
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", err.Error())
 		return
 	}
 
-	product, err := h.db.GetProductByID(id)
+	var (
+		idOrSku = mux.Vars(r)["id"]
+		product *models.Product
+	)
+
+	if patNumeric.MatchString(idOrSku) {
+		var id int
+		if id, err = strconv.Atoi(idOrSku); err != nil {
+			h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidProductID, cInvalidProductId, "")
+			return
+		}
+		product, err = h.db.GetProductByID(r.Context(), id)
+	} else {
+		product, err = h.db.GetProductBySKU(r.Context(), idOrSku)
+	}
+
 	switch {
+	case errors.Is(err, db.ErrGone):
+		h.writeErrorResponse(w, r, http.StatusGone, models.CodeProductGone, cProductGone, "")
+		return
+
 	case errors.Is(err, db.ErrNotFound):
-		h.writeErrorResponse(w, http.StatusNotFound, cProductNotFound, "")
+		h.writeErrorResponse(w, r, http.StatusNotFound, models.CodeProductNotFound, cProductNotFound, "")
 		return
 
 	case err != nil:
-		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to retrieve product", err.Error())
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to retrieve product", err.Error())
+		return
+	}
+
+	if fields != nil {
+		h.writeResponse(w, r, http.StatusOK, productProjection{product: product, fields: fields})
 		return
 	}
 
-	h.writeJSONResponse(w, http.StatusOK, product)
+	h.writeResponse(w, r, http.StatusOK, product)
+}
+
+// bodylessResponseWriter wraps an http.ResponseWriter, discarding the body
+// of a response (e.g. to a HEAD request) while writing the status and
+// headers as for the corresponding GET request
+type bodylessResponseWriter struct {
+	http.ResponseWriter
+}
+
+// Write discards the body, reporting it as written
+func (w bodylessResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
 }
 
 // CreateProduct handles POST /api/v1/products
 func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	var req models.CreateProductRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, cInvalidJSON, err.Error())
+	if !h.requireContentType(w, r, "application/json") || !h.decodeCreateRequest(w, r, &req) {
 		return
 	}
+	req.TrimSpace()
 
 	// Validate request
-	if err := h.validator.Struct(&req); err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, cValidationFailed, err.Error())
+	if !h.validateRequest(w, r, &req) || !h.validateCategory(w, r, req.Category) {
 		return
 	}
 
 	// Create product
-	product, err := h.db.CreateProduct(req)
+	product, err := h.createProduct(r.Context(), req)
+	switch {
+	case errors.Is(err, db.ErrDuplicateSKU):
+		h.writeErrorResponse(w, r, http.StatusConflict, models.CodeDuplicateSKU, cDuplicateSKU, "")
+		return
+
+	case errors.Is(err, db.ErrDuplicateName):
+		h.writeErrorResponse(w, r, http.StatusConflict, models.CodeNameConflict, cDuplicateName, "")
+		return
+
+	case errors.Is(err, db.ErrTooManyCategories):
+		h.writeErrorResponse(w, r, http.StatusUnprocessableEntity, models.CodeTooManyCategories, cTooManyCategories, "")
+		return
+
+	case errors.Is(err, db.ErrCapacityExceeded):
+		h.writeErrorResponse(w, r, http.StatusInsufficientStorage, models.CodeCapacityExceeded, cCapacityExceeded, "")
+		return
+
+	case err != nil:
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to create product", err.Error())
+		return
+	}
+
+	if warning := h.capacityWarning(r); warning != "" {
+		w.Header().Set("X-Capacity-Warning", warning)
+	}
+
+	w.Header().Set("Location", productLocation(product.ID))
+	h.writeResponse(w, r, http.StatusCreated, product)
+}
+
+// createProduct creates a product, requiring that the name of the product is
+// unique if the Handler is configured with unique names (see
+// WithUniqueNames)
+func (h *Handler) createProduct(ctx context.Context, req models.CreateProductRequest) (*models.Product, error) {
+	if h.uniqueNames {
+		return h.db.CreateProductWithUniqueName(ctx, req)
+	}
+	return h.db.CreateProduct(ctx, req)
+}
+
+// cloneSuffix is appended to the name of a product to name its clone
+const cloneSuffix = " (copy)"
+
+// CloneProduct handles POST /api/v1/products/{id}/clone
+//
+// Creates a product with the fields of an existing product, other than the
+// SKU (which must be unique, so the clone has none), and with the name of the
+// existing product suffixed with " (copy)".  If necessary, the name of the
+// existing product is shortened so that the name of the clone is valid.
+func (h *Handler) CloneProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to create product", err.Error())
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidProductID, cInvalidProductId, "")
 		return
 	}
 
-	h.writeJSONResponse(w, http.StatusCreated, product)
+	source, err := h.db.GetProductByID(r.Context(), id)
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		h.writeErrorResponse(w, r, http.StatusNotFound, models.CodeProductNotFound, cProductNotFound, "")
+		return
+
+	case err != nil:
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to retrieve product", err.Error())
+		return
+	}
+
+	if !h.validateCategory(w, r, source.Category) {
+		return
+	}
+
+	name := []rune(source.Name)
+	if n := maxNameLength - utf8.RuneCountInString(cloneSuffix); len(name) > n {
+		name = name[:n]
+	}
+
+	product, err := h.createProduct(r.Context(), models.CreateProductRequest{
+		Name:        strings.TrimSpace(string(name)) + cloneSuffix,
+		Description: source.Description,
+		Price:       source.Price,
+		Currency:    source.Currency,
+		Category:    source.Category,
+		InStock:     source.InStock,
+		Quantity:    source.Quantity,
+		Tags:        slices.Clone(source.Tags),
+		Images:      slices.Clone(source.Images),
+	})
+	switch {
+	case errors.Is(err, db.ErrDuplicateName):
+		h.writeErrorResponse(w, r, http.StatusConflict, models.CodeNameConflict, cDuplicateName, "")
+		return
+
+	case errors.Is(err, db.ErrTooManyCategories):
+		h.writeErrorResponse(w, r, http.StatusUnprocessableEntity, models.CodeTooManyCategories, cTooManyCategories, "")
+		return
+
+	case errors.Is(err, db.ErrCapacityExceeded):
+		h.writeErrorResponse(w, r, http.StatusInsufficientStorage, models.CodeCapacityExceeded, cCapacityExceeded, "")
+		return
+
+	case err != nil:
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to create product", err.Error())
+		return
+	}
+
+	if warning := h.capacityWarning(r); warning != "" {
+		w.Header().Set("X-Capacity-Warning", warning)
+	}
+
+	w.Header().Set("Location", productLocation(product.ID))
+	h.writeResponse(w, r, http.StatusCreated, product)
 }
 
 // UpdateProduct handles PUT /api/v1/products/{id}
+//
+// Any tags supplied replace the existing tags of the product.
 func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	h.updateProduct(w, r, false)
+}
+
+// PatchProduct handles PATCH /api/v1/products/{id}
+//
+// Any tags supplied are merged with the existing tags of the product.  As for
+// a JSON Merge Patch (RFC 7396), a field that is null clears the field of the
+// product (null tags removes all tags), while absent fields are unchanged.
+// Required fields (name, price, currency, in_stock and quantity) cannot be
+// null.
+func (h *Handler) PatchProduct(w http.ResponseWriter, r *http.Request) {
+	h.updateProduct(w, r, true)
+}
+
+// updateProduct updates a product.  A patch merges tags in the request with
+// the existing tags of the product and clears fields that are null; otherwise
+// tags replace the existing tags and null fields are ignored.  The body of
+// a patch may be a JSON Merge Patch (application/merge-patch+json).
+func (h *Handler) updateProduct(w http.ResponseWriter, r *http.Request, patch bool) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, cInvalidProductId, "")
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidProductID, cInvalidProductId, "")
+		return
+	}
+
+	mediaTypes := []string{"application/json"}
+	if patch {
+		mediaTypes = append(mediaTypes, "application/merge-patch+json")
+	}
+	if !h.requireContentType(w, r, mediaTypes...) {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidJSON, cInvalidJSON, err.Error())
 		return
 	}
 
 	var req models.UpdateProductRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, cInvalidJSON, err.Error())
+	if err := json.Unmarshal(body, &req); err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidJSON, cInvalidJSON, err.Error())
 		return
 	}
+	req.TrimSpace()
+	req.MergeTags = patch
 
 	// Validate request
-	if err := h.validator.Struct(&req); err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, cValidationFailed, err.Error())
+	if !h.validateRequest(w, r, &req) {
+		return
+	}
+	if req.Category != nil && !h.validateCategory(w, r, *req.Category) {
 		return
 	}
 
+	if patch {
+		// null fields are cleared after validation since a cleared field is
+		// not necessarily valid (e.g. an empty SKU).  The body is known to be
+		// valid JSON, so the fields of an object are decoded successfully (and
+		// a non-object body has no null fields).
+		var fields map[string]json.RawMessage
+		_ = json.Unmarshal(body, &fields)
+
+		for _, field := range slices.Sorted(maps.Keys(fields)) {
+			if string(fields[field]) != "null" {
+				continue
+			}
+			if !req.SetNull(field) {
+				h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeValidationFailed, cValidationFailed, fmt.Sprintf("%s cannot be null", field))
+				return
+			}
+		}
+	}
+
 	// Update product
-	product, err := h.db.UpdateProduct(id, req)
+	product, err := h.db.UpdateProduct(r.Context(), id, req)
 	switch {
 	case errors.Is(err, db.ErrNotFound):
-		h.writeErrorResponse(w, http.StatusNotFound, cProductNotFound, "")
+		h.writeErrorResponse(w, r, http.StatusNotFound, models.CodeProductNotFound, cProductNotFound, "")
+		return
+
+	case errors.Is(err, db.ErrDuplicateSKU):
+		h.writeErrorResponse(w, r, http.StatusConflict, models.CodeDuplicateSKU, cDuplicateSKU, "")
+		return
+
+	case errors.Is(err, db.ErrTooManyCategories):
+		h.writeErrorResponse(w, r, http.StatusUnprocessableEntity, models.CodeTooManyCategories, cTooManyCategories, "")
 		return
 
 	case err != nil:
-		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to update product", err.Error())
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to update product", err.Error())
 		return
 	}
 
-	h.writeJSONResponse(w, http.StatusOK, product)
+	h.writeResponse(w, r, http.StatusOK, product)
+}
+
+// UpsertProduct handles PUT /api/v1/products/sku/{sku}
+//
+// Creates a product with the SKU (201 Created) or, if a product with the SKU
+// exists, replaces that product (200 OK).  A SKU in the request body must
+// match the SKU in the path.
+func (h *Handler) UpsertProduct(w http.ResponseWriter, r *http.Request) {
+	sku := mux.Vars(r)["sku"]
+
+	var req models.CreateProductRequest
+	if !h.requireContentType(w, r, "application/json") || !h.decodeCreateRequest(w, r, &req) {
+		return
+	}
+	req.TrimSpace()
+
+	if req.SKU != "" && req.SKU != sku {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeValidationFailed, cValidationFailed, fmt.Sprintf("sku %s does not match the sku in the path (%s)", req.SKU, sku))
+		return
+	}
+	req.SKU = sku
+
+	// Validate request
+	if !h.validateRequest(w, r, &req) || !h.validateCategory(w, r, req.Category) {
+		return
+	}
+
+	product, created, err := h.db.UpsertBySKU(r.Context(), sku, req)
+	switch {
+	case errors.Is(err, db.ErrTooManyCategories):
+		h.writeErrorResponse(w, r, http.StatusUnprocessableEntity, models.CodeTooManyCategories, cTooManyCategories, "")
+		return
+
+	case errors.Is(err, db.ErrCapacityExceeded):
+		h.writeErrorResponse(w, r, http.StatusInsufficientStorage, models.CodeCapacityExceeded, cCapacityExceeded, "")
+		return
+
+	case err != nil:
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to upsert product", err.Error())
+		return
+	}
+
+	if !created {
+		h.writeResponse(w, r, http.StatusOK, product)
+		return
+	}
+
+	if warning := h.capacityWarning(r); warning != "" {
+		w.Header().Set("X-Capacity-Warning", warning)
+	}
+
+	w.Header().Set("Location", productLocation(product.ID))
+	h.writeResponse(w, r, http.StatusCreated, product)
 }
 
 // DeleteProduct handles DELETE /api/v1/products/{id}
+//
+// With ?return=true the deleted product is returned (200 OK) rather than an
+// empty response (204 No Content).  The product is retrieved before it is
+// deleted; if it is deleted concurrently by some other request between the
+// two, the response is 404 Not Found, exactly as if the other request had
+// been handled first.
 func (h *Handler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		h.writeErrorResponse(w, http.StatusBadRequest, cInvalidProductId, "")
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidProductID, cInvalidProductId, "")
 		return
 	}
 
-	err = h.db.DeleteProduct(id)
+	var returnProduct bool
+	if r.URL.Query().Has("return") {
+		switch s := r.URL.Query().Get("return"); strings.ToLower(s) {
+		case "true":
+			returnProduct = true
+		case "false":
+		default:
+			h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", fmt.Sprintf("invalid return value: %s", s))
+			return
+		}
+	}
+
+	var product *models.Product
+	if returnProduct {
+		product, err = h.db.GetProductByID(r.Context(), id)
+	}
+	if err == nil {
+		err = h.db.DeleteProduct(r.Context(), id)
+	}
+
 	switch {
 	case errors.Is(err, db.ErrNotFound):
-		h.writeErrorResponse(w, http.StatusNotFound, cProductNotFound, "")
+		h.writeErrorResponse(w, r, http.StatusNotFound, models.CodeProductNotFound, cProductNotFound, "")
 		return
 
 	case err != nil:
-		h.writeErrorResponse(w, http.StatusInternalServerError, "Failed to delete product", err.Error())
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to delete product", err.Error())
 		return
 	}
 
+	if returnProduct {
+		h.writeResponse(w, r, http.StatusOK, product)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // HealthCheck handles GET /health
+//
+// The response includes the number of products and the time since the
+// Handler was created.  Failure to count the products is logged and the
+// count omitted; it does not fail the check.
 func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	response := map[string]string{
-		"status":  "healthy",
-		"service": "products-api",
+	response := models.HealthResponse{
+		Service:       "products-api",
+		Status:        "healthy",
+		UptimeSeconds: h.clock.Since(h.startTime).Seconds(),
 	}
-	h.writeJSONResponse(w, http.StatusOK, response)
+
+	if count, err := h.db.CountProducts(r.Context()); err != nil {
+		h.logger.Error("failed to count products", "error", err, "request_id", RequestIDFromContext(r.Context()))
+	} else {
+		response.ProductCount = &count
+	}
+
+	h.writeResponse(w, r, http.StatusOK, response)
+}
+
+// ReadinessCheck handles GET /ready
+//
+// Unlike the liveness check (/health), readiness exercises the database and
+// reports 503 Service Unavailable if the database cannot be queried.
+func (h *Handler) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
+	count, err := h.db.CountProducts(r.Context())
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusServiceUnavailable, models.CodeDatabaseUnavailable, "Database unavailable", err.Error())
+		return
+	}
+
+	response := models.HealthResponse{
+		Service:       "products-api",
+		Status:        "ready",
+		ProductCount:  &count,
+		UptimeSeconds: h.clock.Since(h.startTime).Seconds(),
+	}
+	h.writeResponse(w, r, http.StatusOK, response)
 }
 
 // Helper methods
 
-func (h *Handler) writeJSONResponse(w http.ResponseWriter, status int, data interface{}) {
+// writeResponse writes data with the specified status, as XML if preferred
+// by the Accept header of the request, otherwise as JSON.  Data that cannot
+// be marshalled to XML is written as JSON.  JSON is compact unless the request
+// asks for it to be indented (see prefersPrettyJSON).
+func (h *Handler) writeResponse(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	w.Header().Add("Vary", "Accept")
+
+	if prefersXML(r) {
+		body, err := xml.Marshal(data)
+		if err == nil {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(status)
+			_, _ = io.WriteString(w, xml.Header)
+			_, _ = w.Write(body)
+			return
+		}
+		h.logger.Error("failed to marshal XML response", "error", err, "request_id", RequestIDFromContext(r.Context()))
+	}
+
+	enc := json.NewEncoder(w)
+	if prefersPrettyJSON(r) {
+		enc.SetIndent("", "  ")
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(data)
+	_ = enc.Encode(data)
 }
 
-func (h *Handler) writeErrorResponse(w http.ResponseWriter, status int, message, details string) {
+// writeErrorResponse writes an ErrorResponse with the specified status, error
+// code (one of the models.Code... constants), error message and details.
+//
+// The response includes the ID of the request (if any).
+//
+// Server errors (5xx) are logged with their details; if the Handler is
+// configured to hide internal errors, the details are omitted from the
+// response to avoid leaking internal information to clients.  A server
+// error resulting from the request exceeding its deadline (see
+// WithRequestTimeout) is reported as 503 Service Unavailable.
+func (h *Handler) writeErrorResponse(w http.ResponseWriter, r *http.Request, status int, code, message, details string) {
+	requestID := RequestIDFromContext(r.Context())
+
+	if status >= http.StatusInternalServerError && errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		status = http.StatusServiceUnavailable
+		code = models.CodeRequestTimeout
+		message = cRequestTimeout
+	}
+
+	if status >= http.StatusInternalServerError {
+		h.logger.Error(message, "status", status, "details", details, "request_id", requestID)
+		if h.hideInternalErrors {
+			details = ""
+		}
+	}
+
 	response := models.ErrorResponse{
-		Error:   message,
-		Message: details,
+		Code:      code,
+		Error:     message,
+		Message:   details,
+		RequestID: requestID,
 	}
-	h.writeJSONResponse(w, status, response)
+	h.writeResponse(w, r, status, response)
 }
 
-// Middleware
+// requireContentType reports whether the body of a request has one of the
+// specified media types (see hasContentType), writing a 415 Unsupported Media
+// Type response if it does not
+func (h *Handler) requireContentType(w http.ResponseWriter, r *http.Request, mediaTypes ...string) bool {
+	if hasContentType(r, mediaTypes...) {
+		return true
+	}
 
-func (h *Handler) loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Printf("%s %s %s\n", r.Method, r.RequestURI, r.RemoteAddr)
-		next.ServeHTTP(w, r)
-	})
+	details := fmt.Sprintf("Content-Type must be %s", strings.Join(mediaTypes, " or "))
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		details += fmt.Sprintf(", not %s", contentType)
+	}
+	h.writeErrorResponse(w, r, http.StatusUnsupportedMediaType, models.CodeUnsupportedMedia, cUnsupportedMedia, details)
+	return false
 }
 
-func (h *Handler) corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+// filterSuggestions identifies the query parameters that apply filters to
+// a product listing, with a suggestion offered for each when a filtered
+// listing is empty
+var filterSuggestions = []struct {
+	param      string
+	suggestion string
+}{
+	{"in_stock", "try removing the in_stock filter"},
+	{"min_quantity", "try a lower min_quantity"},
+	{"has_description", "try removing the has_description filter"},
+	{"category", "try a different category"},
+	{"category!", "try excluding fewer categories"},
+	{"exclude_category", "try excluding fewer categories"},
+	{"tag", "try fewer or different tags"},
+	{"q", "try a shorter or different search term"},
+	{"name", "try a shorter or different name"},
+	{"price", "try a price range (price_min/price_max) rather than a price"},
+	{"price_min", "try widening the price range"},
+	{"price_max", "try widening the price range"},
+	{"created_after", "try widening the created_after/created_before window"},
+	{"created_before", "try widening the created_after/created_before window"},
+	{"updated_after", "try widening the updated_after/updated_before window"},
+	{"updated_before", "try widening the updated_after/updated_before window"},
+	{"modified_since", "try an earlier modified_since"},
+	{"new_within", "try a longer new_within"},
+}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+// emptyResultHints returns a summary of the filters applied by a request
+// and suggestions for widening them
+func emptyResultHints(r *http.Request) (map[string]string, []string) {
+	var (
+		applied     = map[string]string{}
+		suggestions []string
+	)
 
-		next.ServeHTTP(w, r)
-	})
-}
+	for _, filter := range filterSuggestions {
+		if !r.URL.Query().Has(filter.param) {
+			continue
+		}
+		applied[filter.param] = r.URL.Query().Get(filter.param)
 
-func (h *Handler) ratelimiterMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !h.rateLimiter.Allow(r) {
-			fmt.Printf("%s %s %s: rate limit exceeded\n", r.Method, r.RequestURI, r.RemoteAddr)
-			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
-			return
+		if !slices.Contains(suggestions, filter.suggestion) {
+			suggestions = append(suggestions, filter.suggestion)
 		}
-		next.ServeHTTP(w, r)
-	})
+	}
+
+	return applied, suggestions
 }
 
+// productFiltersFromQuery returns the filters specified by the query
+// parameters of a request (see productFilters)
 func (h *Handler) productFiltersFromQuery(r *http.Request) ([]db.ProductFilter, error) {
+	return h.productFilters(r.URL.Query())
+}
+
+// productFilters returns the filters specified by query parameters.  Products
+// must satisfy all of the filters unless match=any is specified, in which
+// case the filters are combined into a single filter satisfied by products
+// satisfying any of them.
+func (h *Handler) productFilters(query url.Values) ([]db.ProductFilter, error) {
 	var (
 		filters []db.ProductFilter
 		errs    []error
 	)
 
-	// in stock
-	if r.URL.Query().Has("in_stock") {
-		inStock := r.URL.Query().Get("in_stock")
+	// in stock (with a quantity greater than zero) and/or with a minimum
+	// quantity; a product that is not in stock cannot have a minimum quantity
+	// greater than zero
+	if query.Has("in_stock") {
+		inStock := query.Get("in_stock")
 		switch strings.ToLower(inStock) {
 		case "false":
-			filters = append(filters, func(product *models.Product) bool {
-				return !product.InStock
-			})
+			filters = append(filters, db.InStock(false))
 
 		case "true":
-			filters = append(filters, func(product *models.Product) bool {
-				return product.InStock
-			})
+			filters = append(filters, db.InStock(true))
 
 		default:
 			errs = append(errs, fmt.Errorf("invalid in_stock value: %s", inStock))
 		}
 	}
+	if s := query.Get("min_quantity"); s != "" {
+		minQuantity, err := strconv.Atoi(s)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("invalid min_quantity: %w", err))
+
+		case minQuantity < 0:
+			errs = append(errs, fmt.Errorf("invalid min_quantity: %d is negative", minQuantity))
+
+		case minQuantity > 0 && strings.EqualFold(query.Get("in_stock"), "false"):
+			errs = append(errs, fmt.Errorf("min_quantity %d contradicts in_stock=false", minQuantity))
+
+		default:
+			filters = append(filters, db.QuantityAtLeast(minQuantity))
+		}
+	}
+
+	// has a description (that is not empty or only whitespace)
+	if query.Has("has_description") {
+		hasDescription := query.Get("has_description")
+		switch strings.ToLower(hasDescription) {
+		case "false":
+			filters = append(filters, db.HasDescription(false))
+
+		case "true":
+			filters = append(filters, db.HasDescription(true))
+
+		default:
+			errs = append(errs, fmt.Errorf("invalid has_description value: %s", hasDescription))
+		}
+	}
 
 	// in a specified category
-	if category := r.URL.Query().Get("category"); category != "" {
-		filters = append(filters, func(product *models.Product) bool {
-			return strings.EqualFold(product.Category, category)
-		})
+	if category := query.Get("category"); category != "" {
+		filters = append(filters, db.ByCategory(category))
+	}
+
+	// in none of the excluded categories; category!=x is parsed as the
+	// parameter "category!" with the value x, so is an alternative to
+	// exclude_category=x
+	if excluded := slices.DeleteFunc(slices.Concat(query["category!"], query["exclude_category"]), func(category string) bool { return category == "" }); len(excluded) > 0 {
+		filters = append(filters, db.NotInCategories(excluded...))
+	}
+
+	// has all of the specified tags
+	if tags := slices.DeleteFunc(slices.Clone(query["tag"]), func(tag string) bool { return tag == "" }); len(tags) > 0 {
+		filters = append(filters, db.HasTags(tags...))
+	}
+
+	// name or description contains a search term
+	if q := query.Get("q"); q != "" {
+		filters = append(filters, searchFilter(q))
 	}
 
 	// name contains a substring
-	if name := r.URL.Query().Get("name"); name != "" {
-		name = strings.ToLower(name)
-		filters = append(filters, func(product *models.Product) bool {
-			return strings.Contains(strings.ToLower(product.Name), name)
-		})
+	if name := query.Get("name"); name != "" {
+		filters = append(filters, db.NameContains(name))
 	}
 
-	// >= minimum price
-	if priceMinStr := r.URL.Query().Get("price_min"); priceMinStr != "" {
-		priceMin, err := strconv.ParseFloat(priceMinStr, 64)
+	// a price, or >= minimum and/or <= maximum price; a price takes
+	// precedence over a range including it, but contradicts a range that does
+	// not
+	var prices [3]*float64 // price, price_min and price_max
+	for i, param := range []string{"price", "price_min", "price_max"} {
+		if s := query.Get(param); s != "" {
+			price, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %w", param, err))
+				continue
+			}
+			prices[i] = &price
+		}
+	}
+	switch price, priceMin, priceMax := prices[0], prices[1], prices[2]; {
+	case price != nil && priceMin != nil && *price < *priceMin-db.PriceEpsilon:
+		errs = append(errs, fmt.Errorf("price %g is less than price_min %g", *price, *priceMin))
+
+	case price != nil && priceMax != nil && *price > *priceMax+db.PriceEpsilon:
+		errs = append(errs, fmt.Errorf("price %g is greater than price_max %g", *price, *priceMax))
+
+	case price != nil:
+		filters = append(filters, db.PriceEquals(*price))
+
+	default:
+		if priceMin != nil {
+			filters = append(filters, db.PriceAtLeast(*priceMin))
+		}
+		if priceMax != nil {
+			filters = append(filters, db.PriceAtMost(*priceMax))
+		}
+	}
+
+	// created or updated after or before a time, or modified at or after a
+	// time (see also productOrderFromQuery)
+	for _, window := range []struct {
+		param  string
+		filter func(time.Time) db.ProductFilter
+	}{
+		{"created_after", db.CreatedAfter},
+		{"created_before", db.CreatedBefore},
+		{"updated_after", db.UpdatedAfter},
+		{"updated_before", db.UpdatedBefore},
+		{"modified_since", db.ModifiedSince},
+	} {
+		s := query.Get(window.param)
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, s)
 		if err != nil {
-			errs = append(errs, fmt.Errorf("invalid price_min: %w", err))
-		} else {
-			filters = append(filters, func(product *models.Product) bool {
-				return product.Price >= priceMin
-			})
+			errs = append(errs, fmt.Errorf("invalid %s: %w", window.param, err))
+			continue
 		}
+		filters = append(filters, window.filter(t))
 	}
 
-	// <= maximum price
-	if priceMaxStr := r.URL.Query().Get("price_max"); priceMaxStr != "" {
-		priceMax, err := strconv.ParseFloat(priceMaxStr, 64)
+	// created within a duration of the current time (see also
+	// productOrderFromQuery)
+	if s := query.Get("new_within"); s != "" {
+		d, err := parseNewWithin(s)
 		if err != nil {
-			errs = append(errs, fmt.Errorf("invalid price_max: %w", err))
+			errs = append(errs, fmt.Errorf("invalid new_within: %w", err))
 		} else {
-			filters = append(filters, func(product *models.Product) bool {
-				return product.Price <= priceMax
-			})
+			filters = append(filters, db.CreatedSince(h.clock.Now().Add(-d)))
 		}
 	}
 
+	// combination of filters
+	switch match := query.Get("match"); strings.ToLower(match) {
+	case "", "all":
+
+	case "any":
+		if len(filters) > 1 {
+			filters = []db.ProductFilter{db.AnyOf(filters...)}
+		}
+
+	default:
+		errs = append(errs, fmt.Errorf("invalid match value: %s", match))
+	}
+
 	return filters, errors.Join(errs...)
 }
+
+// parseNewWithin parses the duration of a new_within query parameter, a
+// positive number of days (e.g. "7d") or a Go duration (e.g. "36h")
+func parseNewWithin(s string) (time.Duration, error) {
+	var (
+		d   time.Duration
+		err error
+	)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * time.Day
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+
+	switch {
+	case err != nil:
+		return 0, fmt.Errorf("%s is not a number of days (e.g. 7d) or a duration (e.g. 36h)", s)
+	case d <= 0:
+		return 0, fmt.Errorf("%s is not a positive duration", s)
+	}
+	return d, nil
+}
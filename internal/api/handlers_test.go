@@ -3,10 +3,21 @@ package api_test
 import (
 	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"math/rand/v2"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
 	"strings"
 	"testing"
 
@@ -33,7 +44,7 @@ func newMockDB() *mockDB {
 	}
 }
 
-func (m *mockDB) GetProducts(page, pageSize int, filters ...db.ProductFilter) ([]models.Product, int, error) {
+func (m *mockDB) GetProducts(ctx context.Context, page, pageSize int, order db.ProductOrder, filters ...db.ProductFilter) ([]models.Product, int, error) {
 	if m.shouldFail {
 		return nil, 0, fmt.Errorf("mock database error")
 	}
@@ -52,21 +63,61 @@ productLoop:
 		products = append(products, *p)
 	}
 
-	total := len(products)
-	start := (page - 1) * pageSize
-	end := start + pageSize
+	products, total := db.Paginate(products, page, pageSize, order)
+	return products, total, nil
+}
+
+func (m *mockDB) ListProducts(ctx context.Context, filters ...db.ProductFilter) ([]models.Product, error) {
+	if m.shouldFail {
+		return nil, fmt.Errorf("mock database error")
+	}
+
+	products := make([]models.Product, 0, len(m.products))
+productLoop:
+	for _, p := range m.products {
+		for _, filter := range filters {
+			if !filter(p) {
+				continue productLoop
+			}
+		}
+		products = append(products, *p)
+	}
+
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].ID < products[j].ID
+	})
+
+	return products, nil
+}
 
-	if start >= total {
-		return []models.Product{}, total, nil
+func (m *mockDB) CountProducts(ctx context.Context, filters ...db.ProductFilter) (int, error) {
+	products, err := m.ListProducts(ctx, filters...)
+	return len(products), err
+}
+
+func (m *mockDB) PriceStats(ctx context.Context, filters ...db.ProductFilter) ([]models.CategoryStats, error) {
+	products, err := m.ListProducts(ctx, filters...)
+	if err != nil {
+		return nil, err
 	}
-	if end > total {
-		end = total
+	return db.CategoryPriceStats(products), nil
+}
+
+func (m *mockDB) ScanProducts(ctx context.Context, fn func(models.Product) error, filters ...db.ProductFilter) error {
+	products, err := m.ListProducts(ctx, filters...)
+	if err != nil {
+		return err
 	}
 
-	return products[start:end], total, nil
+	for _, product := range products {
+		if err := fn(product); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (m *mockDB) GetProductByID(id int) (*models.Product, error) {
+func (m *mockDB) GetProductByID(ctx context.Context, id int) (*models.Product, error) {
 	if m.shouldFail {
 		return nil, fmt.Errorf("mock database error")
 	}
@@ -80,18 +131,55 @@ func (m *mockDB) GetProductByID(id int) (*models.Product, error) {
 	return &productCopy, nil
 }
 
-func (m *mockDB) CreateProduct(req models.CreateProductRequest) (*models.Product, error) {
+func (m *mockDB) GetProductsByIDs(ctx context.Context, ids []int) ([]models.Product, error) {
+	if m.shouldFail {
+		return nil, fmt.Errorf("mock database error")
+	}
+
+	products := []models.Product{}
+	for _, id := range ids {
+		if product, exists := m.products[id]; exists {
+			products = append(products, *product)
+		}
+	}
+	return products, nil
+}
+
+func (m *mockDB) GetProductBySKU(ctx context.Context, sku string) (*models.Product, error) {
+	if m.shouldFail {
+		return nil, fmt.Errorf("mock database error")
+	}
+
+	for _, product := range m.products {
+		if product.SKU == sku {
+			productCopy := *product
+			return &productCopy, nil
+		}
+	}
+
+	return nil, db.ErrNotFound
+}
+
+func (m *mockDB) CreateProduct(ctx context.Context, req models.CreateProductRequest) (*models.Product, error) {
 	if m.shouldFail {
 		return nil, fmt.Errorf("mock database error")
 	}
 
 	product := &models.Product{
 		ID:          m.nextID,
+		SKU:         req.SKU,
 		Name:        req.Name,
 		Description: req.Description,
 		Price:       req.Price,
+		Currency:    req.Currency,
 		Category:    req.Category,
 		InStock:     req.InStock,
+		Quantity:    req.Quantity,
+		Tags:        slices.Clone(req.Tags),
+		Images:      slices.Clone(req.Images),
+	}
+	if product.Currency == "" {
+		product.Currency = models.DefaultCurrency
 	}
 
 	m.products[m.nextID] = product
@@ -101,7 +189,56 @@ func (m *mockDB) CreateProduct(req models.CreateProductRequest) (*models.Product
 	return &productCopy, nil
 }
 
-func (m *mockDB) UpdateProduct(id int, req models.UpdateProductRequest) (*models.Product, error) {
+func (m *mockDB) CreateProductWithUniqueName(ctx context.Context, req models.CreateProductRequest) (*models.Product, error) {
+	if m.shouldFail {
+		return nil, fmt.Errorf("mock database error")
+	}
+
+	for _, product := range m.products {
+		if strings.EqualFold(product.Name, req.Name) {
+			return nil, db.ErrDuplicateName
+		}
+	}
+	return m.CreateProduct(ctx, req)
+}
+
+func (m *mockDB) UpsertBySKU(ctx context.Context, sku string, req models.CreateProductRequest) (*models.Product, bool, error) {
+	if m.shouldFail {
+		return nil, false, fmt.Errorf("mock database error")
+	}
+
+	req.SKU = sku
+	for id, product := range m.products {
+		if product.SKU == sku {
+			replacement := &models.Product{
+				ID:          id,
+				SKU:         sku,
+				Name:        req.Name,
+				Description: req.Description,
+				Price:       req.Price,
+				Currency:    req.Currency,
+				Category:    req.Category,
+				InStock:     req.InStock,
+				Quantity:    req.Quantity,
+				Tags:        slices.Clone(req.Tags),
+				Images:      slices.Clone(req.Images),
+				CreatedAt:   product.CreatedAt,
+			}
+			if replacement.Currency == "" {
+				replacement.Currency = models.DefaultCurrency
+			}
+			m.products[id] = replacement
+
+			productCopy := *replacement
+			return &productCopy, false, nil
+		}
+	}
+
+	product, err := m.CreateProduct(ctx, req)
+	return product, err == nil, err
+}
+
+func (m *mockDB) UpdateProduct(ctx context.Context, id int, req models.UpdateProductRequest) (*models.Product, error) {
 	if m.shouldFail {
 		return nil, fmt.Errorf("mock database error")
 	}
@@ -111,6 +248,9 @@ func (m *mockDB) UpdateProduct(id int, req models.UpdateProductRequest) (*models
 		return nil, db.ErrNotFound
 	}
 
+	if req.SKU != nil {
+		product.SKU = *req.SKU
+	}
 	if req.Name != nil {
 		product.Name = *req.Name
 	}
@@ -120,18 +260,64 @@ func (m *mockDB) UpdateProduct(id int, req models.UpdateProductRequest) (*models
 	if req.Price != nil {
 		product.Price = *req.Price
 	}
+	if req.PriceMultiplier != nil {
+		product.Price *= *req.PriceMultiplier
+	}
+	if req.Currency != nil {
+		product.Currency = *req.Currency
+	}
 	if req.Category != nil {
 		product.Category = *req.Category
 	}
 	if req.InStock != nil {
 		product.InStock = *req.InStock
 	}
+	if req.Quantity != nil {
+		product.Quantity = *req.Quantity
+	}
+	if req.Tags != nil {
+		if req.MergeTags {
+			tags := slices.Clone(product.Tags)
+			for _, tag := range req.Tags {
+				if !slices.Contains(tags, tag) {
+					tags = append(tags, tag)
+				}
+			}
+			product.Tags = tags
+		} else {
+			product.Tags = slices.Clone(req.Tags)
+		}
+	}
+	if req.Images != nil {
+		product.Images = slices.Clone(req.Images)
+	}
 
 	productCopy := *product
 	return &productCopy, nil
 }
 
-func (m *mockDB) DeleteProduct(id int) error {
+func (m *mockDB) UpdateWhere(ctx context.Context, filters []db.ProductFilter, req models.UpdateProductRequest) (int, error) {
+	if m.shouldFail {
+		return 0, fmt.Errorf("mock database error")
+	}
+
+	updated := 0
+productLoop:
+	for id, product := range m.products {
+		for _, filter := range filters {
+			if !filter(product) {
+				continue productLoop
+			}
+		}
+		if _, err := m.UpdateProduct(ctx, id, req); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+func (m *mockDB) DeleteProduct(ctx context.Context, id int) error {
 	if m.shouldFail {
 		return fmt.Errorf("mock database error")
 	}
@@ -145,8 +331,68 @@ func (m *mockDB) DeleteProduct(id int) error {
 	return nil
 }
 
+func (m *mockDB) ExportAll(ctx context.Context) (models.Backup, error) {
+	if m.shouldFail {
+		return models.Backup{}, fmt.Errorf("mock database error")
+	}
+
+	backup := models.Backup{DeletedIDs: []int{}}
+	for _, id := range slices.Sorted(maps.Keys(m.products)) {
+		backup.Products = append(backup.Products, *m.products[id])
+	}
+	return backup, nil
+}
+
+func (m *mockDB) ImportAll(ctx context.Context, backup models.Backup, replace bool) error {
+	if m.shouldFail {
+		return fmt.Errorf("mock database error")
+	}
+
+	if replace {
+		clear(m.products)
+	}
+	for _, product := range backup.Products {
+		m.products[product.ID] = &product
+		m.nextID = max(m.nextID, product.ID+1)
+	}
+	return nil
+}
+
+func (m *mockDB) ReserveStock(ctx context.Context, id, quantity int, ttl time.Duration) (*models.Reservation, error) {
+	if m.shouldFail {
+		return nil, fmt.Errorf("mock database error")
+	}
+
+	product, exists := m.products[id]
+	switch {
+	case !exists:
+		return nil, db.ErrNotFound
+	case quantity > product.Quantity:
+		return nil, db.ErrInsufficientStock
+	}
+
+	product.Quantity -= quantity
+	return &models.Reservation{ID: 1, ProductID: id, Quantity: quantity, ExpiresAt: time.Now(ctx).Add(ttl)}, nil
+}
+
+func (m *mockDB) ProductHistory(ctx context.Context, id int) ([]models.ProductChange, error) {
+	if m.shouldFail {
+		return nil, fmt.Errorf("mock database error")
+	}
+
+	if _, exists := m.products[id]; !exists {
+		return nil, db.ErrNotFound
+	}
+	return []models.ProductChange{}, nil
+}
+
 func TestHealthCheck(t *testing.T) {
 	mockDB := newMockDB()
+	for _, name := range []string{"Product 1", "Product 2"} {
+		if _, err := mockDB.CreateProduct(context.Background(), models.CreateProductRequest{Name: name, Price: 1.0}); err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
+	}
 	handler := api.NewHandler(mockDB, nil)
 
 	req := httptest.NewRequest("GET", "/health", nil)
@@ -158,10 +404,19 @@ func TestHealthCheck(t *testing.T) {
 		t.Errorf("Expected status code %d, got %d", http.StatusOK, status)
 	}
 
-	expected := `{"service":"products-api","status":"healthy"}`
-	body := strings.TrimSpace(rr.Body.String())
-	if body != expected {
-		t.Errorf("Expected body %s, got %s", expected, body)
+	var response map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if response["service"] != "products-api" || response["status"] != "healthy" {
+		t.Errorf("Expected service products-api and status healthy, got %s", rr.Body.String())
+	}
+	if count, ok := response["product_count"].(float64); !ok || count != 2 {
+		t.Errorf("Expected product_count 2, got %v", response["product_count"])
+	}
+	if uptime, ok := response["uptime_seconds"].(float64); !ok || uptime < 0 {
+		t.Errorf("Expected non-negative uptime_seconds, got %v", response["uptime_seconds"])
 	}
 
 	contentType := rr.Header().Get("Content-Type")
@@ -170,19 +425,136 @@ func TestHealthCheck(t *testing.T) {
 	}
 }
 
+func TestHealthCheckUptime(t *testing.T) {
+	clock := time.NewMockClock()
+	handler := api.NewHandler(newMockDB(), nil, api.WithClock(clock))
+
+	// uptime returns the uptime_seconds reported by the health check
+	uptime := func(t *testing.T) any {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handler.HealthCheck(rr, httptest.NewRequest("GET", "/health", nil))
+
+		var response map[string]any
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		return response["uptime_seconds"]
+	}
+
+	if seconds := uptime(t); seconds != 0.0 {
+		t.Errorf("Expected uptime_seconds 0, got %v", seconds)
+	}
+
+	clock.AdvanceBy(90 * time.Second)
+	if seconds := uptime(t); seconds != 90.0 {
+		t.Errorf("Expected uptime_seconds 90, got %v", seconds)
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	handler := api.NewHandler(newMockDB(), nil)
+	router := handler.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/version", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	var response models.VersionResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	// the build metadata is not set when testing
+	if response.Version != "dev" || response.Commit != "dev" || response.BuildTime != "dev" {
+		t.Errorf("Expected version, commit and build_time dev, got %s", rr.Body.String())
+	}
+}
+
+func TestReadinessCheck(t *testing.T) {
+	mockDB := newMockDB()
+	handler := api.NewHandler(mockDB, nil)
+	router := handler.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/ready", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+
+	var response models.HealthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if response.Service != "products-api" || response.Status != "ready" {
+		t.Errorf("Expected service products-api and status ready, got %s", rr.Body.String())
+	}
+	if response.ProductCount == nil || *response.ProductCount != 0 {
+		t.Errorf("Expected product_count 0, got %s", rr.Body.String())
+	}
+}
+
+func TestReadinessCheckDatabaseError(t *testing.T) {
+	mockDB := newMockDB()
+	mockDB.shouldFail = true
+	handler := api.NewHandler(mockDB, nil)
+	router := handler.SetupRoutes()
+
+	// readiness should fail with the database
+	req := httptest.NewRequest("GET", "/ready", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, status)
+	}
+
+	var errorResponse models.ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &errorResponse); err != nil {
+		t.Fatalf("Failed to unmarshal error response: %v", err)
+	}
+
+	if errorResponse.Error != "Database unavailable" {
+		t.Errorf("Expected error message 'Database unavailable', got %s", errorResponse.Error)
+	}
+
+	// liveness is unaffected, but the product count is omitted
+	req = httptest.NewRequest("GET", "/health", nil)
+	rr = httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Expected status code %d, got %d", http.StatusOK, status)
+	}
+	if strings.Contains(rr.Body.String(), "product_count") {
+		t.Errorf("Expected no product_count, got %s", rr.Body.String())
+	}
+}
+
 func TestGetProducts(t *testing.T) {
 	mockDB := newMockDB()
 	handler := api.NewHandler(mockDB, nil)
 
 	// Add some test products
 	testProducts := []models.CreateProductRequest{
-		{Name: "Accessory 1", Price: 10.0, Category: "Accessory", InStock: true},
-		{Name: "Product 1", Price: 20.0, Category: "Product", InStock: false},
-		{Name: "Product 2", Price: 30.0, Category: "Product", InStock: true},
+		{Name: "Accessory 1", Price: 10.0, Category: "Accessory", InStock: true, Quantity: 1},
+		{Name: "Product 1", Description: "  ", Price: 20.0, Category: "Product", InStock: false},
+		{Name: "Product 2", Description: "The second product", Price: 30.0, Category: "Product", InStock: true, Quantity: 1},
 	}
 
 	for _, product := range testProducts {
-		if _, err := mockDB.CreateProduct(product); err != nil {
+		if _, err := mockDB.CreateProduct(context.Background(), product); err != nil {
 			t.Fatalf("Failed to create test product: %v", err)
 		}
 	}
@@ -264,6 +636,42 @@ func TestGetProducts(t *testing.T) {
 			expectedTotal:  0,
 			expectedSize:   0,
 		},
+		{
+			name:           "Filter by price",
+			queryParams:    "?price=20",
+			expectedStatus: http.StatusOK,
+			expectedTotal:  1,
+			expectedSize:   1,
+		},
+		{
+			name:           "Filter by price (near miss)",
+			queryParams:    "?price=20.01",
+			expectedStatus: http.StatusOK,
+			expectedTotal:  0,
+			expectedSize:   0,
+		},
+		{
+			name:           "Filter by price within price range",
+			queryParams:    "?price=20&price_min=10&price_max=20",
+			expectedStatus: http.StatusOK,
+			expectedTotal:  1,
+			expectedSize:   1,
+		},
+		{
+			name:           "Price less than price_min",
+			queryParams:    "?price=20&price_min=25",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Price greater than price_max",
+			queryParams:    "?price=20&price_max=15",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid price",
+			queryParams:    "?price=invalid",
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name:           "Filter by name and in_stock",
 			queryParams:    "?name=Product&in_stock=true",
@@ -278,6 +686,27 @@ func TestGetProducts(t *testing.T) {
 			expectedTotal:  0,
 			expectedSize:   0,
 		},
+		{
+			name:           "Filter by has_description",
+			queryParams:    "?has_description=true",
+			expectedStatus: http.StatusOK,
+			expectedTotal:  1,
+			expectedSize:   1,
+		},
+		{
+			name:           "Filter by not has_description (empty or whitespace)",
+			queryParams:    "?has_description=FALSE",
+			expectedStatus: http.StatusOK,
+			expectedTotal:  2,
+			expectedSize:   2,
+		},
+		{
+			name:           "Invalid has_description value",
+			queryParams:    "?has_description=maybe",
+			expectedStatus: http.StatusBadRequest,
+			expectedTotal:  0,
+			expectedSize:   0,
+		},
 		{
 			name:           "Invalid price_min",
 			queryParams:    "?price_min=invalid",
@@ -322,71 +751,2353 @@ func TestGetProducts(t *testing.T) {
 	}
 }
 
-func TestGetProductsError(t *testing.T) {
+func TestGetProductsLinks(t *testing.T) {
 	mockDB := newMockDB()
-	mockDB.shouldFail = true
-	handler := api.NewHandler(mockDB, nil)
-
-	req := httptest.NewRequest("GET", "/api/v1/products", nil)
-	rr := httptest.NewRecorder()
-
-	handler.GetProducts(rr, req)
-
-	if status := rr.Code; status != http.StatusInternalServerError {
-		t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, status)
-	}
-
-	var errorResponse models.ErrorResponse
-	err := json.Unmarshal(rr.Body.Bytes(), &errorResponse)
-	if err != nil {
-		t.Fatalf("Failed to unmarshal error response: %v", err)
-	}
-
-	if errorResponse.Error != "Failed to retrieve products" {
-		t.Errorf("Expected error message 'Failed to retrieve products', got %s", errorResponse.Error)
+	for i := range 25 {
+		if _, err := mockDB.CreateProduct(context.Background(), models.CreateProductRequest{Name: fmt.Sprintf("Product %d", i), Price: 1.0, InStock: true, Quantity: 1}); err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
 	}
-}
+	router := api.NewHandler(mockDB, nil).SetupRoutes()
+
+	const base = "http://example.com/api/v1/products?"
+	tests := []struct {
+		name        string
+		queryParams string
+		expected    models.PaginationLinks
+	}{
+		{
+			name:        "First page",
+			queryParams: "",
+			expected:    models.PaginationLinks{First: base + "page=1", Next: base + "page=2", Last: base + "page=3"},
+		},
+		{
+			name:        "Middle page",
+			queryParams: "?page=2",
+			expected:    models.PaginationLinks{First: base + "page=1", Prev: base + "page=1", Next: base + "page=3", Last: base + "page=3"},
+		},
+		{
+			name:        "Last page",
+			queryParams: "?page=3",
+			expected:    models.PaginationLinks{First: base + "page=1", Prev: base + "page=2", Last: base + "page=3"},
+		},
+		{
+			name:        "Beyond last page",
+			queryParams: "?page=5",
+			expected:    models.PaginationLinks{First: base + "page=1", Prev: base + "page=3", Last: base + "page=3"},
+		},
+		{
+			name:        "Filters and sort preserved",
+			queryParams: "?in_stock=true&sort=name:desc&page_size=20",
+			expected: models.PaginationLinks{
+				First: base + "in_stock=true&page=1&page_size=20&sort=name%3Adesc",
+				Next:  base + "in_stock=true&page=2&page_size=20&sort=name%3Adesc",
+				Last:  base + "in_stock=true&page=2&page_size=20&sort=name%3Adesc",
+			},
+		},
+		{
+			name:        "Page size reduced to maximum",
+			queryParams: "?page_size=500",
+			expected:    models.PaginationLinks{First: base + "page=1&page_size=100", Last: base + "page=1&page_size=100"},
+		},
+		{
+			name:        "No matching products",
+			queryParams: "?in_stock=false",
+			expected:    models.PaginationLinks{First: base + "in_stock=false&page=1", Last: base + "in_stock=false&page=1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products"+tt.queryParams, nil))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+			}
+
+			var response models.PaginatedResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Links != tt.expected {
+				t.Errorf("Expected links %+v, got %+v", tt.expected, response.Links)
+			}
+		})
+	}
+}
+
+func TestGetProductsPageSize(t *testing.T) {
+	mockDB := newMockDB()
+	for i := range 250 {
+		if _, err := mockDB.CreateProduct(context.Background(), models.CreateProductRequest{Name: fmt.Sprintf("Product %d", i), Price: 1.0}); err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		opts          []api.Option
+		queryParams   string
+		expectedSize  int
+		expectedError string
+	}{
+		{name: "Default", queryParams: "", expectedSize: 10},
+		{name: "Zero", queryParams: "?page_size=0", expectedSize: 10},
+		{name: "Maximum", queryParams: "?page_size=100", expectedSize: 100},
+		{name: "Beyond maximum", queryParams: "?page_size=150", expectedSize: 100},
+		{name: "Within configured maximum", opts: []api.Option{api.WithMaxPageSize(200)}, queryParams: "?page_size=150", expectedSize: 150},
+		{name: "Beyond configured maximum", opts: []api.Option{api.WithMaxPageSize(20)}, queryParams: "?page_size=150", expectedSize: 20},
+		{name: "Negative", queryParams: "?page_size=-5", expectedSize: 10},
+		{name: "Configured default", opts: []api.Option{api.WithDefaultPageSize(25)}, queryParams: "", expectedSize: 25},
+		{name: "Configured default replacing zero", opts: []api.Option{api.WithDefaultPageSize(25)}, queryParams: "?page_size=0", expectedSize: 25},
+		{name: "Configured default with page_size", opts: []api.Option{api.WithDefaultPageSize(25)}, queryParams: "?page_size=5", expectedSize: 5},
+		{name: "Configured default beyond maximum", opts: []api.Option{api.WithDefaultPageSize(25), api.WithMaxPageSize(20)}, queryParams: "", expectedSize: 20},
+		{name: "Invalid configured default", opts: []api.Option{api.WithDefaultPageSize(0)}, queryParams: "", expectedSize: 10},
+		{name: "Negative page", queryParams: "?page=-1&page_size=5", expectedSize: 5},
+		{name: "Non-numeric", queryParams: "?page_size=abc", expectedError: "invalid page_size value: abc"},
+		{name: "Non-numeric page", queryParams: "?page=abc", expectedError: "invalid page value: abc"},
+		{name: "Empty page", queryParams: "?page=", expectedError: "invalid page value: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := api.NewHandler(mockDB, nil, tt.opts...).SetupRoutes()
+
+			req := httptest.NewRequest("GET", "/api/v1/products"+tt.queryParams, nil)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if tt.expectedError != "" {
+				var response models.ErrorResponse
+				if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if rr.Code != http.StatusBadRequest || response.Message != tt.expectedError {
+					t.Errorf("Expected status code %d with message %q, got %d with %q", http.StatusBadRequest, tt.expectedError, rr.Code, response.Message)
+				}
+				return
+			}
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+			}
+
+			var response models.PaginatedResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if len(response.Data) != tt.expectedSize || response.PageSize != tt.expectedSize {
+				t.Errorf("Expected page of %d products, got %d (page_size %d)", tt.expectedSize, len(response.Data), response.PageSize)
+			}
+		})
+	}
+}
+
+func TestGetProductsModifiedSince(t *testing.T) {
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil).SetupRoutes()
+
+	// products 4 and then 2 are updated
+	var since string
+	for _, id := range []string{"4", "2"} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newJSONRequest("PATCH", "/api/v1/products/"+id, strings.NewReader(`{"in_stock":false}`)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Failed to update product %s: %d %s", id, rr.Code, rr.Body.String())
+		}
+
+		var product models.Product
+		if err := json.Unmarshal(rr.Body.Bytes(), &product); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if since == "" {
+			since = product.UpdatedAt.Format(time.RFC3339Nano)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		expectedStatus int
+		expectedIDs    []int
+	}{
+		{name: "Modified since first update (sorted by updated_at)", queryParams: "?modified_since=" + url.QueryEscape(since), expectedStatus: http.StatusOK, expectedIDs: []int{4, 2}},
+		{name: "With explicit sort", queryParams: "?sort=id&modified_since=" + url.QueryEscape(since), expectedStatus: http.StatusOK, expectedIDs: []int{2, 4}},
+		{name: "Combined with filters", queryParams: "?category=electronics&modified_since=" + url.QueryEscape(since), expectedStatus: http.StatusOK, expectedIDs: []int{2}},
+		{name: "Modified since a future time", queryParams: "?modified_since=2999-01-01T00:00:00Z", expectedStatus: http.StatusOK, expectedIDs: []int{}},
+		{name: "Invalid time", queryParams: "?modified_since=yesterday", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products"+tt.queryParams, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response models.PaginatedResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			ids := make([]int, len(response.Data))
+			for i, product := range response.Data {
+				ids[i] = product.ID
+			}
+			if !slices.Equal(ids, tt.expectedIDs) {
+				t.Errorf("Expected products %v, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+}
+
+func TestGetProductsMinQuantity(t *testing.T) {
+	// the sample products have quantities 15, 50, 0 (not in stock), 8 and 25;
+	// a sixth product is marked as in stock with a quantity of zero
+	database := db.NewInMemoryDB(db.WithSampleData())
+	if _, err := database.CreateProduct(context.Background(), models.CreateProductRequest{Name: "Backordered", Price: 1, InStock: true}); err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	router := api.NewHandler(database, nil).SetupRoutes()
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		expectedStatus int
+		expectedIDs    []int
+	}{
+		{name: "Minimum quantity (inclusive)", queryParams: "?min_quantity=15", expectedStatus: http.StatusOK, expectedIDs: []int{1, 2, 5}},
+		{name: "In stock has a quantity", queryParams: "?in_stock=true", expectedStatus: http.StatusOK, expectedIDs: []int{1, 2, 4, 5}},
+		{name: "Not in stock has no quantity", queryParams: "?in_stock=false", expectedStatus: http.StatusOK, expectedIDs: []int{3, 6}},
+		{name: "In stock with minimum quantity", queryParams: "?in_stock=true&min_quantity=20", expectedStatus: http.StatusOK, expectedIDs: []int{2, 5}},
+		{name: "Not in stock with zero minimum quantity", queryParams: "?in_stock=false&min_quantity=0", expectedStatus: http.StatusOK, expectedIDs: []int{3, 6}},
+		{name: "Not in stock with minimum quantity", queryParams: "?in_stock=false&min_quantity=1", expectedStatus: http.StatusBadRequest},
+		{name: "Negative minimum quantity", queryParams: "?min_quantity=-1", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid minimum quantity", queryParams: "?min_quantity=some", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products"+tt.queryParams, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response models.PaginatedResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			ids := make([]int, len(response.Data))
+			for i, product := range response.Data {
+				ids[i] = product.ID
+			}
+			if !slices.Equal(ids, tt.expectedIDs) {
+				t.Errorf("Expected products %v, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+}
+
+func TestGetProductsExcludeCategory(t *testing.T) {
+	// the sample products are in Electronics (1, 2 and 5), Office Supplies (3)
+	// and Furniture (4)
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil).SetupRoutes()
+
+	tests := []struct {
+		name        string
+		queryParams string
+		expectedIDs []int
+	}{
+		{name: "Not equal", queryParams: "?category!=Office%20Supplies", expectedIDs: []int{1, 2, 4, 5}},
+		{name: "Not equal (case-insensitive)", queryParams: "?category!=office+supplies", expectedIDs: []int{1, 2, 4, 5}},
+		{name: "Not equal (escaped)", queryParams: "?category%21=Office%20Supplies", expectedIDs: []int{1, 2, 4, 5}},
+		{name: "Exclude category", queryParams: "?exclude_category=Electronics", expectedIDs: []int{3, 4}},
+		{name: "Exclude several categories", queryParams: "?exclude_category=Electronics&category!=Furniture", expectedIDs: []int{3}},
+		{name: "Empty exclusion", queryParams: "?category!=&exclude_category=", expectedIDs: []int{1, 2, 3, 4, 5}},
+		{name: "With price filter", queryParams: "?category!=Office%20Supplies&price_max=200", expectedIDs: []int{2, 4}},
+		{name: "With category", queryParams: "?category=Electronics&category!=Electronics", expectedIDs: []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products"+tt.queryParams, nil))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+
+			var response models.PaginatedResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			ids := make([]int, len(response.Data))
+			for i, product := range response.Data {
+				ids[i] = product.ID
+			}
+			if !slices.Equal(ids, tt.expectedIDs) {
+				t.Errorf("Expected products %v, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+}
+
+func TestGetProductsNewWithin(t *testing.T) {
+	clock := time.NewMockClock()
+
+	// products created 10, 3, 7, 1 and 6 days ago
+	mockDB := newMockDB()
+	for id, days := range map[int]int{1: 10, 2: 3, 3: 7, 4: 1, 5: 6} {
+		mockDB.products[id] = &models.Product{ID: id, Name: fmt.Sprintf("Product %d", id), CreatedAt: clock.Now().Add(-time.Duration(days) * time.Day)}
+	}
+	router := api.NewHandler(mockDB, nil, api.WithClock(clock)).SetupRoutes()
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		expectedStatus int
+		expectedIDs    []int
+	}{
+		{name: "Within 7 days (newest first, inclusive)", queryParams: "?new_within=7d", expectedStatus: http.StatusOK, expectedIDs: []int{4, 2, 5, 3}},
+		{name: "Within a duration", queryParams: "?new_within=96h", expectedStatus: http.StatusOK, expectedIDs: []int{4, 2}},
+		{name: "With explicit sort", queryParams: "?new_within=7d&sort=id", expectedStatus: http.StatusOK, expectedIDs: []int{2, 3, 4, 5}},
+		{name: "Within less than a day", queryParams: "?new_within=12h", expectedStatus: http.StatusOK, expectedIDs: []int{}},
+		{name: "Invalid duration", queryParams: "?new_within=a-week", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid number of days", queryParams: "?new_within=xd", expectedStatus: http.StatusBadRequest},
+		{name: "Zero duration", queryParams: "?new_within=0d", expectedStatus: http.StatusBadRequest},
+		{name: "Negative duration", queryParams: "?new_within=-1h", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products"+tt.queryParams, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response models.PaginatedResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			ids := make([]int, len(response.Data))
+			for i, product := range response.Data {
+				ids[i] = product.ID
+			}
+			if !slices.Equal(ids, tt.expectedIDs) {
+				t.Errorf("Expected products %v, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+
+	t.Run("Relative to the clock", func(t *testing.T) {
+		clock.AdvanceBy(2 * time.Day)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products?new_within=7d", nil))
+
+		var response models.PaginatedResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+
+		ids := make([]int, len(response.Data))
+		for i, product := range response.Data {
+			ids[i] = product.ID
+		}
+		if expected := []int{4, 2}; !slices.Equal(ids, expected) {
+			t.Errorf("Expected products %v, got %v", expected, ids)
+		}
+	})
+}
+
+func TestGetProductsByIDs(t *testing.T) {
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil, api.WithMaxPageSize(4)).SetupRoutes()
+
+	tests := []struct {
+		name               string
+		query              string
+		expectedStatus     int
+		expectedIDs        string
+		expectedMissingIDs string
+	}{
+		{name: "In order requested", query: "?ids=3,1,5", expectedStatus: http.StatusOK, expectedIDs: "[3 1 5]", expectedMissingIDs: "[]"},
+		{name: "Present and absent", query: "?ids=2,99,4,100", expectedStatus: http.StatusOK, expectedIDs: "[2 4]", expectedMissingIDs: "[99 100]"},
+		{name: "Duplicates", query: "?ids=5,3,5,99,3,99", expectedStatus: http.StatusOK, expectedIDs: "[5 3]", expectedMissingIDs: "[99]"},
+		{name: "None present", query: "?ids=99", expectedStatus: http.StatusOK, expectedIDs: "[]", expectedMissingIDs: "[99]"},
+		{name: "Pagination ignored", query: "?ids=1,2,3&page=2&page_size=1&sort=price:desc", expectedStatus: http.StatusOK, expectedIDs: "[1 2 3]", expectedMissingIDs: "[]"},
+		{name: "Distinct IDs limited to max page size", query: "?ids=1,2,3,4,1", expectedStatus: http.StatusOK, expectedIDs: "[1 2 3 4]", expectedMissingIDs: "[]"},
+		{name: "Too many IDs", query: "?ids=1,2,3,4,5", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid ID", query: "?ids=1,two", expectedStatus: http.StatusBadRequest},
+		{name: "Empty", query: "?ids=", expectedStatus: http.StatusBadRequest},
+		{name: "Combined with filters", query: "?ids=1,2&in_stock=true", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products"+tt.query, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+
+			var response models.ProductsByIDsResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			ids := make([]int, 0, len(response.Data))
+			for _, p := range response.Data {
+				ids = append(ids, p.ID)
+			}
+			if fmt.Sprint(ids) != tt.expectedIDs {
+				t.Errorf("Expected products %s, got %v", tt.expectedIDs, ids)
+			}
+			if fmt.Sprint(response.MissingIDs) != tt.expectedMissingIDs {
+				t.Errorf("Expected missing IDs %s, got %v", tt.expectedMissingIDs, response.MissingIDs)
+			}
+		})
+	}
+
+	t.Run("Sparse fields", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products?ids=2,99&fields=name", nil))
+
+		if body := strings.TrimSpace(rr.Body.String()); body != `{"data":[{"name":"Wireless Mouse"}],"missing_ids":[99]}` {
+			t.Errorf("Expected only the names of the products, got %s", body)
+		}
+	})
+}
+
+func TestGetProductsByTag(t *testing.T) {
+	mockDB := newMockDB()
+	for _, product := range []models.CreateProductRequest{
+		{Name: "Product 1", Price: 1.0, Tags: []string{"sale"}},
+		{Name: "Product 2", Price: 1.0, Tags: []string{"Sale", "featured"}},
+		{Name: "Product 3", Price: 1.0, Tags: []string{"featured"}},
+		{Name: "Product 4", Price: 1.0},
+	} {
+		if _, err := mockDB.CreateProduct(context.Background(), product); err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
+	}
+	router := api.NewHandler(mockDB, nil).SetupRoutes()
+
+	tests := []struct {
+		name        string
+		queryParams string
+		expectedIDs []int
+	}{
+		{name: "Single tag", queryParams: "?tag=sale", expectedIDs: []int{1, 2}},
+		{name: "Single tag (case-insensitive)", queryParams: "?tag=FEATURED", expectedIDs: []int{2, 3}},
+		{name: "All of several tags", queryParams: "?tag=sale&tag=featured", expectedIDs: []int{2}},
+		{name: "No products with all tags", queryParams: "?tag=sale&tag=clearance", expectedIDs: []int{}},
+		{name: "Empty tag", queryParams: "?tag=", expectedIDs: []int{1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/products"+tt.queryParams, nil)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+			}
+
+			var response models.PaginatedResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			ids := []int{}
+			for _, product := range response.Data {
+				ids = append(ids, product.ID)
+			}
+			if !slices.Equal(ids, tt.expectedIDs) {
+				t.Errorf("Expected products %v, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+}
+
+func TestGetProductsMatch(t *testing.T) {
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil).SetupRoutes()
+
+	// sample products: 1 Laptop (Electronics, 1299.99), 2 Wireless Mouse (Electronics,
+	// 29.99), 3 Coffee Mug (Office Supplies, 12.50), 4 Desk Chair (Furniture,
+	// 199.99), 5 Smartphone (Electronics, 899.99)
+	tests := []struct {
+		name           string
+		queryParams    string
+		expectedStatus int
+		expectedIDs    []int
+	}{
+		{name: "All (default)", queryParams: "?category=electronics&price_max=30", expectedStatus: http.StatusOK, expectedIDs: []int{2}},
+		{name: "All", queryParams: "?category=electronics&price_max=30&match=all", expectedStatus: http.StatusOK, expectedIDs: []int{2}},
+		{name: "Any", queryParams: "?category=electronics&price_max=30&match=any", expectedStatus: http.StatusOK, expectedIDs: []int{1, 2, 3, 5}},
+		{name: "Any (single filter)", queryParams: "?category=furniture&match=ANY", expectedStatus: http.StatusOK, expectedIDs: []int{4}},
+		{name: "Any (no filters)", queryParams: "?match=any", expectedStatus: http.StatusOK, expectedIDs: []int{1, 2, 3, 4, 5}},
+		{name: "Invalid", queryParams: "?category=furniture&match=some", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products"+tt.queryParams, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response models.PaginatedResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			ids := []int{}
+			for _, product := range response.Data {
+				ids = append(ids, product.ID)
+			}
+			if !slices.Equal(ids, tt.expectedIDs) {
+				t.Errorf("Expected products %v, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+}
+
+func TestGetProductsTimeWindow(t *testing.T) {
+	mockDB := newMockDB()
+	month := func(m int) time.Time {
+		t.Helper()
+		tm, err := time.Parse(time.RFC3339, fmt.Sprintf("2025-%02d-01T00:00:00Z", m))
+		if err != nil {
+			t.Fatalf("Failed to parse time: %v", err)
+		}
+		return tm
+	}
+
+	// products are created in January, March and May and each is updated a
+	// month after it is created
+	for i, m := range []int{1, 3, 5} {
+		product, err := mockDB.CreateProduct(context.Background(), models.CreateProductRequest{Name: fmt.Sprintf("Product %d", i+1), Price: 1.0})
+		if err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
+		mockDB.products[product.ID].CreatedAt = month(m)
+		mockDB.products[product.ID].UpdatedAt = month(m + 1)
+	}
+	router := api.NewHandler(mockDB, nil).SetupRoutes()
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		expectedStatus int
+		expectedIDs    []int
+	}{
+		{name: "Created after", queryParams: "?created_after=2025-02-01T00:00:00Z", expectedStatus: http.StatusOK, expectedIDs: []int{2, 3}},
+		{name: "Created before", queryParams: "?created_before=2025-03-01T00:00:00Z", expectedStatus: http.StatusOK, expectedIDs: []int{1}},
+		{name: "Created within window", queryParams: "?created_after=2025-02-01T00:00:00Z&created_before=2025-04-01T00:00:00Z", expectedStatus: http.StatusOK, expectedIDs: []int{2}},
+		{name: "Updated within window", queryParams: "?updated_after=2025-03-01T00:00:00Z&updated_before=2025-06-01T00:00:01Z", expectedStatus: http.StatusOK, expectedIDs: []int{2, 3}},
+		{name: "Created and updated windows", queryParams: "?created_before=2025-04-01T00:00:00Z&updated_after=2025-03-01T00:00:00Z", expectedStatus: http.StatusOK, expectedIDs: []int{2}},
+		{name: "Empty window", queryParams: "?created_after=2025-06-01T00:00:00Z&created_before=2025-01-01T00:00:00Z", expectedStatus: http.StatusOK, expectedIDs: []int{}},
+		{name: "Time zone offset", queryParams: "?created_after=" + url.QueryEscape("2025-03-01T00:00:00+01:00"), expectedStatus: http.StatusOK, expectedIDs: []int{2, 3}},
+		{name: "Invalid time", queryParams: "?updated_before=2025-01-01", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/products"+tt.queryParams, nil)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				if !strings.Contains(rr.Body.String(), "invalid updated_before") {
+					t.Errorf("Expected error naming the invalid parameter, got %s", rr.Body.String())
+				}
+				return
+			}
+
+			var response models.PaginatedResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			ids := []int{}
+			for _, product := range response.Data {
+				ids = append(ids, product.ID)
+			}
+			if !slices.Equal(ids, tt.expectedIDs) {
+				t.Errorf("Expected products %v, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+}
+
+func TestGetProductsSorted(t *testing.T) {
+	mockDB := newMockDB()
+	handler := api.NewHandler(mockDB, nil)
+
+	testProducts := []models.CreateProductRequest{
+		{Name: "Reading Light", Description: "A bright lamp for reading", Price: 30.0, Category: "Lighting"},
+		{Name: "Lamp Shade", Description: "A shade", Price: 10.0, Category: "Lighting"},
+		{Name: "Desk", Description: "A desk with a built-in desklamp", Price: 200.0, Category: "Furniture"},
+		{Name: "Lamp", Description: "A lamp", Price: 20.0, Category: "Lighting"},
+		{Name: "Chair", Description: "A chair", Price: 50.0, Category: "Furniture"},
+	}
+	for _, product := range testProducts {
+		if _, err := mockDB.CreateProduct(context.Background(), product); err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		expectedStatus int
+		expectedIDs    []int
+	}{
+		{name: "Search by relevance", queryParams: "?q=lamp", expectedStatus: http.StatusOK, expectedIDs: []int{4, 2, 1, 3}},
+		{name: "Search with explicit relevance", queryParams: "?q=LAMP&sort=relevance", expectedStatus: http.StatusOK, expectedIDs: []int{4, 2, 1, 3}},
+		{name: "Search with ascending relevance", queryParams: "?q=lamp&sort=relevance:asc", expectedStatus: http.StatusOK, expectedIDs: []int{3, 1, 2, 4}},
+		{name: "Search with explicit sort", queryParams: "?q=lamp&sort=id", expectedStatus: http.StatusOK, expectedIDs: []int{1, 2, 3, 4}},
+		{name: "Sort by price", queryParams: "?sort=price", expectedStatus: http.StatusOK, expectedIDs: []int{2, 4, 1, 5, 3}},
+		{name: "Sort by price descending", queryParams: "?sort=price:desc", expectedStatus: http.StatusOK, expectedIDs: []int{3, 5, 1, 4, 2}},
+		{name: "Sort by multiple fields", queryParams: "?sort=category:desc,name", expectedStatus: http.StatusOK, expectedIDs: []int{4, 2, 1, 5, 3}},
+		{name: "Relevance without search", queryParams: "?sort=relevance", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid sort field", queryParams: "?sort=colour", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid sort direction", queryParams: "?sort=price:up", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/products"+tt.queryParams, nil)
+			rr := httptest.NewRecorder()
+
+			handler.GetProducts(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d", tt.expectedStatus, status)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response models.PaginatedResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			ids := make([]int, len(response.Data))
+			for i, product := range response.Data {
+				ids[i] = product.ID
+			}
+			if !slices.Equal(ids, tt.expectedIDs) {
+				t.Errorf("Expected products %v, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+}
+
+func TestGetProductsDefaultSort(t *testing.T) {
+	database := db.NewInMemoryDB(db.WithSampleData())
+
+	tests := []struct {
+		name        string
+		defaultSort string
+		queryParams string
+		expectedIDs []int
+	}{
+		{name: "Default sort", defaultSort: "price:desc", expectedIDs: []int{1, 5, 4, 2, 3}},
+		{name: "Explicit sort", defaultSort: "price:desc", queryParams: "?sort=id", expectedIDs: []int{1, 2, 3, 4, 5}},
+		{name: "Search", defaultSort: "price:desc", queryParams: "?q=laptop", expectedIDs: []int{1}},
+		{name: "Relevance default ignored", defaultSort: "relevance", expectedIDs: []int{1, 2, 3, 4, 5}},
+		{name: "Invalid default ignored", defaultSort: "colour", expectedIDs: []int{1, 2, 3, 4, 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := api.NewHandler(database, nil, api.WithDefaultSort(tt.defaultSort))
+			req := httptest.NewRequest("GET", "/api/v1/products"+tt.queryParams, nil)
+			rr := httptest.NewRecorder()
+
+			handler.GetProducts(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, status)
+			}
+
+			var response models.PaginatedResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			ids := make([]int, len(response.Data))
+			for i, product := range response.Data {
+				ids[i] = product.ID
+			}
+			if !slices.Equal(ids, tt.expectedIDs) {
+				t.Errorf("Expected products %v, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+
+	t.Run("ValidateSort", func(t *testing.T) {
+		if err := api.ValidateSort("category,price:desc"); err != nil {
+			t.Errorf("Expected a valid sort, got %v", err)
+		}
+		for _, spec := range []string{"relevance", "colour", "price:up"} {
+			if err := api.ValidateSort(spec); err == nil {
+				t.Errorf("Expected %q to be invalid", spec)
+			}
+		}
+	})
+}
+
+func TestGetProductsEmptyResultHints(t *testing.T) {
+	mockDB := newMockDB()
+	if _, err := mockDB.CreateProduct(context.Background(), models.CreateProductRequest{Name: "Product", Price: 10.0, Category: "Test"}); err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+
+	// get returns the raw response to a request for products from a handler
+	// configured with the specified options
+	get := func(t *testing.T, query string, opts ...api.Option) map[string]any {
+		t.Helper()
+
+		handler := api.NewHandler(mockDB, nil, opts...)
+		req := httptest.NewRequest("GET", "/api/v1/products"+query, nil)
+		rr := httptest.NewRecorder()
+
+		handler.GetProducts(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var response map[string]any
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		return response
+	}
+
+	const emptyQuery = "?category=Other&price_min=100&price_max=200"
+
+	t.Run("Default is plain empty response", func(t *testing.T) {
+		response := get(t, emptyQuery)
+
+		for _, key := range []string{"applied_filters", "suggestions"} {
+			if _, ok := response[key]; ok {
+				t.Errorf("Expected no %s in response, got %v", key, response[key])
+			}
+		}
+	})
+
+	t.Run("Hints for empty response", func(t *testing.T) {
+		response := get(t, emptyQuery, api.WithEmptyResultHints())
+
+		applied := fmt.Sprint(response["applied_filters"])
+		if expected := "map[category:Other price_max:200 price_min:100]"; applied != expected {
+			t.Errorf("Expected applied_filters %s, got %s", expected, applied)
+		}
+
+		suggestions := fmt.Sprint(response["suggestions"])
+		if expected := "[try a different category try widening the price range]"; suggestions != expected {
+			t.Errorf("Expected suggestions %s, got %s", expected, suggestions)
+		}
+	})
+
+	t.Run("No hints for non-empty response", func(t *testing.T) {
+		response := get(t, "?category=Test", api.WithEmptyResultHints())
+
+		if _, ok := response["suggestions"]; ok {
+			t.Errorf("Expected no suggestions in response, got %v", response["suggestions"])
+		}
+	})
+}
+
+func TestGetProductsError(t *testing.T) {
+	mockDB := newMockDB()
+	mockDB.shouldFail = true
+	handler := api.NewHandler(mockDB, nil)
+
+	req := httptest.NewRequest("GET", "/api/v1/products", nil)
+	rr := httptest.NewRecorder()
+
+	handler.GetProducts(rr, req)
+
+	if status := rr.Code; status != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, status)
+	}
+
+	var errorResponse models.ErrorResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &errorResponse)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal error response: %v", err)
+	}
+
+	if errorResponse.Error != "Failed to retrieve products" {
+		t.Errorf("Expected error message 'Failed to retrieve products', got %s", errorResponse.Error)
+	}
+}
+
+func TestCountProducts(t *testing.T) {
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil).SetupRoutes()
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		expectedStatus int
+	}{
+		{name: "All products", queryParams: "", expectedStatus: http.StatusOK},
+		{name: "Filtered", queryParams: "?category=electronics&price_max=1000", expectedStatus: http.StatusOK},
+		{name: "No matching products", queryParams: "?category=none", expectedStatus: http.StatusOK},
+		{name: "Invalid filter", queryParams: "?in_stock=maybe", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/count"+tt.queryParams, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var count models.CountResponse
+			if err := json.NewDecoder(rr.Body).Decode(&count); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			// the count matches the total of a listing with the same filters
+			rr = httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products"+tt.queryParams, nil))
+
+			var listing models.PaginatedResponse
+			if err := json.NewDecoder(rr.Body).Decode(&listing); err != nil {
+				t.Fatalf("Failed to decode listing: %v", err)
+			}
+			if count.Count != listing.Total {
+				t.Errorf("Expected count %d (the listing total), got %d", listing.Total, count.Count)
+			}
+		})
+	}
+
+	t.Run("Database error", func(t *testing.T) {
+		mockDB := newMockDB()
+		mockDB.shouldFail = true
+		rr := httptest.NewRecorder()
+
+		api.NewHandler(mockDB, nil).SetupRoutes().ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/count", nil))
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+	})
+}
+
+func TestPriceStats(t *testing.T) {
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil).SetupRoutes()
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		expectedStatus int
+		expected       []models.CategoryStats
+	}{
+		{
+			name:           "All products",
+			expectedStatus: http.StatusOK,
+			expected: []models.CategoryStats{
+				{Category: "Electronics", Count: 3, MinPrice: 29.99, MaxPrice: 1299.99, AvgPrice: (1299.99 + 29.99 + 899.99) / 3},
+				{Category: "Furniture", Count: 1, MinPrice: 199.99, MaxPrice: 199.99, AvgPrice: 199.99},
+				{Category: "Office Supplies", Count: 1, MinPrice: 12.50, MaxPrice: 12.50, AvgPrice: 12.50},
+			},
+		},
+		{
+			name:           "Filtered",
+			queryParams:    "?in_stock=true&price_max=1000",
+			expectedStatus: http.StatusOK,
+			expected: []models.CategoryStats{
+				{Category: "Electronics", Count: 2, MinPrice: 29.99, MaxPrice: 899.99, AvgPrice: (29.99 + 899.99) / 2},
+				{Category: "Furniture", Count: 1, MinPrice: 199.99, MaxPrice: 199.99, AvgPrice: 199.99},
+			},
+		},
+		{name: "No matching products", queryParams: "?category=none", expectedStatus: http.StatusOK, expected: []models.CategoryStats{}},
+		{name: "Invalid filter", queryParams: "?in_stock=maybe", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/stats"+tt.queryParams, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response models.PriceStatsResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(response.Categories) != len(tt.expected) {
+				t.Fatalf("Expected %d categories, got %d: %+v", len(tt.expected), len(response.Categories), response.Categories)
+			}
+			for i, expected := range tt.expected {
+				got := response.Categories[i]
+				if got.Category != expected.Category || got.Count != expected.Count || got.MinPrice != expected.MinPrice || got.MaxPrice != expected.MaxPrice {
+					t.Errorf("Expected %+v, got %+v", expected, got)
+				}
+				if math.Abs(got.AvgPrice-expected.AvgPrice) > 1e-9 {
+					t.Errorf("Expected %s avg_price %f, got %f", expected.Category, expected.AvgPrice, got.AvgPrice)
+				}
+			}
+		})
+	}
+
+	t.Run("Database error", func(t *testing.T) {
+		mockDB := newMockDB()
+		mockDB.shouldFail = true
+		rr := httptest.NewRecorder()
+
+		api.NewHandler(mockDB, nil).SetupRoutes().ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/stats", nil))
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+	})
+}
+
+func TestGroupedProducts(t *testing.T) {
+	// the sample products, with an electronics product (6) in a category
+	// differing only by case and a product without a category (7)
+	database := db.NewInMemoryDB(db.WithSampleData())
+	for _, req := range []models.CreateProductRequest{
+		{Name: "Keyboard", Price: 49.99, Category: "electronics", InStock: true, Quantity: 5},
+		{Name: "Gift Card", Price: 25},
+	} {
+		if _, err := database.CreateProduct(context.Background(), req); err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
+	}
+	router := api.NewHandler(database, nil).SetupRoutes()
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		expectedStatus int
+		expectedIDs    map[string][]int
+	}{
+		{
+			name:           "All products",
+			expectedStatus: http.StatusOK,
+			expectedIDs:    map[string][]int{"Electronics": {1, 2, 5, 6}, "Furniture": {4}, "Office Supplies": {3}, models.UncategorizedGroup: {7}},
+		},
+		{
+			name:           "Filtered",
+			queryParams:    "?in_stock=true&price_max=200",
+			expectedStatus: http.StatusOK,
+			expectedIDs:    map[string][]int{"Electronics": {2, 6}, "Furniture": {4}},
+		},
+		{
+			name:           "Filtered by category",
+			queryParams:    "?category=ELECTRONICS",
+			expectedStatus: http.StatusOK,
+			expectedIDs:    map[string][]int{"Electronics": {1, 2, 5, 6}},
+		},
+		{name: "No matching products", queryParams: "?category=none", expectedStatus: http.StatusOK, expectedIDs: map[string][]int{}},
+		{name: "Invalid filter", queryParams: "?in_stock=maybe", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/grouped"+tt.queryParams, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response models.GroupedProducts
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			ids := map[string][]int{}
+			for category, products := range response {
+				for _, product := range products {
+					ids[category] = append(ids[category], product.ID)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.expectedIDs) {
+				t.Errorf("Expected groups %v, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+
+	t.Run("XML", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/v1/products/grouped?category=furniture", nil)
+		req.Header.Set("Accept", "application/xml")
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if body := rr.Body.String(); !strings.Contains(body, `<groups><group category="Furniture"><product><id>4</id>`) {
+			t.Errorf("Expected the products grouped by category as XML, got %s", body)
+		}
+	})
+}
+
+func TestGetRandomProducts(t *testing.T) {
+	mockDB := newMockDB()
+	for i := 1; i <= 10; i++ {
+		req := models.CreateProductRequest{
+			Name:     fmt.Sprintf("Product %d", i),
+			Price:    float64(i),
+			InStock:  i%2 == 0,
+			Quantity: 1,
+		}
+		if _, err := mockDB.CreateProduct(context.Background(), req); err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
+	}
+
+	// sample returns the IDs of the products sampled by a handler with a
+	// fixed seed for the specified query
+	sample := func(t *testing.T, query string) ([]int, int) {
+		t.Helper()
+
+		handler := api.NewHandler(mockDB, nil, api.WithRandSource(rand.NewPCG(1, 2)))
+		router := handler.SetupRoutes()
+
+		req := httptest.NewRequest("GET", "/api/v1/products/random"+query, nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			return nil, rr.Code
+		}
+
+		var response models.ProductListResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+
+		ids := make([]int, 0, len(response.Data))
+		for _, p := range response.Data {
+			ids = append(ids, p.ID)
+		}
+		return ids, rr.Code
+	}
+
+	t.Run("Deterministic sample", func(t *testing.T) {
+		first, _ := sample(t, "?count=5")
+		second, _ := sample(t, "?count=5")
+
+		if len(first) != 5 {
+			t.Fatalf("Expected 5 products, got %d", len(first))
+		}
+		if fmt.Sprint(first) != fmt.Sprint(second) {
+			t.Errorf("Expected identical samples with the same seed, got %v and %v", first, second)
+		}
+
+		seen := map[int]bool{}
+		for _, id := range first {
+			if seen[id] {
+				t.Errorf("Expected sampling without replacement, got duplicate ID %d in %v", id, first)
+			}
+			seen[id] = true
+		}
+	})
+
+	t.Run("Default count", func(t *testing.T) {
+		ids, _ := sample(t, "")
+		if len(ids) != 1 {
+			t.Errorf("Expected 1 product, got %d", len(ids))
+		}
+	})
+
+	t.Run("Count larger than catalog", func(t *testing.T) {
+		ids, _ := sample(t, "?count=50")
+		sort.Ints(ids)
+		if expected := "[1 2 3 4 5 6 7 8 9 10]"; fmt.Sprint(ids) != expected {
+			t.Errorf("Expected all products %s, got %v", expected, ids)
+		}
+	})
+
+	t.Run("Filters applied", func(t *testing.T) {
+		ids, _ := sample(t, "?count=50&in_stock=true")
+		sort.Ints(ids)
+		if expected := "[2 4 6 8 10]"; fmt.Sprint(ids) != expected {
+			t.Errorf("Expected in-stock products %s, got %v", expected, ids)
+		}
+	})
+
+	t.Run("Invalid count", func(t *testing.T) {
+		for _, query := range []string{"?count=0", "?count=abc", "?in_stock=maybe"} {
+			if _, status := sample(t, query); status != http.StatusBadRequest {
+				t.Errorf("%s: expected status code %d, got %d", query, http.StatusBadRequest, status)
+			}
+		}
+	})
+}
+
+func TestLowStockProducts(t *testing.T) {
+	// sample quantities: Laptop 15, Wireless Mouse 50, Coffee Mug 0, Desk
+	// Chair 8, Smartphone 25
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil).SetupRoutes()
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedIDs    string
+	}{
+		{name: "Default threshold", query: "", expectedStatus: http.StatusOK, expectedIDs: "[3 4]"},
+		{name: "Threshold is inclusive", query: "?threshold=8", expectedStatus: http.StatusOK, expectedIDs: "[3 4]"},
+		{name: "Below a quantity", query: "?threshold=7", expectedStatus: http.StatusOK, expectedIDs: "[3]"},
+		{name: "Zero threshold", query: "?threshold=0", expectedStatus: http.StatusOK, expectedIDs: "[3]"},
+		{name: "Ordered by quantity", query: "?threshold=25", expectedStatus: http.StatusOK, expectedIDs: "[3 4 1 5]"},
+		{name: "Filters applied", query: "?threshold=25&category=electronics", expectedStatus: http.StatusOK, expectedIDs: "[1 5]"},
+		{name: "Negative threshold", query: "?threshold=-1", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid threshold", query: "?threshold=low", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid filter", query: "?in_stock=maybe", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/low-stock"+tt.query, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+
+			var response models.ProductListResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			ids := make([]int, 0, len(response.Data))
+			for _, p := range response.Data {
+				ids = append(ids, p.ID)
+			}
+			if fmt.Sprint(ids) != tt.expectedIDs {
+				t.Errorf("Expected products %s, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+}
+
+func TestExportProducts(t *testing.T) {
+	mockDB := newMockDB()
+	for i := 1; i <= 10; i++ {
+		req := models.CreateProductRequest{Name: fmt.Sprintf("Product %d", i), Price: float64(i), InStock: i%2 == 0, Quantity: 1}
+		if _, err := mockDB.CreateProduct(context.Background(), req); err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
+	}
+	handler := api.NewHandler(mockDB, nil)
+	router := handler.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/api/v1/products/export?in_stock=true", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("Expected Content-Type application/x-ndjson, got %s", contentType)
+	}
+
+	var ids []int
+	dec := json.NewDecoder(rr.Body)
+	for dec.More() {
+		var product models.Product
+		if err := dec.Decode(&product); err != nil {
+			t.Fatalf("Failed to decode product: %v", err)
+		}
+		ids = append(ids, product.ID)
+	}
+
+	if expected := "[2 4 6 8 10]"; fmt.Sprint(ids) != expected {
+		t.Errorf("Expected exported products %s, got %v", expected, ids)
+	}
+
+	// errors before streaming starts are reported
+	mockDB.shouldFail = true
+	rr = httptest.NewRecorder()
+
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/export", nil))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+}
+
+func TestStreamProducts(t *testing.T) {
+	mockDB := newMockDB()
+	for i := 1; i <= 100; i++ {
+		req := models.CreateProductRequest{Name: fmt.Sprintf("Product %d", i), Price: float64(i), InStock: i%4 == 0, Quantity: 1}
+		if _, err := mockDB.CreateProduct(context.Background(), req); err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
+	}
+	router := api.NewHandler(mockDB, nil).SetupRoutes()
+
+	// stream returns the response to a request for the stream of products
+	// with a query and Accept header
+	stream := func(t *testing.T, query, accept, expectedContentType string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/api/v1/products/stream"+query, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if contentType := rr.Header().Get("Content-Type"); contentType != expectedContentType {
+			t.Errorf("Expected Content-Type %s, got %s", expectedContentType, contentType)
+		}
+		return rr
+	}
+
+	t.Run("NDJSON", func(t *testing.T) {
+		rr := stream(t, "", "application/x-ndjson", "application/x-ndjson")
+		body := rr.Body.String()
+
+		records := 0
+		dec := json.NewDecoder(strings.NewReader(body))
+		for dec.More() {
+			var product models.Product
+			if err := dec.Decode(&product); err != nil {
+				t.Fatalf("Failed to decode product: %v", err)
+			}
+			records++
+		}
+		if records != 100 {
+			t.Errorf("Expected 100 records, got %d", records)
+		}
+		if lines := strings.Count(body, "\n"); lines != 100 {
+			t.Errorf("Expected 100 lines, got %d", lines)
+		}
+	})
+
+	t.Run("NDJSON filtered", func(t *testing.T) {
+		rr := stream(t, "?in_stock=true", "application/x-ndjson", "application/x-ndjson")
+
+		if records := strings.Count(rr.Body.String(), "\n"); records != 25 {
+			t.Errorf("Expected 25 records, got %d", records)
+		}
+	})
+
+	t.Run("JSON array", func(t *testing.T) {
+		rr := stream(t, "", "", "application/json")
+
+		var products []models.Product
+		if err := json.Unmarshal(rr.Body.Bytes(), &products); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if len(products) != 100 {
+			t.Errorf("Expected 100 products, got %d", len(products))
+		}
+	})
+
+	t.Run("JSON preferred to NDJSON", func(t *testing.T) {
+		stream(t, "", "application/x-ndjson;q=0.5, application/json", "application/json")
+	})
+
+	t.Run("Empty JSON array", func(t *testing.T) {
+		rr := stream(t, "?name=missing", "", "application/json")
+
+		if body := strings.TrimSpace(rr.Body.String()); body != "[]" {
+			t.Errorf("Expected an empty array, got %s", body)
+		}
+	})
+
+	t.Run("Invalid query string", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/stream?in_stock=maybe", nil))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestExportProductsCSV(t *testing.T) {
+	mockDB := newMockDB()
+	testProducts := []models.CreateProductRequest{
+		{Name: "Plain", Price: 1.5, InStock: true, Quantity: 1},
+		{Name: "Comma, Separated", Description: `Say "hello"`, Price: 2.0, InStock: true, Quantity: 1, Tags: []string{"a", "b"}, Images: []string{"https://example.com/a.png", "https://example.com/b.png"}},
+		{Name: "Multi\nLine", Price: 3.0, InStock: true, Quantity: 1},
+		{Name: "Out of stock", Price: 4.0},
+	}
+	for _, product := range testProducts {
+		if _, err := mockDB.CreateProduct(context.Background(), product); err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
+	}
+	handler := api.NewHandler(mockDB, nil)
+	router := handler.SetupRoutes()
+
+	req := httptest.NewRequest("GET", "/api/v1/products.csv?in_stock=true", nil)
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "text/csv" {
+		t.Errorf("Expected Content-Type text/csv, got %s", contentType)
+	}
+
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+
+	if len(records) != 4 {
+		t.Fatalf("Expected 4 records (header and 3 products), got %d", len(records))
+	}
+	if expected := "[id sku name description price currency category in_stock quantity tags images created_at updated_at]"; fmt.Sprint(records[0]) != expected {
+		t.Errorf("Expected header %s, got %v", expected, records[0])
+	}
+
+	// fields containing separators, quotes and newlines survive the round-trip
+	row := records[2]
+	if row[0] != "2" || row[2] != "Comma, Separated" || row[3] != `Say "hello"` || row[4] != "2" || row[5] != "USD" || row[9] != "a;b" || row[10] != "https://example.com/a.png https://example.com/b.png" {
+		t.Errorf("Unexpected record for product 2: %q", row)
+	}
+	if row := records[3]; row[2] != "Multi\nLine" {
+		t.Errorf("Expected name %q, got %q", "Multi\nLine", row[2])
+	}
+
+	t.Run("No matching products", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products.csv?category=none", nil))
+
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("Failed to parse CSV: %v", err)
+		}
+		if rr.Code != http.StatusOK || len(records) != 1 {
+			t.Errorf("Expected status code %d with only a header row, got %d with %d records", http.StatusOK, rr.Code, len(records))
+		}
+	})
+
+	t.Run("Database error", func(t *testing.T) {
+		mockDB.shouldFail = true
+		defer func() { mockDB.shouldFail = false }()
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products.csv", nil))
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+	})
+}
+
+func TestHideInternalErrors(t *testing.T) {
+	mockDB := newMockDB()
+	mockDB.shouldFail = true
+
+	tests := []struct {
+		name            string
+		opts            []api.Option
+		expectedMessage string
+	}{
+		{name: "Details shown by default", expectedMessage: "mock database error"},
+		{name: "Details hidden", opts: []api.Option{api.WithHideInternalErrors()}, expectedMessage: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			opts := append(tt.opts, api.WithLogger(slog.New(slog.NewJSONHandler(buf, nil))))
+			handler := api.NewHandler(mockDB, nil, opts...)
+
+			req := httptest.NewRequest("GET", "/api/v1/products", nil)
+			rr := httptest.NewRecorder()
+
+			handler.GetProducts(rr, req)
+
+			if status := rr.Code; status != http.StatusInternalServerError {
+				t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, status)
+			}
+
+			var errorResponse models.ErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &errorResponse); err != nil {
+				t.Fatalf("Failed to unmarshal error response: %v", err)
+			}
+
+			if errorResponse.Error != "Failed to retrieve products" {
+				t.Errorf("Expected error 'Failed to retrieve products', got %s", errorResponse.Error)
+			}
+			if errorResponse.Message != tt.expectedMessage {
+				t.Errorf("Expected message %q, got %q", tt.expectedMessage, errorResponse.Message)
+			}
+
+			// the details are always logged
+			if !strings.Contains(buf.String(), "mock database error") {
+				t.Errorf("Expected error details to be logged, got: %s", buf.String())
+			}
+		})
+	}
+
+	// client error details are not hidden
+	handler := api.NewHandler(newMockDB(), nil, api.WithHideInternalErrors())
+	req := httptest.NewRequest("GET", "/api/v1/products?price_min=invalid", nil)
+	rr := httptest.NewRecorder()
+
+	handler.GetProducts(rr, req)
+
+	var errorResponse models.ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &errorResponse); err != nil {
+		t.Fatalf("Failed to unmarshal error response: %v", err)
+	}
+	if errorResponse.Message == "" {
+		t.Error("Expected details of a client error to be provided")
+	}
+}
+
+func TestGetProductTimestampsInUTC(t *testing.T) {
+	// a product with timestamps in a zone other than UTC, as the times of a
+	// server in that zone would be
+	created, _ := time.Parse(time.RFC3339, "2025-07-12T10:00:00+12:00")
+	mockDB := newMockDB()
+	mockDB.products[1] = &models.Product{ID: 1, Name: "Zoned Product", CreatedAt: created, UpdatedAt: created.Add(time.Hour)}
+	router := api.NewHandler(mockDB, nil).SetupRoutes()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/1", nil))
+
+	var response map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	for field, expected := range map[string]string{"created_at": "2025-07-11T22:00:00Z", "updated_at": "2025-07-11T23:00:00Z"} {
+		if response[field] != expected {
+			t.Errorf("Expected %s %q, got %v", field, expected, response[field])
+		}
+	}
+}
 
 func TestGetProduct(t *testing.T) {
 	mockDB := newMockDB()
 	handler := api.NewHandler(mockDB, nil)
 
-	// Add a test product
-	req := models.CreateProductRequest{
-		Name:        "Test Product",
-		Description: "A test product",
-		Price:       99.99,
-		Category:    "Test",
+	// Add a test product
+	req := models.CreateProductRequest{
+		SKU:         "TST-001",
+		Name:        "Test Product",
+		Description: "A test product",
+		Price:       99.99,
+		Category:    "Test",
+		InStock:     true,
+	}
+	product, _ := mockDB.CreateProduct(context.Background(), req)
+
+	tests := []struct {
+		name           string
+		productID      string
+		dbShouldFail   bool
+		expectedStatus int
+		expectedName   string
+	}{
+		{
+			name:           "Valid product ID",
+			productID:      "1",
+			expectedStatus: http.StatusOK,
+			expectedName:   "Test Product",
+		},
+		{
+			name:           "Invalid product ID",
+			productID:      "9999999999999999999", // exceeds int range
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Non-existent product",
+			productID:      "999",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Valid product SKU",
+			productID:      "TST-001",
+			expectedStatus: http.StatusOK,
+			expectedName:   "Test Product",
+		},
+		{
+			name:           "Non-existent product SKU",
+			productID:      "TST-999",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Database error",
+			productID:      "1",
+			dbShouldFail:   true,
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "Database error by SKU",
+			productID:      "TST-001",
+			dbShouldFail:   true,
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB.shouldFail = tt.dbShouldFail
+
+			req := httptest.NewRequest("GET", "/api/v1/products/"+tt.productID, nil)
+			rr := httptest.NewRecorder()
+
+			// Set up router to parse URL parameters
+			router := mux.NewRouter()
+			router.HandleFunc("/api/v1/products/{id:[0-9A-Za-z-]+}", handler.GetProduct).Methods("GET")
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tt.expectedStatus, status)
+			}
+
+			if tt.expectedStatus == http.StatusOK {
+				var response models.Product
+				err := json.Unmarshal(rr.Body.Bytes(), &response)
+				if err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+
+				if response.Name != tt.expectedName {
+					t.Errorf("Expected product name %s, got %s", tt.expectedName, response.Name)
+				}
+
+				if response.ID != product.ID {
+					t.Errorf("Expected product ID %d, got %d", product.ID, response.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestGetDeletedProduct(t *testing.T) {
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil).SetupRoutes()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/api/v1/products/3", nil))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d deleting product, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		id             string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "Live", method: "GET", id: "1", expectedStatus: http.StatusOK},
+		{name: "Deleted", method: "GET", id: "3", expectedStatus: http.StatusGone, expectedCode: models.CodeProductGone},
+		{name: "Never existed", method: "GET", id: "999", expectedStatus: http.StatusNotFound, expectedCode: models.CodeProductNotFound},
+		{name: "Deleted (HEAD)", method: "HEAD", id: "3", expectedStatus: http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(tt.method, "/api/v1/products/"+tt.id, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tt.expectedStatus, rr.Code)
+			}
+
+			if tt.expectedCode != "" {
+				var response models.ErrorResponse
+				if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if response.Code != tt.expectedCode {
+					t.Errorf("Expected code %s, got %s", tt.expectedCode, response.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestHeadProduct(t *testing.T) {
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil).SetupRoutes()
+
+	tests := []struct {
+		name           string
+		idOrSku        string
+		expectedStatus int
+	}{
+		{name: "Existing ID", idOrSku: "1", expectedStatus: http.StatusOK},
+		{name: "Existing SKU", idOrSku: "LAP-001", expectedStatus: http.StatusOK},
+		{name: "Missing ID", idOrSku: "999", expectedStatus: http.StatusNotFound},
+		{name: "Missing SKU", idOrSku: "NONE-001", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("HEAD", "/api/v1/products/"+tt.idOrSku, nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Body.Len() != 0 {
+				t.Errorf("Expected empty body, got %q", rr.Body.String())
+			}
+
+			// headers are as for a GET
+			get := httptest.NewRecorder()
+			router.ServeHTTP(get, httptest.NewRequest("GET", "/api/v1/products/"+tt.idOrSku, nil))
+
+			if head, get := rr.Header().Get("Content-Type"), get.Header().Get("Content-Type"); head != get {
+				t.Errorf("Expected Content-Type %q, got %q", get, head)
+			}
+		})
+	}
+}
+
+func TestCreateProduct(t *testing.T) {
+	mockDB := newMockDB()
+	handler := api.NewHandler(mockDB, nil)
+
+	tests := []struct {
+		name           string
+		requestBody    interface{}
+		expectedStatus int
+		expectedName   string
+	}{
+		{
+			name: "Valid product",
+			requestBody: models.CreateProductRequest{
+				Name:        "New Product",
+				Description: "A new product",
+				Price:       49.99,
+				Category:    "Electronics",
+				InStock:     true,
+			},
+			expectedStatus: http.StatusCreated,
+			expectedName:   "New Product",
+		},
+		{
+			name: "Missing required fields",
+			requestBody: models.CreateProductRequest{
+				Description: "Missing name and price",
+				Category:    "Electronics",
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Invalid price",
+			requestBody: models.CreateProductRequest{
+				Name:     "Invalid Price Product",
+				Price:    -10.0,
+				Category: "Electronics",
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Invalid SKU",
+			requestBody: models.CreateProductRequest{
+				SKU:   "NOT A SKU",
+				Name:  "Invalid SKU Product",
+				Price: 10.0,
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Numeric SKU",
+			requestBody: models.CreateProductRequest{
+				SKU:   "12345",
+				Name:  "Numeric SKU Product",
+				Price: 10.0,
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid JSON",
+			requestBody:    "invalid json",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			var err error
+
+			if str, ok := tt.requestBody.(string); ok {
+				body = []byte(str)
+			} else {
+				body, err = json.Marshal(tt.requestBody)
+				if err != nil {
+					t.Fatalf("Failed to marshal request body: %v", err)
+				}
+			}
+
+			req := newJSONRequest("POST", "/api/v1/products", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			handler.CreateProduct(rr, req)
+
+			if status := rr.Code; status != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tt.expectedStatus, status)
+			}
+
+			if tt.expectedStatus == http.StatusCreated {
+				var response models.Product
+				err := json.Unmarshal(rr.Body.Bytes(), &response)
+				if err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+
+				if response.Name != tt.expectedName {
+					t.Errorf("Expected product name %s, got %s", tt.expectedName, response.Name)
+				}
+
+				if response.ID == 0 {
+					t.Error("Product ID should not be 0")
+				}
+			}
+		})
+	}
+}
+
+func TestProductCurrency(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		path             string
+		body             string
+		expectedStatus   int
+		expectedCurrency string
+	}{
+		{name: "Default", method: "POST", path: "/api/v1/products", body: `{"name":"New","price":1}`, expectedStatus: http.StatusCreated, expectedCurrency: "USD"},
+		{name: "Valid code", method: "POST", path: "/api/v1/products", body: `{"name":"New","price":1,"currency":"EUR"}`, expectedStatus: http.StatusCreated, expectedCurrency: "EUR"},
+		{name: "Invalid code", method: "POST", path: "/api/v1/products", body: `{"name":"New","price":1,"currency":"XYZ"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Lowercase code", method: "POST", path: "/api/v1/products", body: `{"name":"New","price":1,"currency":"eur"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Updating", method: "PATCH", path: "/api/v1/products/1", body: `{"currency":"NZD"}`, expectedStatus: http.StatusOK, expectedCurrency: "NZD"},
+		{name: "Updating (invalid code)", method: "PATCH", path: "/api/v1/products/1", body: `{"currency":""}`, expectedStatus: http.StatusBadRequest},
+		{name: "Not updating", method: "PATCH", path: "/api/v1/products/1", body: `{"price":2}`, expectedStatus: http.StatusOK, expectedCurrency: "GBP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := newMockDB()
+			if _, err := mockDB.CreateProduct(context.Background(), models.CreateProductRequest{Name: "Product", Price: 1, Currency: "GBP"}); err != nil {
+				t.Fatalf("Failed to create test product: %v", err)
+			}
+			router := api.NewHandler(mockDB, nil).SetupRoutes()
+
+			req := newJSONRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+
+			if tt.expectedStatus == http.StatusBadRequest {
+				if !strings.Contains(rr.Body.String(), "'iso4217'") {
+					t.Errorf("Expected iso4217 validation failure, got %s", rr.Body.String())
+				}
+				return
+			}
+
+			var product models.Product
+			if err := json.NewDecoder(rr.Body).Decode(&product); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if product.Currency != tt.expectedCurrency {
+				t.Errorf("Expected currency %q, got %q", tt.expectedCurrency, product.Currency)
+			}
+		})
+	}
+}
+
+func TestCreateProductUniqueNames(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           []api.Option
+		body           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "Existing name", opts: []api.Option{api.WithUniqueNames()}, body: `{"name":"laptop","price":1}`, expectedStatus: http.StatusConflict, expectedCode: models.CodeNameConflict},
+		{name: "New name", opts: []api.Option{api.WithUniqueNames()}, body: `{"name":"Tablet","price":1}`, expectedStatus: http.StatusCreated},
+		{name: "Existing name with unique names disabled", body: `{"name":"laptop","price":1}`, expectedStatus: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil, tt.opts...).SetupRoutes()
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newJSONRequest("POST", "/api/v1/products", strings.NewReader(tt.body)))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedCode == "" {
+				return
+			}
+
+			var response models.ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Code != tt.expectedCode {
+				t.Errorf("Expected code %q, got %q", tt.expectedCode, response.Code)
+			}
+		})
+	}
+}
+
+func TestCreateProductLocation(t *testing.T) {
+	mockDB := newMockDB()
+	router := api.NewHandler(mockDB, nil).SetupRoutes()
+
+	req := newJSONRequest("POST", "/api/v1/products", strings.NewReader(`{"name":"New","price":1}`))
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, rr.Code)
+	}
+
+	var product models.Product
+	if err := json.NewDecoder(rr.Body).Decode(&product); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	location := rr.Header().Get("Location")
+	if expected := fmt.Sprintf("/api/v1/products/%d", product.ID); location != expected {
+		t.Fatalf("Expected Location %q, got %q", expected, location)
+	}
+
+	// the location identifies the created product
+	req = httptest.NewRequest("GET", location, nil)
+	rr = httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status code %d getting the created product, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestCreateProductCapacityWarning(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            []api.Option
+		existing        int
+		expectedWarning string
+	}{
+		{name: "No maximum", existing: 99},
+		{name: "Below default threshold", opts: []api.Option{api.WithMaxProducts(10)}, existing: 7},
+		{name: "At default threshold", opts: []api.Option{api.WithMaxProducts(10)}, existing: 8, expectedWarning: "9 of 10 products (90%)"},
+		{name: "Beyond maximum", opts: []api.Option{api.WithMaxProducts(10)}, existing: 10, expectedWarning: "11 of 10 products (110%)"},
+		{name: "Below configured threshold", opts: []api.Option{api.WithMaxProducts(10), api.WithCapacityWarningThreshold(50)}, existing: 3},
+		{name: "At configured threshold", opts: []api.Option{api.WithMaxProducts(10), api.WithCapacityWarningThreshold(50)}, existing: 4, expectedWarning: "5 of 10 products (50%)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := newMockDB()
+			for i := range tt.existing {
+				if _, err := mockDB.CreateProduct(context.Background(), models.CreateProductRequest{Name: fmt.Sprintf("Product %d", i), Price: 1.0}); err != nil {
+					t.Fatalf("Failed to create test product: %v", err)
+				}
+			}
+
+			buf := &bytes.Buffer{}
+			opts := append(tt.opts, api.WithLogger(slog.New(slog.NewJSONHandler(buf, nil))))
+			router := api.NewHandler(mockDB, nil, opts...).SetupRoutes()
+
+			req := newJSONRequest("POST", "/api/v1/products", strings.NewReader(`{"name":"New","price":1}`))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("Expected status code %d, got %d", http.StatusCreated, rr.Code)
+			}
+
+			if warning := rr.Header().Get("X-Capacity-Warning"); warning != tt.expectedWarning {
+				t.Errorf("Expected X-Capacity-Warning %q, got %q", tt.expectedWarning, warning)
+			}
+
+			if logged := strings.Contains(buf.String(), "catalog approaching capacity"); logged != (tt.expectedWarning != "") {
+				t.Errorf("Expected capacity warning logged: %v, got %v", tt.expectedWarning != "", logged)
+			}
+		})
+	}
+}
+
+func TestProductNameValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		productName    string
+		expectedStatus int
+		expectedDetail string
+	}{
+		{name: "Minimum length", productName: "ab", expectedStatus: http.StatusOK},
+		{name: "Maximum length", productName: strings.Repeat("a", 200), expectedStatus: http.StatusOK},
+		{name: "Too short", productName: "a", expectedStatus: http.StatusBadRequest, expectedDetail: "'min=2'"},
+		{name: "Too long", productName: strings.Repeat("a", 201), expectedStatus: http.StatusBadRequest, expectedDetail: "'max=200'"},
+		{name: "Padded to minimum length", productName: " a ", expectedStatus: http.StatusBadRequest, expectedDetail: "'min=2'"},
+		{name: "Whitespace only", productName: "   ", expectedStatus: http.StatusBadRequest, expectedDetail: ".Name'"},
+	}
+
+	for _, tt := range tests {
+		for _, rq := range []struct {
+			method, path, body string
+			status             int
+		}{
+			{method: "POST", path: "/api/v1/products", body: fmt.Sprintf(`{"name":%q,"price":1}`, tt.productName), status: http.StatusCreated},
+			{method: "PUT", path: "/api/v1/products/1", body: fmt.Sprintf(`{"name":%q}`, tt.productName), status: http.StatusOK},
+			{method: "PATCH", path: "/api/v1/products/1", body: fmt.Sprintf(`{"name":%q}`, tt.productName), status: http.StatusOK},
+		} {
+			t.Run(tt.name+"/"+rq.method, func(t *testing.T) {
+				mockDB := newMockDB()
+				if _, err := mockDB.CreateProduct(context.Background(), models.CreateProductRequest{Name: "Product", Price: 1}); err != nil {
+					t.Fatalf("Failed to create test product: %v", err)
+				}
+				router := api.NewHandler(mockDB, nil).SetupRoutes()
+
+				req := newJSONRequest(rq.method, rq.path, strings.NewReader(rq.body))
+				rr := httptest.NewRecorder()
+
+				router.ServeHTTP(rr, req)
+
+				expectedStatus := tt.expectedStatus
+				if expectedStatus == http.StatusOK {
+					expectedStatus = rq.status
+				}
+				if rr.Code != expectedStatus {
+					t.Fatalf("Expected status code %d, got %d: %s", expectedStatus, rr.Code, rr.Body.String())
+				}
+
+				if tt.expectedDetail == "" {
+					return
+				}
+				var response models.ErrorResponse
+				if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if !strings.Contains(response.Message, tt.expectedDetail) {
+					t.Errorf("Expected error detail to contain %q, got %q", tt.expectedDetail, response.Message)
+				}
+			})
+		}
+	}
+}
+
+func TestProductTrimmed(t *testing.T) {
+	mockDB := newMockDB()
+	router := api.NewHandler(mockDB, nil).SetupRoutes()
+
+	req := newJSONRequest("POST", "/api/v1/products", strings.NewReader(`{"name":"  Padded  ","description":"\tA description\n","category":" Test ","price":1}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	product, err := mockDB.GetProductByID(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Failed to get created product: %v", err)
+	}
+	if product.Name != "Padded" || product.Description != "A description" || product.Category != "Test" {
+		t.Errorf("Expected trimmed name, description and category, got %q, %q, %q", product.Name, product.Description, product.Category)
+	}
+
+	req = newJSONRequest("PATCH", "/api/v1/products/1", strings.NewReader(`{"name":" Renamed ","category":"  "}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	product, err = mockDB.GetProductByID(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Failed to get updated product: %v", err)
+	}
+	if product.Name != "Renamed" || product.Category != "" {
+		t.Errorf("Expected trimmed name and category, got %q, %q", product.Name, product.Category)
+	}
+}
+
+func TestAllowedCategories(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "Create in an allowed category", method: "POST", path: "/api/v1/products", body: `{"name":"Desk","price":99,"category":"Furniture"}`, expectedStatus: http.StatusCreated},
+		{name: "Create in an allowed category (case-insensitive)", method: "POST", path: "/api/v1/products", body: `{"name":"Desk","price":99,"category":"FURNITURE"}`, expectedStatus: http.StatusCreated},
+		{name: "Create without a category", method: "POST", path: "/api/v1/products", body: `{"name":"Desk","price":99}`, expectedStatus: http.StatusCreated},
+		{name: "Create in a disallowed category", method: "POST", path: "/api/v1/products", body: `{"name":"Novel","price":9,"category":"Books"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Update to an allowed category", method: "PUT", path: "/api/v1/products/2", body: `{"category":"electronics"}`, expectedStatus: http.StatusOK},
+		{name: "Update to a disallowed category", method: "PUT", path: "/api/v1/products/2", body: `{"category":"Books"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Patch to a disallowed category", method: "PATCH", path: "/api/v1/products/2", body: `{"category":"Books"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Update other fields", method: "PATCH", path: "/api/v1/products/3", body: `{"quantity":5}`, expectedStatus: http.StatusOK},
+		{name: "Upsert in a disallowed category", method: "PUT", path: "/api/v1/products/sku/NOV-001", body: `{"name":"Novel","price":9,"category":"Books"}`, expectedStatus: http.StatusBadRequest},
+		{name: "Bulk update to a disallowed category", method: "POST", path: "/api/v1/products/bulk-update", body: `{"filter":{"category":"electronics"},"update":{"category":"Books"}}`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the sample product in the Office Supplies category predates the
+			// allowed categories, and may be updated other than its category
+			router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil, api.WithAllowedCategories("Electronics", "Furniture")).SetupRoutes()
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newJSONRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusBadRequest {
+				return
+			}
+
+			var response models.ErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response.Code != models.CodeInvalidCategory {
+				t.Errorf("Expected code %q, got %q", models.CodeInvalidCategory, response.Code)
+			}
+			if expected := "Books is not an allowed category (allowed categories are Electronics, Furniture)"; response.Message != expected {
+				t.Errorf("Expected message %q, got %q", expected, response.Message)
+			}
+		})
+	}
+}
+
+func TestCreateProductTooManyCategories(t *testing.T) {
+	// the sample data has 3 categories
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData(), db.WithMaxCategories(4)), nil).SetupRoutes()
+
+	tests := []struct {
+		name           string
+		category       string
+		expectedStatus int
+	}{
+		{name: "New category within maximum", category: "Books", expectedStatus: http.StatusCreated},
+		{name: "New category beyond maximum", category: "Toys", expectedStatus: http.StatusUnprocessableEntity},
+		{name: "Existing category", category: "Electronics", expectedStatus: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"name":"New","price":1,"category":%q}`, tt.category)
+			req := newJSONRequest("POST", "/api/v1/products", strings.NewReader(body))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateProductCapacityExceeded(t *testing.T) {
+	// the sample data has 5 products
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData(), db.WithMaxProducts(6)), nil).SetupRoutes()
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "Create within capacity", method: "POST", path: "/api/v1/products", body: `{"name":"Book","price":1}`, expectedStatus: http.StatusCreated},
+		{name: "Create beyond capacity", method: "POST", path: "/api/v1/products", body: `{"name":"Toy","price":1}`, expectedStatus: http.StatusInsufficientStorage},
+		{name: "Clone beyond capacity", method: "POST", path: "/api/v1/products/1/clone", expectedStatus: http.StatusInsufficientStorage},
+		{name: "Upsert beyond capacity", method: "PUT", path: "/api/v1/products/sku/TOY-001", body: `{"name":"Toy","price":1}`, expectedStatus: http.StatusInsufficientStorage},
+		{name: "Update at capacity", method: "PUT", path: "/api/v1/products/1", body: `{"price":999.99}`, expectedStatus: http.StatusOK},
+		{name: "Delete at capacity", method: "DELETE", path: "/api/v1/products/2", expectedStatus: http.StatusNoContent},
+		{name: "Create after delete", method: "POST", path: "/api/v1/products", body: `{"name":"Toy","price":1}`, expectedStatus: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newJSONRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateProductDatabaseError(t *testing.T) {
+	mockDB := newMockDB()
+	mockDB.shouldFail = true
+	handler := api.NewHandler(mockDB, nil)
+
+	requestBody := models.CreateProductRequest{
+		Name:        "Test Product",
+		Description: "A test product",
+		Price:       99.99,
+		Category:    "Test",
+		InStock:     true,
+	}
+
+	body, _ := json.Marshal(requestBody)
+	req := newJSONRequest("POST", "/api/v1/products", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	handler.CreateProduct(rr, req)
+
+	if status := rr.Code; status != http.StatusInternalServerError {
+		t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, status)
+	}
+}
+
+func TestCloneProduct(t *testing.T) {
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil, api.WithUniqueNames()).SetupRoutes()
+
+	// a product with every field, and a name that cannot be suffixed without
+	// exceeding the maximum length of a name
+	longName := strings.Repeat("x", 199)
+	body := fmt.Sprintf(`{"sku":"WID-001","name":%q,"description":"A widget","price":9.99,"currency":"EUR","category":"Widgets","in_stock":true,"tags":["blue","small"]}`, longName)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newJSONRequest("POST", "/api/v1/products", strings.NewReader(body)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Failed to create product: %d %s", rr.Code, rr.Body.String())
+	}
+
+	var source models.Product
+	if err := json.Unmarshal(rr.Body.Bytes(), &source); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		id             int
+		expectedStatus int
+		expectedName   string
+		expectedCode   string
+	}{
+		{name: "Product", id: 1, expectedStatus: http.StatusCreated, expectedName: "Laptop (copy)"},
+		{name: "Product with all fields", id: source.ID, expectedStatus: http.StatusCreated, expectedName: longName[:193] + " (copy)"},
+		{name: "Copy of a copy", id: 7, expectedStatus: http.StatusCreated, expectedName: "Laptop (copy) (copy)"},
+		{name: "Name conflict", id: 1, expectedStatus: http.StatusConflict, expectedCode: models.CodeNameConflict},
+		{name: "Not found", id: 999, expectedStatus: http.StatusNotFound, expectedCode: models.CodeProductNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("POST", fmt.Sprintf("/api/v1/products/%d/clone", tt.id), nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+
+			if tt.expectedCode != "" {
+				var response models.ErrorResponse
+				if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if response.Code != tt.expectedCode {
+					t.Errorf("Expected code %q, got %q", tt.expectedCode, response.Code)
+				}
+				return
+			}
+
+			var clone models.Product
+			if err := json.Unmarshal(rr.Body.Bytes(), &clone); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if location := rr.Header().Get("Location"); location != fmt.Sprintf("/api/v1/products/%d", clone.ID) {
+				t.Errorf("Expected Location /api/v1/products/%d, got %q", clone.ID, location)
+			}
+
+			rr = httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/api/v1/products/%d", tt.id), nil))
+			var original models.Product
+			if err := json.Unmarshal(rr.Body.Bytes(), &original); err != nil {
+				t.Fatalf("Failed to unmarshal product: %v", err)
+			}
+
+			if clone.ID == original.ID {
+				t.Errorf("Expected a new ID, got %d", clone.ID)
+			}
+			if clone.Name != tt.expectedName {
+				t.Errorf("Expected name %q, got %q", tt.expectedName, clone.Name)
+			}
+			if clone.SKU != "" {
+				t.Errorf("Expected no SKU, got %q", clone.SKU)
+			}
+			if clone.CreatedAt.Before(original.CreatedAt) || !clone.UpdatedAt.Equal(clone.CreatedAt) {
+				t.Errorf("Expected fresh timestamps, got created_at %v and updated_at %v (original created at %v)", clone.CreatedAt, clone.UpdatedAt, original.CreatedAt)
+			}
+
+			// the remaining fields match the original
+			clone.ID, clone.SKU, clone.Name, clone.CreatedAt, clone.UpdatedAt = original.ID, original.SKU, original.Name, original.CreatedAt, original.UpdatedAt
+			if !reflect.DeepEqual(clone, original) {
+				t.Errorf("Expected clone of %+v, got %+v", original, clone)
+			}
+		})
+	}
+}
+
+func TestUpdateProduct(t *testing.T) {
+	mockDB := newMockDB()
+	handler := api.NewHandler(mockDB, nil)
+
+	// Create a product to update
+	createReq := models.CreateProductRequest{
+		Name:        "Original Product",
+		Description: "Original description",
+		Price:       100.0,
+		Category:    "Original",
 		InStock:     true,
 	}
-	product, _ := mockDB.CreateProduct(req)
+	if _, err := mockDB.CreateProduct(context.Background(), createReq); err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
 
 	tests := []struct {
 		name           string
 		productID      string
+		requestBody    interface{}
 		dbShouldFail   bool
 		expectedStatus int
 		expectedName   string
 	}{
 		{
-			name:           "Valid product ID",
-			productID:      "1",
+			name:      "Valid update",
+			productID: "1",
+			requestBody: models.UpdateProductRequest{
+				Name:  byref("Updated Product"),
+				Price: byref(150.0),
+			},
 			expectedStatus: http.StatusOK,
-			expectedName:   "Test Product",
+			expectedName:   "Updated Product",
 		},
 		{
-			name:           "Invalid product ID",
-			productID:      "9999999999999999999", // exceeds int range
-			expectedStatus: http.StatusBadRequest,
+			name:      "Partial update",
+			productID: "1",
+			requestBody: models.UpdateProductRequest{
+				InStock: byref(false),
+			},
+			expectedStatus: http.StatusOK,
 		},
 		{
-			name:           "Non-existent product",
-			productID:      "999",
+			name:      "Non-existent product",
+			productID: "999",
+			requestBody: models.UpdateProductRequest{
+				Name: byref("Should not work"),
+			},
 			expectedStatus: http.StatusNotFound,
 		},
+		{
+			name:      "Invalid product ID",
+			productID: "9999999999999999999", // exceeds int range
+			requestBody: models.UpdateProductRequest{
+				Name: byref("Should not work"),
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid JSON",
+			productID:      "1",
+			requestBody:    "invalid json",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:      "Invalid price",
+			productID: "1",
+			requestBody: models.UpdateProductRequest{
+				Price: byref(-50.0),
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name:           "Database error",
 			productID:      "1",
+			requestBody:    models.UpdateProductRequest{Name: byref("Should not work")},
 			dbShouldFail:   true,
 			expectedStatus: http.StatusInternalServerError,
 		},
@@ -394,21 +3105,34 @@ func TestGetProduct(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			var err error
+
+			if str, ok := tt.requestBody.(string); ok {
+				body = []byte(str)
+			} else {
+				body, err = json.Marshal(tt.requestBody)
+				if err != nil {
+					t.Fatalf("Failed to marshal request body: %v", err)
+				}
+			}
+
 			mockDB.shouldFail = tt.dbShouldFail
 
-			req := httptest.NewRequest("GET", "/api/v1/products/"+tt.productID, nil)
+			req := newJSONRequest("PUT", "/api/v1/products/"+tt.productID, bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
 			rr := httptest.NewRecorder()
 
 			// Set up router to parse URL parameters
 			router := mux.NewRouter()
-			router.HandleFunc("/api/v1/products/{id:[0-9]+}", handler.GetProduct).Methods("GET")
+			router.HandleFunc("/api/v1/products/{id:[0-9]+}", handler.UpdateProduct).Methods("PUT")
 			router.ServeHTTP(rr, req)
 
 			if status := rr.Code; status != tt.expectedStatus {
 				t.Errorf("Expected status code %d, got %d", tt.expectedStatus, status)
 			}
 
-			if tt.expectedStatus == http.StatusOK {
+			if tt.expectedStatus == http.StatusOK && tt.expectedName != "" {
 				var response models.Product
 				err := json.Unmarshal(rr.Body.Bytes(), &response)
 				if err != nil {
@@ -418,249 +3142,323 @@ func TestGetProduct(t *testing.T) {
 				if response.Name != tt.expectedName {
 					t.Errorf("Expected product name %s, got %s", tt.expectedName, response.Name)
 				}
-
-				if response.ID != product.ID {
-					t.Errorf("Expected product ID %d, got %d", product.ID, response.ID)
-				}
 			}
 		})
 	}
 }
 
-func TestCreateProduct(t *testing.T) {
-	mockDB := newMockDB()
-	handler := api.NewHandler(mockDB, nil)
+func TestUpdateProductTags(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		requestBody  string
+		expectedTags []string
+	}{
+		{name: "PUT replaces tags", method: "PUT", requestBody: `{"tags":["c","d"]}`, expectedTags: []string{"c", "d"}},
+		{name: "PUT with empty tags removes tags", method: "PUT", requestBody: `{"tags":[]}`, expectedTags: nil},
+		{name: "PUT without tags preserves tags", method: "PUT", requestBody: `{"name":"Renamed"}`, expectedTags: []string{"a", "b"}},
+		{name: "PATCH merges tags", method: "PATCH", requestBody: `{"tags":["b","c"]}`, expectedTags: []string{"a", "b", "c"}},
+		{name: "PATCH without tags preserves tags", method: "PATCH", requestBody: `{"name":"Renamed"}`, expectedTags: []string{"a", "b"}},
+		{name: "PATCH with null tags removes tags", method: "PATCH", requestBody: `{"tags":null}`, expectedTags: nil},
+		{name: "PUT with null tags preserves tags", method: "PUT", requestBody: `{"tags":null}`, expectedTags: []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := newMockDB()
+			if _, err := mockDB.CreateProduct(context.Background(), models.CreateProductRequest{Name: "Product", Price: 10.0, Tags: []string{"a", "b"}}); err != nil {
+				t.Fatalf("Failed to create test product: %v", err)
+			}
+			router := api.NewHandler(mockDB, nil).SetupRoutes()
+
+			req := newJSONRequest(tt.method, "/api/v1/products/1", strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+
+			var response models.Product
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if !slices.Equal(response.Tags, tt.expectedTags) {
+				t.Errorf("Expected tags %v, got %v", tt.expectedTags, response.Tags)
+			}
+		})
+	}
+
+	t.Run("Blank tag", func(t *testing.T) {
+		router := api.NewHandler(newMockDB(), nil).SetupRoutes()
 
+		req := newJSONRequest("POST", "/api/v1/products", strings.NewReader(`{"name":"Product","price":1,"tags":["a",""]}`))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestProductImages(t *testing.T) {
 	tests := []struct {
 		name           string
-		requestBody    interface{}
+		method         string
+		path           string
+		requestBody    string
 		expectedStatus int
-		expectedName   string
+		expectedImages []string
+		expectedDetail string
 	}{
 		{
-			name: "Valid product",
-			requestBody: models.CreateProductRequest{
-				Name:        "New Product",
-				Description: "A new product",
-				Price:       49.99,
-				Category:    "Electronics",
-				InStock:     true,
-			},
+			name:           "Create with valid URLs",
+			method:         "POST",
+			path:           "/api/v1/products",
+			requestBody:    `{"name":"Product","price":1,"images":["https://example.com/a.png","http://example.com/b.jpg?size=large"]}`,
 			expectedStatus: http.StatusCreated,
-			expectedName:   "New Product",
+			expectedImages: []string{"https://example.com/a.png", "http://example.com/b.jpg?size=large"},
 		},
 		{
-			name: "Missing required fields",
-			requestBody: models.CreateProductRequest{
-				Description: "Missing name and price",
-				Category:    "Electronics",
-			},
+			name:           "Create with empty images",
+			method:         "POST",
+			path:           "/api/v1/products",
+			requestBody:    `{"name":"Product","price":1,"images":[]}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Create with invalid scheme",
+			method:         "POST",
+			path:           "/api/v1/products",
+			requestBody:    `{"name":"Product","price":1,"images":["https://example.com/a.png","ftp://example.com/b.png"]}`,
 			expectedStatus: http.StatusBadRequest,
+			expectedDetail: "'CreateProductRequest.Images[1]' failed on the 'http_url' tag",
 		},
 		{
-			name: "Invalid price",
-			requestBody: models.CreateProductRequest{
-				Name:     "Invalid Price Product",
-				Price:    -10.0,
-				Category: "Electronics",
-			},
+			name:           "Create with invalid URL",
+			method:         "POST",
+			path:           "/api/v1/products",
+			requestBody:    `{"name":"Product","price":1,"images":["not a url"]}`,
 			expectedStatus: http.StatusBadRequest,
+			expectedDetail: "'CreateProductRequest.Images[0]' failed on the 'http_url' tag",
 		},
 		{
-			name:           "Invalid JSON",
-			requestBody:    "invalid json",
+			name:           "PUT replaces images",
+			method:         "PUT",
+			path:           "/api/v1/products/1",
+			requestBody:    `{"images":["https://example.com/c.png"]}`,
+			expectedStatus: http.StatusOK,
+			expectedImages: []string{"https://example.com/c.png"},
+		},
+		{
+			name:           "PUT with empty images removes images",
+			method:         "PUT",
+			path:           "/api/v1/products/1",
+			requestBody:    `{"images":[]}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "PATCH without images preserves images",
+			method:         "PATCH",
+			path:           "/api/v1/products/1",
+			requestBody:    `{"name":"Renamed"}`,
+			expectedStatus: http.StatusOK,
+			expectedImages: []string{"https://example.com/a.png"},
+		},
+		{
+			name:           "PATCH with null images removes images",
+			method:         "PATCH",
+			path:           "/api/v1/products/1",
+			requestBody:    `{"images":null}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "PATCH with invalid scheme",
+			method:         "PATCH",
+			path:           "/api/v1/products/1",
+			requestBody:    `{"images":["javascript:alert(1)"]}`,
 			expectedStatus: http.StatusBadRequest,
+			expectedDetail: "'UpdateProductRequest.Images[0]' failed on the 'http_url' tag",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			var body []byte
-			var err error
-
-			if str, ok := tt.requestBody.(string); ok {
-				body = []byte(str)
-			} else {
-				body, err = json.Marshal(tt.requestBody)
-				if err != nil {
-					t.Fatalf("Failed to marshal request body: %v", err)
-				}
+			mockDB := newMockDB()
+			if _, err := mockDB.CreateProduct(context.Background(), models.CreateProductRequest{Name: "Product", Price: 10.0, Images: []string{"https://example.com/a.png"}}); err != nil {
+				t.Fatalf("Failed to create test product: %v", err)
 			}
+			router := api.NewHandler(mockDB, nil).SetupRoutes()
 
-			req := httptest.NewRequest("POST", "/api/v1/products", bytes.NewBuffer(body))
-			req.Header.Set("Content-Type", "application/json")
+			req := newJSONRequest(tt.method, tt.path, strings.NewReader(tt.requestBody))
 			rr := httptest.NewRecorder()
 
-			handler.CreateProduct(rr, req)
+			router.ServeHTTP(rr, req)
 
-			if status := rr.Code; status != tt.expectedStatus {
-				t.Errorf("Expected status code %d, got %d", tt.expectedStatus, status)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
 			}
 
-			if tt.expectedStatus == http.StatusCreated {
-				var response models.Product
-				err := json.Unmarshal(rr.Body.Bytes(), &response)
-				if err != nil {
+			if tt.expectedDetail != "" {
+				var response models.ErrorResponse
+				if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
 					t.Fatalf("Failed to unmarshal response: %v", err)
 				}
-
-				if response.Name != tt.expectedName {
-					t.Errorf("Expected product name %s, got %s", tt.expectedName, response.Name)
+				if !strings.Contains(response.Message, tt.expectedDetail) {
+					t.Errorf("Expected error detail to contain %q, got %q", tt.expectedDetail, response.Message)
 				}
+				return
+			}
 
-				if response.ID == 0 {
-					t.Error("Product ID should not be 0")
-				}
+			var response models.Product
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if !slices.Equal(response.Images, tt.expectedImages) {
+				t.Errorf("Expected images %v, got %v", tt.expectedImages, response.Images)
 			}
 		})
 	}
 }
 
-func TestCreateProductDatabaseError(t *testing.T) {
-	mockDB := newMockDB()
-	mockDB.shouldFail = true
-	handler := api.NewHandler(mockDB, nil)
-
-	requestBody := models.CreateProductRequest{
-		Name:        "Test Product",
-		Description: "A test product",
-		Price:       99.99,
-		Category:    "Test",
-		InStock:     true,
+func TestUpsertProduct(t *testing.T) {
+	tests := []struct {
+		name           string
+		sku            string
+		requestBody    string
+		expectedStatus int
+		expectedID     int
+	}{
+		{name: "Create", sku: "NEW-001", requestBody: `{"name":"New Product","price":10}`, expectedStatus: http.StatusCreated, expectedID: 6},
+		{name: "Update", sku: "LAP-001", requestBody: `{"name":"Laptop Pro","price":1599.99}`, expectedStatus: http.StatusOK, expectedID: 1},
+		{name: "Matching SKU in body", sku: "LAP-001", requestBody: `{"sku":"LAP-001","name":"Laptop Pro","price":1599.99}`, expectedStatus: http.StatusOK, expectedID: 1},
+		{name: "Mismatched SKU in body", sku: "LAP-001", requestBody: `{"sku":"MUG-001","name":"Laptop Pro","price":1599.99}`, expectedStatus: http.StatusBadRequest},
+		{name: "Invalid SKU", sku: "12345", requestBody: `{"name":"New Product","price":10}`, expectedStatus: http.StatusBadRequest},
+		{name: "Validation failed", sku: "LAP-001", requestBody: `{"price":10}`, expectedStatus: http.StatusBadRequest},
+		{name: "Invalid JSON", sku: "LAP-001", requestBody: `invalid json`, expectedStatus: http.StatusBadRequest},
 	}
 
-	body, _ := json.Marshal(requestBody)
-	req := httptest.NewRequest("POST", "/api/v1/products", bytes.NewBuffer(body))
-	req.Header.Set("Content-Type", "application/json")
-	rr := httptest.NewRecorder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil).SetupRoutes()
 
-	handler.CreateProduct(rr, req)
+			req := newJSONRequest("PUT", "/api/v1/products/sku/"+tt.sku, strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
 
-	if status := rr.Code; status != http.StatusInternalServerError {
-		t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, status)
-	}
-}
+			router.ServeHTTP(rr, req)
 
-func TestUpdateProduct(t *testing.T) {
-	mockDB := newMockDB()
-	handler := api.NewHandler(mockDB, nil)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if rr.Code >= http.StatusBadRequest {
+				return
+			}
 
-	// Create a product to update
-	createReq := models.CreateProductRequest{
-		Name:        "Original Product",
-		Description: "Original description",
-		Price:       100.0,
-		Category:    "Original",
-		InStock:     true,
-	}
-	if _, err := mockDB.CreateProduct(createReq); err != nil {
-		t.Fatalf("Failed to create test product: %v", err)
+			var response models.Product
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response.ID != tt.expectedID || response.SKU != tt.sku {
+				t.Errorf("Expected product %d with SKU %s, got %d with %s", tt.expectedID, tt.sku, response.ID, response.SKU)
+			}
+
+			location := rr.Header().Get("Location")
+			switch {
+			case rr.Code == http.StatusCreated && location != fmt.Sprintf("/api/v1/products/%d", tt.expectedID):
+				t.Errorf("Expected Location /api/v1/products/%d, got %q", tt.expectedID, location)
+			case rr.Code == http.StatusOK && location != "":
+				t.Errorf("Expected no Location for an update, got %q", location)
+			}
+		})
 	}
 
+	t.Run("Database error", func(t *testing.T) {
+		mockDB := newMockDB()
+		mockDB.shouldFail = true
+		rr := httptest.NewRecorder()
+
+		api.NewHandler(mockDB, nil).SetupRoutes().ServeHTTP(rr, newJSONRequest("PUT", "/api/v1/products/sku/NEW-001", strings.NewReader(`{"name":"New Product","price":10}`)))
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+	})
+}
+
+func TestPatchProductNull(t *testing.T) {
 	tests := []struct {
 		name           string
-		productID      string
-		requestBody    interface{}
-		dbShouldFail   bool
+		method         string
+		requestBody    string
 		expectedStatus int
-		expectedName   string
+		expected       models.Product
 	}{
 		{
-			name:      "Valid update",
-			productID: "1",
-			requestBody: models.UpdateProductRequest{
-				Name:  byref("Updated Product"),
-				Price: byref(150.0),
-			},
+			name:           "Null clears optional fields",
+			method:         "PATCH",
+			requestBody:    `{"description":null,"category":null,"sku":null}`,
 			expectedStatus: http.StatusOK,
-			expectedName:   "Updated Product",
+			expected:       models.Product{Name: "Product", Price: 10.0},
 		},
 		{
-			name:      "Partial update",
-			productID: "1",
-			requestBody: models.UpdateProductRequest{
-				InStock: byref(false),
-			},
+			name:           "Absent fields are preserved",
+			method:         "PATCH",
+			requestBody:    `{"price":20}`,
 			expectedStatus: http.StatusOK,
+			expected:       models.Product{SKU: "PRD-001", Name: "Product", Description: "Description", Price: 20.0, Category: "Category"},
 		},
 		{
-			name:      "Non-existent product",
-			productID: "999",
-			requestBody: models.UpdateProductRequest{
-				Name: byref("Should not work"),
-			},
-			expectedStatus: http.StatusNotFound,
-		},
-		{
-			name:      "Invalid product ID",
-			productID: "9999999999999999999", // exceeds int range
-			requestBody: models.UpdateProductRequest{
-				Name: byref("Should not work"),
-			},
-			expectedStatus: http.StatusBadRequest,
-		},
-		{
-			name:           "Invalid JSON",
-			productID:      "1",
-			requestBody:    "invalid json",
-			expectedStatus: http.StatusBadRequest,
-		},
-		{
-			name:      "Invalid price",
-			productID: "1",
-			requestBody: models.UpdateProductRequest{
-				Price: byref(-50.0),
-			},
-			expectedStatus: http.StatusBadRequest,
-		},
-		{
-			name:           "Database error",
-			productID:      "1",
-			requestBody:    models.UpdateProductRequest{Name: byref("Should not work")},
-			dbShouldFail:   true,
-			expectedStatus: http.StatusInternalServerError,
+			name:           "PUT ignores null",
+			method:         "PUT",
+			requestBody:    `{"description":null,"category":null}`,
+			expectedStatus: http.StatusOK,
+			expected:       models.Product{SKU: "PRD-001", Name: "Product", Description: "Description", Price: 10.0, Category: "Category"},
 		},
+		{name: "Null name", method: "PATCH", requestBody: `{"name":null}`, expectedStatus: http.StatusBadRequest},
+		{name: "Null price", method: "PATCH", requestBody: `{"price":null}`, expectedStatus: http.StatusBadRequest},
+		{name: "Null in_stock", method: "PATCH", requestBody: `{"category":null,"in_stock":null}`, expectedStatus: http.StatusBadRequest},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			var body []byte
-			var err error
-
-			if str, ok := tt.requestBody.(string); ok {
-				body = []byte(str)
-			} else {
-				body, err = json.Marshal(tt.requestBody)
-				if err != nil {
-					t.Fatalf("Failed to marshal request body: %v", err)
-				}
+			mockDB := newMockDB()
+			if _, err := mockDB.CreateProduct(context.Background(), models.CreateProductRequest{SKU: "PRD-001", Name: "Product", Description: "Description", Price: 10.0, Category: "Category"}); err != nil {
+				t.Fatalf("Failed to create test product: %v", err)
 			}
+			router := api.NewHandler(mockDB, nil).SetupRoutes()
 
-			mockDB.shouldFail = tt.dbShouldFail
-
-			req := httptest.NewRequest("PUT", "/api/v1/products/"+tt.productID, bytes.NewBuffer(body))
+			req := newJSONRequest(tt.method, "/api/v1/products/1", strings.NewReader(tt.requestBody))
 			req.Header.Set("Content-Type", "application/json")
 			rr := httptest.NewRecorder()
 
-			// Set up router to parse URL parameters
-			router := mux.NewRouter()
-			router.HandleFunc("/api/v1/products/{id:[0-9]+}", handler.UpdateProduct).Methods("PUT")
 			router.ServeHTTP(rr, req)
 
-			if status := rr.Code; status != tt.expectedStatus {
-				t.Errorf("Expected status code %d, got %d", tt.expectedStatus, status)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
 			}
 
-			if tt.expectedStatus == http.StatusOK && tt.expectedName != "" {
-				var response models.Product
-				err := json.Unmarshal(rr.Body.Bytes(), &response)
-				if err != nil {
-					t.Fatalf("Failed to unmarshal response: %v", err)
+			if tt.expectedStatus != http.StatusOK {
+				// the product is unchanged
+				if product, _ := mockDB.GetProductByID(context.Background(), 1); product.Category != "Category" {
+					t.Errorf("Expected product to be unchanged, got category %q", product.Category)
 				}
+				return
+			}
 
-				if response.Name != tt.expectedName {
-					t.Errorf("Expected product name %s, got %s", tt.expectedName, response.Name)
-				}
+			var response models.Product
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if response.SKU != tt.expected.SKU || response.Name != tt.expected.Name || response.Description != tt.expected.Description ||
+				response.Price != tt.expected.Price || response.Category != tt.expected.Category {
+				t.Errorf("Expected product %+v, got %+v", tt.expected, response)
 			}
 		})
 	}
@@ -678,7 +3476,7 @@ func TestDeleteProduct(t *testing.T) {
 		Category:    "Test",
 		InStock:     true,
 	}
-	if _, err := mockDB.CreateProduct(createReq); err != nil {
+	if _, err := mockDB.CreateProduct(context.Background(), createReq); err != nil {
 		t.Fatalf("Failed to create test product: %v", err)
 	}
 
@@ -736,8 +3534,62 @@ func TestDeleteProduct(t *testing.T) {
 	}
 }
 
+func TestDeleteProductReturn(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		productID      string
+		expectedStatus int
+		expectProduct  bool
+	}{
+		{name: "Returning the product", query: "?return=true", productID: "1", expectedStatus: http.StatusOK, expectProduct: true},
+		{name: "Not returning the product", query: "?return=false", productID: "1", expectedStatus: http.StatusNoContent},
+		{name: "Non-existent product", query: "?return=true", productID: "999", expectedStatus: http.StatusNotFound},
+		{name: "Invalid return value", query: "?return=yes", productID: "1", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := newMockDB()
+			created, err := mockDB.CreateProduct(context.Background(), models.CreateProductRequest{Name: "Product to Delete", Price: 50.0, Category: "Test"})
+			if err != nil {
+				t.Fatalf("Failed to create test product: %v", err)
+			}
+			router := api.NewHandler(mockDB, nil).SetupRoutes()
+
+			req := httptest.NewRequest("DELETE", "/api/v1/products/"+tt.productID+tt.query, nil)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+
+			if tt.expectProduct {
+				var product models.Product
+				if err := json.NewDecoder(rr.Body).Decode(&product); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if product.ID != created.ID || product.Name != created.Name {
+					t.Errorf("Expected deleted product %+v, got %+v", created, product)
+				}
+			} else if rr.Code == http.StatusNoContent && rr.Body.Len() != 0 {
+				t.Error("Expected empty response body for successful deletion")
+			}
+
+			// the product is deleted (or retained) regardless of the response body
+			_, err = mockDB.GetProductByID(context.Background(), created.ID)
+			expectDeleted := tt.expectedStatus == http.StatusOK || tt.expectedStatus == http.StatusNoContent
+			if deleted := errors.Is(err, db.ErrNotFound); deleted != expectDeleted {
+				t.Errorf("Expected product deleted: %v, got %v", expectDeleted, deleted)
+			}
+		})
+	}
+}
+
 func TestSetupRoutes(t *testing.T) {
-	realDB := db.NewInMemoryDB()
+	realDB := db.NewInMemoryDB(db.WithSampleData())
 	handler := api.NewHandler(realDB, nil)
 	router := handler.SetupRoutes()
 
@@ -748,10 +3600,14 @@ func TestSetupRoutes(t *testing.T) {
 	}{
 		{"GET", "/api/v1/products"},
 		{"POST", "/api/v1/products"},
+		{"GET", "/api/v1/products/random"},
+		{"GET", "/api/v1/products/export"},
 		{"GET", "/api/v1/products/1"},
+		{"GET", "/api/v1/products/LAP-001"},
 		{"PUT", "/api/v1/products/1"},
 		{"DELETE", "/api/v1/products/1"},
 		{"GET", "/health"},
+		{"GET", "/ready"},
 	}
 
 	for _, tt := range tests {
@@ -769,6 +3625,59 @@ func TestSetupRoutes(t *testing.T) {
 	}
 }
 
+func TestMethodNotAllowed(t *testing.T) {
+	router := api.NewHandler(newMockDB(), nil).SetupRoutes()
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		expectedAllow string
+	}{
+		{name: "POST product by ID", method: "POST", path: "/api/v1/products/1", expectedAllow: "GET, HEAD, PUT, PATCH, DELETE, OPTIONS"},
+		{name: "PUT product by SKU", method: "PUT", path: "/api/v1/products/LAP-001", expectedAllow: "GET, HEAD, OPTIONS"},
+		{name: "DELETE products", method: "DELETE", path: "/api/v1/products", expectedAllow: "GET, POST, OPTIONS"},
+		{name: "POST health", method: "POST", path: "/health", expectedAllow: "GET, OPTIONS"},
+		{name: "HEAD product count", method: "HEAD", path: "/api/v1/products/count", expectedAllow: "GET, OPTIONS"},
+		{name: "HEAD price stats", method: "HEAD", path: "/api/v1/products/stats", expectedAllow: "GET, OPTIONS"},
+		{name: "GET bulk update", method: "GET", path: "/api/v1/products/bulk-update", expectedAllow: "POST, OPTIONS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rr.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("Expected status code %d, got %d", http.StatusMethodNotAllowed, rr.Code)
+			}
+			if allow := rr.Header().Get("Allow"); allow != tt.expectedAllow {
+				t.Errorf("Expected Allow %q, got %q", tt.expectedAllow, allow)
+			}
+
+			var response models.ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Error != "Method not allowed" {
+				t.Errorf("Expected error %q, got %q", "Method not allowed", response.Error)
+			}
+		})
+	}
+
+	t.Run("Unknown path", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/unknown", nil))
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+		if allow := rr.Header().Get("Allow"); allow != "" {
+			t.Errorf("Expected no Allow header, got %q", allow)
+		}
+	})
+}
+
 func TestCORSMiddleware(t *testing.T) {
 	mockDB := newMockDB()
 	handler := api.NewHandler(mockDB, nil)
@@ -784,11 +3693,12 @@ func TestCORSMiddleware(t *testing.T) {
 		t.Errorf("Expected status code %d for OPTIONS request, got %d", http.StatusOK, rr.Code)
 	}
 
-	// Check CORS headers
+	// Check CORS headers; the methods are those routed for the collection
 	headers := map[string]string{
 		"Access-Control-Allow-Origin":  "*",
-		"Access-Control-Allow-Methods": "GET, POST, PUT, DELETE, OPTIONS",
+		"Access-Control-Allow-Methods": "GET, POST, OPTIONS",
 		"Access-Control-Allow-Headers": "Content-Type, Authorization",
+		"Allow":                        "GET, POST, OPTIONS",
 	}
 
 	for header, expectedValue := range headers {
@@ -808,6 +3718,157 @@ func TestCORSMiddleware(t *testing.T) {
 	if corsOrigin != "*" {
 		t.Errorf("Expected Access-Control-Allow-Origin header on GET request, got %s", corsOrigin)
 	}
+
+	// the methods routed for a product exclude POST
+	req = httptest.NewRequest("OPTIONS", "/api/v1/products/1", nil)
+	rr = httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status code %d for OPTIONS request, got %d", http.StatusOK, rr.Code)
+	}
+	if methods := rr.Header().Get("Access-Control-Allow-Methods"); methods != "GET, HEAD, PUT, PATCH, DELETE, OPTIONS" {
+		t.Errorf("Expected Access-Control-Allow-Methods header to be %s, got %s", "GET, HEAD, PUT, PATCH, DELETE, OPTIONS", methods)
+	}
+	if methods := rr.Header().Get("Access-Control-Allow-Methods"); strings.Contains(methods, "POST") {
+		t.Errorf("Expected POST not to be allowed for a product, got %s", methods)
+	}
+
+	// every route may be preflighted, not only the products collection
+	// and products
+	for path, expected := range map[string]string{
+		"/api/v1/products/count":     "GET, OPTIONS",
+		"/api/v1/products/import":    "POST, OPTIONS",
+		"/api/v1/products/sku/ABC":   "PUT, OPTIONS",
+		"/api/v1/products/1/clone":   "POST, OPTIONS",
+		"/api/v1/products/1/history": "GET, OPTIONS",
+		"/api/v1/products/1/reserve": "POST, OPTIONS",
+		"/health":                    "GET, OPTIONS",
+	} {
+		t.Run("Preflight "+path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("OPTIONS", path, nil))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+			}
+			if origin := rr.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
+				t.Errorf("Expected Access-Control-Allow-Origin header to be *, got %s", origin)
+			}
+			if methods := rr.Header().Get("Access-Control-Allow-Methods"); methods != expected {
+				t.Errorf("Expected Access-Control-Allow-Methods header to be %s, got %s", expected, methods)
+			}
+		})
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	ctx, cancel := context.WithCancel(time.ContextWithClock(context.Background(), time.NewMockClock()))
+	defer cancel()
+
+	rateLimiter, err := ratelimiter.New(ctx, ratelimiter.Config{
+		Limit:         3,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+
+	t.Run("Enabled", func(t *testing.T) {
+		router := api.NewHandler(newMockDB(), rateLimiter, api.WithRateLimitHeaders()).SetupRoutes()
+
+		for i, expected := range []struct {
+			status    int
+			remaining string
+		}{
+			{http.StatusOK, "2"},
+			{http.StatusOK, "1"},
+			{http.StatusOK, "0"},
+			{http.StatusTooManyRequests, "0"},
+		} {
+			req := httptest.NewRequest("GET", "/health", nil)
+			req.RemoteAddr = "198.51.100.1:1234"
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != expected.status {
+				t.Errorf("request #%d: expected status code %d, got %d", i+1, expected.status, rr.Code)
+			}
+			if limit := rr.Header().Get("X-RateLimit-Limit"); limit != "3" {
+				t.Errorf("request #%d: expected X-RateLimit-Limit 3, got %q", i+1, limit)
+			}
+			if remaining := rr.Header().Get("X-RateLimit-Remaining"); remaining != expected.remaining {
+				t.Errorf("request #%d: expected X-RateLimit-Remaining %s, got %q", i+1, expected.remaining, remaining)
+			}
+			if used := rr.Header().Values("X-RateLimit-Burst-Used"); len(used) != 0 {
+				t.Errorf("request #%d: expected no X-RateLimit-Burst-Used header without a burst, got %q", i+1, used)
+			}
+		}
+	})
+
+	t.Run("Burst", func(t *testing.T) {
+		rateLimiter, err := ratelimiter.New(ctx, ratelimiter.Config{
+			Limit:         2,
+			Burst:         1,
+			LimitInterval: time.Second,
+			ClientTimeout: time.Minute,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create rate limiter: %v", err)
+		}
+		router := api.NewHandler(newMockDB(), rateLimiter, api.WithRateLimitHeaders()).SetupRoutes()
+
+		for i, expected := range []struct {
+			status    int
+			burstUsed string
+		}{
+			{http.StatusOK, "0"},
+			{http.StatusOK, "0"},
+			{http.StatusOK, "1"},
+			{http.StatusTooManyRequests, "1"},
+		} {
+			req := httptest.NewRequest("GET", "/health", nil)
+			req.RemoteAddr = "198.51.100.1:1234"
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != expected.status {
+				t.Errorf("request #%d: expected status code %d, got %d", i+1, expected.status, rr.Code)
+			}
+			if used := rr.Header().Get("X-RateLimit-Burst-Used"); used != expected.burstUsed {
+				t.Errorf("request #%d: expected X-RateLimit-Burst-Used %s, got %q", i+1, expected.burstUsed, used)
+			}
+		}
+	})
+
+	t.Run("Not enabled", func(t *testing.T) {
+		router := api.NewHandler(newMockDB(), rateLimiter).SetupRoutes()
+
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.RemoteAddr = "198.51.100.2:1234"
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if limit := rr.Header().Get("X-RateLimit-Limit"); limit != "" {
+			t.Errorf("Expected no X-RateLimit-Limit header, got %q", limit)
+		}
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		router := api.NewHandler(newMockDB(), ratelimiter.NewNoopLimiter(), api.WithRateLimitHeaders()).SetupRoutes()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/health", nil))
+
+		if limit := rr.Header().Get("X-RateLimit-Limit"); limit != "" {
+			t.Errorf("Expected no X-RateLimit-Limit header, got %q", limit)
+		}
+	})
 }
 
 func TestRateLimiterMiddleware(t *testing.T) {
@@ -885,6 +3946,162 @@ func TestRateLimiterMiddleware(t *testing.T) {
 	}
 }
 
+func TestRateLimiterMiddlewareWriteCost(t *testing.T) {
+	ctx, cancel := context.WithCancel(time.ContextWithClock(context.Background(), time.NewMockClock()))
+	defer cancel()
+
+	tests := []struct {
+		name    string
+		opts    []api.Option
+		limit   int // default 10
+		method  string
+		body    string
+		allowed int
+	}{
+		{name: "Reads", method: "GET", allowed: 10},
+		{name: "Writes", method: "POST", body: `{"name":"New","price":1}`, allowed: 2},
+		{name: "Writes with configured cost", opts: []api.Option{api.WithWriteCost(3)}, method: "POST", body: `{"name":"New","price":1}`, allowed: 3},
+		{name: "Writes costing more than the limit", limit: 3, method: "POST", body: `{"name":"New","price":1}`, allowed: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.limit == 0 {
+				tt.limit = 10
+			}
+			rateLimiter, err := ratelimiter.New(ctx, ratelimiter.Config{
+				Limit:         tt.limit,
+				LimitInterval: time.Second,
+				ClientTimeout: time.Minute,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create rate limiter: %v", err)
+			}
+			router := api.NewHandler(newMockDB(), rateLimiter, tt.opts...).SetupRoutes()
+
+			for i := 1; i <= tt.allowed+1; i++ {
+				req := newJSONRequest(tt.method, "/api/v1/products", strings.NewReader(tt.body))
+				req.RemoteAddr = "198.51.100.1:1234"
+				rr := httptest.NewRecorder()
+
+				router.ServeHTTP(rr, req)
+
+				limited := rr.Code == http.StatusTooManyRequests
+				if expected := i > tt.allowed; limited != expected {
+					t.Errorf("request #%d: expected rate limited %v, got status code %d", i, expected, rr.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterMiddlewareDeniedWrite(t *testing.T) {
+	ctx, cancel := context.WithCancel(time.ContextWithClock(context.Background(), time.NewMockClock()))
+	defer cancel()
+
+	rateLimiter, err := ratelimiter.New(ctx, ratelimiter.Config{
+		Limit:         7,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	router := api.NewHandler(newMockDB(), rateLimiter).SetupRoutes()
+
+	// a write (costing 5) is allowed, a second is denied and the remaining
+	// 2 requests of the limit may still be used by reads
+	for i, tc := range []struct {
+		method   string
+		expected int
+	}{
+		{method: "POST", expected: http.StatusCreated},
+		{method: "POST", expected: http.StatusTooManyRequests},
+		{method: "GET", expected: http.StatusOK},
+		{method: "GET", expected: http.StatusOK},
+		{method: "GET", expected: http.StatusTooManyRequests},
+	} {
+		req := newJSONRequest(tc.method, "/api/v1/products", strings.NewReader(`{"name":"New","price":1}`))
+		req.RemoteAddr = "198.51.100.1:1234"
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != tc.expected {
+			t.Errorf("request #%d (%s): expected status code %d, got %d", i+1, tc.method, tc.expected, rr.Code)
+		}
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	failingDB := newMockDB()
+	failingDB.shouldFail = true
+
+	tests := []struct {
+		name           string
+		db             db.Database
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "Product not found", method: "GET", path: "/api/v1/products/999", expectedStatus: http.StatusNotFound, expectedCode: models.CodeProductNotFound},
+		{name: "Product not found by SKU", method: "GET", path: "/api/v1/products/NONE-001", expectedStatus: http.StatusNotFound, expectedCode: models.CodeProductNotFound},
+		{name: "Invalid product ID", method: "DELETE", path: "/api/v1/products/99999999999999999999", expectedStatus: http.StatusBadRequest, expectedCode: models.CodeInvalidProductID},
+		{name: "Invalid JSON", method: "POST", path: "/api/v1/products", body: `invalid json`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeInvalidJSON},
+		{name: "Validation failed", method: "POST", path: "/api/v1/products", body: `{"name":"","price":1}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+		{name: "Null field", method: "PATCH", path: "/api/v1/products/1", body: `{"name":null}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+		{name: "Duplicate SKU", method: "POST", path: "/api/v1/products", body: `{"name":"Laptop","price":1,"sku":"LAP-001"}`, expectedStatus: http.StatusConflict, expectedCode: models.CodeDuplicateSKU},
+		{name: "Too many categories", db: db.NewInMemoryDB(db.WithSampleData(), db.WithMaxCategories(3)), method: "POST", path: "/api/v1/products", body: `{"name":"Book","price":1,"category":"Books"}`, expectedStatus: http.StatusUnprocessableEntity, expectedCode: models.CodeTooManyCategories},
+		{name: "Capacity exceeded", db: db.NewInMemoryDB(db.WithSampleData(), db.WithMaxProducts(5)), method: "POST", path: "/api/v1/products", body: `{"name":"Book","price":1}`, expectedStatus: http.StatusInsufficientStorage, expectedCode: models.CodeCapacityExceeded},
+		{name: "Invalid query string", method: "GET", path: "/api/v1/products?page=abc", expectedStatus: http.StatusBadRequest, expectedCode: models.CodeInvalidQuery},
+		{name: "Method not allowed", method: "PATCH", path: "/api/v1/products", expectedStatus: http.StatusMethodNotAllowed, expectedCode: models.CodeMethodNotAllowed},
+		{name: "Internal error", db: failingDB, method: "GET", path: "/api/v1/products", expectedStatus: http.StatusInternalServerError, expectedCode: models.CodeInternalError},
+		{name: "Database unavailable", db: failingDB, method: "GET", path: "/ready", expectedStatus: http.StatusServiceUnavailable, expectedCode: models.CodeDatabaseUnavailable},
+		{name: "Rate limit reset not supported", method: "POST", path: "/api/v1/admin/ratelimit/reset", body: `{"client":"192.0.2.1"}`, expectedStatus: http.StatusNotImplemented, expectedCode: models.CodeNotSupported},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := tt.db
+			if database == nil {
+				database = db.NewInMemoryDB(db.WithSampleData())
+			}
+			var limiter api.RateLimiter
+			if tt.expectedCode == models.CodeNotSupported {
+				limiter = allowAll{}
+			}
+			router := api.NewHandler(database, limiter, api.WithAdminEndpoints()).SetupRoutes()
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newJSONRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+
+			var response models.ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Code != tt.expectedCode {
+				t.Errorf("Expected code %q, got %q", tt.expectedCode, response.Code)
+			}
+			if response.Error == "" {
+				t.Error("Expected an error message")
+			}
+		})
+	}
+}
+
+// newJSONRequest returns a request for testing with a JSON body
+func newJSONRequest(method, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
 // Helper function for creating pointers to literals
 func byref[T any](v T) *T {
 	return &v
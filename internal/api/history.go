@@ -0,0 +1,41 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"products-api/internal/db"
+	"products-api/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// GetProductHistory handles GET /api/v1/products/{id}/history
+//
+// Returns the changes to a product, oldest change first.  A product that
+// has not been changed since it was created has an empty history.
+func (h *Handler) GetProductHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidProductID, cInvalidProductId, "")
+		return
+	}
+
+	changes, err := h.db.ProductHistory(r.Context(), id)
+	switch {
+	case errors.Is(err, db.ErrGone):
+		h.writeErrorResponse(w, r, http.StatusGone, models.CodeProductGone, cProductGone, "")
+		return
+
+	case errors.Is(err, db.ErrNotFound):
+		h.writeErrorResponse(w, r, http.StatusNotFound, models.CodeProductNotFound, cProductNotFound, "")
+		return
+
+	case err != nil:
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to retrieve product history", err.Error())
+		return
+	}
+
+	h.writeResponse(w, r, http.StatusOK, models.ProductHistoryResponse{Data: changes})
+}
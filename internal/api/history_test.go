@@ -0,0 +1,94 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"products-api/internal/api"
+	"products-api/internal/db"
+	"products-api/internal/models"
+)
+
+func TestGetProductHistory(t *testing.T) {
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil).SetupRoutes()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newJSONRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+
+	// history returns the history of a product, failing the test if it
+	// cannot be retrieved
+	history := func(t *testing.T, id string) []models.ProductChange {
+		t.Helper()
+		rr := serve("GET", "/api/v1/products/"+id+"/history", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		var response struct {
+			Data []models.ProductChange `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if response.Data == nil {
+			t.Fatalf("Expected a list of changes, got %s", rr.Body.String())
+		}
+		return response.Data
+	}
+
+	t.Run("Unchanged", func(t *testing.T) {
+		if changes := history(t, "1"); len(changes) != 0 {
+			t.Errorf("Expected an empty history, got %v", changes)
+		}
+	})
+
+	t.Run("Updated twice", func(t *testing.T) {
+		for _, rq := range []struct{ method, body string }{
+			{"PUT", `{"price":24.99}`},
+			{"PATCH", `{"name":"Wireless Mouse v2","quantity":10}`},
+		} {
+			if rr := serve(rq.method, "/api/v1/products/2", rq.body); rr.Code != http.StatusOK {
+				t.Fatalf("%s: expected status code %d, got %d: %s", rq.method, http.StatusOK, rr.Code, rr.Body.String())
+			}
+		}
+
+		changes := history(t, "2")
+		if len(changes) != 2 {
+			t.Fatalf("Expected 2 changes, got %d: %v", len(changes), changes)
+		}
+		for i, expected := range [][]string{{"price"}, {"name", "quantity"}} {
+			if changes[i].Operation != models.OperationUpdate || !slices.Equal(changes[i].Fields, expected) {
+				t.Errorf("Expected change %d to update %v, got %s of %v", i+1, expected, changes[i].Operation, changes[i].Fields)
+			}
+		}
+		if changes[1].Timestamp.Before(changes[0].Timestamp) {
+			t.Errorf("Expected changes in order, got %v then %v", changes[0].Timestamp, changes[1].Timestamp)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if rr := serve("DELETE", "/api/v1/products/3", ""); rr.Code != http.StatusNoContent {
+			t.Fatalf("Failed to delete product: %d", rr.Code)
+		}
+
+		for _, tt := range []struct {
+			id     string
+			status int
+		}{
+			{"999", http.StatusNotFound},
+			{"3", http.StatusGone},
+			{"99999999999999999999", http.StatusBadRequest},
+		} {
+			if rr := serve("GET", "/api/v1/products/"+tt.id+"/history", ""); rr.Code != tt.status {
+				t.Errorf("Product %s: expected status code %d, got %d", tt.id, tt.status, rr.Code)
+			}
+		}
+	})
+}
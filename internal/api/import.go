@@ -0,0 +1,316 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"products-api/internal/db"
+	"products-api/internal/models"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// defaultImportConcurrency is the number of products created concurrently
+// by an import, if not configured
+const defaultImportConcurrency = 4
+
+// maxImportLine is the maximum length of a line in an import
+const maxImportLine = 1 << 20
+
+// importRow is a product to be created by an import, decoded from a
+// non-blank line (or CSV record) with a (1-based) line number.  A row that
+// cannot be decoded or fails validation has an error.
+type importRow struct {
+	line  int
+	req   models.CreateProductRequest
+	error string
+}
+
+// ImportProducts handles POST /api/v1/products/import
+//
+// Creates a product for each line of a newline-delimited JSON (NDJSON) body,
+// as produced by GET /api/v1/products/export (any id or timestamps are
+// ignored), or for each record of a CSV body (Content-Type: text/csv) with a
+// header row, as produced by GET /api/v1/products.csv.  Blank lines are
+// skipped.  A line that cannot be decoded, fails validation or cannot be
+// created does not abort the import; the response summarises the result of
+// each line, in line order.
+//
+// With ?strict=true, a line that cannot be decoded or fails validation
+// aborts the import before any products are created, with a 400 Bad Request
+// response identifying the failing lines.  A line that is valid but cannot
+// be created (e.g. a duplicate SKU) does not abort a strict import.
+//
+// Lines are processed concurrently by a pool of workers (see
+// WithImportConcurrency), so the IDs assigned to products need not follow
+// the order of the lines.
+func (h *Handler) ImportProducts(w http.ResponseWriter, r *http.Request) {
+	var strict bool
+	if r.URL.Query().Has("strict") {
+		switch s := r.URL.Query().Get("strict"); strings.ToLower(s) {
+		case "true":
+			strict = true
+		case "false":
+		default:
+			h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidQuery, "Invalid query string", fmt.Sprintf("invalid strict value: %s", s))
+			return
+		}
+	}
+
+	var (
+		rows []importRow
+		err  error
+	)
+	if hasContentType(r, "text/csv") {
+		rows, err = csvImportRows(r.Body)
+	} else {
+		rows, err = ndjsonImportRows(r.Body)
+	}
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidImport, "Invalid import", err.Error())
+		return
+	}
+
+	var invalid []string
+	for i := range rows {
+		if h.validateImportRow(r, &rows[i]); rows[i].error != "" {
+			invalid = append(invalid, fmt.Sprintf("line %d: %s", rows[i].line, rows[i].error))
+		}
+	}
+	if strict && len(invalid) > 0 {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidImport, "Invalid import", strings.Join(invalid, "; "))
+		return
+	}
+
+	// each worker writes only the results of the rows it processes, so
+	// results are in line order regardless of the order of processing
+	results := make([]models.ImportResult, len(rows))
+	h.importRows(r, rows, results)
+
+	response := models.ImportResponse{Results: results}
+	for _, result := range results {
+		if result.Error == "" {
+			response.Created++
+		} else {
+			response.Failed++
+		}
+	}
+
+	h.writeResponse(w, r, http.StatusOK, response)
+}
+
+// ndjsonImportRows returns the rows of an NDJSON import, one for each
+// non-blank line
+func ndjsonImportRows(body io.Reader) ([]importRow, error) {
+	var rows []importRow
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, maxImportLine)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		row := importRow{line: line}
+		if err := json.Unmarshal(data, &row.req); err != nil {
+			row.error = cInvalidJSON + ": " + err.Error()
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// csvImportRows returns the rows of a CSV import, one for each record after
+// the header row.  The header row identifies the column of each field, with
+// the names of the columns of a CSV export (see csvHeader); the id,
+// created_at and updated_at columns are ignored.  Tags are separated by
+// semicolons and image URLs by spaces.  An empty or invalid header row is an
+// error, while a record that cannot be decoded is a row with an error.
+func csvImportRows(body io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1 // records with the wrong number of fields are rows with an error
+
+	header, err := reader.Read()
+	switch {
+	case errors.Is(err, io.EOF):
+		return nil, errors.New("missing CSV header row")
+	case err != nil:
+		return nil, err
+	}
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if !slices.Contains(csvHeader, column) {
+			return nil, fmt.Errorf("unknown CSV column: %s", column)
+		}
+		if slices.Contains(header[:i], column) {
+			return nil, fmt.Errorf("duplicate CSV column: %s", column)
+		}
+		header[i] = column
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+
+		var (
+			row      importRow
+			parseErr *csv.ParseError
+		)
+		switch {
+		case errors.Is(err, io.EOF):
+			return rows, nil
+
+		case errors.As(err, &parseErr):
+			row = importRow{line: parseErr.StartLine, error: cInvalidCSV + ": " + parseErr.Err.Error()}
+
+		case err != nil:
+			return nil, err
+
+		default:
+			row.line, _ = reader.FieldPos(0)
+			if err := csvImportRecord(header, record, &row.req); err != nil {
+				row.error = cInvalidCSV + ": " + err.Error()
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// csvImportRecord decodes the fields of a CSV record into a request creating
+// a product, according to the columns of the header row
+func csvImportRecord(header, record []string, req *models.CreateProductRequest) error {
+	if len(record) != len(header) {
+		return fmt.Errorf("expected %d fields, got %d", len(header), len(record))
+	}
+
+	var err error
+	for i, column := range header {
+		value := record[i]
+		switch column {
+		case "sku":
+			req.SKU = value
+		case "name":
+			req.Name = value
+		case "description":
+			req.Description = value
+		case "price":
+			if req.Price, err = strconv.ParseFloat(value, 64); err != nil {
+				return fmt.Errorf("invalid price: %s", value)
+			}
+		case "currency":
+			req.Currency = value
+		case "category":
+			req.Category = value
+		case "in_stock":
+			if req.InStock, err = strconv.ParseBool(value); err != nil && value != "" {
+				return fmt.Errorf("invalid in_stock: %s", value)
+			}
+		case "quantity":
+			if req.Quantity, err = strconv.Atoi(value); err != nil && value != "" {
+				return fmt.Errorf("invalid quantity: %s", value)
+			}
+		case "tags":
+			if value != "" {
+				req.Tags = strings.Split(value, ";")
+			}
+		case "images":
+			req.Images = strings.Fields(value)
+		}
+	}
+	return nil
+}
+
+// importRows processes rows using a pool of workers, writing the result of
+// each row to the corresponding element of results
+func (h *Handler) importRows(r *http.Request, rows []importRow, results []models.ImportResult) {
+	var (
+		wg      sync.WaitGroup
+		indices = make(chan int)
+	)
+
+	for range min(h.importConcurrency, len(rows)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i] = h.importRow(r, rows[i])
+			}
+		}()
+	}
+
+	for i := range rows {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+}
+
+// validateImportRow validates the request of a row that has been decoded,
+// setting the error of the row if it fails validation
+func (h *Handler) validateImportRow(r *http.Request, row *importRow) {
+	if row.error != "" {
+		return
+	}
+	row.req.TrimSpace()
+
+	switch err := h.validator.Struct(&row.req).(type) {
+	case nil:
+
+	case validator.ValidationErrors:
+		row.error = cValidationFailed + ": " + validationDetail(err, h.requestTranslator(r))
+		return
+
+	default:
+		// the request cannot be validated, which is a bug
+		row.error = cInternalError
+		h.logger.Error("import failed", "error", err, "line", row.line, "request_id", RequestIDFromContext(r.Context()))
+		return
+	}
+
+	if err := h.categoryError(row.req.Category); err != nil {
+		row.error = cInvalidCategory + ": " + err.Error()
+	}
+}
+
+// importRow creates the product of a valid row
+func (h *Handler) importRow(r *http.Request, row importRow) models.ImportResult {
+	result := models.ImportResult{Line: row.line, Error: row.error}
+	if result.Error != "" {
+		return result
+	}
+
+	product, err := h.createProduct(r.Context(), row.req)
+	switch {
+	case errors.Is(err, db.ErrDuplicateSKU):
+		result.Error = cDuplicateSKU
+
+	case errors.Is(err, db.ErrDuplicateName):
+		result.Error = cDuplicateName
+
+	case errors.Is(err, db.ErrTooManyCategories):
+		result.Error = cTooManyCategories
+
+	case errors.Is(err, db.ErrCapacityExceeded):
+		result.Error = cCapacityExceeded
+
+	case err != nil:
+		result.Error = "Failed to create product"
+		h.logger.Error("import failed", "error", err, "line", row.line, "request_id", RequestIDFromContext(r.Context()))
+
+	default:
+		result.ID = product.ID
+	}
+
+	return result
+}
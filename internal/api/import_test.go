@@ -0,0 +1,283 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"products-api/internal/api"
+	"products-api/internal/db"
+	"products-api/internal/models"
+)
+
+// importBody returns an NDJSON import of n products; if invalid is non-zero
+// every invalid'th product has a negative price
+func importBody(n, invalid int) string {
+	sb := &strings.Builder{}
+	for i := 1; i <= n; i++ {
+		price := float64(i)
+		if invalid > 0 && i%invalid == 0 {
+			price = -1
+		}
+		fmt.Fprintf(sb, `{"name":"Imported %d","price":%g}`+"\n", i, price)
+	}
+	return sb.String()
+}
+
+func TestImportProducts(t *testing.T) {
+	body := importBody(3, 0) +
+		"\n" + // blank lines are skipped
+		`{"name":"Invalid","price":-1}` + "\n" +
+		`not json` + "\n" +
+		`{"sku":"LAP-001","name":"Duplicate","price":1}` + "\n" +
+		importBody(20, 5)
+
+	for _, concurrency := range []int{1, 8} {
+		t.Run(fmt.Sprintf("Concurrency %d", concurrency), func(t *testing.T) {
+			database := db.NewInMemoryDB(db.WithSampleData())
+			handler := api.NewHandler(database, nil, api.WithImportConcurrency(concurrency))
+			router := handler.SetupRoutes()
+
+			req := httptest.NewRequest("POST", "/api/v1/products/import", strings.NewReader(body))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+
+			var response models.ImportResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			// 3 valid, 3 invalid, then 20 with every 5th invalid
+			if response.Created != 19 || response.Failed != 7 {
+				t.Errorf("Expected 19 created and 7 failed, got %d created and %d failed", response.Created, response.Failed)
+			}
+			if len(response.Results) != 26 {
+				t.Fatalf("Expected 26 results, got %d", len(response.Results))
+			}
+
+			ids := map[int]bool{}
+			for i, result := range response.Results {
+				// line 4 is blank
+				expectedLine := i + 1
+				if i >= 3 {
+					expectedLine++
+				}
+				if result.Line != expectedLine {
+					t.Errorf("Expected result %d to be for line %d, got %d", i, expectedLine, result.Line)
+				}
+
+				if result.Error != "" {
+					continue
+				}
+
+				if ids[result.ID] {
+					t.Errorf("Product ID %d created more than once", result.ID)
+				}
+				ids[result.ID] = true
+
+				product, err := database.GetProductByID(context.Background(), result.ID)
+				if err != nil {
+					t.Errorf("Failed to get imported product %d: %v", result.ID, err)
+				} else if i >= 6 && product.Name != fmt.Sprintf("Imported %d", i-5) {
+					t.Errorf("Expected line %d to create product Imported %d, got %s", result.Line, i-5, product.Name)
+				}
+			}
+
+			for i, expected := range []string{"Validation failed", "Invalid JSON", "SKU already exists"} {
+				if result := response.Results[3+i]; !strings.HasPrefix(result.Error, expected) {
+					t.Errorf("Expected error for line %d to start %q, got %q", result.Line, expected, result.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestImportProductsCSV(t *testing.T) {
+	// line 3 has an invalid price and line 5 (after a blank line) fails
+	// validation; line 6 is quoted over two lines
+	body := "name,price,category,in_stock,quantity,tags,images\n" +
+		"Desk,149.99,Furniture,true,3,wood;large,https://example.com/desk.png\n" +
+		"Lamp,cheap,Furniture,true,1,,\n" +
+		"\n" +
+		"Stool,-1,Furniture,false,0,,\n" +
+		"\"Rug\nRunner\",59,,false,,,\n"
+
+	// importCSV returns the response to an import of the body
+	importCSV := func(t *testing.T, database db.Database, query string) *httptest.ResponseRecorder {
+		t.Helper()
+		router := api.NewHandler(database, nil).SetupRoutes()
+
+		req := httptest.NewRequest("POST", "/api/v1/products/import"+query, strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Lenient", func(t *testing.T) {
+		database := db.NewInMemoryDB()
+		rr := importCSV(t, database, "")
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		var response models.ImportResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if response.Created != 2 || response.Failed != 2 {
+			t.Fatalf("Expected 2 created and 2 failed, got %d created and %d failed", response.Created, response.Failed)
+		}
+
+		for i, expected := range []struct {
+			line  int
+			error string
+		}{
+			{line: 2},
+			{line: 3, error: "Invalid CSV: invalid price: cheap"},
+			{line: 5, error: "Validation failed"},
+			{line: 6},
+		} {
+			result := response.Results[i]
+			if result.Line != expected.line || !strings.HasPrefix(result.Error, expected.error) || (expected.error == "") != (result.ID != 0) {
+				t.Errorf("Expected result %d for line %d with error %q, got %+v", i, expected.line, expected.error, result)
+			}
+		}
+
+		desk, err := database.GetProductByID(context.Background(), response.Results[0].ID)
+		if err != nil {
+			t.Fatalf("Failed to get imported product: %v", err)
+		}
+		if desk.Name != "Desk" || desk.Price != 149.99 || desk.Category != "Furniture" || !desk.InStock || desk.Quantity != 3 ||
+			fmt.Sprint(desk.Tags) != "[wood large]" || fmt.Sprint(desk.Images) != "[https://example.com/desk.png]" {
+			t.Errorf("Unexpected imported product: %+v", desk)
+		}
+
+		rug, err := database.GetProductByID(context.Background(), response.Results[3].ID)
+		if err != nil {
+			t.Fatalf("Failed to get imported product: %v", err)
+		}
+		if rug.Name != "Rug\nRunner" || rug.Price != 59 {
+			t.Errorf("Unexpected imported product: %+v", rug)
+		}
+	})
+
+	t.Run("Strict", func(t *testing.T) {
+		database := db.NewInMemoryDB()
+		rr := importCSV(t, database, "?strict=true")
+
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+		}
+
+		var response models.ErrorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if response.Code != models.CodeInvalidImport {
+			t.Errorf("Expected code %q, got %q", models.CodeInvalidImport, response.Code)
+		}
+		if !strings.HasPrefix(response.Message, "line 3: Invalid CSV: invalid price: cheap; line 5: Validation failed") {
+			t.Errorf("Expected a message identifying lines 3 and 5, got %q", response.Message)
+		}
+
+		if count, _ := database.CountProducts(context.Background()); count != 0 {
+			t.Errorf("Expected no products to be created, got %d", count)
+		}
+	})
+
+	t.Run("Exported products", func(t *testing.T) {
+		source := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil).SetupRoutes()
+		export := httptest.NewRecorder()
+		source.ServeHTTP(export, httptest.NewRequest("GET", "/api/v1/products.csv", nil))
+
+		router := api.NewHandler(db.NewInMemoryDB(), nil).SetupRoutes()
+		req := httptest.NewRequest("POST", "/api/v1/products/import?strict=true", export.Body)
+		req.Header.Set("Content-Type", "text/csv")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		var response models.ImportResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if rr.Code != http.StatusOK || response.Created != 5 {
+			t.Errorf("Expected the 5 exported products to be imported, got %d %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("Invalid header", func(t *testing.T) {
+		for _, body := range []string{"", "name,colour\nDesk,brown\n", "name,name\nDesk,Desk\n"} {
+			req := httptest.NewRequest("POST", "/api/v1/products/import", strings.NewReader(body))
+			req.Header.Set("Content-Type", "text/csv")
+			rr := httptest.NewRecorder()
+
+			api.NewHandler(db.NewInMemoryDB(), nil).SetupRoutes().ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%q: expected status code %d, got %d", body, http.StatusBadRequest, rr.Code)
+			}
+		}
+	})
+
+	t.Run("Invalid strict", func(t *testing.T) {
+		rr := importCSV(t, db.NewInMemoryDB(), "?strict=maybe")
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestImportProductsUniqueNames(t *testing.T) {
+	body := `{"name":"Laptop","price":1}` + "\n" + `{"name":"Tablet","price":1}` + "\n" + `{"name":"tablet","price":1}` + "\n"
+
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil, api.WithUniqueNames(), api.WithImportConcurrency(1)).SetupRoutes()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/api/v1/products/import", strings.NewReader(body)))
+
+	var response models.ImportResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Created != 1 || response.Failed != 2 {
+		t.Fatalf("Expected 1 created and 2 failed, got %d created and %d failed", response.Created, response.Failed)
+	}
+	for _, i := range []int{0, 2} {
+		if result := response.Results[i]; result.Error != "Name already exists" {
+			t.Errorf("Expected error for line %d %q, got %q", result.Line, "Name already exists", result.Error)
+		}
+	}
+}
+
+func BenchmarkImportProducts(b *testing.B) {
+	body := importBody(1000, 0)
+
+	for _, concurrency := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			for range b.N {
+				handler := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil, api.WithImportConcurrency(concurrency))
+
+				rr := httptest.NewRecorder()
+				handler.ImportProducts(rr, httptest.NewRequest("POST", "/api/v1/products/import", strings.NewReader(body)))
+
+				if rr.Code != http.StatusOK {
+					b.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+				}
+			}
+		})
+	}
+}
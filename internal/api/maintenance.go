@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"products-api/internal/models"
+)
+
+// maintenanceRetryAfter is the time after which a client is advised to retry
+// a request rejected in maintenance mode (the Retry-After header)
+const maintenanceRetryAfter = time.Minute
+
+// maintenanceRoute is the route of the maintenance mode of the Handler
+// (relative to apiBasePath); requests to this route are not rejected in
+// maintenance mode, so that maintenance mode can be disabled.  The route is
+// registered only if the administration endpoints are enabled (see
+// WithAdminEndpoints).
+const maintenanceRoute = "/admin/maintenance"
+
+// InMaintenance returns true if the Handler is in maintenance mode (see
+// SetMaintenance)
+func (h *Handler) InMaintenance() bool {
+	return h.maintenance.Load()
+}
+
+// SetMaintenance enables or disables maintenance mode.  In maintenance mode,
+// requests that modify products (POST, PUT, PATCH or DELETE) are rejected
+// with a 503 Service Unavailable response; other requests (e.g. GET and the
+// health checks) are handled as usual.
+func (h *Handler) SetMaintenance(enabled bool) {
+	if h.maintenance.Swap(enabled) != enabled {
+		h.logger.Info("maintenance mode changed", "enabled", enabled)
+	}
+}
+
+// GetMaintenanceMode handles GET /api/v1/admin/maintenance
+func (h *Handler) GetMaintenanceMode(w http.ResponseWriter, r *http.Request) {
+	enabled := h.InMaintenance()
+	h.writeResponse(w, r, http.StatusOK, models.MaintenanceMode{Enabled: &enabled})
+}
+
+// SetMaintenanceMode handles PUT /api/v1/admin/maintenance
+//
+// Enables or disables maintenance mode (see SetMaintenance), e.g.
+// {"enabled": true}.
+func (h *Handler) SetMaintenanceMode(w http.ResponseWriter, r *http.Request) {
+	var req models.MaintenanceMode
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidJSON, cInvalidJSON, err.Error())
+		return
+	}
+
+	if !h.validateRequest(w, r, &req) {
+		return
+	}
+
+	h.SetMaintenance(*req.Enabled)
+	h.writeResponse(w, r, http.StatusOK, req)
+}
+
+// maintenanceMiddleware rejects requests that modify products while the
+// Handler is in maintenance mode, other than requests to the maintenance
+// route
+func (h *Handler) maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.InMaintenance() || !isMutating(r.Method) || r.URL.Path == apiBasePath+maintenanceRoute {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.logger.LogAttrs(r.Context(), slog.LevelInfo, "request rejected in maintenance mode",
+			slog.String("request_id", RequestIDFromContext(r.Context())),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+		)
+
+		w.Header().Set("Retry-After", strconv.Itoa(int(maintenanceRetryAfter.Seconds())))
+		h.writeErrorResponse(w, r, http.StatusServiceUnavailable, models.CodeMaintenance, cMaintenance, "the service is in maintenance mode; try again later")
+	})
+}
@@ -0,0 +1,105 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"products-api/internal/api"
+	"products-api/internal/db"
+	"products-api/internal/models"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	handler := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil, api.WithMaintenance(), api.WithAdminEndpoints())
+	router := handler.SetupRoutes()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newJSONRequest(method, path, strings.NewReader(body)))
+		return rr
+	}
+
+	t.Run("Writes are rejected", func(t *testing.T) {
+		for _, rq := range []struct{ method, path, body string }{
+			{"POST", "/api/v1/products", `{"name":"Desk","price":99}`},
+			{"PUT", "/api/v1/products/1", `{"quantity":1}`},
+			{"PATCH", "/api/v1/products/1", `{"quantity":1}`},
+			{"DELETE", "/api/v1/products/1", ""},
+		} {
+			rr := serve(rq.method, rq.path, rq.body)
+
+			if rr.Code != http.StatusServiceUnavailable {
+				t.Fatalf("%s %s: expected status code %d, got %d: %s", rq.method, rq.path, http.StatusServiceUnavailable, rr.Code, rr.Body.String())
+			}
+			if retryAfter := rr.Header().Get("Retry-After"); retryAfter != "60" {
+				t.Errorf("%s %s: expected Retry-After 60, got %q", rq.method, rq.path, retryAfter)
+			}
+
+			var response models.ErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response.Code != models.CodeMaintenance {
+				t.Errorf("%s %s: expected code %q, got %q", rq.method, rq.path, models.CodeMaintenance, response.Code)
+			}
+		}
+
+		if rr := serve("GET", "/api/v1/products/1", ""); rr.Code != http.StatusOK {
+			t.Errorf("Expected the product to be unchanged (and not deleted), got %d", rr.Code)
+		}
+	})
+
+	t.Run("Reads are allowed", func(t *testing.T) {
+		for _, path := range []string{"/api/v1/products", "/api/v1/products/1", "/health", "/ready"} {
+			if rr := serve("GET", path, ""); rr.Code != http.StatusOK {
+				t.Errorf("GET %s: expected status code %d, got %d", path, http.StatusOK, rr.Code)
+			}
+		}
+	})
+
+	t.Run("Disabled at runtime", func(t *testing.T) {
+		rr := serve("GET", "/api/v1/admin/maintenance", "")
+		if rr.Code != http.StatusOK || strings.TrimSpace(rr.Body.String()) != `{"enabled":true}` {
+			t.Fatalf("Expected maintenance mode to be enabled, got %d %s", rr.Code, rr.Body.String())
+		}
+
+		if rr := serve("PUT", "/api/v1/admin/maintenance", `{"enabled":false}`); rr.Code != http.StatusOK {
+			t.Fatalf("Failed to disable maintenance mode: %d %s", rr.Code, rr.Body.String())
+		}
+		if handler.InMaintenance() {
+			t.Error("Expected maintenance mode to be disabled")
+		}
+		if rr := serve("POST", "/api/v1/products", `{"name":"Desk","price":99}`); rr.Code != http.StatusCreated {
+			t.Errorf("Expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		handler.SetMaintenance(true)
+		if rr := serve("POST", "/api/v1/products", `{"name":"Lamp","price":19}`); rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status code %d, got %d", http.StatusServiceUnavailable, rr.Code)
+		}
+	})
+
+	t.Run("Invalid request", func(t *testing.T) {
+		for _, body := range []string{`{}`, `not json`} {
+			if rr := serve("PUT", "/api/v1/admin/maintenance", body); rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status code %d, got %d", body, http.StatusBadRequest, rr.Code)
+			}
+		}
+	})
+
+	// any client could otherwise put the API into maintenance mode
+	t.Run("Admin endpoints not enabled", func(t *testing.T) {
+		router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil).SetupRoutes()
+
+		for _, method := range []string{"GET", "PUT"} {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newJSONRequest(method, "/api/v1/admin/maintenance", strings.NewReader(`{"enabled":true}`)))
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("%s: expected status code %d, got %d", method, http.StatusNotFound, rr.Code)
+			}
+		}
+	})
+}
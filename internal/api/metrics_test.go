@@ -0,0 +1,61 @@
+package api_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"products-api/internal/api"
+	"products-api/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetrics(t *testing.T) {
+	mockDB := newMockDB()
+	if _, err := mockDB.CreateProduct(context.Background(), models.CreateProductRequest{Name: "Product", Price: 10.0}); err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+
+	reg := prometheus.NewRegistry()
+	handler := api.NewHandler(mockDB, nil, api.WithMetricsRegistry(reg))
+	router := handler.SetupRoutes()
+
+	for _, path := range []string{
+		"/api/v1/products",
+		"/api/v1/products/1",
+		"/api/v1/products/1",
+		"/api/v1/products/999",
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	body, _ := io.ReadAll(rr.Body)
+	scraped := string(body)
+
+	// requests are labelled by route template, not the raw path
+	for _, expected := range []string{
+		`http_requests_total{method="GET",route="/api/v1/products",status="200"} 1`,
+		`http_requests_total{method="GET",route="/api/v1/products/{id:[0-9A-Za-z-]+}",status="200"} 2`,
+		`http_requests_total{method="GET",route="/api/v1/products/{id:[0-9A-Za-z-]+}",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/api/v1/products/{id:[0-9A-Za-z-]+}"} 3`,
+	} {
+		if !strings.Contains(scraped, expected) {
+			t.Errorf("Expected metrics to contain %s", expected)
+		}
+	}
+
+	if strings.Contains(scraped, `route="/api/v1/products/1"`) {
+		t.Error("Expected metrics not to be labelled by raw path")
+	}
+}
@@ -0,0 +1,324 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"products-api/internal/api/ratelimiter"
+	"products-api/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// maxLoggedBody is the maximum number of bytes of a request or response body
+// captured for debug logging
+const maxLoggedBody = 64 << 10
+
+// responseRecorder wraps an http.ResponseWriter to capture the status code
+// and the number of bytes written, for logging.  If body is non-nil, the
+// response body is also captured (up to maxLoggedBody bytes).
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	body   *bytes.Buffer
+}
+
+// WriteHeader records the status code before writing it to the underlying
+// ResponseWriter
+func (rw *responseRecorder) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the number of bytes written; if no status has been written
+// an implicit 200 OK is recorded (consistent with http.ResponseWriter)
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	if rw.body != nil && rw.body.Len() < maxLoggedBody {
+		rw.body.Write(b[:min(n, maxLoggedBody-rw.body.Len())])
+	}
+	return n, err
+}
+
+// Unwrap returns the underlying ResponseWriter, allowing an
+// http.ResponseController to access optional interfaces (e.g. Flusher)
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// remoteIP returns the IP address of the client making a request, removing
+// the port from the request RemoteAddr (if present)
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// isMutating returns true if requests with a specified method modify
+// products
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Middleware
+
+// recoveryMiddleware recovers from a panic in handling a request, logging the
+// panic with the stack trace and responding 500 Internal Server Error (unless
+// the response has already started).  Neither the panic nor the stack trace
+// is included in the response.
+//
+// The middleware is outermost, so the request ID is obtained from the
+// X-Request-ID response header set by requestIDMiddleware.
+func (h *Handler) recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseRecorder{ResponseWriter: w}
+
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// http.ErrAbortHandler aborts the response without logging
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			requestID := w.Header().Get("X-Request-ID")
+			h.logger.Error("panic handling request",
+				"panic", v,
+				"stack", string(debug.Stack()),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"request_id", requestID,
+			)
+
+			if rw.status != 0 {
+				// the response has already started so the error cannot be
+				// reported to the client
+				return
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), requestIDKey, requestID))
+			h.writeResponse(rw, r, http.StatusInternalServerError, models.ErrorResponse{
+				Code:      models.CodeInternalError,
+				Error:     cInternalError,
+				RequestID: requestID,
+			})
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// inFlightMiddleware counts the requests currently being handled (see
+// Handler.InFlight)
+func (h *Handler) inFlightMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.inFlight.Add(1)
+		defer h.inFlight.Add(-1)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *Handler) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseRecorder{ResponseWriter: w}
+		start := h.clock.Now()
+
+		// request and response bodies are only captured when debug logging
+		// is enabled
+		var requestBody []byte
+		debug := h.logger.Enabled(r.Context(), slog.LevelDebug)
+		if debug {
+			rw.body = &bytes.Buffer{}
+			if r.Body != nil {
+				requestBody, _ = io.ReadAll(io.LimitReader(r.Body, maxLoggedBody))
+				r.Body = readCloser{io.MultiReader(bytes.NewReader(requestBody), r.Body), r.Body}
+			}
+		}
+
+		next.ServeHTTP(rw, r)
+
+		// a handler that writes nothing at all results in an implicit 200 OK
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+
+		attrs := []slog.Attr{
+			slog.String("request_id", RequestIDFromContext(r.Context())),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("remote_ip", remoteIP(r)),
+			slog.Int("status", rw.status),
+			slog.Int("bytes", rw.bytes),
+			slog.Float64("duration_ms", float64(h.clock.Since(start))/float64(time.Millisecond)),
+		}
+
+		switch {
+		case isMutating(r.Method):
+			// requests that modify products are logged regardless of the
+			// level of the logger, by handling the record directly
+			record := slog.NewRecord(h.clock.Now(), slog.LevelInfo, "request", 0)
+			record.AddAttrs(attrs...)
+			_ = h.logger.Handler().Handle(r.Context(), record)
+
+		case h.quietPaths[r.URL.Path]:
+			h.logger.LogAttrs(r.Context(), slog.LevelDebug, "request", attrs...)
+
+		default:
+			h.logger.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+		}
+
+		if debug {
+			h.logger.LogAttrs(r.Context(), slog.LevelDebug, "request bodies",
+				slog.String("request_id", RequestIDFromContext(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Any("request_body", h.redactBody(requestBody)),
+				slog.Any("response_body", h.redactBody(rw.body.Bytes())),
+			)
+		}
+	})
+}
+
+// timeoutMiddleware sets a deadline on the context of each request, if the
+// Handler is configured with a request timeout (see WithRequestTimeout)
+func (h *Handler) timeoutMiddleware(next http.Handler) http.Handler {
+	if h.requestTimeout <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := h.clock.ContextWithTimeout(r.Context(), h.requestTimeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// readCloser combines a Reader with the Closer of an original request body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// corsMiddleware adds CORS headers to each response and responds to OPTIONS
+// (preflight) requests.  The methods allowed are those for which the path of
+// the request is routed by the router (in both the Allow header and, for
+// preflight, the Access-Control-Allow-Methods header).
+func (h *Handler) corsMiddleware(router *mux.Router) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+			if r.Method == "OPTIONS" {
+				methods := strings.Join(allowedMethods(router, r), ", ")
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				w.Header().Set("Allow", methods)
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// defaultWriteCost is the number of requests that a request modifying
+// products counts as, if the rate limiter is a WeightedRateLimiter and the
+// cost is not configured (see WithWriteCost)
+const defaultWriteCost = 5
+
+func (h *Handler) ratelimiterMiddleware(next http.Handler) http.Handler {
+	reporter, _ := h.rateLimiter.(RateLimitReporter)
+	burst, _ := h.rateLimiter.(BurstReporter)
+	if !h.rateLimitHeaders {
+		reporter, burst = nil, nil
+	}
+	if burst != nil && burst.Burst() == 0 {
+		burst = nil
+	}
+	weighted, _ := h.rateLimiter.(WeightedRateLimiter)
+	retry, _ := h.rateLimiter.(RetryAfterReporter)
+
+	// a write costing more than a client is allowed in total would never be
+	// allowed, so the cost is capped at the limit (plus any burst allowance)
+	writeCost := h.writeCost
+	if limits, ok := h.rateLimiter.(RateLimitReporter); ok && limits.Limit() != ratelimiter.Unlimited {
+		allowance := limits.Limit()
+		if burst, ok := h.rateLimiter.(BurstReporter); ok {
+			allowance += burst.Burst()
+		}
+		writeCost = min(writeCost, allowance)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var allowed bool
+		cost := 1
+		if weighted != nil && isMutating(r.Method) {
+			cost = writeCost
+			allowed = weighted.AllowN(r, cost)
+		} else {
+			allowed = h.rateLimiter.Allow(r)
+		}
+
+		if reporter != nil {
+			if limit, remaining := reporter.Limit(), reporter.Remaining(r); limit != ratelimiter.Unlimited && remaining != ratelimiter.Unlimited {
+				w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			}
+		}
+		if burst != nil {
+			if used := burst.BurstUsed(r); used != ratelimiter.Unlimited {
+				w.Header().Set("X-RateLimit-Burst-Used", strconv.Itoa(used))
+			}
+		}
+
+		if !allowed {
+			h.logger.LogAttrs(r.Context(), slog.LevelWarn, "rate limit exceeded",
+				slog.String("request_id", RequestIDFromContext(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("remote_ip", remoteIP(r)),
+			)
+
+			response := models.ErrorResponse{
+				Code:      models.CodeRateLimited,
+				Error:     cRateLimited,
+				RequestID: RequestIDFromContext(r.Context()),
+			}
+			if retry != nil {
+				// a whole number of seconds, rounded up; at least 1 since the
+				// request has just been denied
+				response.RetryAfterSeconds = max(1, int(math.Ceil(retry.RetryAfter(r, cost).Seconds())))
+				w.Header().Set("Retry-After", strconv.Itoa(response.RetryAfterSeconds))
+			}
+			h.writeResponse(w, r, http.StatusTooManyRequests, response)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
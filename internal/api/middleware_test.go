@@ -0,0 +1,305 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"products-api/internal/api"
+	"products-api/internal/db"
+	"products-api/internal/models"
+)
+
+// requestLog represents the structured log entry emitted by the logging
+// middleware for each request
+type requestLog struct {
+	Msg        string  `json:"msg"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	RemoteIP   string  `json:"remote_ip"`
+	Status     int     `json:"status"`
+	Bytes      int     `json:"bytes"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	mockDB := newMockDB()
+	if _, err := mockDB.CreateProduct(context.Background(), models.CreateProductRequest{Name: "Product", Price: 10.0}); err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{name: "OK", method: "GET", path: "/api/v1/products/1"},
+		{name: "Not found", method: "GET", path: "/api/v1/products/999"},
+		{name: "Created", method: "POST", path: "/api/v1/products", body: `{"name":"New","price":1}`},
+		{name: "Bad request", method: "POST", path: "/api/v1/products", body: `invalid json`},
+		{name: "No content", method: "DELETE", path: "/api/v1/products/1"},
+		{name: "Route not matched", method: "GET", path: "/nope"},
+		{name: "Method not allowed", method: "PUT", path: "/api/v1/products"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			logger := slog.New(slog.NewJSONHandler(buf, nil))
+			handler := api.NewHandler(mockDB, nil, api.WithLogger(logger))
+			router := handler.SetupRoutes()
+
+			req := newJSONRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.RemoteAddr = "192.0.2.1:1234"
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if len(lines) != 1 {
+				t.Fatalf("Expected 1 log line, got %d: %s", len(lines), buf.String())
+			}
+
+			var entry requestLog
+			if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+				t.Fatalf("Failed to unmarshal log entry: %v", err)
+			}
+
+			if entry.Status != rr.Code {
+				t.Errorf("Expected logged status %d, got %d", rr.Code, entry.Status)
+			}
+			if entry.Bytes != rr.Body.Len() {
+				t.Errorf("Expected logged bytes %d, got %d", rr.Body.Len(), entry.Bytes)
+			}
+			if entry.Method != tt.method {
+				t.Errorf("Expected logged method %s, got %s", tt.method, entry.Method)
+			}
+			if entry.Path != tt.path {
+				t.Errorf("Expected logged path %s, got %s", tt.path, entry.Path)
+			}
+			if entry.RemoteIP != "192.0.2.1" {
+				t.Errorf("Expected logged remote_ip 192.0.2.1, got %s", entry.RemoteIP)
+			}
+			if entry.DurationMs < 0 {
+				t.Errorf("Expected non-negative duration, got %f", entry.DurationMs)
+			}
+		})
+	}
+}
+
+func TestLoggingMiddlewareLevels(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    slog.Level
+		opts     []api.Option
+		method   string
+		path     string
+		body     string
+		expected int
+	}{
+		{name: "Health check at default level", level: slog.LevelInfo, method: "GET", path: "/health", expected: 0},
+		{name: "Readiness check at default level", level: slog.LevelInfo, method: "GET", path: "/ready", expected: 0},
+		{name: "Health check at debug level", level: slog.LevelDebug, method: "GET", path: "/health", expected: 1},
+		{name: "Other paths at default level", level: slog.LevelInfo, method: "GET", path: "/api/v1/products", expected: 1},
+		{name: "Configured quiet paths", level: slog.LevelInfo, opts: []api.Option{api.WithQuietPaths("/api/v1/products")}, method: "GET", path: "/health", expected: 1},
+		{name: "Read at warn level", level: slog.LevelWarn, method: "GET", path: "/api/v1/products", expected: 0},
+		{name: "Mutation at warn level", level: slog.LevelWarn, method: "POST", path: "/api/v1/products", body: `{"name":"New","price":1}`, expected: 1},
+		{name: "Mutation to quiet path", level: slog.LevelInfo, opts: []api.Option{api.WithQuietPaths("/api/v1/products")}, method: "POST", path: "/api/v1/products", body: `{"name":"New","price":1}`, expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: tt.level}))
+			opts := append([]api.Option{api.WithLogger(logger)}, tt.opts...)
+			router := api.NewHandler(newMockDB(), nil, opts...).SetupRoutes()
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newJSONRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			var requests int
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				var entry requestLog
+				if json.Unmarshal([]byte(line), &entry) == nil && entry.Msg == "request" {
+					requests++
+				}
+			}
+			if requests != tt.expected {
+				t.Errorf("Expected %d request log entries, got %d: %s", tt.expected, requests, buf.String())
+			}
+		})
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	mockDB := newMockDB()
+	handler := api.NewHandler(mockDB, nil)
+	router := handler.SetupRoutes()
+
+	// the in-flight count is captured while a request is being handled
+	var inFlight int
+	router.HandleFunc("/in-flight", func(w http.ResponseWriter, r *http.Request) {
+		inFlight = handler.InFlight()
+	})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/in-flight", nil))
+
+	if inFlight != 1 {
+		t.Errorf("Expected 1 request in flight while handling, got %d", inFlight)
+	}
+	if n := handler.InFlight(); n != 0 {
+		t.Errorf("Expected 0 requests in flight after handling, got %d", n)
+	}
+}
+
+// slowDB is a database that takes (up to) a specified delay to get a
+// product, returning early with the context error if the context is done
+type slowDB struct {
+	*db.InMemoryDB
+	delay time.Duration
+}
+
+func (s slowDB) GetProductByID(ctx context.Context, id int) (*models.Product, error) {
+	select {
+	case <-time.After(s.delay):
+		return s.InMemoryDB.GetProductByID(ctx, id)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           []api.Option
+		delay          time.Duration
+		expectedStatus int
+	}{
+		{name: "No timeout", delay: 20 * time.Millisecond, expectedStatus: http.StatusOK},
+		{name: "Within timeout", opts: []api.Option{api.WithRequestTimeout(time.Second)}, delay: 0, expectedStatus: http.StatusOK},
+		{name: "Exceeding timeout", opts: []api.Option{api.WithRequestTimeout(10 * time.Millisecond)}, delay: 5 * time.Second, expectedStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := api.NewHandler(slowDB{db.NewInMemoryDB(db.WithSampleData()), tt.delay}, nil, tt.opts...).SetupRoutes()
+
+			rr := httptest.NewRecorder()
+			start := time.Now()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/1", nil))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+
+			if tt.expectedStatus == http.StatusServiceUnavailable {
+				var response models.ErrorResponse
+				if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if response.Error != "Request timed out" {
+					t.Errorf("Expected error %q, got %q", "Request timed out", response.Error)
+				}
+				if response.Code != models.CodeRequestTimeout {
+					t.Errorf("Expected code %q, got %q", models.CodeRequestTimeout, response.Code)
+				}
+				if elapsed := time.Since(start); elapsed > time.Second {
+					t.Errorf("Expected request to time out promptly, took %s", elapsed)
+				}
+			}
+		})
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, nil))
+	router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil, api.WithLogger(logger)).SetupRoutes()
+
+	router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["boom"]++ // assignment to entry in nil map
+	})
+	router.HandleFunc("/panic-after-write", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		panic("too late")
+	})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/panic", nil)
+	req.Header.Set("X-Request-ID", "panic-request")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusInternalServerError, resp.StatusCode, body)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %s", contentType)
+	}
+
+	var response models.ErrorResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Code != models.CodeInternalError || response.RequestID != "panic-request" || response.Message != "" {
+		t.Errorf("Expected %s with the request ID and no details, got %+v", models.CodeInternalError, response)
+	}
+	if strings.Contains(string(body), "nil map") || strings.Contains(string(body), "goroutine") {
+		t.Errorf("Expected the panic not to be included in the response, got %s", body)
+	}
+
+	var entry struct {
+		Msg       string `json:"msg"`
+		Panic     string `json:"panic"`
+		Stack     string `json:"stack"`
+		RequestID string `json:"request_id"`
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if json.Unmarshal([]byte(line), &entry) == nil && entry.Msg == "panic handling request" {
+			break
+		}
+	}
+	if !strings.Contains(entry.Panic, "nil map") || !strings.Contains(entry.Stack, "goroutine") || entry.RequestID != "panic-request" {
+		t.Errorf("Expected the panic to be logged with the stack and request ID, got %s", buf.String())
+	}
+
+	t.Run("Response already started", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/panic-after-write")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusAccepted {
+			t.Errorf("Expected status code %d, got %d", http.StatusAccepted, resp.StatusCode)
+		}
+	})
+
+	t.Run("Server stays up", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/api/v1/products/1")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"cmp"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// jsonMediaRanges are the media ranges of the Accept header of a request
+// accepting JSON
+var jsonMediaRanges = []string{"application/json", "application/*", "*/*"}
+
+// prefersXML returns true if the Accept header of a request prefers XML
+// (application/xml or text/xml) to JSON.  A request with no Accept header,
+// or accepting neither, is served JSON; where both are equally preferred,
+// JSON is also preferred.
+func prefersXML(r *http.Request) bool {
+	return acceptQuality(r, "application/xml", "text/xml") > acceptQuality(r, jsonMediaRanges...)
+}
+
+// prefersNDJSON returns true if the Accept header of a request prefers
+// newline-delimited JSON (application/x-ndjson) to JSON.  As for XML (see
+// prefersXML), JSON is preferred where both are equally preferred.
+func prefersNDJSON(r *http.Request) bool {
+	return acceptQuality(r, "application/x-ndjson") > acceptQuality(r, jsonMediaRanges...)
+}
+
+// acceptQuality returns the highest quality of the media ranges of the Accept
+// header of a request that are any of the specified media ranges, or zero if
+// there are none
+func acceptQuality(r *http.Request, mediaRanges ...string) float64 {
+	var quality float64
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil {
+				continue
+			}
+
+			q := 1.0
+			if s, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(s, 64); err != nil {
+					continue
+				}
+			}
+
+			if slices.Contains(mediaRanges, mediaType) {
+				quality = max(quality, q)
+			}
+		}
+	}
+	return quality
+}
+
+// prefersPrettyJSON returns true if a request asks for indented JSON, with a
+// true pretty query parameter (e.g. ?pretty=true); an invalid value is false
+func prefersPrettyJSON(r *http.Request) bool {
+	pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty"))
+	return pretty
+}
+
+// hasContentType returns true if the Content-Type header of a request is one
+// of the specified media types, ignoring any parameters (e.g. a charset)
+func hasContentType(r *http.Request, mediaTypes ...string) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && slices.Contains(mediaTypes, mediaType)
+}
+
+// acceptedLanguages returns the language ranges (e.g. "fr-CH" or "fr") of
+// the Accept-Language header of a request, most preferred first; ranges that
+// are equally preferred are in the order of the header.  Ranges with a
+// quality of zero (not acceptable) and the wildcard range are omitted.
+func acceptedLanguages(r *http.Request) []string {
+	type languageRange struct {
+		language string
+		q        float64
+	}
+
+	var ranges []languageRange
+	for _, accept := range r.Header.Values("Accept-Language") {
+		for _, s := range strings.Split(accept, ",") {
+			language, params, _ := strings.Cut(s, ";")
+			language = strings.TrimSpace(language)
+
+			q := 1.0
+			if s, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				var err error
+				if q, err = strconv.ParseFloat(s, 64); err != nil {
+					continue
+				}
+			}
+
+			if language != "" && language != "*" && q > 0 {
+				ranges = append(ranges, languageRange{language: language, q: q})
+			}
+		}
+	}
+
+	slices.SortStableFunc(ranges, func(a, b languageRange) int {
+		return cmp.Compare(b.q, a.q)
+	})
+
+	languages := make([]string, len(ranges))
+	for i, lr := range ranges {
+		languages[i] = lr.language
+	}
+	return languages
+}
@@ -0,0 +1,267 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"products-api/internal/api"
+	"products-api/internal/db"
+	"products-api/internal/models"
+)
+
+func TestRequestContentType(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		contentType    string
+		expectedStatus int
+	}{
+		{name: "Missing content type", method: "POST", path: "/api/v1/products", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "Wrong content type", method: "POST", path: "/api/v1/products", contentType: "text/plain", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "Invalid content type", method: "POST", path: "/api/v1/products", contentType: "application/json; charset", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "JSON", method: "POST", path: "/api/v1/products", contentType: "application/json", expectedStatus: http.StatusCreated},
+		{name: "JSON with charset", method: "POST", path: "/api/v1/products", contentType: "application/json; charset=utf-8", expectedStatus: http.StatusCreated},
+		{name: "Update with wrong content type", method: "PUT", path: "/api/v1/products/1", contentType: "text/plain", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "Update with JSON with charset", method: "PUT", path: "/api/v1/products/1", contentType: "Application/JSON; charset=UTF-8", expectedStatus: http.StatusOK},
+		{name: "Update with merge patch", method: "PUT", path: "/api/v1/products/1", contentType: "application/merge-patch+json", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "Patch with missing content type", method: "PATCH", path: "/api/v1/products/1", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "Patch with merge patch", method: "PATCH", path: "/api/v1/products/1", contentType: "application/merge-patch+json", expectedStatus: http.StatusOK},
+		{name: "Upsert with wrong content type", method: "PUT", path: "/api/v1/products/sku/NEW-001", contentType: "text/plain", expectedStatus: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := api.NewHandler(db.NewInMemoryDB(db.WithSampleData()), nil).SetupRoutes()
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"name":"Product","price":1}`))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusUnsupportedMediaType {
+				return
+			}
+
+			var response models.ErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response.Code != models.CodeUnsupportedMedia {
+				t.Errorf("Expected code %q, got %q", models.CodeUnsupportedMedia, response.Code)
+			}
+		})
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	mockDB := newMockDB()
+	if _, err := mockDB.CreateProduct(context.Background(), models.CreateProductRequest{Name: "Product", Price: 10.0, Tags: []string{"a", "b"}}); err != nil {
+		t.Fatalf("Failed to create test product: %v", err)
+	}
+	router := api.NewHandler(mockDB, nil).SetupRoutes()
+
+	tests := []struct {
+		name        string
+		accept      string
+		expectedXML bool
+	}{
+		{name: "No Accept header"},
+		{name: "JSON", accept: "application/json"},
+		{name: "XML", accept: "application/xml", expectedXML: true},
+		{name: "Text XML", accept: "text/xml", expectedXML: true},
+		{name: "XML preferred", accept: "application/json;q=0.5, application/xml", expectedXML: true},
+		{name: "JSON preferred", accept: "application/xml;q=0.5, application/json"},
+		{name: "Equally preferred", accept: "application/xml, application/json"},
+		{name: "Any", accept: "*/*"},
+		{name: "Unsupported", accept: "text/html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/products/1", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+			}
+
+			var (
+				product models.Product
+				err     error
+			)
+			contentType := rr.Header().Get("Content-Type")
+			if tt.expectedXML {
+				if contentType != "application/xml" {
+					t.Errorf("Expected Content-Type application/xml, got %s", contentType)
+				}
+				err = xml.Unmarshal(rr.Body.Bytes(), &product)
+			} else {
+				if contentType != "application/json" {
+					t.Errorf("Expected Content-Type application/json, got %s", contentType)
+				}
+				err = json.Unmarshal(rr.Body.Bytes(), &product)
+			}
+			if err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if product.ID != 1 || product.Name != "Product" || product.Price != 10.0 || strings.Join(product.Tags, ",") != "a,b" {
+				t.Errorf("Unexpected product: %+v", product)
+			}
+		})
+	}
+
+	t.Run("XML listing", func(t *testing.T) {
+		router := api.NewHandler(mockDB, nil, api.WithEmptyResultHints()).SetupRoutes()
+
+		req := httptest.NewRequest("GET", "/api/v1/products?category=none", nil)
+		req.Header.Set("Accept", "application/xml")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		var response struct {
+			Total   int `xml:"total"`
+			Filters []struct {
+				Param string `xml:"param,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"applied_filters>filter"`
+		}
+		if err := xml.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+
+		if response.Total != 0 || len(response.Filters) != 1 || response.Filters[0].Param != "category" || response.Filters[0].Value != "none" {
+			t.Errorf("Unexpected response: %s", rr.Body.String())
+		}
+	})
+
+	t.Run("XML error", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/v1/products/999", nil)
+		req.Header.Set("Accept", "application/xml")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		var response models.ErrorResponse
+		if err := xml.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+
+		if rr.Code != http.StatusNotFound || response.Error != "Product not found" {
+			t.Errorf("Expected status code %d with error %q, got %d with %q", http.StatusNotFound, "Product not found", rr.Code, response.Error)
+		}
+	})
+	t.Run("Pretty JSON", func(t *testing.T) {
+		for _, tt := range []struct {
+			query          string
+			expectedPretty bool
+		}{
+			{query: ""},
+			{query: "?pretty=false"},
+			{query: "?pretty=invalid"},
+			{query: "?pretty=true", expectedPretty: true},
+		} {
+			req := httptest.NewRequest("GET", "/api/v1/products/1"+tt.query, nil)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			body := rr.Body.String()
+			if pretty := strings.Contains(body, "{\n  \"id\": 1,\n"); pretty != tt.expectedPretty {
+				t.Errorf("%q: expected pretty %v, got %s", tt.query, tt.expectedPretty, body)
+			}
+			if !tt.expectedPretty && strings.Count(body, "\n") != 1 {
+				t.Errorf("%q: expected compact JSON, got %s", tt.query, body)
+			}
+
+			var product models.Product
+			if err := json.Unmarshal(rr.Body.Bytes(), &product); err != nil || product.ID != 1 {
+				t.Errorf("%q: expected product 1, got %s (error: %v)", tt.query, body, err)
+			}
+		}
+	})
+}
+
+func TestLocalizedValidation(t *testing.T) {
+	router := api.NewHandler(newMockDB(), nil).SetupRoutes()
+
+	const (
+		english = "Field validation for 'CreateProductRequest.Name' failed on the 'required' tag"
+		french  = "Name est un champ obligatoire"
+	)
+
+	tests := []struct {
+		name            string
+		acceptLanguage  string
+		expectedMessage string
+	}{
+		{name: "No Accept-Language header", expectedMessage: english},
+		{name: "French", acceptLanguage: "fr", expectedMessage: french},
+		{name: "Regional French", acceptLanguage: "fr-CH", expectedMessage: french},
+		{name: "French preferred", acceptLanguage: "en;q=0.5, fr", expectedMessage: french},
+		{name: "English preferred", acceptLanguage: "en, fr;q=0.5", expectedMessage: english},
+		{name: "German", acceptLanguage: "de", expectedMessage: "Name ist ein Pflichtfeld"},
+		{name: "Unsupported", acceptLanguage: "ja", expectedMessage: english},
+		{name: "Unsupported then French", acceptLanguage: "ja, fr;q=0.8", expectedMessage: french},
+		{name: "French not acceptable", acceptLanguage: "fr;q=0", expectedMessage: english},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newJSONRequest("POST", "/api/v1/products", strings.NewReader(`{"price":1}`))
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			var response models.ErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if rr.Code != http.StatusBadRequest || response.Code != models.CodeValidationFailed {
+				t.Fatalf("Expected status code %d with code %s, got %d: %s", http.StatusBadRequest, models.CodeValidationFailed, rr.Code, rr.Body.String())
+			}
+			if response.Message != tt.expectedMessage {
+				t.Errorf("Expected message %q, got %q", tt.expectedMessage, response.Message)
+			}
+		})
+	}
+
+	t.Run("Custom validation", func(t *testing.T) {
+		req := newJSONRequest("POST", "/api/v1/products", strings.NewReader(`{"name":"Product","price":1,"sku":"123"}`))
+		req.Header.Set("Accept-Language", "fr")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		var response models.ErrorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+
+		if expected := "SKU doit être un SKU valide"; response.Message != expected {
+			t.Errorf("Expected message %q, got %q", expected, response.Message)
+		}
+	})
+}
@@ -0,0 +1,732 @@
+package api
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+
+	"products-api/internal/models"
+)
+
+// The types below describe the subset of an OpenAPI 3.0 document used to
+// describe the API
+
+type openAPIDocument struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       openAPIInfo                `json:"info"`
+	Paths      map[string]openAPIPathItem `json:"paths"`
+	Components openAPIComponents          `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// openAPIPathItem maps (lowercase) HTTP methods to the operations for a path
+type openAPIPathItem map[string]*openAPIOperation
+
+type openAPIOperation struct {
+	Summary     string                     `json:"summary"`
+	OperationID string                     `json:"operationId"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*openAPISchema `json:"schemas"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	MinLength            *int                      `json:"minLength,omitempty"`
+	MaxLength            *int                      `json:"maxLength,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	OneOf                []*openAPISchema          `json:"oneOf,omitempty"`
+}
+
+// schema constructors
+
+func schemaRef(name string) *openAPISchema {
+	return &openAPISchema{Ref: "#/components/schemas/" + name}
+}
+
+func schemaArray(items *openAPISchema) *openAPISchema {
+	return &openAPISchema{Type: "array", Items: items}
+}
+
+func schemaOf(typ, format string) *openAPISchema {
+	return &openAPISchema{Type: typ, Format: format}
+}
+
+func schemaObject(required []string, properties map[string]*openAPISchema) *openAPISchema {
+	return &openAPISchema{Type: "object", Required: required, Properties: properties}
+}
+
+// response constructors
+
+func responseContent(schema *openAPISchema) map[string]openAPIMediaType {
+	return map[string]openAPIMediaType{
+		"application/json": {Schema: schema},
+		"application/xml":  {Schema: schema},
+	}
+}
+
+func schemaResponse(description, schema string) openAPIResponse {
+	return openAPIResponse{Description: description, Content: responseContent(schemaRef(schema))}
+}
+
+func errorResponse(description string) openAPIResponse {
+	return schemaResponse(description, "ErrorResponse")
+}
+
+func jsonRequestBody(schema string) *openAPIRequestBody {
+	return &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{
+		"application/json": {Schema: schemaRef(schema)},
+	}}
+}
+
+// parameter constructors
+
+func queryParameter(name, description string, schema *openAPISchema) openAPIParameter {
+	return openAPIParameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func pathParameter(name, description string, schema *openAPISchema) openAPIParameter {
+	return openAPIParameter{Name: name, In: "path", Description: description, Required: true, Schema: schema}
+}
+
+// filterParameters describes the query parameters applying filters to a
+// product listing (see productFiltersFromQuery)
+func filterParameters() []openAPIParameter {
+	return []openAPIParameter{
+		queryParameter("match", "Whether products must match all (default) or any of the filters", &openAPISchema{Type: "string", Enum: []string{"all", "any"}}),
+		queryParameter("in_stock", "Products that are (or are not) in stock, with a quantity greater than zero", schemaOf("boolean", "")),
+		queryParameter("min_quantity", "Products with a quantity at or above a value; a value greater than zero contradicts in_stock=false", schemaOf("integer", "")),
+		queryParameter("has_description", "Products that have (or do not have) a description that is not empty or whitespace", schemaOf("boolean", "")),
+		queryParameter("category", "Products in a category (case-insensitive)", schemaOf("string", "")),
+		queryParameter("exclude_category", "Products not in a category (case-insensitive); repeat to exclude several categories.  category!= is equivalent (e.g. category!=Furniture)", schemaArray(schemaOf("string", ""))),
+		queryParameter("tag", "Products with a tag (case-insensitive); repeat for products with all of several tags", schemaArray(schemaOf("string", ""))),
+		queryParameter("q", "Products with a name or description containing a search term (case-insensitive)", schemaOf("string", "")),
+		queryParameter("name", "Products with a name containing a substring (case-insensitive)", schemaOf("string", "")),
+		queryParameter("price", "Products priced at a value (to within half a cent); takes precedence over price_min and price_max", schemaOf("number", "double")),
+		queryParameter("price_min", "Products priced at or above a value", schemaOf("number", "double")),
+		queryParameter("price_max", "Products priced at or below a value", schemaOf("number", "double")),
+		queryParameter("created_after", "Products created after a time (RFC 3339)", schemaOf("string", "date-time")),
+		queryParameter("created_before", "Products created before a time (RFC 3339)", schemaOf("string", "date-time")),
+		queryParameter("updated_after", "Products last updated after a time (RFC 3339)", schemaOf("string", "date-time")),
+		queryParameter("updated_before", "Products last updated before a time (RFC 3339)", schemaOf("string", "date-time")),
+		queryParameter("new_within", "Products created within a number of days (e.g. 7d) or a duration (e.g. 36h) of the current time, sorted newest first unless a sort is specified", schemaOf("string", "")),
+		queryParameter("modified_since", "Products updated at or after a time (RFC 3339), sorted by updated_at unless a sort is specified", schemaOf("string", "date-time")),
+	}
+}
+
+// openAPISpec returns the OpenAPI document describing the API.  The
+// document is built by hand and must be maintained alongside SetupRoutes;
+// paths use the OpenAPI form of the route templates (without patterns).
+// The administration endpoints are described only if routed (admin).
+func openAPISpec(admin bool) openAPIDocument {
+	var (
+		zero = 0.0
+		one  = 1.0
+
+		minName, maxName = minNameLength, maxNameLength
+
+		id    = pathParameter("id", "Product ID", schemaOf("integer", "int64"))
+		idSku = pathParameter("id", "Product ID (numeric) or SKU (alphanumeric with dashes)", schemaOf("string", ""))
+		sku   = pathParameter("sku", "Product SKU (alphanumeric with dashes)", schemaOf("string", ""))
+
+		fields = queryParameter("fields", "Comma-separated list of the fields of products to return (default: all fields)", schemaOf("string", ""))
+	)
+
+	listingParameters := append([]openAPIParameter{
+		queryParameter("page", "Page number (default: 1)", &openAPISchema{Type: "integer", Minimum: &one}),
+		queryParameter("page_size", "Number of products per page (default: 10 and max: 100, unless configured); a larger page_size is reduced to the maximum", &openAPISchema{Type: "integer", Minimum: &one}),
+		queryParameter("sort", "Comma-separated list of fields to sort by, each optionally followed by :asc or :desc", schemaOf("string", "")),
+		fields,
+		queryParameter("ids", "Comma-separated list of the IDs of products to return (in the order listed) instead of a page of products; cannot be combined with filters", schemaOf("string", "")),
+	}, filterParameters()...)
+
+	randomParameters := append([]openAPIParameter{
+		queryParameter("count", "Number of products to sample (default: 1)", &openAPISchema{Type: "integer", Minimum: &one}),
+	}, filterParameters()...)
+
+	lowStockParameters := append([]openAPIParameter{
+		queryParameter("threshold", "Maximum quantity of the products reported (default: 10)", &openAPISchema{Type: "integer", Minimum: &zero}),
+	}, filterParameters()...)
+
+	productProperties := func() map[string]*openAPISchema {
+		return map[string]*openAPISchema{
+			"sku":         schemaOf("string", ""),
+			"name":        {Type: "string", MinLength: &minName, MaxLength: &maxName},
+			"description": schemaOf("string", ""),
+			"price":       {Type: "number", Format: "double", Minimum: &zero},
+			"currency":    schemaOf("string", "iso4217"),
+			"category":    schemaOf("string", ""),
+			"in_stock":    schemaOf("boolean", ""),
+			"quantity":    {Type: "integer", Minimum: &zero},
+			"tags":        schemaArray(schemaOf("string", "")),
+			"images":      schemaArray(schemaOf("string", "uri")),
+		}
+	}
+
+	product := schemaObject([]string{"id", "name", "price"}, productProperties())
+	product.Properties["id"] = schemaOf("integer", "int64")
+	product.Properties["created_at"] = schemaOf("string", "date-time")
+	product.Properties["updated_at"] = schemaOf("string", "date-time")
+
+	doc := openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: "Products API", Version: "1.0.0"},
+		Paths: map[string]openAPIPathItem{
+			"/api/v1/products": {
+				"get": {
+					Summary:     "List products (paginated)",
+					OperationID: "getProducts",
+					Parameters:  listingParameters,
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "A page of products (or, if ids are specified, the products with those IDs)", Content: responseContent(&openAPISchema{OneOf: []*openAPISchema{schemaRef("PaginatedResponse"), schemaRef("ProductsByIDsResponse")}})},
+						"400": errorResponse("Invalid query string"),
+					},
+				},
+				"post": {
+					Summary:     "Create a product",
+					OperationID: "createProduct",
+					RequestBody: jsonRequestBody("CreateProductRequest"),
+					Responses: map[string]openAPIResponse{
+						"201": schemaResponse("The created product, the path of which is given by the Location header", "Product"),
+						"400": errorResponse("Invalid JSON or validation failed"),
+						"409": errorResponse("SKU already exists, or name already exists (if names must be unique)"),
+						"415": errorResponse("Content-Type is not application/json"),
+						"422": errorResponse("Too many categories"),
+						"507": errorResponse("Catalog is at capacity (if a maximum number of products is set)"),
+					},
+				},
+			},
+			"/api/v1/products/random": {
+				"get": {
+					Summary:     "Get a random sample of products",
+					OperationID: "getRandomProducts",
+					Parameters:  randomParameters,
+					Responses: map[string]openAPIResponse{
+						"200": schemaResponse("A sample of products", "ProductListResponse"),
+						"400": errorResponse("Invalid query string"),
+					},
+				},
+			},
+			"/api/v1/products/low-stock": {
+				"get": {
+					Summary:     "List products low on stock (ordered by quantity)",
+					OperationID: "getLowStockProducts",
+					Parameters:  lowStockParameters,
+					Responses: map[string]openAPIResponse{
+						"200": schemaResponse("Products with a quantity at or below the threshold", "ProductListResponse"),
+						"400": errorResponse("Invalid query string"),
+					},
+				},
+			},
+			"/api/v1/products/count": {
+				"get": {
+					Summary:     "Count products",
+					OperationID: "countProducts",
+					Parameters:  filterParameters(),
+					Responses: map[string]openAPIResponse{
+						"200": schemaResponse("The number of products matching any filters", "CountResponse"),
+						"400": errorResponse("Invalid query string"),
+					},
+				},
+			},
+			"/api/v1/products/stats": {
+				"get": {
+					Summary:     "Get price statistics of products in each category",
+					OperationID: "getPriceStats",
+					Parameters:  filterParameters(),
+					Responses: map[string]openAPIResponse{
+						"200": schemaResponse("The number of products, and their minimum, maximum and average price, in each category with products matching any filters", "PriceStatsResponse"),
+						"400": errorResponse("Invalid query string"),
+					},
+				},
+			},
+			"/api/v1/products/grouped": {
+				"get": {
+					Summary:     "Get the products matching any filters grouped by category",
+					OperationID: "getGroupedProducts",
+					Parameters:  filterParameters(),
+					Responses: map[string]openAPIResponse{
+						"200": schemaResponse("The products in each category, ordered by ID; products without a category are grouped as "+models.UncategorizedGroup, "GroupedProducts"),
+						"400": errorResponse("Invalid query string"),
+					},
+				},
+			},
+			"/api/v1/products/export": {
+				"get": {
+					Summary:     "Export products as newline-delimited JSON",
+					OperationID: "exportProducts",
+					Parameters:  filterParameters(),
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "Products, one per line", Content: map[string]openAPIMediaType{
+							"application/x-ndjson": {Schema: schemaRef("Product")},
+						}},
+						"400": errorResponse("Invalid query string"),
+					},
+				},
+			},
+			"/api/v1/products/stream": {
+				"get": {
+					Summary:     "Stream products as a JSON array or newline-delimited JSON",
+					OperationID: "streamProducts",
+					Parameters:  filterParameters(),
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "Products, as a JSON array or (if preferred by the Accept header) one per line", Content: map[string]openAPIMediaType{
+							"application/json":     {Schema: schemaArray(schemaRef("Product"))},
+							"application/x-ndjson": {Schema: schemaRef("Product")},
+						}},
+						"400": errorResponse("Invalid query string"),
+					},
+				},
+			},
+			"/api/v1/products.csv": {
+				"get": {
+					Summary:     "Export products as CSV",
+					OperationID: "exportProductsCSV",
+					Parameters:  filterParameters(),
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "Products, with a header row", Content: map[string]openAPIMediaType{
+							"text/csv": {Schema: schemaOf("string", "")},
+						}},
+						"400": errorResponse("Invalid query string"),
+					},
+				},
+			},
+			"/api/v1/products/import": {
+				"post": {
+					Summary:     "Import products from newline-delimited JSON or CSV",
+					OperationID: "importProducts",
+					Parameters: []openAPIParameter{
+						queryParameter("strict", "Abort the import if any line cannot be decoded or fails validation", schemaOf("boolean", "")),
+					},
+					RequestBody: &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{
+						"application/x-ndjson": {Schema: schemaRef("CreateProductRequest")},
+						"text/csv":             {Schema: schemaOf("string", "")},
+					}},
+					Responses: map[string]openAPIResponse{
+						"200": schemaResponse("The result of each line", "ImportResponse"),
+						"400": errorResponse("Invalid import, invalid query string or (if strict) an invalid line"),
+					},
+				},
+			},
+			"/api/v1/products/bulk-update": {
+				"post": {
+					Summary:     "Update all products matching a filter, applying an update and/or a price multiplier",
+					OperationID: "bulkUpdateProducts",
+					RequestBody: jsonRequestBody("BulkUpdateRequest"),
+					Responses: map[string]openAPIResponse{
+						"200": schemaResponse("The number of products updated", "BulkUpdateResponse"),
+						"400": errorResponse("Invalid JSON or validation failed"),
+						"409": errorResponse("SKU already exists, or a SKU would be applied to more than one product"),
+						"422": errorResponse("Too many categories"),
+					},
+				},
+			},
+			"/api/v1/products/schema": {
+				"get": {
+					Summary:     "Get the JSON Schema of a request creating a product",
+					OperationID: "getProductSchema",
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "The JSON Schema of CreateProductRequest", Content: map[string]openAPIMediaType{
+							"application/schema+json": {Schema: schemaOf("object", "")},
+						}},
+					},
+				},
+			},
+			"/api/v1/products/sku/{sku}": {
+				"put": {
+					Summary:     "Create or replace a product by SKU",
+					OperationID: "upsertProduct",
+					Parameters:  []openAPIParameter{sku},
+					RequestBody: jsonRequestBody("CreateProductRequest"),
+					Responses: map[string]openAPIResponse{
+						"200": schemaResponse("The replaced product", "Product"),
+						"201": schemaResponse("The created product, the path of which is given by the Location header", "Product"),
+						"400": errorResponse("Invalid JSON or validation failed"),
+						"415": errorResponse("Content-Type is not application/json"),
+						"422": errorResponse("Too many categories"),
+						"507": errorResponse("Catalog is at capacity (if a maximum number of products is set)"),
+					},
+				},
+			},
+			"/api/v1/products/{id}": {
+				"get": {
+					Summary:     "Get a product by ID or SKU",
+					OperationID: "getProduct",
+					Parameters:  []openAPIParameter{idSku, fields},
+					Responses: map[string]openAPIResponse{
+						"200": schemaResponse("The product", "Product"),
+						"400": errorResponse("Invalid query string"),
+						"404": errorResponse("Product not found"),
+						"410": errorResponse("Product has been deleted"),
+					},
+				},
+				"head": {
+					Summary:     "Check that a product exists, by ID or SKU",
+					OperationID: "headProduct",
+					Parameters:  []openAPIParameter{idSku},
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "The product exists"},
+						"404": {Description: "Product not found"},
+						"410": {Description: "Product has been deleted"},
+					},
+				},
+				"put": {
+					Summary:     "Update a product, replacing any tags",
+					OperationID: "updateProduct",
+					Parameters:  []openAPIParameter{id},
+					RequestBody: jsonRequestBody("UpdateProductRequest"),
+					Responses: map[string]openAPIResponse{
+						"200": schemaResponse("The updated product", "Product"),
+						"400": errorResponse("Invalid product ID, invalid JSON or validation failed"),
+						"404": errorResponse("Product not found"),
+						"409": errorResponse("SKU already exists"),
+						"415": errorResponse("Content-Type is not application/json"),
+						"422": errorResponse("Too many categories"),
+					},
+				},
+				"patch": {
+					Summary:     "Update a product, merging any tags and clearing null fields",
+					OperationID: "patchProduct",
+					Parameters:  []openAPIParameter{id},
+					RequestBody: jsonRequestBody("UpdateProductRequest"),
+					Responses: map[string]openAPIResponse{
+						"200": schemaResponse("The updated product", "Product"),
+						"400": errorResponse("Invalid product ID, invalid JSON or validation failed"),
+						"404": errorResponse("Product not found"),
+						"409": errorResponse("SKU already exists"),
+						"415": errorResponse("Content-Type is not application/json or application/merge-patch+json"),
+						"422": errorResponse("Too many categories"),
+					},
+				},
+				"delete": {
+					Summary:     "Delete a product",
+					OperationID: "deleteProduct",
+					Parameters: []openAPIParameter{
+						id,
+						queryParameter("return", "Return the deleted product", schemaOf("boolean", "")),
+					},
+					Responses: map[string]openAPIResponse{
+						"200": schemaResponse("The deleted product (with ?return=true)", "Product"),
+						"204": {Description: "The product was deleted"},
+						"400": errorResponse("Invalid product ID or invalid query string"),
+						"404": errorResponse("Product not found"),
+					},
+				},
+			},
+			"/api/v1/products/{id}/clone": {
+				"post": {
+					Summary:     "Create a copy of a product, without a SKU and with the name suffixed with \" (copy)\"",
+					OperationID: "cloneProduct",
+					Parameters:  []openAPIParameter{id},
+					Responses: map[string]openAPIResponse{
+						"201": schemaResponse("The created product, the path of which is given by the Location header", "Product"),
+						"400": errorResponse("Invalid product ID"),
+						"404": errorResponse("Product not found"),
+						"409": errorResponse("Name already exists (if names must be unique)"),
+						"422": errorResponse("Too many categories"),
+						"507": errorResponse("Catalog is at capacity (if a maximum number of products is set)"),
+					},
+				},
+			},
+			"/api/v1/products/{id}/history": {
+				"get": {
+					Summary:     "Get the changes to a product, oldest change first",
+					OperationID: "getProductHistory",
+					Parameters:  []openAPIParameter{id},
+					Responses: map[string]openAPIResponse{
+						"200": schemaResponse("The changes to the product (empty if the product has not been changed)", "ProductHistoryResponse"),
+						"400": errorResponse("Invalid product ID"),
+						"404": errorResponse("Product not found"),
+						"410": errorResponse("Product has been deleted"),
+					},
+				},
+			},
+			"/api/v1/products/{id}/reserve": {
+				"post": {
+					Summary:     "Reserve a quantity of the stock of a product, restored to the product when the reservation expires",
+					OperationID: "reserveStock",
+					Parameters:  []openAPIParameter{id},
+					RequestBody: jsonRequestBody("ReserveStockRequest"),
+					Responses: map[string]openAPIResponse{
+						"201": schemaResponse("The reservation", "Reservation"),
+						"400": errorResponse("Invalid product ID, invalid JSON or validation failed"),
+						"404": errorResponse("Product not found"),
+						"409": errorResponse("Quantity exceeds the quantity of the product"),
+						"410": errorResponse("Product has been deleted"),
+						"415": errorResponse("Content-Type is not application/json"),
+					},
+				},
+			},
+			"/health": {
+				"get": {
+					Summary:     "Health (liveness) check",
+					OperationID: "healthCheck",
+					Responses: map[string]openAPIResponse{
+						"200": schemaResponse("The service is healthy", "HealthResponse"),
+					},
+				},
+			},
+			"/version": {
+				"get": {
+					Summary:     "Build metadata",
+					OperationID: "getVersion",
+					Responses: map[string]openAPIResponse{
+						"200": schemaResponse("The version, commit and build time of the service", "VersionResponse"),
+					},
+				},
+			},
+			"/ready": {
+				"get": {
+					Summary:     "Readiness check",
+					OperationID: "readinessCheck",
+					Responses: map[string]openAPIResponse{
+						"200": schemaResponse("The service is ready", "HealthResponse"),
+						"503": errorResponse("Database unavailable"),
+					},
+				},
+			},
+			"/metrics": {
+				"get": {
+					Summary:     "Prometheus metrics",
+					OperationID: "metrics",
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "Metrics in the Prometheus text format", Content: map[string]openAPIMediaType{
+							"text/plain": {Schema: schemaOf("string", "")},
+						}},
+					},
+				},
+			},
+			"/openapi.json": {
+				"get": {
+					Summary:     "This OpenAPI document",
+					OperationID: "openAPI",
+					Responses: map[string]openAPIResponse{
+						"200": {Description: "The OpenAPI document", Content: map[string]openAPIMediaType{
+							"application/json": {Schema: schemaOf("object", "")},
+						}},
+					},
+				},
+			},
+		},
+		Components: openAPIComponents{
+			Schemas: map[string]*openAPISchema{
+				"Product":              product,
+				"CreateProductRequest": schemaObject([]string{"name", "price"}, productProperties()),
+				"UpdateProductRequest": schemaObject(nil, productProperties()),
+				"PaginatedResponse": schemaObject([]string{"data", "page", "page_size", "total", "total_pages", "links"}, map[string]*openAPISchema{
+					"data":            schemaArray(schemaRef("Product")),
+					"page":            schemaOf("integer", ""),
+					"page_size":       schemaOf("integer", ""),
+					"total":           schemaOf("integer", ""),
+					"total_pages":     schemaOf("integer", ""),
+					"applied_filters": {Type: "object", AdditionalProperties: schemaOf("string", "")},
+					"suggestions":     schemaArray(schemaOf("string", "")),
+					"links": schemaObject([]string{"first", "last"}, map[string]*openAPISchema{
+						"first": schemaOf("string", "uri"),
+						"prev":  schemaOf("string", "uri"),
+						"next":  schemaOf("string", "uri"),
+						"last":  schemaOf("string", "uri"),
+					}),
+				}),
+				"ProductListResponse": schemaObject([]string{"data"}, map[string]*openAPISchema{
+					"data": schemaArray(schemaRef("Product")),
+				}),
+				"ProductHistoryResponse": schemaObject([]string{"data"}, map[string]*openAPISchema{
+					"data": schemaArray(schemaObject([]string{"timestamp", "operation", "fields"}, map[string]*openAPISchema{
+						"timestamp": schemaOf("string", "date-time"),
+						"operation": {Type: "string", Enum: []string{models.OperationUpdate, models.OperationBulkUpdate, models.OperationReplace, models.OperationReserve, models.OperationRelease}},
+						"fields":    schemaArray(schemaOf("string", "")),
+					})),
+				}),
+				"ReserveStockRequest": schemaObject([]string{"quantity"}, map[string]*openAPISchema{
+					"quantity": {Type: "integer", Minimum: &one},
+				}),
+				"Reservation": schemaObject([]string{"id", "product_id", "quantity", "expires_at"}, map[string]*openAPISchema{
+					"id":         schemaOf("integer", "int64"),
+					"product_id": schemaOf("integer", "int64"),
+					"quantity":   schemaOf("integer", ""),
+					"expires_at": schemaOf("string", "date-time"),
+				}),
+				"GroupedProducts": {Type: "object", AdditionalProperties: schemaArray(schemaRef("Product"))},
+				"ProductsByIDsResponse": schemaObject([]string{"data", "missing_ids"}, map[string]*openAPISchema{
+					"data":        schemaArray(schemaRef("Product")),
+					"missing_ids": schemaArray(schemaOf("integer", "int64")),
+				}),
+				"ImportResponse": schemaObject([]string{"created", "failed", "results"}, map[string]*openAPISchema{
+					"created": schemaOf("integer", ""),
+					"failed":  schemaOf("integer", ""),
+					"results": schemaArray(schemaObject([]string{"line"}, map[string]*openAPISchema{
+						"line":  schemaOf("integer", ""),
+						"id":    schemaOf("integer", "int64"),
+						"error": schemaOf("string", ""),
+					})),
+				}),
+				"BulkUpdateRequest": schemaObject([]string{"filter"}, map[string]*openAPISchema{
+					"filter":           {Type: "object", AdditionalProperties: &openAPISchema{}}, // filter query parameters and their values
+					"update":           schemaRef("UpdateProductRequest"),
+					"price_multiplier": schemaOf("number", "double"),
+				}),
+				"BulkUpdateResponse": schemaObject([]string{"updated"}, map[string]*openAPISchema{
+					"updated": schemaOf("integer", ""),
+				}),
+				"CountResponse": schemaObject([]string{"count"}, map[string]*openAPISchema{
+					"count": schemaOf("integer", ""),
+				}),
+				"PriceStatsResponse": schemaObject([]string{"categories"}, map[string]*openAPISchema{
+					"categories": schemaArray(schemaObject([]string{"category", "count", "min_price", "max_price", "avg_price"}, map[string]*openAPISchema{
+						"category":  schemaOf("string", ""),
+						"count":     schemaOf("integer", ""),
+						"min_price": schemaOf("number", "double"),
+						"max_price": schemaOf("number", "double"),
+						"avg_price": schemaOf("number", "double"),
+					})),
+				}),
+				"RateLimitReset": schemaObject([]string{"client"}, map[string]*openAPISchema{
+					"client": schemaOf("string", ""),
+				}),
+				"Backup": schemaObject([]string{"products", "deleted_ids"}, map[string]*openAPISchema{
+					"products":    schemaArray(schemaRef("Product")),
+					"deleted_ids": schemaArray(schemaOf("integer", "int64")),
+				}),
+				"RestoreResponse": schemaObject([]string{"restored", "total"}, map[string]*openAPISchema{
+					"restored": schemaOf("integer", ""),
+					"total":    schemaOf("integer", ""),
+				}),
+				"MaintenanceMode": schemaObject([]string{"enabled"}, map[string]*openAPISchema{
+					"enabled": schemaOf("boolean", ""),
+				}),
+				"VersionResponse": schemaObject([]string{"version", "commit", "build_time"}, map[string]*openAPISchema{
+					"version":    schemaOf("string", ""),
+					"commit":     schemaOf("string", ""),
+					"build_time": schemaOf("string", ""),
+				}),
+				"HealthResponse": schemaObject([]string{"service", "status", "uptime_seconds"}, map[string]*openAPISchema{
+					"service":        schemaOf("string", ""),
+					"status":         schemaOf("string", ""),
+					"product_count":  schemaOf("integer", ""),
+					"uptime_seconds": schemaOf("number", "double"),
+				}),
+				"ErrorResponse": schemaObject([]string{"code", "error"}, map[string]*openAPISchema{
+					"code":                schemaOf("string", ""),
+					"error":               schemaOf("string", ""),
+					"message":             schemaOf("string", ""),
+					"request_id":          schemaOf("string", ""),
+					"retry_after_seconds": schemaOf("integer", ""),
+				}),
+			},
+		},
+	}
+	if admin {
+		maps.Copy(doc.Paths, adminOpenAPIPaths())
+	}
+	return doc
+}
+
+// adminOpenAPIPaths returns the paths of the administration endpoints (see
+// WithAdminEndpoints)
+func adminOpenAPIPaths() map[string]openAPIPathItem {
+	return map[string]openAPIPathItem{
+		"/api/v1/admin/ratelimit/reset": {
+			"post": {
+				Summary:     "Reset the rate limit of a client",
+				OperationID: "resetRateLimit",
+				RequestBody: jsonRequestBody("RateLimitReset"),
+				Responses: map[string]openAPIResponse{
+					"200": schemaResponse("The client whose rate limit was reset", "RateLimitReset"),
+					"400": errorResponse("Invalid JSON or validation failed"),
+					"501": errorResponse("Rate limit reset not supported"),
+				},
+			},
+		},
+		"/api/v1/admin/maintenance": {
+			"get": {
+				Summary:     "Get whether the service is in maintenance mode",
+				OperationID: "getMaintenanceMode",
+				Responses: map[string]openAPIResponse{
+					"200": schemaResponse("Whether the service is in maintenance mode", "MaintenanceMode"),
+				},
+			},
+			"put": {
+				Summary:     "Enable or disable maintenance mode, in which requests modifying products are rejected",
+				OperationID: "setMaintenanceMode",
+				RequestBody: jsonRequestBody("MaintenanceMode"),
+				Responses: map[string]openAPIResponse{
+					"200": schemaResponse("Whether the service is in maintenance mode", "MaintenanceMode"),
+					"400": errorResponse("Invalid JSON or validation failed"),
+				},
+			},
+		},
+		"/api/v1/admin/export": {
+			"get": {
+				Summary:     "Export a backup of the entire catalog, including the IDs of deleted products",
+				OperationID: "exportBackup",
+				Responses: map[string]openAPIResponse{
+					"200": schemaResponse("The backup", "Backup"),
+				},
+			},
+		},
+		"/api/v1/admin/import": {
+			"post": {
+				Summary:     "Restore a backup, merging it into the catalog or replacing the catalog",
+				OperationID: "importBackup",
+				Parameters: []openAPIParameter{
+					queryParameter("replace", "Replace the catalog (and discard all history) rather than merging the backup into it", schemaOf("boolean", "")),
+				},
+				RequestBody: jsonRequestBody("Backup"),
+				Responses: map[string]openAPIResponse{
+					"200": schemaResponse("The number of products restored and in the catalog", "RestoreResponse"),
+					"400": errorResponse("Invalid JSON, validation failed, invalid backup or invalid query string"),
+					"409": errorResponse("SKU used by more than one product"),
+					"415": errorResponse("Content-Type is not application/json"),
+				},
+			},
+		},
+	}
+}
+
+// OpenAPI handles GET /openapi.json
+//
+// Returns the OpenAPI 3.0 document describing the API.  The document is
+// always JSON, regardless of the Accept header.
+func (h *Handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(openAPISpec(h.adminEndpoints))
+}
@@ -0,0 +1,96 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"products-api/internal/api"
+
+	"github.com/gorilla/mux"
+)
+
+func TestOpenAPI(t *testing.T) {
+	t.Run("Admin endpoints not enabled", func(t *testing.T) {
+		testOpenAPI(t, api.NewHandler(newMockDB(), nil).SetupRoutes())
+	})
+	t.Run("Admin endpoints enabled", func(t *testing.T) {
+		testOpenAPI(t, api.NewHandler(newMockDB(), nil, api.WithAdminEndpoints()).SetupRoutes())
+	})
+}
+
+// testOpenAPI tests that the OpenAPI document served by a router describes
+// the routes of the router
+func testOpenAPI(t *testing.T, router *mux.Router) {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/openapi.json", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %s", contentType)
+	}
+
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("Failed to unmarshal OpenAPI document: %v", err)
+	}
+
+	if !strings.HasPrefix(spec.OpenAPI, "3.0") {
+		t.Errorf("Expected OpenAPI version 3.0.x, got %s", spec.OpenAPI)
+	}
+	for _, method := range []string{"get", "post"} {
+		if _, ok := spec.Paths["/api/v1/products"][method]; !ok {
+			t.Errorf("Expected %s operation for /api/v1/products", method)
+		}
+	}
+
+	// every route (other than CORS preflight) must be described, and every
+	// described operation must be routed
+	patPattern := regexp.MustCompile(`{([^:}]+):[^}]+}`)
+	routed := map[string]bool{}
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		path := patPattern.ReplaceAllString(tpl, "{$1}")
+		for _, method := range methods {
+			if method == "OPTIONS" {
+				continue
+			}
+			method = strings.ToLower(method)
+			routed[method+" "+path] = true
+
+			if _, ok := spec.Paths[path][method]; !ok {
+				t.Errorf("Route %s %s is not described", method, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk routes: %v", err)
+	}
+
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			if !routed[method+" "+path] {
+				t.Errorf("Described operation %s %s is not routed", method, path)
+			}
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"github.com/blugnu/time"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Option configures optional behaviour of a Handler
+type Option func(*Handler)
+
+// WithLogger sets the logger used by the Handler.  If not specified, a
+// logger writing JSON to stdout is used.
+func WithLogger(logger *slog.Logger) Option {
+	return func(h *Handler) {
+		if logger != nil {
+			h.logger = logger
+		}
+	}
+}
+
+// WithRedactedFields specifies the names of fields whose values are replaced
+// with "[REDACTED]" in request and response bodies emitted in debug logs.
+// Field names are matched case-insensitively at any depth in a JSON body.
+func WithRedactedFields(fields ...string) Option {
+	return func(h *Handler) {
+		if h.redactedFields == nil {
+			h.redactedFields = map[string]bool{}
+		}
+		for _, field := range fields {
+			h.redactedFields[strings.ToLower(field)] = true
+		}
+	}
+}
+
+// WithRandSource sets the source of randomness used for random product
+// sampling.  Specifying a seeded source results in a deterministic sequence
+// of samples, which is useful for testing.
+func WithRandSource(src rand.Source) Option {
+	return func(h *Handler) {
+		if src != nil {
+			h.rand = rand.New(src)
+		}
+	}
+}
+
+// WithClock sets the clock providing the current time to the Handler (e.g.
+// for the new_within filter).  If not specified, the system clock is used;
+// specifying a mock clock is useful for testing.
+func WithClock(clock time.Clock) Option {
+	return func(h *Handler) {
+		if clock != nil {
+			h.clock = clock
+		}
+	}
+}
+
+// WithAdminEndpoints configures the Handler to route the administration
+// endpoints (under /api/v1/admin).  The endpoints are not authenticated, so
+// are not routed unless enabled, and should be enabled only where they
+// cannot be reached by untrusted clients.
+func WithAdminEndpoints() Option {
+	return func(h *Handler) {
+		h.adminEndpoints = true
+	}
+}
+
+// WithEmptyResultHints configures the Handler to include a summary of the
+// applied filters, and suggestions for widening them, when a filtered
+// product listing matches no products.
+func WithEmptyResultHints() Option {
+	return func(h *Handler) {
+		h.emptyResultHints = true
+	}
+}
+
+// WithHideInternalErrors configures the Handler to omit the details of
+// server errors (5xx) from error responses; the details are logged but the
+// client receives only a generic error message.  Details of client errors
+// (4xx), such as validation failures, are still provided.
+func WithHideInternalErrors() Option {
+	return func(h *Handler) {
+		h.hideInternalErrors = true
+	}
+}
+
+// WithMetricsRegistry sets the Prometheus registry with which the Handler
+// registers its request metrics and which is served by the /metrics
+// endpoint.  If not specified, a new registry is created for the Handler.
+//
+// The metrics collectors are registered when the Handler is created; the
+// same registry cannot be used by more than one Handler.
+func WithMetricsRegistry(reg *prometheus.Registry) Option {
+	return func(h *Handler) {
+		h.metricsRegistry = reg
+	}
+}
+
+// WithMaxProducts sets the maximum number of products expected in the
+// catalog.  When a product is created and the number of products has reached
+// the capacity warning threshold (see WithCapacityWarningThreshold), the
+// response includes an X-Capacity-Warning header and a warning is logged.
+//
+// A max of zero (the default) disables capacity warnings.
+func WithMaxProducts(max int) Option {
+	return func(h *Handler) {
+		h.maxProducts = max
+	}
+}
+
+// WithCapacityWarningThreshold sets the percentage of the maximum number of
+// products (see WithMaxProducts) at which capacity warnings are given.  If
+// not specified, warnings are given at 90%.  Values outside the range 1-100
+// are ignored.
+func WithCapacityWarningThreshold(percent int) Option {
+	return func(h *Handler) {
+		if percent > 0 && percent <= 100 {
+			h.capacityWarningThreshold = percent
+		}
+	}
+}
+
+// WithImportConcurrency sets the maximum number of products created
+// concurrently by a bulk import.  If not specified, up to 4 products are
+// created concurrently.  Values less than 1 are ignored.
+func WithImportConcurrency(n int) Option {
+	return func(h *Handler) {
+		if n > 0 {
+			h.importConcurrency = n
+		}
+	}
+}
+
+// WithRateLimitHeaders configures the Handler to include X-RateLimit-Limit
+// and X-RateLimit-Remaining headers in every response, if the rate limiter
+// implements RateLimitReporter, and an X-RateLimit-Burst-Used header if the
+// rate limiter implements BurstReporter with a burst allowance.  The headers
+// are omitted for clients that are not limited (e.g. exempt clients).
+func WithRateLimitHeaders() Option {
+	return func(h *Handler) {
+		h.rateLimitHeaders = true
+	}
+}
+
+// WithDefaultPageSize sets the number of products in a page of a product
+// listing if no page_size is specified (or the page_size is less than 1).  If
+// not specified, the default is db.DefaultPageSize (10).  Values less than 1
+// are ignored.  A default greater than the maximum page size (see
+// WithMaxPageSize) is reduced to the maximum.
+func WithDefaultPageSize(size int) Option {
+	return func(h *Handler) {
+		if size > 0 {
+			h.defaultPageSize = size
+		}
+	}
+}
+
+// WithMaxPageSize sets the maximum number of products in a page of a
+// product listing; a larger page_size is reduced to the maximum.  If not
+// specified, the maximum is 100.  Values less than 1 are ignored.
+func WithMaxPageSize(max int) Option {
+	return func(h *Handler) {
+		if max > 0 {
+			h.maxPageSize = max
+		}
+	}
+}
+
+// WithDefaultSort sets the order of a product listing if no sort is
+// specified (and the order is not implied by the modified_since, new_within
+// or q parameters), using the syntax of the sort parameter (e.g.
+// "price:desc" or "category,created_at:desc").  If not specified, products
+// are ordered by ID.  A sort that is not valid (see ValidateSort), including
+// a sort by relevance, is ignored.
+func WithDefaultSort(spec string) Option {
+	return func(h *Handler) {
+		if order, err := parseSort(spec, ""); err == nil {
+			h.defaultOrder = order
+		}
+	}
+}
+
+// WithRequestTimeout sets the time allowed to handle a request.  The
+// request context is cancelled when the timeout expires; a request that
+// fails as a result receives a 503 Service Unavailable response.  If not
+// specified (or zero), requests have no timeout.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(h *Handler) {
+		h.requestTimeout = timeout
+	}
+}
+
+// WithReservationTTL sets the time for which stock reserved by
+// POST /api/v1/products/{id}/reserve is held before the reservation expires
+// and the quantity is restored to the product.  If not specified, stock is
+// reserved for 15 minutes.  Values less than or equal to zero are ignored.
+func WithReservationTTL(ttl time.Duration) Option {
+	return func(h *Handler) {
+		if ttl > 0 {
+			h.reservationTTL = ttl
+		}
+	}
+}
+
+// WithQuietPaths sets the paths of requests that are logged at debug level
+// rather than info, to avoid frequent requests (e.g. health checks) drowning
+// other requests in the logs.  If not specified, the quiet paths are /health
+// and /ready.  Requests that modify products are always logged.
+func WithQuietPaths(paths ...string) Option {
+	return func(h *Handler) {
+		h.quietPaths = map[string]bool{}
+		for _, path := range paths {
+			h.quietPaths[path] = true
+		}
+	}
+}
+
+// WithWriteCost sets the number of requests that a request modifying products
+// (POST, PUT, PATCH or DELETE) counts as, if the rate limiter implements
+// WeightedRateLimiter, so that writes exhaust a client's limit faster than
+// reads.  If not specified, a write counts as 5 requests.  Values less than 1
+// are ignored; a write never counts as more than the requests allowed from a
+// client (the limit, plus any burst allowance), so that writes can succeed.
+func WithWriteCost(cost int) Option {
+	return func(h *Handler) {
+		if cost > 0 {
+			h.writeCost = cost
+		}
+	}
+}
+
+// WithUniqueNames configures the Handler to reject the creation of a product
+// with the same name as an existing product (compared case-insensitively),
+// with a 409 Conflict response.  If not specified, names need not be unique.
+func WithUniqueNames() Option {
+	return func(h *Handler) {
+		h.uniqueNames = true
+	}
+}
+
+// WithAllowedCategories configures the Handler to reject requests creating or
+// updating a product in a category other than those specified (compared
+// case-insensitively), with a 400 Bad Request response.  A product need not
+// be in a category.  If no categories are specified, products may be in any
+// category.
+func WithAllowedCategories(categories ...string) Option {
+	return func(h *Handler) {
+		h.allowedCategories = slices.Clone(categories)
+	}
+}
+
+// WithMaintenance configures the Handler to start in maintenance mode (see
+// Handler.SetMaintenance)
+func WithMaintenance() Option {
+	return func(h *Handler) {
+		h.maintenance.Store(true)
+	}
+}
+
+// WithSchemaValidation configures the Handler to validate the body of a
+// request creating a product against the JSON Schema of the request (see
+// GET /api/v1/products/schema) before decoding it, describing each failure
+// with the path of the failing value.  Requests passing schema validation are
+// still subject to the validation of the request struct.
+func WithSchemaValidation() Option {
+	return func(h *Handler) {
+		h.schemaValidation = true
+	}
+}
@@ -2,34 +2,92 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
 	"products-api/internal/api/ratelimiter"
+	"products-api/internal/models"
+	"strings"
 	"time"
 )
 
-// NewRateLimiter initializes a new rate limiter with the specified limit.
+// NewRateLimiter initializes a new rate limiter with the specified configuration,
+// selecting the implementation according to the configured algorithm.
 // If the limit is less than or equal to zero, it returns a NoopLimiter that
 // does not enforce any rate limiting.
-func NewRateLimiter(ctx context.Context, limit int) (RateLimiter, error) {
-	if limit <= 0 {
+func NewRateLimiter(ctx context.Context, cfg ratelimiter.Config) (RateLimiter, error) {
+	if cfg.Limit <= 0 {
 		return ratelimiter.NewNoopLimiter(), nil
 	}
 
 	// configuration of the rate limiter would be more comprehensive in
 	// a real application
 	//
-	// for this example the per second limit may be specified with a fixed
-	// client timeout (1 minute)
-	cfg := ratelimiter.Config{
-		Limit:         limit,
-		LimitInterval: time.Second,
-		ClientTimeout: time.Minute,
+	// for this example the limit is applied per second by default, with
+	// a default client timeout of 1 minute
+	if cfg.LimitInterval == 0 {
+		cfg.LimitInterval = time.Second
+	}
+	if cfg.ClientTimeout == 0 {
+		cfg.ClientTimeout = time.Minute
 	}
 
 	// create the rate limiter with the specified configuration
-	limiter, err := ratelimiter.New(ctx, cfg)
-	if err != nil {
-		return nil, err
+	switch cfg.Algorithm {
+	case "", ratelimiter.FixedWindow:
+		limiter, err := ratelimiter.New(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return limiter, nil
+
+	case ratelimiter.TokenBucket:
+		limiter, err := ratelimiter.NewTokenBucket(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return limiter, nil
+
+	default:
+		return nil, ratelimiter.ErrInvalidAlgorithm
+	}
+}
+
+// ResetRateLimit handles POST /api/v1/admin/ratelimit/reset
+//
+// Resets the rate limit of the client identified in the request, so that
+// the client is no longer throttled.  Resetting a client that is not being
+// tracked by the rate limiter (or when there is no rate limiter) has no
+// effect.  If the rate limiter does not implement RateLimitResetter, the
+// response is 501 Not Implemented.
+//
+// Since a client could reset its own limit, the route is registered only
+// if the administration endpoints are enabled (see WithAdminEndpoints).
+func (h *Handler) ResetRateLimit(w http.ResponseWriter, r *http.Request) {
+	var req models.RateLimitReset
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidJSON, cInvalidJSON, err.Error())
+		return
 	}
+	req.Client = strings.TrimSpace(req.Client)
+
+	if !h.validateRequest(w, r, &req) {
+		return
+	}
+
+	if h.rateLimiter != nil {
+		resetter, ok := h.rateLimiter.(RateLimitResetter)
+		if !ok {
+			h.writeErrorResponse(w, r, http.StatusNotImplemented, models.CodeNotSupported, "Rate limit reset not supported", "")
+			return
+		}
+		resetter.Reset(req.Client)
+	}
+
+	h.logger.LogAttrs(r.Context(), slog.LevelInfo, "rate limit reset",
+		slog.String("request_id", RequestIDFromContext(r.Context())),
+		slog.String("client", req.Client),
+	)
 
-	return limiter, nil
+	h.writeResponse(w, r, http.StatusOK, req)
 }
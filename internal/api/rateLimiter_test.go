@@ -0,0 +1,290 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"products-api/internal/api"
+	"products-api/internal/api/ratelimiter"
+	"products-api/internal/models"
+
+	"github.com/blugnu/time"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tests := []struct {
+		name      string
+		cfg       ratelimiter.Config
+		expectErr error
+		expected  any
+	}{
+		{name: "No limit", cfg: ratelimiter.Config{}, expected: &ratelimiter.NoopLimiter{}},
+		{name: "Default algorithm", cfg: ratelimiter.Config{Limit: 10}, expected: &ratelimiter.RateLimiter{}},
+		{name: "Fixed window", cfg: ratelimiter.Config{Limit: 10, Algorithm: ratelimiter.FixedWindow}, expected: &ratelimiter.RateLimiter{}},
+		{name: "Token bucket", cfg: ratelimiter.Config{Limit: 10, Algorithm: ratelimiter.TokenBucket}, expected: &ratelimiter.TokenBucketLimiter{}},
+		{name: "Unknown algorithm", cfg: ratelimiter.Config{Limit: 10, Algorithm: "unknown"}, expectErr: ratelimiter.ErrInvalidAlgorithm},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, err := api.NewRateLimiter(ctx, tt.cfg)
+			if !errors.Is(err, tt.expectErr) {
+				t.Fatalf("Expected error %v, got %v", tt.expectErr, err)
+			}
+
+			if got, want := fmt.Sprintf("%T", limiter), fmt.Sprintf("%T", tt.expected); tt.expectErr == nil && got != want {
+				t.Errorf("Expected limiter of type %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+// allowAll is a rate limiter that allows all requests and does not support
+// resetting clients
+type allowAll struct{}
+
+func (allowAll) Allow(*http.Request) bool { return true }
+
+func TestResetRateLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(time.ContextWithClock(context.Background(), time.NewMockClock()))
+	defer cancel()
+
+	newLimiter := func(t *testing.T, algorithm ratelimiter.Algorithm) api.RateLimiter {
+		limiter, err := api.NewRateLimiter(ctx, ratelimiter.Config{Algorithm: algorithm, Limit: 20, LimitInterval: time.Second, ClientTimeout: time.Minute})
+		if err != nil {
+			t.Fatalf("Failed to create rate limiter: %v", err)
+		}
+		return limiter
+	}
+
+	request := func(router http.Handler, method, path, body, remoteAddr string) *httptest.ResponseRecorder {
+		req := newJSONRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, algorithm := range []ratelimiter.Algorithm{ratelimiter.FixedWindow, ratelimiter.TokenBucket} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			router := api.NewHandler(newMockDB(), newLimiter(t, algorithm), api.WithAdminEndpoints()).SetupRoutes()
+
+			// exhaust the limit of a client
+			const client = "198.51.100.1:1234"
+			for range 20 {
+				request(router, "GET", "/health", "", client)
+			}
+			if rr := request(router, "GET", "/health", "", client); rr.Code != http.StatusTooManyRequests {
+				t.Fatalf("Expected status code %d for exhausted client, got %d", http.StatusTooManyRequests, rr.Code)
+			}
+
+			// reset the client (from another client)
+			rr := request(router, "POST", "/api/v1/admin/ratelimit/reset", `{"client":"198.51.100.1"}`, "192.0.2.1:1234")
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+			var response models.RateLimitReset
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Client != "198.51.100.1" {
+				t.Errorf("Expected client %q, got %q", "198.51.100.1", response.Client)
+			}
+
+			if rr := request(router, "GET", "/health", "", client); rr.Code != http.StatusOK {
+				t.Errorf("Expected status code %d after reset, got %d", http.StatusOK, rr.Code)
+			}
+		})
+	}
+
+	tests := []struct {
+		name           string
+		limiter        api.RateLimiter
+		body           string
+		expectedStatus int
+	}{
+		{name: "Unknown client", limiter: newLimiter(t, ratelimiter.FixedWindow), body: `{"client":"203.0.113.1"}`, expectedStatus: http.StatusOK},
+		{name: "No limit", limiter: ratelimiter.NewNoopLimiter(), body: `{"client":"203.0.113.1"}`, expectedStatus: http.StatusOK},
+		{name: "No rate limiter", body: `{"client":"203.0.113.1"}`, expectedStatus: http.StatusOK},
+		{name: "Reset not supported", limiter: allowAll{}, body: `{"client":"203.0.113.1"}`, expectedStatus: http.StatusNotImplemented},
+		{name: "Missing client", limiter: newLimiter(t, ratelimiter.FixedWindow), body: `{"client":"  "}`, expectedStatus: http.StatusBadRequest},
+		{name: "Invalid JSON", limiter: newLimiter(t, ratelimiter.FixedWindow), body: `invalid json`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := api.NewHandler(newMockDB(), tt.limiter, api.WithAdminEndpoints()).SetupRoutes()
+
+			rr := request(router, "POST", "/api/v1/admin/ratelimit/reset", tt.body, "192.0.2.1:1234")
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	// a client must not be able to reset its own limit unless the
+	// administration endpoints are enabled
+	t.Run("Admin endpoints not enabled", func(t *testing.T) {
+		router := api.NewHandler(newMockDB(), newLimiter(t, ratelimiter.FixedWindow)).SetupRoutes()
+
+		rr := request(router, "POST", "/api/v1/admin/ratelimit/reset", `{"client":"192.0.2.1"}`, "192.0.2.1:1234")
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status code %d, got %d: %s", http.StatusNotFound, rr.Code, rr.Body.String())
+		}
+	})
+}
+
+// denyAll is a rate limiter that denies all requests and does not report
+// when a request may be retried
+type denyAll struct{}
+
+func (denyAll) Allow(*http.Request) bool { return false }
+
+func TestRateLimitByClientID(t *testing.T) {
+	ctx, cancel := context.WithCancel(time.ContextWithClock(context.Background(), time.NewMockClock()))
+	defer cancel()
+
+	limiter, err := api.NewRateLimiter(ctx, ratelimiter.Config{Limit: 2, LimitInterval: time.Second, ClientTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	router := api.NewHandler(newMockDB(), limiter).SetupRoutes()
+
+	// authenticated identifies the client of a request presenting a (valid)
+	// API key to the rate limiter, as an authentication middleware would
+	authenticated := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get("X-API-Key"); key == "alice" || key == "bob" {
+			r = r.WithContext(ratelimiter.ContextWithClientID(r.Context(), "key:"+key))
+		}
+		router.ServeHTTP(w, r)
+	})
+
+	// get makes a request from an address, with an API key (if not empty),
+	// returning the status code of the response
+	get := func(handler http.Handler, addr, key string) int {
+		req := httptest.NewRequest("GET", "/api/v1/products", nil)
+		req.RemoteAddr = addr + ":1234"
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	t.Run("Unauthenticated keys", func(t *testing.T) {
+		// a client cannot evade its limit by presenting a different key with
+		// each request
+		for i, key := range []string{"k1", "k2"} {
+			if code := get(router, "192.0.2.1", key); code != http.StatusOK {
+				t.Fatalf("Request %d: expected status code %d, got %d", i+1, http.StatusOK, code)
+			}
+		}
+		if code := get(router, "192.0.2.1", "k3"); code != http.StatusTooManyRequests {
+			t.Errorf("Expected the address to be limited (%d), got %d", http.StatusTooManyRequests, code)
+		}
+	})
+
+	t.Run("Authenticated keys", func(t *testing.T) {
+		// two requests with the same key from different addresses share a
+		// limit
+		if code := get(authenticated, "198.51.100.1", "alice"); code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, code)
+		}
+		if code := get(authenticated, "198.51.100.2", "alice"); code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d", http.StatusOK, code)
+		}
+		if code := get(authenticated, "198.51.100.3", "alice"); code != http.StatusTooManyRequests {
+			t.Errorf("Expected the key to be limited (%d), got %d", http.StatusTooManyRequests, code)
+		}
+
+		// other keys are limited separately, including from a limited address
+		if code := get(authenticated, "192.0.2.1", "bob"); code != http.StatusOK {
+			t.Errorf("Expected a different key to be allowed (%d), got %d", http.StatusOK, code)
+		}
+
+		// the limit of a key is reset by the ID of the client
+		limiter.(api.RateLimitResetter).Reset("key:alice")
+		if code := get(authenticated, "198.51.100.3", "alice"); code != http.StatusOK {
+			t.Errorf("Expected the key to be allowed after reset (%d), got %d", http.StatusOK, code)
+		}
+	})
+}
+
+func TestRateLimitedResponse(t *testing.T) {
+	ctx, cancel := context.WithCancel(time.ContextWithClock(context.Background(), time.NewMockClock()))
+	defer cancel()
+
+	// a token every second
+	limiter, err := api.NewRateLimiter(ctx, ratelimiter.Config{Algorithm: ratelimiter.TokenBucket, Limit: 10, LimitInterval: 10 * time.Second, ClientTimeout: time.Minute})
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+
+	tests := []struct {
+		name               string
+		limiter            api.RateLimiter
+		method             string
+		expectedRetryAfter int
+	}{
+		{name: "Read", limiter: limiter, method: "GET", expectedRetryAfter: 1},
+		{name: "Write", limiter: limiter, method: "POST", expectedRetryAfter: 5},
+		{name: "Retry not reported", limiter: denyAll{}, method: "GET"},
+	}
+
+	// empty the bucket of the client
+	router := api.NewHandler(newMockDB(), limiter).SetupRoutes()
+	for range 10 {
+		req := httptest.NewRequest("GET", "/api/v1/products", nil)
+		req.RemoteAddr = "198.51.100.1:1234"
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := api.NewHandler(newMockDB(), tt.limiter).SetupRoutes()
+
+			req := newJSONRequest(tt.method, "/api/v1/products", strings.NewReader(`{"name":"New","price":1}`))
+			req.RemoteAddr = "198.51.100.1:1234"
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusTooManyRequests {
+				t.Fatalf("Expected status code %d, got %d", http.StatusTooManyRequests, rr.Code)
+			}
+			if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Expected Content-Type application/json, got %s", contentType)
+			}
+
+			var response models.ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Code != models.CodeRateLimited || response.RequestID == "" {
+				t.Errorf("Expected code %s with a request ID, got %+v", models.CodeRateLimited, response)
+			}
+			if response.RetryAfterSeconds != tt.expectedRetryAfter {
+				t.Errorf("Expected retry_after_seconds %d, got %d", tt.expectedRetryAfter, response.RetryAfterSeconds)
+			}
+
+			expectedHeader := ""
+			if tt.expectedRetryAfter != 0 {
+				expectedHeader = strconv.Itoa(tt.expectedRetryAfter)
+			}
+			if retryAfter := rr.Header().Get("Retry-After"); retryAfter != expectedHeader {
+				t.Errorf("Expected Retry-After %q, got %q", expectedHeader, retryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package ratelimiter
+
+import (
+	"context"
+	"net/http"
+)
+
+// clientIDKey is the context key of the ID of the client making a request
+type clientIDKey struct{}
+
+// ContextWithClientID returns a context identifying the client making a
+// request, e.g. by an API key with which the client has been authenticated.
+// A client identified by the context of a request is limited by that ID
+// rather than by its IP address, so that requests with the same ID from
+// different addresses share a limit and requests with different IDs from the
+// same address (e.g. from behind a NAT) do not.  An empty ID does not
+// identify a client.
+//
+// The ID is used as given (and is the ID of the client to Reset), so should
+// be distinct from any IP address.  A key that has not been authenticated
+// must not be used, since a client could evade its limit by presenting a
+// different key with each request.
+func ContextWithClientID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, clientIDKey{}, id)
+}
+
+// client returns the ID of the client making a request, by which requests
+// from the client are limited, and whether the client is exempt from rate
+// limiting.  A client identified by the context of the request (see
+// ContextWithClientID) is limited by that ID, otherwise by its IP address
+// (see clientIP); exemptions apply to the IP address of a client, however
+// the client is identified.
+func client(rq *http.Request, trustProxy bool, ipHeader string, exempt exemptions) (string, bool) {
+	ip := clientIP(rq, trustProxy, ipHeader)
+	if exempt.contains(ip) {
+		return ip, true
+	}
+	if id, _ := rq.Context().Value(clientIDKey{}).(string); id != "" {
+		return id, false
+	}
+	return ip, false
+}
@@ -0,0 +1,127 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		xForwardedFor string
+		clientIP      string // the value of a True-Client-IP header
+		ipHeader      string
+		trustProxy    bool
+		expected      string
+	}{
+		{name: "IPv4 remote address", remoteAddr: "192.0.2.1:1234", expected: "192.0.2.1"},
+		{name: "IPv6 remote address", remoteAddr: "[2001:db8::1]:1234", expected: "2001:db8::1"},
+		{name: "Invalid remote address", remoteAddr: "test", expected: ""},
+		{
+			name:          "Untrusted proxy ignores forged header",
+			remoteAddr:    "192.0.2.1:1234",
+			xForwardedFor: "198.51.100.1",
+			expected:      "192.0.2.1",
+		},
+		{
+			name:          "Trusted proxy uses header",
+			remoteAddr:    "192.0.2.1:1234",
+			xForwardedFor: "198.51.100.1",
+			trustProxy:    true,
+			expected:      "198.51.100.1",
+		},
+		{
+			name:          "Trusted proxy uses left-most address",
+			remoteAddr:    "192.0.2.1:1234",
+			xForwardedFor: " 198.51.100.1 , 203.0.113.1, 192.0.2.1",
+			trustProxy:    true,
+			expected:      "198.51.100.1",
+		},
+		{
+			name:       "Trusted proxy without header",
+			remoteAddr: "192.0.2.1:1234",
+			trustProxy: true,
+			expected:   "192.0.2.1",
+		},
+		{
+			name:          "Trusted proxy with invalid header",
+			remoteAddr:    "192.0.2.1:1234",
+			xForwardedFor: "not-an-ip",
+			trustProxy:    true,
+			expected:      "192.0.2.1",
+		},
+		{
+			name:          "Trusted proxy uses client IP header",
+			remoteAddr:    "192.0.2.1:1234",
+			xForwardedFor: "198.51.100.1",
+			clientIP:      " 203.0.113.1 ",
+			ipHeader:      "True-Client-IP",
+			trustProxy:    true,
+			expected:      "203.0.113.1",
+		},
+		{
+			name:       "Client IP header name is case-insensitive",
+			remoteAddr: "192.0.2.1:1234",
+			clientIP:   "203.0.113.1",
+			ipHeader:   "true-client-ip",
+			trustProxy: true,
+			expected:   "203.0.113.1",
+		},
+		{
+			name:          "Untrusted proxy ignores client IP header",
+			remoteAddr:    "192.0.2.1:1234",
+			xForwardedFor: "198.51.100.1",
+			clientIP:      "203.0.113.1",
+			ipHeader:      "True-Client-IP",
+			expected:      "192.0.2.1",
+		},
+		{
+			name:          "Client IP header not configured",
+			remoteAddr:    "192.0.2.1:1234",
+			xForwardedFor: "198.51.100.1",
+			clientIP:      "203.0.113.1",
+			trustProxy:    true,
+			expected:      "198.51.100.1",
+		},
+		{
+			name:          "Trusted proxy without client IP header uses X-Forwarded-For",
+			remoteAddr:    "192.0.2.1:1234",
+			xForwardedFor: "198.51.100.1",
+			ipHeader:      "True-Client-IP",
+			trustProxy:    true,
+			expected:      "198.51.100.1",
+		},
+		{
+			name:       "Trusted proxy without either header",
+			remoteAddr: "192.0.2.1:1234",
+			ipHeader:   "True-Client-IP",
+			trustProxy: true,
+			expected:   "192.0.2.1",
+		},
+		{
+			name:       "Trusted proxy with invalid client IP header",
+			remoteAddr: "192.0.2.1:1234",
+			clientIP:   "not-an-ip",
+			ipHeader:   "True-Client-IP",
+			trustProxy: true,
+			expected:   "192.0.2.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rq := &http.Request{RemoteAddr: tt.remoteAddr, Header: http.Header{}}
+			if tt.xForwardedFor != "" {
+				rq.Header.Set("X-Forwarded-For", tt.xForwardedFor)
+			}
+			if tt.clientIP != "" {
+				rq.Header.Set("True-Client-IP", tt.clientIP)
+			}
+
+			if got := clientIP(rq, tt.trustProxy, tt.ipHeader); got != tt.expected {
+				t.Errorf("Expected client IP %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package ratelimiter
+
+import (
+	"container/list"
+
+	"github.com/blugnu/time"
+)
+
+// trackedClient is a client tracked by a clientTracker, with its state
+type trackedClient[T any] struct {
+	id       string
+	lastSeen time.Time
+	state    T
+}
+
+// clientTracker tracks the state of clients by client ID, in the order in
+// which they were last seen.  The least recently seen client is evicted in
+// constant time when a new client would exceed the maximum number of
+// clients, and inactive clients are removed without visiting active ones.
+//
+// A clientTracker is not safe for concurrent use; the rate limiters guard
+// their trackers with their locks.
+type clientTracker[T any] struct {
+	max     int                      // maximum number of clients; zero for no maximum
+	clients map[string]*list.Element // elements of recency by client ID
+	recency *list.List               // of *trackedClient[T], most recently seen first
+}
+
+// newClientTracker returns a clientTracker tracking up to a maximum number
+// of clients (zero for no maximum)
+func newClientTracker[T any](max int) *clientTracker[T] {
+	return &clientTracker[T]{
+		max:     max,
+		clients: map[string]*list.Element{},
+		recency: list.New(),
+	}
+}
+
+// get returns the state of a client, or nil if the client is not tracked
+func (ct *clientTracker[T]) get(id string) *T {
+	if e, exists := ct.clients[id]; exists {
+		return &e.Value.(*trackedClient[T]).state
+	}
+	return nil
+}
+
+// see returns the state of a client seen at a time, making it the most
+// recently seen client.  A client that is not tracked is tracked with the
+// state returned by init, evicting the least recently seen client if the
+// maximum number of clients are already tracked.
+func (ct *clientTracker[T]) see(id string, now time.Time, init func() T) *T {
+	if e, exists := ct.clients[id]; exists {
+		client := e.Value.(*trackedClient[T])
+		client.lastSeen = now
+		ct.recency.MoveToFront(e)
+		return &client.state
+	}
+
+	if ct.max > 0 && ct.recency.Len() >= ct.max {
+		ct.remove(ct.recency.Back())
+	}
+
+	client := &trackedClient[T]{id: id, lastSeen: now, state: init()}
+	ct.clients[id] = ct.recency.PushFront(client)
+	return &client.state
+}
+
+// each calls a function with the state of each tracked client
+func (ct *clientTracker[T]) each(fn func(*T)) {
+	for e := ct.recency.Front(); e != nil; e = e.Next() {
+		fn(&e.Value.(*trackedClient[T]).state)
+	}
+}
+
+// removeInactive removes the clients that have not been seen within a
+// timeout of a time
+func (ct *clientTracker[T]) removeInactive(now time.Time, timeout time.Duration) {
+	for e := ct.recency.Back(); e != nil && now.Sub(e.Value.(*trackedClient[T]).lastSeen) >= timeout; e = ct.recency.Back() {
+		ct.remove(e)
+	}
+}
+
+// remove stops tracking the client of an element of recency
+func (ct *clientTracker[T]) remove(e *list.Element) {
+	delete(ct.clients, ct.recency.Remove(e).(*trackedClient[T]).id)
+}
+
+// len returns the number of clients tracked
+func (ct *clientTracker[T]) len() int {
+	return ct.recency.Len()
+}
@@ -0,0 +1,72 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/blugnu/time"
+)
+
+func TestClientTracker(t *testing.T) {
+	start := time.Now(t.Context())
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+	zero := func() int { return 0 }
+
+	// ids returns the IDs of the tracked clients, most recently seen first
+	ids := func(ct *clientTracker[int]) []string {
+		var ids []string
+		for e := ct.recency.Front(); e != nil; e = e.Next() {
+			ids = append(ids, e.Value.(*trackedClient[int]).id)
+		}
+		return ids
+	}
+
+	t.Run("Eviction", func(t *testing.T) {
+		ct := newClientTracker[int](3)
+		*ct.see("a", at(1), zero) = 1
+		ct.see("b", at(2), zero)
+		ct.see("c", at(3), zero)
+
+		// seeing a client makes it the most recently seen, but getting its
+		// state does not
+		ct.see("a", at(4), zero)
+		ct.get("b")
+
+		ct.see("d", at(5), zero)
+		if got, expected := ids(ct), "[d a c]"; fmt.Sprint(got) != expected {
+			t.Errorf("Expected clients %s, got %v", expected, got)
+		}
+		if ct.get("b") != nil {
+			t.Error("Expected the least recently seen client to be evicted")
+		}
+		if state := ct.get("a"); state == nil || *state != 1 {
+			t.Errorf("Expected the state of a retained client to be retained, got %v", state)
+		}
+	})
+
+	t.Run("No maximum", func(t *testing.T) {
+		ct := newClientTracker[int](0)
+		for i := range 100 {
+			ct.see(string(rune('A'+i)), at(i), zero)
+		}
+		if n := ct.len(); n != 100 {
+			t.Errorf("Expected 100 clients, got %d", n)
+		}
+	})
+
+	t.Run("Remove inactive", func(t *testing.T) {
+		ct := newClientTracker[int](0)
+		ct.see("a", at(1), zero)
+		ct.see("b", at(2), zero)
+		ct.see("c", at(3), zero)
+		ct.see("a", at(4), zero)
+
+		ct.removeInactive(at(12), 10*time.Second)
+		if got, expected := ids(ct), "[a c]"; fmt.Sprint(got) != expected {
+			t.Errorf("Expected clients %s, got %v", expected, got)
+		}
+		if ct.get("b") != nil || len(ct.clients) != 2 {
+			t.Errorf("Expected the inactive client to be removed, got %v", ct.clients)
+		}
+	})
+}
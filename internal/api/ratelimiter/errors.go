@@ -6,4 +6,9 @@ var (
 	ErrInvalidLimit         = errors.New("rate limit must be greater than zero")
 	ErrInvalidLimitInterval = errors.New("limit interval must be at least one second")
 	ErrInvalidClientTimeout = errors.New("client timeout must be greater than limit interval")
+	ErrInvalidExemption     = errors.New("exemption must be an IP address or CIDR range")
+	ErrInvalidBucketSize    = errors.New("bucket size must not be negative")
+	ErrInvalidBurst         = errors.New("burst must not be negative")
+	ErrInvalidMaxClients    = errors.New("max clients must not be negative")
+	ErrInvalidAlgorithm     = errors.New("unsupported rate limiting algorithm")
 )
@@ -0,0 +1,61 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"net"
+)
+
+// exemptions identifies clients that are exempt from rate limiting, either
+// by exact IP address or by inclusion in a CIDR range
+type exemptions struct {
+	ips  []net.IP
+	nets []*net.IPNet
+}
+
+// parseExemptions parses a list of IP addresses and/or CIDR ranges.  Returns
+// ErrInvalidExemption if any entry is neither a valid CIDR range nor a valid
+// IP address.
+func parseExemptions(entries []string) (exemptions, error) {
+	var result exemptions
+
+	for _, entry := range entries {
+		if _, ipnet, err := net.ParseCIDR(entry); err == nil {
+			result.nets = append(result.nets, ipnet)
+			continue
+		}
+
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return exemptions{}, fmt.Errorf("%w: %q", ErrInvalidExemption, entry)
+		}
+		result.ips = append(result.ips, ip)
+	}
+
+	return result, nil
+}
+
+// contains returns true if the specified client IP is exempt
+func (ex exemptions) contains(client string) bool {
+	if len(ex.ips) == 0 && len(ex.nets) == 0 {
+		return false
+	}
+
+	ip := net.ParseIP(client)
+	if ip == nil {
+		return false
+	}
+
+	for _, ipnet := range ex.nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+
+	for _, exempt := range ex.ips {
+		if exempt.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,8 +1,15 @@
 package ratelimiter
 
-import "net/http"
+import (
+	"net/http"
 
-type NoopLimiter struct{}
+	"github.com/blugnu/time"
+)
+
+// NoopLimiter is a rate limiter that allows all requests
+type NoopLimiter struct {
+	stats
+}
 
 func NewNoopLimiter() *NoopLimiter {
 	return &NoopLimiter{}
@@ -10,5 +17,31 @@ func NewNoopLimiter() *NoopLimiter {
 
 // Allow always returns true, indicating that all requests are allowed
 func (n *NoopLimiter) Allow(rq *http.Request) bool {
-	return true
+	return n.record(true)
+}
+
+// AllowN always returns true, regardless of cost
+func (n *NoopLimiter) AllowN(rq *http.Request, cost int) bool {
+	return n.record(true)
+}
+
+// Reset has no effect, since no client is limited
+func (n *NoopLimiter) Reset(clientID string) {}
+
+// Stop has no effect, since a NoopLimiter has no goroutines
+func (n *NoopLimiter) Stop() {}
+
+// Limit returns Unlimited
+func (n *NoopLimiter) Limit() int {
+	return Unlimited
+}
+
+// Remaining returns Unlimited
+func (n *NoopLimiter) Remaining(rq *http.Request) int {
+	return Unlimited
+}
+
+// RetryAfter returns zero, since all requests are allowed
+func (n *NoopLimiter) RetryAfter(rq *http.Request, cost int) time.Duration {
+	return 0
 }
@@ -16,4 +16,16 @@ func TestNoopLimiter(t *testing.T) {
 			t.Errorf("Expected request #%d to be allowed", i)
 		}
 	}
+
+	// the limiter reports that requests are unlimited
+	if limit := rateLimiter.Limit(); limit != ratelimiter.Unlimited {
+		t.Errorf("Expected unlimited limit, got %d", limit)
+	}
+	if remaining := rateLimiter.Remaining(&http.Request{RemoteAddr: "test"}); remaining != ratelimiter.Unlimited {
+		t.Errorf("Expected unlimited remaining, got %d", remaining)
+	}
+	// every request is counted as allowed
+	if allowed, denied := rateLimiter.Stats(); allowed != 1000 || denied != 0 {
+		t.Errorf("Expected 1000 allowed and 0 denied, got %d allowed and %d denied", allowed, denied)
+	}
 }
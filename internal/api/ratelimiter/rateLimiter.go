@@ -2,8 +2,10 @@ package ratelimiter
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"regexp"
+	"strings"
 	"sync"
 
 	"github.com/blugnu/time"
@@ -17,17 +19,46 @@ var (
 	patIP = regexp.MustCompile(`^(.*):[0-9]{1,5}$`)
 )
 
-// ClientActivity tracks the number of requests and the last seen time for each client
+// ClientActivity tracks the number of requests from each client in the
+// current limit interval
 type ClientActivity struct {
 	requestCount int
-	lastSeen     time.Time
 }
 
+// Unlimited is reported as the limit (and remaining requests) by rate
+// limiters that do not limit requests from a client
+const Unlimited = -1
+
+// Algorithm identifies a rate limiting algorithm
+type Algorithm string
+
+const (
+	// FixedWindow limits the number of requests from a client in each limit
+	// interval, with the count reset at the end of each interval (default)
+	FixedWindow Algorithm = "fixed-window"
+
+	// TokenBucket allows requests from a client while tokens remain in a
+	// bucket that is continuously refilled at a rate of Limit tokens per
+	// limit interval
+	TokenBucket Algorithm = "token-bucket"
+)
+
 // Config provides configuration for a RateLimiter
 type Config struct {
-	Limit         int           // Maximum requests per second
+	Algorithm     Algorithm     // Rate limiting algorithm (default: FixedWindow)
+	Limit         int           // Maximum requests per limit interval
 	LimitInterval time.Duration // Time interval for the limit
+	Burst         int           // Requests allowed in each limit interval in excess of Limit (FixedWindow only)
+	BucketSize    int           // Token bucket capacity; zero for the same as Limit (TokenBucket only)
 	ClientTimeout time.Duration // Time after which a client is considered inactive
+	MaxClients    int           // Maximum number of clients tracked; zero for no maximum
+	Exempt        []string      // IP addresses and/or CIDR ranges exempt from rate limiting
+	TrustProxy    bool          // Identify clients by X-Forwarded-For (when present)
+
+	// ClientIPHeader, if set (e.g. "True-Client-IP" or "CF-Connecting-IP"),
+	// names a header identifying the client that is consulted before
+	// X-Forwarded-For; it is only consulted if TrustProxy is true
+	ClientIPHeader string
 }
 
 // RateLimiter implements a simple rate limiting mechanism
@@ -35,60 +66,223 @@ type Config struct {
 // based on a configured limit and interval.
 type RateLimiter struct {
 	sync.RWMutex
-	time     time.Clock
-	limit    int
-	activity map[string]ClientActivity
+	stats
+	time       time.Clock
+	limit      int
+	burst      int
+	exempt     exemptions
+	trustProxy bool
+	ipHeader   string
+	activity   *clientTracker[ClientActivity]
+	nextReset  time.Time // the time at which request counts are next reset
+	stop       context.CancelFunc
+	running    sync.WaitGroup // the goroutines resetting counts and removing clients
 }
 
 // New creates a new RateLimiter with the specified configuration.
 // It validates the configuration and initializes the rate limiter.
 // Returns an error if the configuration is invalid.
+//
+// The goroutines of the rate limiter run until the context is cancelled or
+// the rate limiter is stopped (see Stop).
 func New(ctx context.Context, cfg Config) (*RateLimiter, error) {
-	if cfg.Limit <= 0 {
-		return nil, ErrInvalidLimit
-	}
-	if cfg.LimitInterval < time.Second {
-		return nil, ErrInvalidLimitInterval
-	}
-	if cfg.ClientTimeout <= cfg.LimitInterval {
-		return nil, ErrInvalidClientTimeout
+	exempt, err := cfg.validate()
+	if err != nil {
+		return nil, err
 	}
 
 	limiter := &RateLimiter{
-		time:     time.ClockFromContext(ctx),
-		limit:    cfg.Limit,
-		activity: map[string]ClientActivity{},
+		time:       time.ClockFromContext(ctx),
+		limit:      cfg.Limit,
+		burst:      cfg.Burst,
+		exempt:     exempt,
+		trustProxy: cfg.TrustProxy,
+		ipHeader:   cfg.ClientIPHeader,
+		activity:   newClientTracker[ClientActivity](cfg.MaxClients),
 	}
 
+	ctx, limiter.stop = context.WithCancel(ctx)
 	limiter.startLimitReset(ctx, cfg.LimitInterval)
 	limiter.startClientCleanup(ctx, cfg.ClientTimeout)
 
 	return limiter, nil
 }
 
+// clientIP returns the IP address of the client making a request.
+//
+// If trustProxy is true, the client is identified by the address in any
+// ipHeader (if specified and valid) or else by the left-most address in any
+// X-Forwarded-For header (if valid).  Otherwise, or if there is no valid
+// address in either header, the client is identified by the request
+// RemoteAddr.
+//
+// Since these headers are trivially forged by a client, they should only be
+// trusted when requests are received via a proxy that sets them.
+func clientIP(rq *http.Request, trustProxy bool, ipHeader string) string {
+	if trustProxy {
+		if ipHeader != "" {
+			if ip := strings.TrimSpace(rq.Header.Get(ipHeader)); net.ParseIP(ip) != nil {
+				return ip
+			}
+		}
+		if xff := rq.Header.Get("X-Forwarded-For"); xff != "" {
+			ip, _, _ := strings.Cut(xff, ",")
+			if ip = strings.TrimSpace(ip); net.ParseIP(ip) != nil {
+				return ip
+			}
+		}
+	}
+
+	if patIP.MatchString(rq.RemoteAddr) {
+		// IPv6 addresses are enclosed in brackets in a RemoteAddr
+		return strings.Trim(patIP.FindStringSubmatch(rq.RemoteAddr)[1], "[]")
+	}
+	return ""
+}
+
+// validate validates the configuration, returning the parsed exemptions
+func (cfg Config) validate() (exemptions, error) {
+	if cfg.Limit <= 0 {
+		return exemptions{}, ErrInvalidLimit
+	}
+	if cfg.LimitInterval < time.Second {
+		return exemptions{}, ErrInvalidLimitInterval
+	}
+	if cfg.ClientTimeout <= cfg.LimitInterval {
+		return exemptions{}, ErrInvalidClientTimeout
+	}
+	if cfg.BucketSize < 0 {
+		return exemptions{}, ErrInvalidBucketSize
+	}
+	if cfg.Burst < 0 {
+		return exemptions{}, ErrInvalidBurst
+	}
+	if cfg.MaxClients < 0 {
+		return exemptions{}, ErrInvalidMaxClients
+	}
+
+	return parseExemptions(cfg.Exempt)
+}
+
 // Allow returns true if the specified request is allowed to execute.
 // It checks if the request from the client is within the allowed
-// rate limit.
+// rate limit, including any burst allowance.  Requests from exempt clients
+// are always allowed.
+//
+// If the maximum number of clients are already tracked, the least recently
+// seen client is evicted to track a new client.
 func (rl *RateLimiter) Allow(rq *http.Request) bool {
+	return rl.AllowN(rq, 1)
+}
+
+// AllowN returns true if the specified request is allowed to execute, as for
+// Allow, with the request counted as cost requests (e.g. so that expensive
+// requests exhaust the limit faster); the request is denied (and not
+// counted) if it would exceed the limit, including any burst allowance.  A
+// cost less than 1 is counted as 1; a cost greater than the limit plus the
+// burst allowance is never allowed.
+func (rl *RateLimiter) AllowN(rq *http.Request, cost int) bool {
+	id, exempt := client(rq, rl.trustProxy, rl.ipHeader, rl.exempt)
+	if exempt {
+		return rl.record(true)
+	}
+
 	rl.Lock()
 	defer rl.Unlock()
 
-	var id = ""
-	if patIP.MatchString(rq.RemoteAddr) {
-		id = patIP.FindStringSubmatch(rq.RemoteAddr)[1]
+	activity := rl.activity.see(id, rl.time.Now(), func() ClientActivity { return ClientActivity{} })
+	cost = max(cost, 1)
+	if activity.requestCount+cost > rl.limit+rl.burst {
+		return rl.record(false)
+	}
+
+	activity.requestCount += cost
+	return rl.record(true)
+}
+
+// requestCount returns the number of requests from a client in the current
+// limit interval; zero if the client is not tracked.  The caller must hold
+// the lock.
+func (rl *RateLimiter) requestCount(id string) int {
+	if activity := rl.activity.get(id); activity != nil {
+		return activity.requestCount
+	}
+	return 0
+}
+
+// Limit returns the maximum number of requests allowed from a client in
+// each limit interval
+func (rl *RateLimiter) Limit() int {
+	return rl.limit
+}
+
+// Remaining returns the number of further requests that would be allowed
+// from the client making the specified request in the current limit
+// interval, within the limit (i.e. excluding any burst allowance) and
+// without counting the request.  Unlimited is returned for exempt clients.
+func (rl *RateLimiter) Remaining(rq *http.Request) int {
+	id, exempt := client(rq, rl.trustProxy, rl.ipHeader, rl.exempt)
+	if exempt {
+		return Unlimited
+	}
+
+	rl.RLock()
+	defer rl.RUnlock()
+
+	return max(0, rl.limit-rl.requestCount(id))
+}
+
+// Burst returns the number of requests allowed from a client in each limit
+// interval in excess of the limit
+func (rl *RateLimiter) Burst() int {
+	return rl.burst
+}
+
+// BurstUsed returns the number of requests from the client making the
+// specified request in the current limit interval that have been in excess
+// of the limit, up to the burst allowance, without counting the request.
+// Unlimited is returned for exempt clients.
+func (rl *RateLimiter) BurstUsed(rq *http.Request) int {
+	id, exempt := client(rq, rl.trustProxy, rl.ipHeader, rl.exempt)
+	if exempt {
+		return Unlimited
 	}
 
-	activity, exists := rl.activity[id]
-	if !exists {
-		activity = ClientActivity{requestCount: 0}
+	rl.RLock()
+	defer rl.RUnlock()
+
+	return min(rl.burst, max(0, rl.requestCount(id)-rl.limit))
+}
+
+// Reset resets the request count of the specified client, allowing the
+// client a full limit of requests in the current limit interval.  Reset has
+// no effect if the client is not being tracked.
+func (rl *RateLimiter) Reset(clientID string) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	if activity := rl.activity.get(clientID); activity != nil {
+		activity.requestCount = 0
 	}
+}
 
-	activity.requestCount += 1
-	activity.lastSeen = rl.time.Now()
+// RetryAfter returns the time until a request from the client making the
+// specified request, counted as cost requests, would be allowed: zero if the
+// request would be allowed now, otherwise the time until request counts are
+// next reset.  Zero is returned for exempt clients.
+func (rl *RateLimiter) RetryAfter(rq *http.Request, cost int) time.Duration {
+	id, exempt := client(rq, rl.trustProxy, rl.ipHeader, rl.exempt)
+	if exempt {
+		return 0
+	}
 
-	rl.activity[id] = activity
+	rl.RLock()
+	defer rl.RUnlock()
 
-	return activity.requestCount <= rl.limit
+	if rl.requestCount(id)+max(cost, 1) <= rl.limit+rl.burst {
+		return 0
+	}
+	return max(0, rl.nextReset.Sub(rl.time.Now()))
 }
 
 // NumberOfClients returns the number of clients currently tracked by the rate limiter.
@@ -97,14 +291,26 @@ func (rl *RateLimiter) NumberOfClients() int {
 	rl.RLock()
 	defer rl.RUnlock()
 
-	return len(rl.activity)
+	return rl.activity.len()
+}
+
+// Stop stops the goroutines of the rate limiter, returning once they have
+// exited.  A stopped rate limiter continues to count requests but no longer
+// resets request counts or removes inactive clients, so should be discarded.
+// Stop may be called more than once.
+func (rl *RateLimiter) Stop() {
+	rl.stop()
+	rl.running.Wait()
 }
 
 // startLimitReset starts a goroutine that resets the request count for all clients
 // when the configured limit interval expires.
 func (rl *RateLimiter) startLimitReset(ctx context.Context, dur time.Duration) {
 	ticker := rl.time.NewTicker(dur)
+	rl.nextReset = rl.time.Now().Add(dur)
+	rl.running.Add(1)
 	go func() {
+		defer rl.running.Done()
 		defer ticker.Stop()
 
 		for {
@@ -112,13 +318,13 @@ func (rl *RateLimiter) startLimitReset(ctx context.Context, dur time.Duration) {
 			case <-ctx.Done():
 				return
 
-			case <-ticker.C:
+			case now := <-ticker.C:
 				rl.Lock()
-				for client, activity := range rl.activity {
+				rl.activity.each(func(activity *ClientActivity) {
 					// reset request count for each client
 					activity.requestCount = 0
-					rl.activity[client] = activity
-				}
+				})
+				rl.nextReset = now.Add(dur)
 				rl.Unlock()
 			}
 		}
@@ -129,7 +335,9 @@ func (rl *RateLimiter) startLimitReset(ctx context.Context, dur time.Duration) {
 // any requests in the configured client timeout interval.
 func (rl *RateLimiter) startClientCleanup(ctx context.Context, dur time.Duration) {
 	ticker := rl.time.NewTicker(dur)
+	rl.running.Add(1)
 	go func() {
+		defer rl.running.Done()
 		defer ticker.Stop()
 		for {
 			select {
@@ -138,11 +346,7 @@ func (rl *RateLimiter) startClientCleanup(ctx context.Context, dur time.Duration
 
 			case now := <-ticker.C:
 				rl.Lock()
-				for client, activity := range rl.activity {
-					if now.Sub(activity.lastSeen) >= dur {
-						delete(rl.activity, client) // remove client if no requests in last 10 seconds
-					}
-				}
+				rl.activity.removeInactive(now, dur)
 				rl.Unlock()
 			}
 		}
@@ -3,8 +3,10 @@ package ratelimiter_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"products-api/internal/api/ratelimiter"
+	"runtime"
 	"testing"
 
 	"github.com/blugnu/time"
@@ -30,6 +32,27 @@ func TestRateLimiterConfiguration(t *testing.T) {
 	if !errors.Is(err, ratelimiter.ErrInvalidClientTimeout) {
 		t.Errorf("Expected error for invalid client timeout, got: %v", err)
 	}
+
+	cfg.ClientTimeout = time.Minute
+	cfg.Exempt = []string{"10.0.0.0/8", "not-an-ip"}
+	_, err = ratelimiter.New(ctx, cfg)
+	if !errors.Is(err, ratelimiter.ErrInvalidExemption) {
+		t.Errorf("Expected error for invalid exemption, got: %v", err)
+	}
+
+	cfg.Exempt = nil
+	cfg.Burst = -1
+	_, err = ratelimiter.New(ctx, cfg)
+	if !errors.Is(err, ratelimiter.ErrInvalidBurst) {
+		t.Errorf("Expected error for invalid burst, got: %v", err)
+	}
+
+	cfg.Burst = 0
+	cfg.MaxClients = -1
+	_, err = ratelimiter.New(ctx, cfg)
+	if !errors.Is(err, ratelimiter.ErrInvalidMaxClients) {
+		t.Errorf("Expected error for invalid max clients, got: %v", err)
+	}
 }
 
 func TestRateLimiter(t *testing.T) {
@@ -95,3 +118,576 @@ func TestRateLimiter(t *testing.T) {
 		t.Errorf("Expected no clients after client timeout, got %d", rateLimiter.NumberOfClients())
 	}
 }
+
+func TestRateLimiterBurst(t *testing.T) {
+	clock := time.NewMockClock()
+	ctx, cancel := context.WithCancel(time.ContextWithClock(context.Background(), clock))
+	defer cancel()
+
+	cfg := ratelimiter.Config{
+		Limit:         3,
+		Burst:         2,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+	}
+
+	rateLimiter, err := ratelimiter.New(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+
+	// requests within the limit and burst are allowed; the burst used counts
+	// only the requests in excess of the limit, up to the burst
+	rq := &http.Request{RemoteAddr: "198.51.100.1:1234"}
+	for i, expected := range []struct {
+		allowed   bool
+		remaining int
+		burstUsed int
+	}{
+		{allowed: true, remaining: 2, burstUsed: 0},
+		{allowed: true, remaining: 1, burstUsed: 0},
+		{allowed: true, remaining: 0, burstUsed: 0},
+		{allowed: true, remaining: 0, burstUsed: 1},
+		{allowed: true, remaining: 0, burstUsed: 2},
+		{allowed: false, remaining: 0, burstUsed: 2},
+	} {
+		if allowed := rateLimiter.Allow(rq); allowed != expected.allowed {
+			t.Errorf("request #%d: expected allowed %v, got %v", i+1, expected.allowed, allowed)
+		}
+		if remaining := rateLimiter.Remaining(rq); remaining != expected.remaining {
+			t.Errorf("request #%d: expected %d remaining, got %d", i+1, expected.remaining, remaining)
+		}
+		if used := rateLimiter.BurstUsed(rq); used != expected.burstUsed {
+			t.Errorf("request #%d: expected burst used %d, got %d", i+1, expected.burstUsed, used)
+		}
+	}
+
+	// the request counts (including the burst used) are reset as usual
+	clock.AdvanceBy(cfg.LimitInterval)
+	if !rateLimiter.Allow(rq) {
+		t.Error("Expected request to be allowed after the limit interval")
+	}
+	if used := rateLimiter.BurstUsed(rq); used != 0 {
+		t.Errorf("Expected burst used 0 after the limit interval, got %d", used)
+	}
+}
+
+func TestRateLimiterExemptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = time.ContextWithClock(ctx, time.NewMockClock())
+
+	cfg := ratelimiter.Config{
+		Limit:         5,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+		Exempt:        []string{"10.0.0.0/8", "192.0.2.1", "::1"},
+	}
+
+	rateLimiter, err := ratelimiter.New(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		exempt     bool
+	}{
+		{remoteAddr: "10.1.2.3:1234", exempt: true},  // in CIDR range
+		{remoteAddr: "192.0.2.1:1234", exempt: true}, // exact IP
+		{remoteAddr: "[::1]:1234", exempt: true},     // exact IPv6
+		{remoteAddr: "192.0.2.2:1234", exempt: false},
+		{remoteAddr: "11.0.0.1:1234", exempt: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remoteAddr, func(t *testing.T) {
+			// exceed the limit for the client
+			allowed := 0
+			for range 2 * cfg.Limit {
+				if rateLimiter.Allow(&http.Request{RemoteAddr: tt.remoteAddr}) {
+					allowed++
+				}
+			}
+
+			switch {
+			case tt.exempt && allowed != 2*cfg.Limit:
+				t.Errorf("Expected all %d requests from exempt client to be allowed, got %d", 2*cfg.Limit, allowed)
+			case !tt.exempt && allowed != cfg.Limit:
+				t.Errorf("Expected %d requests from non-exempt client to be allowed, got %d", cfg.Limit, allowed)
+			}
+		})
+	}
+}
+
+func TestRateLimiterTrustProxy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = time.ContextWithClock(ctx, time.NewMockClock())
+
+	// request returns a request received from a single proxy address on
+	// behalf of the specified (forwarded) client
+	request := func(client string) *http.Request {
+		rq := &http.Request{RemoteAddr: "192.0.2.1:1234", Header: http.Header{}}
+		rq.Header.Set("X-Forwarded-For", client)
+		return rq
+	}
+
+	for _, trustProxy := range []bool{true, false} {
+		t.Run(fmt.Sprintf("TrustProxy=%v", trustProxy), func(t *testing.T) {
+			cfg := ratelimiter.Config{
+				Limit:         5,
+				LimitInterval: time.Second,
+				ClientTimeout: time.Minute,
+				TrustProxy:    trustProxy,
+			}
+
+			rateLimiter, err := ratelimiter.New(ctx, cfg)
+			if err != nil {
+				t.Fatalf("Failed to create rate limiter: %v", err)
+			}
+
+			// exhaust the limit for one forwarded client
+			for range cfg.Limit {
+				rateLimiter.Allow(request("198.51.100.1"))
+			}
+
+			// a request for a different forwarded client is only allowed
+			// if the proxy is trusted; otherwise all requests are from the proxy
+			allowed := rateLimiter.Allow(request("198.51.100.2"))
+			if allowed != trustProxy {
+				t.Errorf("Expected request allowed to be %v, got %v", trustProxy, allowed)
+			}
+		})
+	}
+}
+
+func TestRateLimiterStop(t *testing.T) {
+	// the limiters are created with a context that is never cancelled, so
+	// their goroutines exit only if they are stopped
+	cfg := ratelimiter.Config{
+		Limit:         5,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+	}
+
+	type limiter interface{ Stop() }
+	for name, newLimiter := range map[string]func() (limiter, error){
+		"FixedWindow": func() (limiter, error) { return ratelimiter.New(context.Background(), cfg) },
+		"TokenBucket": func() (limiter, error) { return ratelimiter.NewTokenBucket(context.Background(), cfg) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			goroutines := runtime.NumGoroutine()
+
+			for range 100 {
+				rateLimiter, err := newLimiter()
+				if err != nil {
+					t.Fatalf("Failed to create rate limiter: %v", err)
+				}
+				rateLimiter.Stop()
+				rateLimiter.Stop() // stopping again has no effect
+			}
+
+			if n := runtime.NumGoroutine(); n > goroutines {
+				t.Errorf("Expected at most %d goroutines after stopping the limiters, got %d", goroutines, n)
+			}
+		})
+	}
+}
+
+func TestRateLimiterClientIPHeader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = time.ContextWithClock(ctx, time.NewMockClock())
+
+	// request returns a request received from a single proxy address, with
+	// the same X-Forwarded-For, on behalf of the specified client
+	request := func(client string) *http.Request {
+		rq := &http.Request{RemoteAddr: "192.0.2.1:1234", Header: http.Header{}}
+		rq.Header.Set("X-Forwarded-For", "198.51.100.1")
+		rq.Header.Set("CF-Connecting-IP", client)
+		return rq
+	}
+
+	for _, trustProxy := range []bool{true, false} {
+		t.Run(fmt.Sprintf("TrustProxy=%v", trustProxy), func(t *testing.T) {
+			cfg := ratelimiter.Config{
+				Limit:          5,
+				LimitInterval:  time.Second,
+				ClientTimeout:  time.Minute,
+				TrustProxy:     trustProxy,
+				ClientIPHeader: "CF-Connecting-IP",
+			}
+
+			type limiter interface{ Allow(*http.Request) bool }
+			for name, newLimiter := range map[string]func() (limiter, error){
+				"FixedWindow": func() (limiter, error) { return ratelimiter.New(ctx, cfg) },
+				"TokenBucket": func() (limiter, error) { return ratelimiter.NewTokenBucket(ctx, cfg) },
+			} {
+				t.Run(name, func(t *testing.T) {
+					rateLimiter, err := newLimiter()
+					if err != nil {
+						t.Fatalf("Failed to create rate limiter: %v", err)
+					}
+
+					// exhaust the limit for one client
+					for range cfg.Limit {
+						rateLimiter.Allow(request("203.0.113.1"))
+					}
+
+					// a request for a different client is only allowed if the
+					// proxy is trusted; otherwise all requests are from the proxy
+					allowed := rateLimiter.Allow(request("203.0.113.2"))
+					if allowed != trustProxy {
+						t.Errorf("Expected request allowed to be %v, got %v", trustProxy, allowed)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestRateLimiterClientID(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = time.ContextWithClock(ctx, time.NewMockClock())
+
+	// request returns a request from an address, identifying the client by
+	// an ID (if not empty)
+	request := func(addr, id string) *http.Request {
+		rq := &http.Request{RemoteAddr: addr + ":1234", Header: http.Header{}}
+		if id != "" {
+			rq = rq.WithContext(ratelimiter.ContextWithClientID(ctx, id))
+		}
+		return rq
+	}
+
+	cfg := ratelimiter.Config{
+		Limit:         5,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+		Exempt:        []string{"203.0.113.1"},
+	}
+
+	type limiter interface{ Allow(*http.Request) bool }
+	for name, newLimiter := range map[string]func() (limiter, error){
+		"FixedWindow": func() (limiter, error) { return ratelimiter.New(ctx, cfg) },
+		"TokenBucket": func() (limiter, error) { return ratelimiter.NewTokenBucket(ctx, cfg) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			rateLimiter, err := newLimiter()
+			if err != nil {
+				t.Fatalf("Failed to create rate limiter: %v", err)
+			}
+
+			// exhaust the limit for a client using two addresses
+			for i := range cfg.Limit {
+				if !rateLimiter.Allow(request(fmt.Sprintf("192.0.2.%d", i%2+1), "key:a")) {
+					t.Fatalf("Expected request %d to be allowed", i+1)
+				}
+			}
+
+			for _, tt := range []struct {
+				name     string
+				addr     string
+				id       string
+				expected bool
+			}{
+				{name: "Same ID, same address", addr: "192.0.2.1", id: "key:a", expected: false},
+				{name: "Same ID, different address", addr: "198.51.100.1", id: "key:a", expected: false},
+				{name: "Different ID, same address", addr: "192.0.2.1", id: "key:b", expected: true},
+				{name: "No ID, same address", addr: "192.0.2.1", expected: true},
+				{name: "Same ID, exempt address", addr: "203.0.113.1", id: "key:a", expected: true},
+			} {
+				if allowed := rateLimiter.Allow(request(tt.addr, tt.id)); allowed != tt.expected {
+					t.Errorf("%s: expected request allowed to be %v, got %v", tt.name, tt.expected, allowed)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterRemaining(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := time.NewMockClock()
+	ctx = time.ContextWithClock(ctx, clock)
+
+	cfg := ratelimiter.Config{
+		Limit:         3,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+		Exempt:        []string{"192.0.2.1"},
+	}
+
+	rateLimiter, err := ratelimiter.New(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+
+	if limit := rateLimiter.Limit(); limit != 3 {
+		t.Errorf("Expected limit 3, got %d", limit)
+	}
+
+	rq := &http.Request{RemoteAddr: "198.51.100.1:1234"}
+	if remaining := rateLimiter.Remaining(rq); remaining != 3 {
+		t.Errorf("Expected 3 remaining for a new client, got %d", remaining)
+	}
+
+	// remaining requests are not consumed by Remaining, and do not go
+	// below zero when requests are denied
+	for i, expected := range []int{2, 1, 0, 0} {
+		rateLimiter.Allow(rq)
+		for range 2 {
+			if remaining := rateLimiter.Remaining(rq); remaining != expected {
+				t.Errorf("request #%d: expected %d remaining, got %d", i+1, expected, remaining)
+			}
+		}
+	}
+
+	clock.AdvanceBy(cfg.LimitInterval)
+	if remaining := rateLimiter.Remaining(rq); remaining != 3 {
+		t.Errorf("Expected 3 remaining after reset, got %d", remaining)
+	}
+
+	exempt := &http.Request{RemoteAddr: "192.0.2.1:1234"}
+	if remaining := rateLimiter.Remaining(exempt); remaining != ratelimiter.Unlimited {
+		t.Errorf("Expected unlimited remaining for an exempt client, got %d", remaining)
+	}
+}
+
+func TestRateLimiterMaxClients(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock := time.NewMockClock()
+	ctx = time.ContextWithClock(ctx, clock)
+
+	cfg := ratelimiter.Config{
+		Limit:         2,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+		MaxClients:    3,
+	}
+
+	rateLimiter, err := ratelimiter.New(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+
+	request := func(client string) bool {
+		clock.AdvanceBy(10 * time.Millisecond)
+		return rateLimiter.Allow(&http.Request{RemoteAddr: client + ":1234"})
+	}
+
+	// client A exhausts its limit, then B and C are seen, then A again
+	for range cfg.Limit {
+		request("198.51.100.1")
+	}
+	request("198.51.100.2")
+	request("198.51.100.3")
+	if request("198.51.100.1") {
+		t.Error("Expected request from client A to be denied")
+	}
+
+	// a new client evicts the least recently seen client (B), so A remains
+	// tracked (and limited)
+	request("198.51.100.4")
+	if n := rateLimiter.NumberOfClients(); n != cfg.MaxClients {
+		t.Errorf("Expected %d clients, got %d", cfg.MaxClients, n)
+	}
+	if request("198.51.100.1") {
+		t.Error("Expected client A to remain tracked and its request to be denied")
+	}
+
+	// a flood of new clients does not grow the number of clients tracked
+	for i := range 100 {
+		request(fmt.Sprintf("203.0.113.%d", i))
+	}
+	if n := rateLimiter.NumberOfClients(); n != cfg.MaxClients {
+		t.Errorf("Expected %d clients after a flood of new clients, got %d", cfg.MaxClients, n)
+	}
+}
+
+func TestRateLimiterStats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = time.ContextWithClock(ctx, time.NewMockClock())
+
+	cfg := ratelimiter.Config{
+		Limit:         5,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+		Exempt:        []string{"192.0.2.1"},
+	}
+
+	rateLimiter, err := ratelimiter.New(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+
+	if allowed, denied := rateLimiter.Stats(); allowed != 0 || denied != 0 {
+		t.Errorf("Expected no requests counted initially, got %d allowed and %d denied", allowed, denied)
+	}
+
+	// 8 requests from a client are 5 allowed and 3 denied; 4 requests from an
+	// exempt client are all allowed
+	for range 8 {
+		rateLimiter.Allow(&http.Request{RemoteAddr: "198.51.100.1:1234"})
+	}
+	for range 4 {
+		rateLimiter.Allow(&http.Request{RemoteAddr: "192.0.2.1:1234"})
+	}
+
+	if allowed, denied := rateLimiter.Stats(); allowed != 9 || denied != 3 {
+		t.Errorf("Expected 9 allowed and 3 denied, got %d allowed and %d denied", allowed, denied)
+	}
+}
+
+func TestRateLimiterAllowN(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = time.ContextWithClock(ctx, time.NewMockClock())
+
+	cfg := ratelimiter.Config{
+		Limit:         10,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+	}
+
+	rateLimiter, err := ratelimiter.New(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+
+	// a client making requests costing 5 is limited after 2 requests; a
+	// client making requests costing 1 is limited after 10
+	for _, tc := range []struct {
+		addr    string
+		cost    int
+		allowed int
+	}{
+		{addr: "198.51.100.1:1234", cost: 5, allowed: 2},
+		{addr: "198.51.100.2:1234", cost: 1, allowed: 10},
+		{addr: "198.51.100.3:1234", cost: 0, allowed: 10},
+	} {
+		rq := &http.Request{RemoteAddr: tc.addr}
+		for i := 1; i <= tc.allowed+1; i++ {
+			if got, want := rateLimiter.AllowN(rq, tc.cost), i <= tc.allowed; got != want {
+				t.Errorf("%s: request %d costing %d: expected allowed %v, got %v", tc.addr, i, tc.cost, want, got)
+			}
+		}
+	}
+
+	// requests of differing cost accumulate for the same client
+	rq := &http.Request{RemoteAddr: "198.51.100.4:1234"}
+	if !rateLimiter.AllowN(rq, 5) {
+		t.Error("Expected request costing 5 to be allowed")
+	}
+	for i := 1; i <= 5; i++ {
+		if !rateLimiter.Allow(rq) {
+			t.Errorf("Expected request %d costing 1 to be allowed", i)
+		}
+	}
+	if rateLimiter.Allow(rq) {
+		t.Error("Expected request exceeding the accumulated cost to be denied")
+	}
+	if remaining := rateLimiter.Remaining(rq); remaining != 0 {
+		t.Errorf("Expected 0 remaining, got %d", remaining)
+	}
+
+	// a denied request is not counted
+	rq = &http.Request{RemoteAddr: "198.51.100.5:1234"}
+	if !rateLimiter.AllowN(rq, 8) {
+		t.Error("Expected request costing 8 to be allowed")
+	}
+	if rateLimiter.AllowN(rq, 5) {
+		t.Error("Expected request exceeding the limit to be denied")
+	}
+	if remaining := rateLimiter.Remaining(rq); remaining != 2 {
+		t.Errorf("Expected 2 remaining after a denied request, got %d", remaining)
+	}
+}
+
+func TestRateLimiterReset(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = time.ContextWithClock(ctx, time.NewMockClock())
+
+	cfg := ratelimiter.Config{
+		Limit:         3,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+	}
+
+	rateLimiter, err := ratelimiter.New(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+
+	// exhaust the limit of a client
+	rq := &http.Request{RemoteAddr: "198.51.100.1:1234"}
+	for range 4 {
+		rateLimiter.Allow(rq)
+	}
+	if rateLimiter.Allow(rq) {
+		t.Fatal("Expected request from exhausted client to be denied")
+	}
+
+	// resetting an unknown client has no effect
+	rateLimiter.Reset("198.51.100.2")
+	if n := rateLimiter.NumberOfClients(); n != 1 {
+		t.Errorf("Expected 1 client after resetting an unknown client, got %d", n)
+	}
+
+	// after reset, the client is allowed a full limit of requests
+	rateLimiter.Reset("198.51.100.1")
+	for i := 1; i <= 4; i++ {
+		if got, want := rateLimiter.Allow(rq), i <= 3; got != want {
+			t.Errorf("Request %d after reset: expected allowed %v, got %v", i, want, got)
+		}
+	}
+}
+
+func TestRateLimiterRetryAfter(t *testing.T) {
+	clock := time.NewMockClock()
+	ctx, cancel := context.WithCancel(time.ContextWithClock(context.Background(), clock))
+	defer cancel()
+
+	cfg := ratelimiter.Config{
+		Limit:         3,
+		LimitInterval: 10 * time.Second,
+		ClientTimeout: time.Minute,
+		Exempt:        []string{"198.51.100.2"},
+	}
+
+	rateLimiter, err := ratelimiter.New(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+
+	rq := &http.Request{RemoteAddr: "198.51.100.1:1234"}
+	if d := rateLimiter.RetryAfter(rq, 1); d != 0 {
+		t.Errorf("Expected no wait for a new client, got %v", d)
+	}
+
+	// a request within the limit need not wait, even if a costlier one must
+	rateLimiter.AllowN(rq, 2)
+	if d := rateLimiter.RetryAfter(rq, 1); d != 0 {
+		t.Errorf("Expected no wait for a request within the limit, got %v", d)
+	}
+	if d := rateLimiter.RetryAfter(rq, 2); d != 10*time.Second {
+		t.Errorf("Expected a wait of 10s for a request beyond the limit, got %v", d)
+	}
+
+	// the wait is until the end of the current interval
+	clock.AdvanceBy(4 * time.Second)
+	rateLimiter.AllowN(rq, 1)
+	if d := rateLimiter.RetryAfter(rq, 1); d != 6*time.Second {
+		t.Errorf("Expected a wait of 6s, got %v", d)
+	}
+
+	// exempt clients never wait
+	if d := rateLimiter.RetryAfter(&http.Request{RemoteAddr: "198.51.100.2:1234"}, 100); d != 0 {
+		t.Errorf("Expected no wait for an exempt client, got %v", d)
+	}
+}
@@ -0,0 +1,27 @@
+package ratelimiter
+
+import "sync/atomic"
+
+// stats counts the requests allowed and denied by a rate limiter.  It is
+// embedded in each rate limiter, providing the Stats method.
+type stats struct {
+	allowed atomic.Uint64
+	denied  atomic.Uint64
+}
+
+// record counts a request as allowed or denied, returning allowed
+func (s *stats) record(allowed bool) bool {
+	if allowed {
+		s.allowed.Add(1)
+	} else {
+		s.denied.Add(1)
+	}
+	return allowed
+}
+
+// Stats returns the cumulative number of requests allowed and denied by the
+// rate limiter (requests from exempt clients are counted as allowed).  It is
+// safe to call concurrently with requests being allowed or denied.
+func (s *stats) Stats() (allowed, denied uint64) {
+	return s.allowed.Load(), s.denied.Load()
+}
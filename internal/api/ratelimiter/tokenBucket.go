@@ -0,0 +1,218 @@
+package ratelimiter
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/blugnu/time"
+)
+
+// bucket holds the tokens available to a client
+type bucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+// TokenBucketLimiter implements token bucket rate limiting.
+//
+// Each client has a bucket holding up to a configured number of tokens; each
+// request consumes a token and is denied if the bucket is empty.  Buckets
+// are refilled continuously at a rate of Limit tokens per LimitInterval,
+// calculated from the time elapsed since the bucket was last refilled.
+//
+// Compared to the fixed window RateLimiter, this avoids allowing bursts of
+// up to twice the limit either side of a window boundary.
+type TokenBucketLimiter struct {
+	sync.RWMutex
+	stats
+	time       time.Clock
+	capacity   float64
+	rate       float64 // tokens per second
+	exempt     exemptions
+	trustProxy bool
+	ipHeader   string
+	buckets    *clientTracker[bucket]
+	stop       context.CancelFunc
+	running    sync.WaitGroup // the goroutine removing clients
+}
+
+// NewTokenBucket creates a new TokenBucketLimiter with the specified
+// configuration.  The bucket size defaults to the limit if not specified.
+// Returns an error if the configuration is invalid.
+//
+// The goroutine of the limiter runs until the context is cancelled or the
+// limiter is stopped (see Stop).
+func NewTokenBucket(ctx context.Context, cfg Config) (*TokenBucketLimiter, error) {
+	exempt, err := cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	capacity := cfg.BucketSize
+	if capacity == 0 {
+		capacity = cfg.Limit
+	}
+
+	limiter := &TokenBucketLimiter{
+		time:       time.ClockFromContext(ctx),
+		capacity:   float64(capacity),
+		rate:       float64(cfg.Limit) / cfg.LimitInterval.Seconds(),
+		exempt:     exempt,
+		trustProxy: cfg.TrustProxy,
+		ipHeader:   cfg.ClientIPHeader,
+		buckets:    newClientTracker[bucket](cfg.MaxClients),
+	}
+
+	ctx, limiter.stop = context.WithCancel(ctx)
+	limiter.startClientCleanup(ctx, cfg.ClientTimeout)
+
+	return limiter, nil
+}
+
+// Allow returns true if the specified request is allowed to execute,
+// consuming a token from the client's bucket.  Requests from exempt clients
+// are always allowed.
+//
+// If the maximum number of clients are already tracked, the bucket of the
+// least recently seen client is discarded to track a new client.
+func (tb *TokenBucketLimiter) Allow(rq *http.Request) bool {
+	return tb.AllowN(rq, 1)
+}
+
+// AllowN returns true if the specified request is allowed to execute, as for
+// Allow, consuming cost tokens from the client's bucket; the request is
+// denied (consuming no tokens) if fewer tokens remain.  A cost less than 1
+// consumes 1 token; a cost greater than the bucket size is never allowed.
+func (tb *TokenBucketLimiter) AllowN(rq *http.Request, cost int) bool {
+	id, exempt := client(rq, tb.trustProxy, tb.ipHeader, tb.exempt)
+	if exempt {
+		return tb.record(true)
+	}
+
+	tb.Lock()
+	defer tb.Unlock()
+
+	now := tb.time.Now()
+
+	// new clients start with a full bucket
+	b := tb.buckets.see(id, now, func() bucket { return bucket{tokens: tb.capacity, lastRefill: now} })
+
+	elapsed := now.Sub(b.lastRefill)
+	b.tokens = min(tb.capacity, b.tokens+elapsed.Seconds()*tb.rate)
+	b.lastRefill = now
+
+	tokens := float64(max(cost, 1))
+	if b.tokens < tokens {
+		return tb.record(false)
+	}
+
+	b.tokens -= tokens
+	return tb.record(true)
+}
+
+// Reset refills the bucket of the specified client.  Reset has no effect if
+// the client is not being tracked.
+func (tb *TokenBucketLimiter) Reset(clientID string) {
+	tb.Lock()
+	defer tb.Unlock()
+
+	if b := tb.buckets.get(clientID); b != nil {
+		b.tokens = tb.capacity
+		b.lastRefill = tb.time.Now()
+	}
+}
+
+// Limit returns the capacity of a client's bucket, i.e. the maximum number
+// of requests allowed from a client in a burst
+func (tb *TokenBucketLimiter) Limit() int {
+	return int(tb.capacity)
+}
+
+// Remaining returns the number of whole tokens currently in the bucket of
+// the client making the specified request (after refilling), without
+// consuming a token.  Unlimited is returned for exempt clients.
+func (tb *TokenBucketLimiter) Remaining(rq *http.Request) int {
+	id, exempt := client(rq, tb.trustProxy, tb.ipHeader, tb.exempt)
+	if exempt {
+		return Unlimited
+	}
+
+	tb.RLock()
+	defer tb.RUnlock()
+
+	b := tb.buckets.get(id)
+	if b == nil {
+		return int(tb.capacity)
+	}
+
+	elapsed := tb.time.Now().Sub(b.lastRefill)
+	return int(min(tb.capacity, b.tokens+elapsed.Seconds()*tb.rate))
+}
+
+// RetryAfter returns the time until the bucket of the client making the
+// specified request holds cost tokens (after refilling): zero if the request
+// would be allowed now.  Since a cost greater than the bucket size is never
+// allowed, the time until the bucket is full is returned for such a cost.
+// Zero is returned for exempt clients.
+func (tb *TokenBucketLimiter) RetryAfter(rq *http.Request, cost int) time.Duration {
+	id, exempt := client(rq, tb.trustProxy, tb.ipHeader, tb.exempt)
+	if exempt {
+		return 0
+	}
+
+	tb.RLock()
+	defer tb.RUnlock()
+
+	b := tb.buckets.get(id)
+	if b == nil {
+		return 0
+	}
+
+	elapsed := tb.time.Now().Sub(b.lastRefill)
+	tokens := min(tb.capacity, b.tokens+elapsed.Seconds()*tb.rate)
+	needed := min(tb.capacity, float64(max(cost, 1))) - tokens
+	if needed <= 0 {
+		return 0
+	}
+	return time.Duration(needed / tb.rate * float64(time.Second))
+}
+
+// NumberOfClients returns the number of clients currently tracked by the rate limiter.
+// This is useful for monitoring and debugging purposes.
+func (tb *TokenBucketLimiter) NumberOfClients() int {
+	tb.RLock()
+	defer tb.RUnlock()
+
+	return tb.buckets.len()
+}
+
+// Stop stops the goroutine of the limiter, returning once it has exited.  A
+// stopped limiter continues to allow requests but no longer removes inactive
+// clients, so should be discarded.  Stop may be called more than once.
+func (tb *TokenBucketLimiter) Stop() {
+	tb.stop()
+	tb.running.Wait()
+}
+
+// startClientCleanup starts a goroutine that removes clients that have not made
+// any requests in the configured client timeout interval.
+func (tb *TokenBucketLimiter) startClientCleanup(ctx context.Context, dur time.Duration) {
+	ticker := tb.time.NewTicker(dur)
+	tb.running.Add(1)
+	go func() {
+		defer tb.running.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case now := <-ticker.C:
+				tb.Lock()
+				tb.buckets.removeInactive(now, dur)
+				tb.Unlock()
+			}
+		}
+	}()
+}
@@ -0,0 +1,411 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"products-api/internal/api/ratelimiter"
+	"testing"
+
+	"github.com/blugnu/time"
+)
+
+func TestTokenBucketConfiguration(t *testing.T) {
+	ctx := context.Background()
+	cfg := ratelimiter.Config{
+		Limit:         5,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+		BucketSize:    -1,
+	}
+
+	_, err := ratelimiter.NewTokenBucket(ctx, cfg)
+	if !errors.Is(err, ratelimiter.ErrInvalidBucketSize) {
+		t.Errorf("Expected error for invalid bucket size, got: %v", err)
+	}
+
+	cfg.BucketSize = 0
+	cfg.MaxClients = -1
+	_, err = ratelimiter.NewTokenBucket(ctx, cfg)
+	if !errors.Is(err, ratelimiter.ErrInvalidMaxClients) {
+		t.Errorf("Expected error for invalid max clients, got: %v", err)
+	}
+
+	cfg.Limit = 0
+	_, err = ratelimiter.NewTokenBucket(ctx, cfg)
+	if !errors.Is(err, ratelimiter.ErrInvalidLimit) {
+		t.Errorf("Expected error for invalid limit, got: %v", err)
+	}
+}
+
+func TestTokenBucketLimiter(t *testing.T) {
+	clock := time.NewMockClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = time.ContextWithClock(ctx, clock)
+
+	cfg := ratelimiter.Config{
+		Limit:         5,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+		BucketSize:    10,
+	}
+
+	rateLimiter, err := ratelimiter.NewTokenBucket(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+
+	// allowed returns the number of n requests that are allowed
+	allowed := func(n int) int {
+		result := 0
+		for range n {
+			if rateLimiter.Allow(&http.Request{RemoteAddr: "test"}) {
+				result++
+			}
+		}
+		return result
+	}
+
+	// a new client may burst up to the bucket size
+	if n := allowed(11); n != cfg.BucketSize {
+		t.Errorf("Expected %d requests to be allowed, got %d", cfg.BucketSize, n)
+	}
+
+	// the bucket refills at the limit rate
+	clock.AdvanceBy(200 * time.Millisecond)
+	if n := allowed(2); n != 1 {
+		t.Errorf("Expected 1 request to be allowed after 200ms, got %d", n)
+	}
+
+	// the bucket does not refill beyond its capacity
+	clock.AdvanceBy(10 * time.Second)
+	if n := allowed(11); n != cfg.BucketSize {
+		t.Errorf("Expected %d requests to be allowed, got %d", cfg.BucketSize, n)
+	}
+
+	// inactive clients are cleaned up
+	clock.AdvanceBy(2 * cfg.ClientTimeout)
+	if rateLimiter.NumberOfClients() != 0 {
+		t.Errorf("Expected no clients after client timeout, got %d", rateLimiter.NumberOfClients())
+	}
+}
+
+func TestTokenBucketRemaining(t *testing.T) {
+	clock := time.NewMockClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = time.ContextWithClock(ctx, clock)
+
+	cfg := ratelimiter.Config{
+		Limit:         5,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+		BucketSize:    10,
+	}
+
+	rateLimiter, err := ratelimiter.NewTokenBucket(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+
+	if limit := rateLimiter.Limit(); limit != cfg.BucketSize {
+		t.Errorf("Expected limit %d, got %d", cfg.BucketSize, limit)
+	}
+
+	rq := &http.Request{RemoteAddr: "test"}
+	if remaining := rateLimiter.Remaining(rq); remaining != cfg.BucketSize {
+		t.Errorf("Expected %d remaining for a new client, got %d", cfg.BucketSize, remaining)
+	}
+
+	for range 10 {
+		rateLimiter.Allow(rq)
+	}
+	if remaining := rateLimiter.Remaining(rq); remaining != 0 {
+		t.Errorf("Expected 0 remaining with an empty bucket, got %d", remaining)
+	}
+
+	// remaining reflects refilling, without consuming a token
+	clock.AdvanceBy(400 * time.Millisecond)
+	for range 2 {
+		if remaining := rateLimiter.Remaining(rq); remaining != 2 {
+			t.Errorf("Expected 2 remaining after 400ms, got %d", remaining)
+		}
+	}
+}
+
+func TestTokenBucketSmootherThanFixedWindow(t *testing.T) {
+	cfg := ratelimiter.Config{
+		Limit:         5,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+	}
+
+	// burst returns the number of requests allowed in two bursts of twice the
+	// limit, either side of a limit interval boundary 100ms apart
+	burst := func(t *testing.T, limiter interface{ Allow(*http.Request) bool }, clock time.MockClock) int {
+		t.Helper()
+
+		allowed := 0
+		send := func() {
+			for range 2 * cfg.Limit {
+				if limiter.Allow(&http.Request{RemoteAddr: "test"}) {
+					allowed++
+				}
+			}
+		}
+
+		clock.AdvanceBy(900 * time.Millisecond)
+		send()
+		clock.AdvanceBy(100 * time.Millisecond)
+		send()
+
+		return allowed
+	}
+
+	t.Run("Fixed window", func(t *testing.T) {
+		clock := time.NewMockClock()
+		ctx, cancel := context.WithCancel(time.ContextWithClock(context.Background(), clock))
+		defer cancel()
+
+		limiter, err := ratelimiter.New(ctx, cfg)
+		if err != nil {
+			t.Fatalf("Failed to create rate limiter: %v", err)
+		}
+
+		// the window reset at the boundary allows twice the limit in 100ms
+		if n := burst(t, limiter, clock); n != 2*cfg.Limit {
+			t.Errorf("Expected %d requests to be allowed, got %d", 2*cfg.Limit, n)
+		}
+	})
+
+	t.Run("Token bucket", func(t *testing.T) {
+		clock := time.NewMockClock()
+		ctx, cancel := context.WithCancel(time.ContextWithClock(context.Background(), clock))
+		defer cancel()
+
+		limiter, err := ratelimiter.NewTokenBucket(ctx, cfg)
+		if err != nil {
+			t.Fatalf("Failed to create rate limiter: %v", err)
+		}
+
+		// only half a token is refilled in 100ms, so no further requests are
+		// allowed after the first burst
+		if n := burst(t, limiter, clock); n != cfg.Limit {
+			t.Errorf("Expected %d requests to be allowed, got %d", cfg.Limit, n)
+		}
+	})
+}
+
+func TestTokenBucketMaxClients(t *testing.T) {
+	clock := time.NewMockClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = time.ContextWithClock(ctx, clock)
+
+	cfg := ratelimiter.Config{
+		Limit:         2,
+		LimitInterval: time.Minute,
+		ClientTimeout: time.Hour,
+		MaxClients:    3,
+	}
+
+	limiter, err := ratelimiter.NewTokenBucket(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create token bucket limiter: %v", err)
+	}
+
+	request := func(client string) bool {
+		clock.AdvanceBy(10 * time.Millisecond)
+		return limiter.Allow(&http.Request{RemoteAddr: client + ":1234"})
+	}
+
+	// client A empties its bucket, then B and C are seen, then A again
+	for range cfg.Limit {
+		request("198.51.100.1")
+	}
+	request("198.51.100.2")
+	request("198.51.100.3")
+	if request("198.51.100.1") {
+		t.Error("Expected request from client A to be denied")
+	}
+
+	// a new client evicts the least recently seen client (B), so A's bucket
+	// is retained (and empty)
+	request("198.51.100.4")
+	if n := limiter.NumberOfClients(); n != cfg.MaxClients {
+		t.Errorf("Expected %d clients, got %d", cfg.MaxClients, n)
+	}
+	if request("198.51.100.1") {
+		t.Error("Expected client A to remain tracked and its request to be denied")
+	}
+}
+
+func TestTokenBucketStats(t *testing.T) {
+	clock := time.NewMockClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = time.ContextWithClock(ctx, clock)
+
+	cfg := ratelimiter.Config{
+		Limit:         5,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+	}
+
+	limiter, err := ratelimiter.NewTokenBucket(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create token bucket limiter: %v", err)
+	}
+
+	// a full bucket allows 5 of 7 requests; after refilling for 1/5th of a
+	// second, 1 more of 2 requests is allowed
+	rq := &http.Request{RemoteAddr: "198.51.100.1:1234"}
+	for range 7 {
+		limiter.Allow(rq)
+	}
+	clock.AdvanceBy(200 * time.Millisecond)
+	for range 2 {
+		limiter.Allow(rq)
+	}
+
+	if allowed, denied := limiter.Stats(); allowed != 6 || denied != 3 {
+		t.Errorf("Expected 6 allowed and 3 denied, got %d allowed and %d denied", allowed, denied)
+	}
+}
+
+func TestTokenBucketAllowN(t *testing.T) {
+	clock := time.NewMockClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = time.ContextWithClock(ctx, clock)
+
+	cfg := ratelimiter.Config{
+		Limit:         10,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+	}
+
+	limiter, err := ratelimiter.NewTokenBucket(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create token bucket limiter: %v", err)
+	}
+
+	// a full bucket allows 2 requests costing 5 (emptying it)
+	rq := &http.Request{RemoteAddr: "198.51.100.1:1234"}
+	for i := 1; i <= 3; i++ {
+		if got, want := limiter.AllowN(rq, 5), i <= 2; got != want {
+			t.Errorf("Request %d costing 5: expected allowed %v, got %v", i, want, got)
+		}
+	}
+
+	// after refilling for 3/10ths of a second, a request costing 5 is denied
+	// without consuming tokens, leaving enough for 3 requests costing 1
+	clock.AdvanceBy(300 * time.Millisecond)
+	if limiter.AllowN(rq, 5) {
+		t.Error("Expected request costing more than the remaining tokens to be denied")
+	}
+	for i := 1; i <= 4; i++ {
+		if got, want := limiter.Allow(rq), i <= 3; got != want {
+			t.Errorf("Request %d costing 1: expected allowed %v, got %v", i, want, got)
+		}
+	}
+
+	// a request costing more than the bucket size is never allowed
+	if limiter.AllowN(&http.Request{RemoteAddr: "198.51.100.2:1234"}, 11) {
+		t.Error("Expected request costing more than the bucket size to be denied")
+	}
+}
+
+func TestTokenBucketReset(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = time.ContextWithClock(ctx, time.NewMockClock())
+
+	cfg := ratelimiter.Config{
+		Limit:         3,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+	}
+
+	limiter, err := ratelimiter.NewTokenBucket(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create token bucket limiter: %v", err)
+	}
+
+	// empty the bucket of a client
+	rq := &http.Request{RemoteAddr: "198.51.100.1:1234"}
+	for range 3 {
+		limiter.Allow(rq)
+	}
+	if limiter.Allow(rq) {
+		t.Fatal("Expected request from client with an empty bucket to be denied")
+	}
+
+	// resetting an unknown client has no effect
+	limiter.Reset("198.51.100.2")
+	if n := limiter.NumberOfClients(); n != 1 {
+		t.Errorf("Expected 1 client after resetting an unknown client, got %d", n)
+	}
+
+	// after reset, the bucket is full
+	limiter.Reset("198.51.100.1")
+	if remaining := limiter.Remaining(rq); remaining != 3 {
+		t.Errorf("Expected 3 tokens remaining after reset, got %d", remaining)
+	}
+	for i := 1; i <= 4; i++ {
+		if got, want := limiter.Allow(rq), i <= 3; got != want {
+			t.Errorf("Request %d after reset: expected allowed %v, got %v", i, want, got)
+		}
+	}
+}
+
+func TestTokenBucketRetryAfter(t *testing.T) {
+	clock := time.NewMockClock()
+	ctx, cancel := context.WithCancel(time.ContextWithClock(context.Background(), clock))
+	defer cancel()
+
+	// a token every 100ms
+	cfg := ratelimiter.Config{
+		Limit:         10,
+		LimitInterval: time.Second,
+		ClientTimeout: time.Minute,
+	}
+
+	limiter, err := ratelimiter.NewTokenBucket(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create token bucket limiter: %v", err)
+	}
+
+	rq := &http.Request{RemoteAddr: "198.51.100.1:1234"}
+	if d := limiter.RetryAfter(rq, 1); d != 0 {
+		t.Errorf("Expected no wait for a new client, got %v", d)
+	}
+
+	// empty the bucket
+	limiter.AllowN(rq, 10)
+
+	tests := []struct {
+		cost     int
+		expected time.Duration
+	}{
+		{cost: 1, expected: 100 * time.Millisecond},
+		{cost: 5, expected: 500 * time.Millisecond},
+		{cost: 0, expected: 100 * time.Millisecond},
+		{cost: 20, expected: time.Second}, // never allowed; the time to fill the bucket
+	}
+	for _, tt := range tests {
+		if d := limiter.RetryAfter(rq, tt.cost); d.Round(time.Millisecond) != tt.expected {
+			t.Errorf("Cost %d: expected a wait of %v, got %v", tt.cost, tt.expected, d)
+		}
+	}
+
+	// the wait reduces as the bucket refills
+	clock.AdvanceBy(300 * time.Millisecond)
+	if d := limiter.RetryAfter(rq, 5); d.Round(time.Millisecond) != 200*time.Millisecond {
+		t.Errorf("Expected a wait of 200ms after 300ms, got %v", d)
+	}
+	if d := limiter.RetryAfter(rq, 3); d != 0 {
+		t.Errorf("Expected no wait for a request within the refilled tokens, got %v", d)
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// redacted is the value substituted for redacted fields in debug logs
+const redacted = "[REDACTED]"
+
+// redactBody returns a body for debug logging with the values of any
+// configured redacted fields replaced.  A JSON body is returned as a
+// json.RawMessage so that it is logged as structured data; an empty body
+// is returned as nil and any other body is returned as a string.
+func (h *Handler) redactBody(body []byte) any {
+	if len(body) == 0 {
+		return nil
+	}
+
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+
+	if len(h.redactedFields) > 0 {
+		v = h.redact(v)
+		if b, err := json.Marshal(v); err == nil {
+			body = b
+		}
+	}
+
+	return json.RawMessage(body)
+}
+
+// redact recursively replaces the values of redacted fields in a decoded
+// JSON value
+func (h *Handler) redact(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if h.redactedFields[strings.ToLower(key)] {
+				v[key] = redacted
+				continue
+			}
+			v[key] = h.redact(value)
+		}
+		return v
+
+	case []any:
+		for i, value := range v {
+			v[i] = h.redact(value)
+		}
+		return v
+
+	default:
+		return v
+	}
+}
@@ -0,0 +1,83 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"products-api/internal/api"
+)
+
+func TestDebugLogRedaction(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	handler := api.NewHandler(newMockDB(), nil,
+		api.WithLogger(logger),
+		api.WithRedactedFields("Description"),
+	)
+	router := handler.SetupRoutes()
+
+	body := `{"name":"Secret Product","description":"internal notes","price":10}`
+	req := newJSONRequest("POST", "/api/v1/products", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	// the handler must still receive the complete request body
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d", http.StatusCreated, status)
+	}
+
+	var entry struct {
+		Msg          string         `json:"msg"`
+		RequestBody  map[string]any `json:"request_body"`
+		ResponseBody map[string]any `json:"response_body"`
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Failed to unmarshal log entry: %v", err)
+		}
+		if entry.Msg == "request bodies" {
+			break
+		}
+	}
+	if entry.Msg != "request bodies" {
+		t.Fatalf("Expected a debug log entry with request bodies, got: %s", buf.String())
+	}
+
+	for name, logged := range map[string]map[string]any{
+		"request":  entry.RequestBody,
+		"response": entry.ResponseBody,
+	} {
+		if logged["description"] != "[REDACTED]" {
+			t.Errorf("Expected %s description to be redacted, got %v", name, logged["description"])
+		}
+		if logged["name"] != "Secret Product" {
+			t.Errorf("Expected %s name to be logged, got %v", name, logged["name"])
+		}
+		if logged["price"] != 10.0 {
+			t.Errorf("Expected %s price to be logged, got %v", name, logged["price"])
+		}
+	}
+}
+
+func TestDebugLogBodiesNotCapturedAtInfoLevel(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, nil))
+	handler := api.NewHandler(newMockDB(), nil, api.WithLogger(logger))
+	router := handler.SetupRoutes()
+
+	body := `{"name":"Product","description":"notes","price":10}`
+	req := newJSONRequest("POST", "/api/v1/products", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	if strings.Contains(buf.String(), "notes") {
+		t.Errorf("Expected request body not to be logged at info level, got: %s", buf.String())
+	}
+}
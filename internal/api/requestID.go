@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// contextKey is the type of keys for values stored in a request context
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+)
+
+// RequestIDFromContext returns the ID of the request associated with a
+// context, or an empty string if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// newRequestID returns a new (version 4) UUID to identify a request
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// patRequestID matches a request ID that may be accepted from a client: up
+// to 128 letters, digits, dots, underscores and hyphens.  A supplied ID is
+// echoed in the response and written to logs and error responses, so any
+// other ID is replaced.
+var patRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// requestIDMiddleware identifies each request by the ID supplied in any
+// X-Request-ID header or, if not supplied (or not a valid ID; see
+// patRequestID), a generated UUID.  The ID is stored in the request context
+// and returned in the X-Request-ID response header.
+func (h *Handler) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !patRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
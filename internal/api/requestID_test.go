@@ -0,0 +1,111 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"products-api/internal/api"
+	"products-api/internal/models"
+)
+
+func TestRequestID(t *testing.T) {
+	patUUID := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	t.Run("Incoming ID is returned", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		handler := api.NewHandler(newMockDB(), nil, api.WithLogger(slog.New(slog.NewJSONHandler(buf, nil))))
+		router := handler.SetupRoutes()
+
+		req := httptest.NewRequest("GET", "/api/v1/products/999", nil)
+		req.Header.Set("X-Request-ID", "test-request-id")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if id := rr.Header().Get("X-Request-ID"); id != "test-request-id" {
+			t.Errorf("Expected X-Request-ID header test-request-id, got %q", id)
+		}
+
+		// the ID is included in error responses
+		var errorResponse models.ErrorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &errorResponse); err != nil {
+			t.Fatalf("Failed to unmarshal error response: %v", err)
+		}
+		if errorResponse.RequestID != "test-request-id" {
+			t.Errorf("Expected request_id test-request-id in error response, got %q", errorResponse.RequestID)
+		}
+
+		// the ID is included in the request log
+		var entry struct {
+			RequestID string `json:"request_id"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("Failed to unmarshal log entry: %v", err)
+		}
+		if entry.RequestID != "test-request-id" {
+			t.Errorf("Expected request_id test-request-id in log, got %q", entry.RequestID)
+		}
+	})
+
+	t.Run("Invalid incoming ID is replaced", func(t *testing.T) {
+		router := api.NewHandler(newMockDB(), nil).SetupRoutes()
+
+		for name, id := range map[string]string{
+			"Too long":          strings.Repeat("a", 129),
+			"Invalid character": "id with spaces",
+			"Control character": "id\x1b[31m",
+		} {
+			t.Run(name, func(t *testing.T) {
+				req := httptest.NewRequest("GET", "/health", nil)
+				req.Header.Set("X-Request-ID", id)
+				rr := httptest.NewRecorder()
+
+				router.ServeHTTP(rr, req)
+
+				if got := rr.Header().Get("X-Request-ID"); !patUUID.MatchString(got) {
+					t.Errorf("Expected X-Request-ID to be replaced by a UUID, got %q", got)
+				}
+			})
+		}
+
+		// an ID of the maximum length is accepted
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set("X-Request-ID", strings.Repeat("a", 128))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if got := rr.Header().Get("X-Request-ID"); got != strings.Repeat("a", 128) {
+			t.Errorf("Expected an ID of 128 characters to be returned, got %q", got)
+		}
+	})
+
+	t.Run("ID is generated when absent", func(t *testing.T) {
+		handler := api.NewHandler(newMockDB(), nil)
+		router := handler.SetupRoutes()
+
+		ids := map[string]bool{}
+		for range 2 {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/health", nil))
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+			}
+
+			id := rr.Header().Get("X-Request-ID")
+			if !patUUID.MatchString(id) {
+				t.Errorf("Expected generated X-Request-ID to be a UUID, got %q", id)
+			}
+			ids[id] = true
+		}
+
+		if len(ids) != 2 {
+			t.Error("Expected a different ID to be generated for each request")
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"products-api/internal/db"
+	"products-api/internal/models"
+
+	"github.com/blugnu/time"
+	"github.com/gorilla/mux"
+)
+
+// defaultReservationTTL is the time for which stock is reserved, if not
+// specified by WithReservationTTL
+const defaultReservationTTL = 15 * time.Minute
+
+// ReserveStock handles POST /api/v1/products/{id}/reserve
+//
+// Reserves a quantity of the stock of a product (e.g. for a cart), holding
+// it for the reservation time-to-live (see WithReservationTTL).  The quantity
+// of the product is decremented, and restored when the reservation expires.
+// A quantity greater than that of the product is rejected with 409 Conflict.
+func (h *Handler) ReserveStock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidProductID, cInvalidProductId, "")
+		return
+	}
+
+	if !h.requireContentType(w, r, "application/json") {
+		return
+	}
+
+	var req models.ReserveStockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidJSON, cInvalidJSON, err.Error())
+		return
+	}
+	if !h.validateRequest(w, r, &req) {
+		return
+	}
+
+	reservation, err := h.db.ReserveStock(r.Context(), id, req.Quantity, h.reservationTTL)
+	switch {
+	case errors.Is(err, db.ErrGone):
+		h.writeErrorResponse(w, r, http.StatusGone, models.CodeProductGone, cProductGone, "")
+		return
+
+	case errors.Is(err, db.ErrNotFound):
+		h.writeErrorResponse(w, r, http.StatusNotFound, models.CodeProductNotFound, cProductNotFound, "")
+		return
+
+	case errors.Is(err, db.ErrInsufficientStock):
+		h.writeErrorResponse(w, r, http.StatusConflict, models.CodeInsufficientStock, "Insufficient stock", err.Error())
+		return
+
+	case err != nil:
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, "Failed to reserve stock", err.Error())
+		return
+	}
+
+	h.writeResponse(w, r, http.StatusCreated, reservation)
+}
@@ -0,0 +1,108 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"products-api/internal/api"
+	"products-api/internal/db"
+	"products-api/internal/models"
+
+	"github.com/blugnu/time"
+)
+
+func TestReserveStock(t *testing.T) {
+	clock := time.NewMockClock()
+	database := db.NewInMemoryDB(db.WithClock(clock), db.WithSampleData())
+	router := api.NewHandler(database, nil, api.WithReservationTTL(10*time.Minute)).SetupRoutes()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	database.StartReservationSweep(ctx, time.Minute)
+
+	serve := func(path, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newJSONRequest("POST", path, strings.NewReader(body)))
+		return rr
+	}
+
+	// quantity returns the quantity of the laptop (15 in the sample data)
+	quantity := func(t *testing.T) int {
+		t.Helper()
+		product, err := database.GetProductByID(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("GetProductByID() failed: %v", err)
+		}
+		return product.Quantity
+	}
+
+	rr := serve("/api/v1/products/1/reserve", `{"quantity":2}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	var reservation models.Reservation
+	if err := json.Unmarshal(rr.Body.Bytes(), &reservation); err != nil {
+		t.Fatalf("Failed to unmarshal reservation: %v", err)
+	}
+	if reservation.ProductID != 1 || reservation.Quantity != 2 || !reservation.ExpiresAt.Equal(clock.Now().Add(10*time.Minute)) {
+		t.Errorf("Expected a reservation of 2 of product 1 expiring in 10 minutes, got %+v", reservation)
+	}
+	if n := quantity(t); n != 13 {
+		t.Errorf("Expected quantity 13 once reserved, got %d", n)
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+		if err := database.DeleteProduct(context.Background(), 5); err != nil {
+			t.Fatalf("DeleteProduct() failed: %v", err)
+		}
+
+		for _, tt := range []struct {
+			name, path, body string
+			expectedStatus   int
+			expectedCode     string
+		}{
+			{name: "Beyond available", path: "/api/v1/products/1/reserve", body: `{"quantity":14}`, expectedStatus: http.StatusConflict, expectedCode: models.CodeInsufficientStock},
+			{name: "Zero quantity", path: "/api/v1/products/1/reserve", body: `{"quantity":0}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+			{name: "Negative quantity", path: "/api/v1/products/1/reserve", body: `{"quantity":-1}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+			{name: "Invalid JSON", path: "/api/v1/products/1/reserve", body: `{`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeInvalidJSON},
+			{name: "Deleted product", path: "/api/v1/products/5/reserve", body: `{"quantity":1}`, expectedStatus: http.StatusGone, expectedCode: models.CodeProductGone},
+			{name: "Unknown product", path: "/api/v1/products/99/reserve", body: `{"quantity":1}`, expectedStatus: http.StatusNotFound, expectedCode: models.CodeProductNotFound},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				rr := serve(tt.path, tt.body)
+				if rr.Code != tt.expectedStatus {
+					t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+				}
+
+				var response models.ErrorResponse
+				if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if response.Code != tt.expectedCode {
+					t.Errorf("Expected code %s, got %s", tt.expectedCode, response.Code)
+				}
+			})
+		}
+
+		if n := quantity(t); n != 13 {
+			t.Errorf("Expected quantity 13 to be unchanged, got %d", n)
+		}
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		clock.AdvanceBy(9 * time.Minute)
+		if n := quantity(t); n != 13 {
+			t.Errorf("Expected quantity 13 before expiry, got %d", n)
+		}
+
+		clock.AdvanceBy(time.Minute)
+		if n := quantity(t); n != 15 {
+			t.Errorf("Expected quantity 15 to be restored once expired, got %d", n)
+		}
+	})
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"products-api/internal/models"
+)
+
+const (
+	// minNameLength and maxNameLength are the limits of the length of the
+	// name of a product (see models.CreateProductRequest)
+	minNameLength = 2
+	maxNameLength = 200
+)
+
+// jsonSchema describes the subset of JSON Schema (draft 2020-12) used to
+// describe request bodies.  Patterns are held as compiled regular
+// expressions, so that the regular expressions used in validating requests
+// are also those described by the schema.
+type jsonSchema struct {
+	Schema     string                 `json:"$schema,omitempty"`
+	Title      string                 `json:"title,omitempty"`
+	Type       string                 `json:"type,omitempty"`
+	Required   []string               `json:"required,omitempty"`
+	Properties map[string]*jsonSchema `json:"properties,omitempty"`
+	Items      *jsonSchema            `json:"items,omitempty"`
+	MinLength  *int                   `json:"minLength,omitempty"`
+	MaxLength  *int                   `json:"maxLength,omitempty"`
+	Minimum    *float64               `json:"minimum,omitempty"`
+	Pattern    *regexp.Regexp         `json:"pattern,omitempty"`
+	Not        *jsonSchema            `json:"not,omitempty"`
+}
+
+// createProductSchema returns the JSON Schema of a CreateProductRequest; it
+// must be maintained to reflect the validations of the struct tags of the
+// request
+func createProductSchema() *jsonSchema {
+	var (
+		zero = 0.0
+		one  = 1
+
+		minName, maxName = minNameLength, maxNameLength
+	)
+
+	return &jsonSchema{
+		Schema:   "https://json-schema.org/draft/2020-12/schema",
+		Title:    "CreateProductRequest",
+		Type:     "object",
+		Required: []string{"name", "price"},
+		Properties: map[string]*jsonSchema{
+			"sku":         {Type: "string", Pattern: patSKU, Not: &jsonSchema{Pattern: patNumeric}},
+			"name":        {Type: "string", MinLength: &minName, MaxLength: &maxName, Pattern: patNotBlank},
+			"description": {Type: "string"},
+			"price":       {Type: "number", Minimum: &zero},
+			"currency":    {Type: "string", Pattern: patCurrency},
+			"category":    {Type: "string"},
+			"in_stock":    {Type: "boolean"},
+			"quantity":    {Type: "integer", Minimum: &zero},
+			"tags":        {Type: "array", Items: &jsonSchema{Type: "string", MinLength: &one}},
+			"images":      {Type: "array", Items: &jsonSchema{Type: "string", Pattern: patHTTPURL}},
+		},
+	}
+}
+
+var (
+	// a name must contain something other than whitespace
+	patNotBlank = regexp.MustCompile(`\S`)
+
+	// a currency is a three letter (ISO 4217) code; whether the code is a
+	// known currency is left to struct validation
+	patCurrency = regexp.MustCompile(`^[A-Z]{3}$`)
+
+	// an image is an http or https URL; whether the URL is otherwise valid
+	// is left to struct validation
+	patHTTPURL = regexp.MustCompile(`^(?i)https?://\S+$`)
+)
+
+// validate returns a description of each way in which a value decoded from
+// JSON fails to conform to the schema, identifying the value by a path (e.g.
+// "tags[1]"); nil is returned if the value conforms.  Properties of an
+// object are validated in name order, so that failures are reported in a
+// consistent order.
+func (s *jsonSchema) validate(path string, value any) []string {
+	fail := func(format string, args ...any) []string {
+		if path == "" {
+			return []string{fmt.Sprintf(format, args...)}
+		}
+		return []string{path + ": " + fmt.Sprintf(format, args...)}
+	}
+
+	var failures []string
+	switch v := value.(type) {
+	case map[string]any:
+		if s.Type != "" && s.Type != "object" {
+			return fail("must be of type %s", s.Type)
+		}
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				failures = append(failures, s.property(path, name)+": is required")
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(v)) {
+			if prop, ok := s.Properties[name]; ok {
+				failures = append(failures, prop.validate(s.property(path, name), v[name])...)
+			}
+		}
+
+	case []any:
+		if s.Type != "" && s.Type != "array" {
+			return fail("must be of type %s", s.Type)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				failures = append(failures, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+			}
+		}
+
+	case string:
+		if s.Type != "" && s.Type != "string" {
+			return fail("must be of type %s", s.Type)
+		}
+		switch n := utf8.RuneCountInString(v); {
+		case s.MinLength != nil && n < *s.MinLength && *s.MinLength == 1:
+			failures = append(failures, fail("must not be empty")...)
+		case s.MinLength != nil && n < *s.MinLength:
+			failures = append(failures, fail("must be at least %d characters", *s.MinLength)...)
+		case s.MaxLength != nil && n > *s.MaxLength:
+			failures = append(failures, fail("must be at most %d characters", *s.MaxLength)...)
+		}
+		if s.Pattern != nil && !s.Pattern.MatchString(v) {
+			failures = append(failures, fail("must match the pattern %s", s.Pattern)...)
+		}
+		if s.Not != nil && s.Not.validate(path, v) == nil {
+			failures = append(failures, fail("must not match %s", s.Not.describe())...)
+		}
+
+	case float64:
+		if s.Type != "" && s.Type != "number" && (s.Type != "integer" || v != math.Trunc(v)) {
+			return fail("must be of type %s", s.Type)
+		}
+		if s.Minimum != nil && v < *s.Minimum {
+			failures = append(failures, fail("must be at least %g", *s.Minimum)...)
+		}
+
+	case bool:
+		if s.Type != "" && s.Type != "boolean" {
+			return fail("must be of type %s", s.Type)
+		}
+
+	case nil:
+		if s.Type != "" && s.Type != "null" {
+			return fail("must be of type %s", s.Type)
+		}
+	}
+	return failures
+}
+
+// property returns the path of a named property of the value at a path
+func (s *jsonSchema) property(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// describe returns a description of the constraints of a schema, for
+// failures of a 'not' schema
+func (s *jsonSchema) describe() string {
+	if s.Pattern != nil {
+		return "the pattern " + s.Pattern.String()
+	}
+	return "the schema"
+}
+
+// MarshalJSON marshals a regular expression as its source text, as the
+// pattern of a schema
+func (s *jsonSchema) MarshalJSON() ([]byte, error) {
+	type schema jsonSchema // without the MarshalJSON method
+	var pattern string
+	if s.Pattern != nil {
+		pattern = s.Pattern.String()
+	}
+	return json.Marshal(struct {
+		*schema
+		Pattern string `json:"pattern,omitempty"`
+	}{(*schema)(s), pattern})
+}
+
+// ProductSchema handles GET /api/v1/products/schema
+//
+// Returns the JSON Schema of the body of a request creating a product.  The
+// schema is always JSON, regardless of the Accept header.
+func (h *Handler) ProductSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(createProductSchema())
+}
+
+// decodeCreateRequest decodes the body of a request creating a product into
+// req.  If the Handler is configured with schema validation (see
+// WithSchemaValidation), the body is first validated against the JSON Schema
+// of the request.  If the body cannot be decoded or fails schema validation
+// an error response is written and false is returned.
+//
+// The decoded request is not trimmed or validated.
+func (h *Handler) decodeCreateRequest(w http.ResponseWriter, r *http.Request, req *models.CreateProductRequest) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidJSON, cInvalidJSON, err.Error())
+		return false
+	}
+
+	if h.schemaValidation {
+		var value any
+		if err := json.Unmarshal(body, &value); err != nil {
+			h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidJSON, cInvalidJSON, err.Error())
+			return false
+		}
+		if failures := createProductSchema().validate("", value); len(failures) > 0 {
+			h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeValidationFailed, cValidationFailed, strings.Join(failures, "; "))
+			return false
+		}
+	}
+
+	if err := json.Unmarshal(body, req); err != nil {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeInvalidJSON, cInvalidJSON, err.Error())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"products-api/internal/api"
+	"products-api/internal/models"
+)
+
+func TestProductSchema(t *testing.T) {
+	router := api.NewHandler(newMockDB(), nil).SetupRoutes()
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/products/schema", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/schema+json" {
+		t.Errorf("Expected Content-Type application/schema+json, got %s", contentType)
+	}
+
+	var schema struct {
+		Schema     string   `json:"$schema"`
+		Type       string   `json:"type"`
+		Required   []string `json:"required"`
+		Properties map[string]struct {
+			Type    string   `json:"type"`
+			Minimum *float64 `json:"minimum"`
+			Pattern string   `json:"pattern"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &schema); err != nil {
+		t.Fatalf("Failed to unmarshal schema: %v", err)
+	}
+
+	if schema.Schema == "" || schema.Type != "object" {
+		t.Errorf("Expected a JSON Schema of an object, got $schema %q and type %q", schema.Schema, schema.Type)
+	}
+	if !slices.Contains(schema.Required, "name") {
+		t.Errorf("Expected name to be required, got required %v", schema.Required)
+	}
+	if price := schema.Properties["price"]; price.Type != "number" || price.Minimum == nil || *price.Minimum != 0 {
+		t.Errorf("Expected price to be a number with a minimum of 0, got %+v", price)
+	}
+	if sku := schema.Properties["sku"]; sku.Pattern == "" {
+		t.Error("Expected sku to have a pattern")
+	}
+}
+
+func TestSchemaValidation(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            []api.Option
+		method          string
+		path            string
+		body            string
+		expectedStatus  int
+		expectedCode    string
+		expectedMessage string
+	}{
+		{name: "Valid", opts: []api.Option{api.WithSchemaValidation()}, method: "POST", path: "/api/v1/products", body: `{"name":"Widget","price":1,"sku":"WID-001","currency":"EUR","tags":["a"]}`, expectedStatus: http.StatusCreated},
+		{name: "Missing name", opts: []api.Option{api.WithSchemaValidation()}, method: "POST", path: "/api/v1/products", body: `{"price":1}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed, expectedMessage: "name: is required"},
+		{name: "Several failures", opts: []api.Option{api.WithSchemaValidation()}, method: "POST", path: "/api/v1/products", body: `{"name":"W","price":-1,"tags":["a",""]}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed, expectedMessage: "name: must be at least 2 characters; price: must be at least 0; tags[1]: must not be empty"},
+		{name: "Wrong type", opts: []api.Option{api.WithSchemaValidation()}, method: "POST", path: "/api/v1/products", body: `{"name":"Widget","price":"1"}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed, expectedMessage: "price: must be of type number"},
+		{name: "Fractional quantity", opts: []api.Option{api.WithSchemaValidation()}, method: "POST", path: "/api/v1/products", body: `{"name":"Widget","price":1,"quantity":1.5}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed, expectedMessage: "quantity: must be of type integer"},
+		{name: "Negative quantity", opts: []api.Option{api.WithSchemaValidation()}, method: "POST", path: "/api/v1/products", body: `{"name":"Widget","price":1,"quantity":-1}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed, expectedMessage: "quantity: must be at least 0"},
+		{name: "Numeric SKU", opts: []api.Option{api.WithSchemaValidation()}, method: "POST", path: "/api/v1/products", body: `{"name":"Widget","price":1,"sku":"12345"}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed, expectedMessage: "sku: must not match the pattern ^[0-9]+$"},
+		{name: "Not an object", opts: []api.Option{api.WithSchemaValidation()}, method: "POST", path: "/api/v1/products", body: `[]`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed, expectedMessage: "must be of type object"},
+		{name: "Invalid JSON", opts: []api.Option{api.WithSchemaValidation()}, method: "POST", path: "/api/v1/products", body: `invalid json`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeInvalidJSON},
+		{name: "Struct validation", opts: []api.Option{api.WithSchemaValidation()}, method: "POST", path: "/api/v1/products", body: `{"name":"Widget","price":1,"currency":"XYZ"}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+		{name: "Upsert", opts: []api.Option{api.WithSchemaValidation()}, method: "PUT", path: "/api/v1/products/sku/WID-001", body: `{"name":"Widget","price":-1}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed, expectedMessage: "price: must be at least 0"},
+		{name: "Negative quantity without schema validation", method: "POST", path: "/api/v1/products", body: `{"name":"Widget","price":1,"quantity":-1}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+		{name: "Wrong type without schema validation", method: "POST", path: "/api/v1/products", body: `{"name":"Widget","price":"1"}`, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeInvalidJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := api.NewHandler(newMockDB(), nil, tt.opts...).SetupRoutes()
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newJSONRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedCode == "" {
+				return
+			}
+
+			var response models.ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Code != tt.expectedCode {
+				t.Errorf("Expected code %q, got %q", tt.expectedCode, response.Code)
+			}
+			if tt.expectedMessage != "" && response.Message != tt.expectedMessage {
+				t.Errorf("Expected message %q, got %q", tt.expectedMessage, response.Message)
+			}
+		})
+	}
+}
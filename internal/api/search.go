@@ -0,0 +1,70 @@
+package api
+
+import (
+	"cmp"
+	"strings"
+
+	"products-api/internal/db"
+	"products-api/internal/models"
+)
+
+// relevance scores for a match of a search term in each part of a product;
+// a match in the name is weighted higher than in the description and an
+// exact or prefix match higher than a substring
+const (
+	relevanceNameExact       = 100
+	relevanceNamePrefix      = 60
+	relevanceNameSubstring   = 40
+	relevanceDescription     = 10
+	relevanceDescriptionWord = 15
+)
+
+// searchFilter returns a filter matching products with a name or description
+// containing a search term (case-insensitive)
+func searchFilter(q string) db.ProductFilter {
+	q = strings.ToLower(q)
+	return func(product *models.Product) bool {
+		return strings.Contains(strings.ToLower(product.Name), q) ||
+			strings.Contains(strings.ToLower(product.Description), q)
+	}
+}
+
+// relevance returns a score for the relevance of a product to a (lowercase)
+// search term; a higher score indicates a better match
+func relevance(product *models.Product, q string) int {
+	var score int
+
+	name := strings.ToLower(product.Name)
+	switch {
+	case name == q:
+		score += relevanceNameExact
+	case strings.HasPrefix(name, q):
+		score += relevanceNamePrefix
+	case strings.Contains(name, q):
+		score += relevanceNameSubstring
+	}
+
+	description := strings.ToLower(product.Description)
+	switch {
+	case strings.HasPrefix(description, q) || strings.Contains(description, " "+q):
+		score += relevanceDescriptionWord
+	case strings.Contains(description, q):
+		score += relevanceDescription
+	}
+
+	return score
+}
+
+// relevanceOrder returns an order comparing products by their relevance to a
+// search term, in ascending order of relevance unless desc is set
+func relevanceOrder(q string, desc bool) db.ProductOrder {
+	q = strings.ToLower(q)
+	if desc {
+		return func(a, b *models.Product) int {
+			return cmp.Compare(relevance(b, q), relevance(a, q))
+		}
+	}
+	return func(a, b *models.Product) int {
+		return cmp.Compare(relevance(a, q), relevance(b, q))
+	}
+}
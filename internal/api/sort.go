@@ -0,0 +1,117 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"products-api/internal/db"
+	"products-api/internal/models"
+)
+
+// sortFields maps the fields by which products may be sorted to functions
+// comparing products by that field (in ascending order)
+var sortFields = map[string]db.ProductOrder{
+	"id": func(a, b *models.Product) int {
+		return cmp.Compare(a.ID, b.ID)
+	},
+	"name": func(a, b *models.Product) int {
+		return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	},
+	"price": func(a, b *models.Product) int {
+		return cmp.Compare(a.Price, b.Price)
+	},
+	"category": func(a, b *models.Product) int {
+		return cmp.Compare(strings.ToLower(a.Category), strings.ToLower(b.Category))
+	},
+	"created_at": func(a, b *models.Product) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	},
+	"updated_at": func(a, b *models.Product) int {
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	},
+}
+
+// productOrderFromQuery returns the order specified by the sort query
+// parameter of a request (see parseSort).
+//
+// If no sort is specified, products changed since a time (the modified_since
+// parameter) are sorted by updated_at, for incremental syncs, products
+// created within a duration (the new_within parameter) are sorted newest
+// first, and products matching a search term are sorted by relevance (best
+// matches first).  Otherwise, if no sort is specified the default order is
+// returned (see WithDefaultSort), which is nil (products are ordered by ID)
+// unless configured.
+func (h *Handler) productOrderFromQuery(r *http.Request) (db.ProductOrder, error) {
+	q := r.URL.Query().Get("q")
+
+	spec := r.URL.Query().Get("sort")
+	if spec == "" {
+		switch {
+		case r.URL.Query().Get("modified_since") != "":
+			return sortFields["updated_at"], nil
+		case r.URL.Query().Get("new_within") != "":
+			return func(a, b *models.Product) int { return sortFields["created_at"](b, a) }, nil
+		case q != "":
+			return relevanceOrder(q, true), nil
+		}
+		return h.defaultOrder, nil
+	}
+
+	return parseSort(spec, q)
+}
+
+// ValidateSort returns an error if a sort (see WithDefaultSort) is not
+// valid
+func ValidateSort(spec string) error {
+	_, err := parseSort(spec, "")
+	return err
+}
+
+// parseSort returns the order specified by a sort, a comma-separated list of
+// fields each optionally followed by a direction (e.g. "category,price:desc").
+// Products may be sorted by relevance only if a search term (q) is specified.
+func parseSort(spec, q string) (db.ProductOrder, error) {
+	var orders []db.ProductOrder
+	for _, term := range strings.Split(spec, ",") {
+		field, direction, _ := strings.Cut(strings.TrimSpace(term), ":")
+		field = strings.ToLower(field)
+
+		var desc bool
+		switch strings.ToLower(direction) {
+		case "", "asc":
+			// relevance is naturally sorted best (highest score) first
+			desc = field == "relevance" && direction == ""
+		case "desc":
+			desc = true
+		default:
+			return nil, fmt.Errorf("invalid sort direction: %s", direction)
+		}
+
+		switch order, ok := sortFields[field]; {
+		case ok && desc:
+			orders = append(orders, func(a, b *models.Product) int { return order(b, a) })
+		case ok:
+			orders = append(orders, order)
+		case field == "relevance" && q == "":
+			return nil, fmt.Errorf("sort by relevance requires a search term (q)")
+		case field == "relevance":
+			orders = append(orders, relevanceOrder(q, desc))
+		default:
+			return nil, fmt.Errorf("invalid sort field: %s", field)
+		}
+	}
+
+	if len(orders) == 1 {
+		return orders[0], nil
+	}
+	return func(a, b *models.Product) int {
+		for _, order := range orders {
+			if c := order(a, b); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}, nil
+}
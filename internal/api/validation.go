@@ -0,0 +1,176 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"products-api/internal/models"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/de"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/es"
+	"github.com/go-playground/locales/fr"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	det "github.com/go-playground/validator/v10/translations/de"
+	est "github.com/go-playground/validator/v10/translations/es"
+	frt "github.com/go-playground/validator/v10/translations/fr"
+)
+
+var (
+	// a SKU is one or more groups of letters and digits separated by dashes
+	patSKU = regexp.MustCompile(`^[A-Za-z0-9]+(-[A-Za-z0-9]+)*$`)
+
+	// a path segment consisting only of digits identifies a product by ID
+	patNumeric = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// newValidator returns a validator with the custom validations used by
+// request models registered
+func newValidator() *validator.Validate {
+	v := validator.New()
+
+	_ = v.RegisterValidation("notblank", validateNotBlank)
+	_ = v.RegisterValidation("sku", validateSKU)
+
+	return v
+}
+
+// ValidateCreateRequest returns an error describing the validation failures
+// of a request creating a product, validating the request as the Handler
+// does (e.g. the products of a seed file, which are not created by requests)
+func ValidateCreateRequest(req models.CreateProductRequest) error {
+	if err := newValidator().Struct(&req); err != nil {
+		return errors.New(validationDetail(err, nil))
+	}
+	return nil
+}
+
+// validationLocales are the locales, other than English, in which validation
+// failures are described; for each locale, the translations of the built-in
+// validations are registered by the validator translations package and the
+// translations of the custom validations are specified
+var validationLocales = []struct {
+	locale   locales.Translator
+	register func(*validator.Validate, ut.Translator) error
+	notblank string
+	sku      string
+}{
+	{locale: de.New(), register: det.RegisterDefaultTranslations, notblank: "{0} darf nicht leer sein", sku: "{0} muss eine gültige SKU sein"},
+	{locale: es.New(), register: est.RegisterDefaultTranslations, notblank: "{0} no debe estar en blanco", sku: "{0} debe ser un SKU válido"},
+	{locale: fr.New(), register: frt.RegisterDefaultTranslations, notblank: "{0} ne doit pas être vide", sku: "{0} doit être un SKU valide"},
+}
+
+// newTranslator returns a translator of the descriptions of validation
+// failures, registering the translations of each of the validationLocales
+// with a validator.  English is the fallback locale, for which failures are
+// not translated (see validationDetail).
+func newTranslator(v *validator.Validate) *ut.UniversalTranslator {
+	supported := []locales.Translator{en.New()}
+	for _, l := range validationLocales {
+		supported = append(supported, l.locale)
+	}
+	translator := ut.New(supported[0], supported...)
+
+	for _, l := range validationLocales {
+		trans, _ := translator.GetTranslator(l.locale.Locale())
+		_ = l.register(v, trans)
+		for tag, text := range map[string]string{"notblank": l.notblank, "sku": l.sku} {
+			_ = v.RegisterTranslation(tag, trans, func(t ut.Translator) error {
+				return t.Add(tag, text, false)
+			}, func(t ut.Translator, fe validator.FieldError) string {
+				s, _ := t.T(tag, fe.Field())
+				return s
+			})
+		}
+	}
+
+	return translator
+}
+
+// requestTranslator returns the translator for the language most preferred
+// by the Accept-Language header of a request, of the languages in which
+// validation failures are described, or nil if English is preferred or none
+// of the accepted languages are supported
+func (h *Handler) requestTranslator(r *http.Request) ut.Translator {
+	for _, language := range acceptedLanguages(r) {
+		// the language (e.g. "fr") of a language range (e.g. "fr-CH")
+		language, _, _ = strings.Cut(strings.ToLower(language), "-")
+		if trans, found := h.translator.GetTranslator(language); found {
+			if language == "en" {
+				return nil
+			}
+			return trans
+		}
+	}
+	return nil
+}
+
+// validateSKU validates that a field is a SKU: alphanumeric with dashes.
+// A SKU consisting only of digits is not valid since it would be
+// indistinguishable from a product ID.
+func validateSKU(fl validator.FieldLevel) bool {
+	sku := fl.Field().String()
+	return patSKU.MatchString(sku) && !patNumeric.MatchString(sku)
+}
+
+// validateNotBlank validates that a string field contains something other
+// than whitespace.  Unlike required, a string of only whitespace is not
+// valid.
+func validateNotBlank(fl validator.FieldLevel) bool {
+	return strings.TrimSpace(fl.Field().String()) != ""
+}
+
+// validateRequest validates a request (a pointer to a request model), writing
+// an error response if it is not valid, and returns true if it is valid.  A
+// request failing validation is 400 Bad Request; a request that cannot be
+// validated (e.g. a nil pointer) is a bug, so is 500 Internal Server Error.
+func (h *Handler) validateRequest(w http.ResponseWriter, r *http.Request, req any) bool {
+	switch err := h.validator.Struct(req).(type) {
+	case nil:
+		return true
+
+	case validator.ValidationErrors:
+		h.writeErrorResponse(w, r, http.StatusBadRequest, models.CodeValidationFailed, cValidationFailed, validationDetail(err, h.requestTranslator(r)))
+
+	default:
+		h.writeErrorResponse(w, r, http.StatusInternalServerError, models.CodeInternalError, cInternalError, err.Error())
+	}
+	return false
+}
+
+// validationDetail describes the failures in a validation error, including
+// the parameter of each failed validation (e.g. the minimum length of a
+// field failing a 'min' validation).
+//
+// Failures are described in English unless a translator is specified (see
+// requestTranslator); a failure for which there is no translation is
+// described in English.
+func validationDetail(err error, trans ut.Translator) string {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return err.Error()
+	}
+
+	failures := make([]string, len(errs))
+	for i, fe := range errs {
+		if trans != nil {
+			// a FieldError is its own description if it cannot be translated
+			if s := fe.Translate(trans); s != fe.Error() {
+				failures[i] = s
+				continue
+			}
+		}
+
+		tag := fe.Tag()
+		if fe.Param() != "" {
+			tag += "=" + fe.Param()
+		}
+		failures[i] = fmt.Sprintf("Field validation for '%s' failed on the '%s' tag", fe.Namespace(), tag)
+	}
+	return strings.Join(failures, "; ")
+}
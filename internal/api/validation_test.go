@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"products-api/internal/db"
+	"products-api/internal/models"
+)
+
+func TestValidateRequest(t *testing.T) {
+	h := NewHandler(db.NewInMemoryDB(), nil)
+
+	tests := []struct {
+		name           string
+		req            any
+		expectedValid  bool
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "Valid", req: &models.CreateProductRequest{Name: "Product", Price: 1}, expectedValid: true, expectedStatus: http.StatusOK},
+		{name: "Fails validation", req: &models.CreateProductRequest{Price: 1}, expectedStatus: http.StatusBadRequest, expectedCode: models.CodeValidationFailed},
+		// a nil pointer cannot be validated (an InvalidValidationError)
+		{name: "Cannot be validated", req: (*models.CreateProductRequest)(nil), expectedStatus: http.StatusInternalServerError, expectedCode: models.CodeInternalError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+
+			if valid := h.validateRequest(rr, httptest.NewRequest("POST", "/api/v1/products", nil), tt.req); valid != tt.expectedValid {
+				t.Errorf("Expected valid %v, got %v", tt.expectedValid, valid)
+			}
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status code %d, got %d", tt.expectedStatus, rr.Code)
+			}
+
+			if tt.expectedCode != "" {
+				var response models.ErrorResponse
+				if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+				if response.Code != tt.expectedCode {
+					t.Errorf("Expected code %s, got %s", tt.expectedCode, response.Code)
+				}
+			}
+		})
+	}
+}
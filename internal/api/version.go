@@ -0,0 +1,27 @@
+package api
+
+import (
+	"net/http"
+
+	"products-api/internal/models"
+)
+
+// Version, Commit and BuildTime identify the build of the service; they are
+// set when building, using -ldflags (e.g.
+// -X products-api/internal/api.Version=1.2.0), and are "dev" otherwise
+var (
+	Version   = "dev"
+	Commit    = "dev"
+	BuildTime = "dev"
+)
+
+// GetVersion handles GET /version
+//
+// Returns the version, commit and build time of the build of the service.
+func (h *Handler) GetVersion(w http.ResponseWriter, r *http.Request) {
+	h.writeResponse(w, r, http.StatusOK, models.VersionResponse{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+	})
+}
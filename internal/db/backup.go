@@ -0,0 +1,139 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"products-api/internal/models"
+)
+
+// ExportAll returns a backup of the database: all of the products, ordered by
+// ID, and the IDs of deleted products, which may be restored by ImportAll.
+// The history of products is not included.
+func (db *InMemoryDB) ExportAll(ctx context.Context) (models.Backup, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	backup := models.Backup{
+		Products:   make([]models.Product, 0, len(db.ordered)),
+		DeletedIDs: slices.Sorted(maps.Keys(db.deleted)),
+	}
+	for _, product := range db.ordered {
+		backup.Products = append(backup.Products, *product)
+	}
+	if backup.DeletedIDs == nil {
+		backup.DeletedIDs = []int{}
+	}
+	return backup, nil
+}
+
+// ImportAll restores a backup (see ExportAll).  If replace is true, the
+// products and deleted IDs of the database are replaced by those of the
+// backup and all history and reservations are discarded.  Otherwise the
+// backup is merged into the database: the backup takes precedence for each
+// ID it includes, so that a product in the backup replaces any product with
+// the same ID (discarding its history and reservations) and a deleted ID in
+// the backup deletes any product with that ID.  Products are restored with
+// their IDs and timestamps (in UTC).
+//
+// The ID of the next product created follows the greatest ID in the database
+// as a result (including deleted IDs), so that new products do not collide
+// with restored ones.
+//
+// A backup is restored entirely or not at all: ErrInvalidBackup is returned
+// if an ID in the backup is not positive or is repeated, and ErrDuplicateSKU
+// if a SKU would be used by more than one product.  The maximum numbers of
+// categories and products (see WithMaxCategories and WithMaxProducts) do not
+// apply to a restore; the maximum number of deleted IDs retained (see
+// WithMaxDeleted) does, retaining the greatest.
+func (db *InMemoryDB) ImportAll(ctx context.Context, backup models.Backup, replace bool) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	products := map[int]*models.Product{}
+	deleted := map[int]struct{}{}
+	if !replace {
+		maps.Copy(products, db.products)
+		maps.Copy(deleted, db.deleted)
+	}
+
+	restored := map[int]bool{}
+	for _, product := range backup.Products {
+		switch {
+		case product.ID <= 0:
+			return fmt.Errorf("%w: invalid product id %d", ErrInvalidBackup, product.ID)
+		case restored[product.ID]:
+			return fmt.Errorf("%w: duplicate product id %d", ErrInvalidBackup, product.ID)
+		}
+		restored[product.ID] = true
+
+		product.Currency = currencyOrDefault(product.Currency)
+		product.Tags = slices.Clone(product.Tags)
+		product.Images = slices.Clone(product.Images)
+		product.CreatedAt = product.CreatedAt.UTC()
+		product.UpdatedAt = product.UpdatedAt.UTC()
+		products[product.ID] = &product
+		delete(deleted, product.ID)
+	}
+	for _, id := range backup.DeletedIDs {
+		switch {
+		case id <= 0:
+			return fmt.Errorf("%w: invalid deleted id %d", ErrInvalidBackup, id)
+		case restored[id]:
+			return fmt.Errorf("%w: id %d is both a product and deleted", ErrInvalidBackup, id)
+		}
+		delete(products, id)
+		deleted[id] = struct{}{}
+	}
+
+	skus := map[string]int{}
+	for id, product := range products {
+		if product.SKU == "" {
+			continue
+		}
+		if other, exists := skus[product.SKU]; exists {
+			return fmt.Errorf("%w: %s (products %d and %d)", ErrDuplicateSKU, product.SKU, min(id, other), max(id, other))
+		}
+		skus[product.SKU] = id
+	}
+
+	// the backup is valid, so the database is rebuilt with the result
+	if replace {
+		clear(db.history)
+		clear(db.reservations)
+	}
+	for id := range restored {
+		delete(db.history, id)
+	}
+	for _, id := range backup.DeletedIDs {
+		delete(db.history, id)
+	}
+	for id, reservation := range db.reservations {
+		if restored[reservation.ProductID] {
+			delete(db.reservations, id)
+		}
+	}
+
+	db.products = make(map[int]*models.Product, len(products))
+	db.ordered = make([]*models.Product, 0, len(products))
+	clear(db.skus)
+	clear(db.categories)
+	clear(db.names)
+	if replace {
+		db.nextID = 1
+	}
+	for _, product := range slices.SortedFunc(maps.Values(products), func(a, b *models.Product) int { return cmp.Compare(a.ID, b.ID) }) {
+		db.insert(product)
+	}
+	db.deleted = deleted
+	for id := range deleted {
+		db.nextID = max(db.nextID, id+1)
+	}
+	db.tombstones = slices.Sorted(maps.Keys(deleted))
+	db.trimDeleted()
+
+	return nil
+}
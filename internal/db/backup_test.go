@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"products-api/internal/models"
+)
+
+func TestImportAll(t *testing.T) {
+	ctx := context.Background()
+
+	// ids returns the IDs of the products in a database, failing the test if
+	// they cannot be exported
+	ids := func(t *testing.T, db *InMemoryDB) string {
+		t.Helper()
+		backup, err := db.ExportAll(ctx)
+		if err != nil {
+			t.Fatalf("ExportAll() failed: %v", err)
+		}
+		ids := []int{}
+		for _, product := range backup.Products {
+			ids = append(ids, product.ID)
+		}
+		return fmt.Sprintf("%v deleted %v", ids, backup.DeletedIDs)
+	}
+
+	t.Run("Export", func(t *testing.T) {
+		db := NewInMemoryDB(WithSampleData())
+		if err := db.DeleteProduct(ctx, 3); err != nil {
+			t.Fatalf("DeleteProduct() failed: %v", err)
+		}
+
+		if got := ids(t, db); got != "[1 2 4 5] deleted [3]" {
+			t.Errorf("Expected products [1 2 4 5] deleted [3], got %s", got)
+		}
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		db := NewInMemoryDB(WithSampleData())
+		err := db.ImportAll(ctx, models.Backup{
+			Products:   []models.Product{{ID: 2, Name: "Restored Mouse", Price: 19.99}, {ID: 10, Name: "Lamp", Price: 39.99}},
+			DeletedIDs: []int{4, 7},
+		}, false)
+		if err != nil {
+			t.Fatalf("ImportAll() failed: %v", err)
+		}
+
+		if got := ids(t, db); got != "[1 2 3 5 10] deleted [4 7]" {
+			t.Errorf("Expected products [1 2 3 5 10] deleted [4 7], got %s", got)
+		}
+		if product, _ := db.GetProductByID(ctx, 2); product == nil || product.Name != "Restored Mouse" || product.Currency != models.DefaultCurrency {
+			t.Errorf("Expected the restored product with the default currency, got %+v", product)
+		}
+		if _, err := db.GetProductByID(ctx, 4); !errors.Is(err, ErrGone) {
+			t.Errorf("Expected %v for a deleted ID, got %v", ErrGone, err)
+		}
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		db := NewInMemoryDB(WithSampleData())
+		err := db.ImportAll(ctx, models.Backup{
+			Products:   []models.Product{{ID: 2, SKU: "LAP-001", Name: "Laptop", Price: 999.99}},
+			DeletedIDs: []int{12},
+		}, true)
+		if err != nil {
+			t.Fatalf("ImportAll() failed: %v", err)
+		}
+
+		if got := ids(t, db); got != "[2] deleted [12]" {
+			t.Errorf("Expected products [2] deleted [12], got %s", got)
+		}
+		if product, err := db.GetProductBySKU(ctx, "LAP-001"); err != nil || product.ID != 2 {
+			t.Errorf("Expected product 2 by SKU, got %+v (error %v)", product, err)
+		}
+	})
+
+	t.Run("Next ID", func(t *testing.T) {
+		for _, tt := range []struct {
+			name    string
+			backup  models.Backup
+			replace bool
+			nextID  int
+		}{
+			{name: "Restored product", backup: models.Backup{Products: []models.Product{{ID: 20, Name: "Lamp"}}}, nextID: 21},
+			{name: "Restored deleted ID", backup: models.Backup{DeletedIDs: []int{30}}, nextID: 31},
+			{name: "Existing product", backup: models.Backup{Products: []models.Product{{ID: 2, Name: "Mouse"}}}, nextID: 6},
+			{name: "Replaced with empty backup", replace: true, nextID: 1},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				db := NewInMemoryDB(WithSampleData())
+				if err := db.ImportAll(ctx, tt.backup, tt.replace); err != nil {
+					t.Fatalf("ImportAll() failed: %v", err)
+				}
+
+				product, err := db.CreateProduct(ctx, models.CreateProductRequest{Name: "New", Price: 1})
+				if err != nil {
+					t.Fatalf("CreateProduct() failed: %v", err)
+				}
+				if product.ID != tt.nextID {
+					t.Errorf("Expected ID %d, got %d", tt.nextID, product.ID)
+				}
+			})
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, tt := range []struct {
+			name   string
+			backup models.Backup
+			err    error
+		}{
+			{name: "Invalid product ID", backup: models.Backup{Products: []models.Product{{ID: 0, Name: "Lamp"}}}, err: ErrInvalidBackup},
+			{name: "Duplicate product ID", backup: models.Backup{Products: []models.Product{{ID: 8, Name: "Lamp"}, {ID: 8, Name: "Desk"}}}, err: ErrInvalidBackup},
+			{name: "Invalid deleted ID", backup: models.Backup{DeletedIDs: []int{-1}}, err: ErrInvalidBackup},
+			{name: "Product and deleted", backup: models.Backup{Products: []models.Product{{ID: 8, Name: "Lamp"}}, DeletedIDs: []int{8}}, err: ErrInvalidBackup},
+			{name: "Duplicate SKU", backup: models.Backup{Products: []models.Product{{ID: 8, SKU: "CHR-001", Name: "Stool"}}}, err: ErrDuplicateSKU},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				db := NewInMemoryDB(WithSampleData())
+				if err := db.ImportAll(ctx, tt.backup, false); !errors.Is(err, tt.err) {
+					t.Errorf("Expected %v, got %v", tt.err, err)
+				}
+
+				// the database is unchanged
+				if got := ids(t, db); got != "[1 2 3 4 5] deleted []" {
+					t.Errorf("Expected the sample products, got %s", got)
+				}
+			})
+		}
+	})
+}
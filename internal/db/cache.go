@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"sync"
+
+	"products-api/internal/models"
+
+	"github.com/blugnu/time"
+)
+
+// cachedProduct is a product held by a CachingDB, with the time at which it
+// expires
+type cachedProduct struct {
+	product models.Product
+	expires time.Time
+}
+
+// CachingDB is a Database decorating another Database with a read-through
+// cache of products by ID: a product retrieved by GetProductByID is cached
+// for a configured time-to-live, during which it is retrieved from the cache
+// rather than the decorated Database.  Other methods are those of the
+// decorated Database.
+//
+// The cached product is invalidated when it is updated, upserted, reserved or
+// deleted through the CachingDB, or when the quantity of an expired
+// reservation is restored to it by a sweep started through the CachingDB
+// (see StartReservationSweep); a bulk update (UpdateWhere) or the restore of
+// a backup (ImportAll) invalidates all cached products.  Changes made other
+// than through the CachingDB are not visible until a cached product expires.
+// Expired products are removed when next retrieved, so the cache holds at
+// most one entry for each product that has been retrieved by ID.
+type CachingDB struct {
+	Database
+	mutex sync.Mutex
+	clock time.Clock
+	ttl   time.Duration
+	cache map[int]cachedProduct
+
+	// generation is incremented on each invalidation, so that a product
+	// retrieved from the decorated Database concurrently with a change
+	// is not cached (it may be the product from before the change)
+	generation uint64
+}
+
+// NewCachingDB returns a CachingDB caching the products of a Database for
+// a time-to-live.  The clock used to expire cached products is that of the
+// context (see time.ContextWithClock), or the system clock if there is none.
+func NewCachingDB(ctx context.Context, db Database, ttl time.Duration) *CachingDB {
+	return &CachingDB{
+		Database: db,
+		clock:    time.ClockFromContext(ctx),
+		ttl:      ttl,
+		cache:    map[int]cachedProduct{},
+	}
+}
+
+// GetProductByID returns a product by its ID, from the cache if it is cached
+// and has not expired or otherwise from the decorated Database (caching the
+// product retrieved)
+func (c *CachingDB) GetProductByID(ctx context.Context, id int) (*models.Product, error) {
+	c.mutex.Lock()
+	entry, cached := c.cache[id]
+	switch {
+	case cached && c.clock.Now().Before(entry.expires):
+		c.mutex.Unlock()
+		product := entry.product
+		return &product, nil
+
+	case cached:
+		delete(c.cache, id)
+	}
+	generation := c.generation
+	c.mutex.Unlock()
+
+	product, err := c.Database.GetProductByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	if c.generation == generation {
+		c.cache[id] = cachedProduct{product: *product, expires: c.clock.Now().Add(c.ttl)}
+	}
+	c.mutex.Unlock()
+
+	return product, nil
+}
+
+// UpdateProduct updates a product in the decorated Database, invalidating
+// any cached product
+func (c *CachingDB) UpdateProduct(ctx context.Context, id int, req models.UpdateProductRequest) (*models.Product, error) {
+	defer c.invalidate(id)
+	return c.Database.UpdateProduct(ctx, id, req)
+}
+
+// UpdateWhere updates products in the decorated Database, invalidating all
+// cached products
+func (c *CachingDB) UpdateWhere(ctx context.Context, filters []ProductFilter, req models.UpdateProductRequest) (int, error) {
+	defer c.invalidateAll()
+	return c.Database.UpdateWhere(ctx, filters, req)
+}
+
+// UpsertBySKU creates or replaces a product in the decorated Database,
+// invalidating any cached product replaced
+func (c *CachingDB) UpsertBySKU(ctx context.Context, sku string, req models.CreateProductRequest) (*models.Product, bool, error) {
+	product, created, err := c.Database.UpsertBySKU(ctx, sku, req)
+	if product != nil {
+		c.invalidate(product.ID)
+	}
+	return product, created, err
+}
+
+// ImportAll restores a backup to the decorated Database, invalidating all
+// cached products
+func (c *CachingDB) ImportAll(ctx context.Context, backup models.Backup, replace bool) error {
+	defer c.invalidateAll()
+	return c.Database.ImportAll(ctx, backup, replace)
+}
+
+// ReserveStock reserves stock of a product in the decorated Database,
+// invalidating any cached product
+func (c *CachingDB) ReserveStock(ctx context.Context, id, quantity int, ttl time.Duration) (*models.Reservation, error) {
+	defer c.invalidate(id)
+	return c.Database.ReserveStock(ctx, id, quantity, ttl)
+}
+
+// DeleteProduct deletes a product from the decorated Database, invalidating
+// any cached product
+func (c *CachingDB) DeleteProduct(ctx context.Context, id int) error {
+	defer c.invalidate(id)
+	return c.Database.DeleteProduct(ctx, id)
+}
+
+// reservationSweeper is implemented by a Database sweeping the reservations
+// of stock that have expired, restoring their quantities (see
+// InMemoryDB.StartReservationSweep)
+type reservationSweeper interface {
+	startReservationSweep(ctx context.Context, interval time.Duration, restored func(id int))
+}
+
+// StartReservationSweep starts the sweep of expired stock reservations of
+// the decorated Database, invalidating any cached product whose quantity is
+// restored when a reservation expires.  Has no effect if the decorated
+// Database does not sweep reservations.
+func (c *CachingDB) StartReservationSweep(ctx context.Context, interval time.Duration) {
+	if sweeper, ok := c.Database.(reservationSweeper); ok {
+		sweeper.startReservationSweep(ctx, interval, c.invalidate)
+	}
+}
+
+// invalidate removes a product from the cache
+func (c *CachingDB) invalidate(id int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.cache, id)
+	c.generation++
+}
+
+// invalidateAll removes all products from the cache
+func (c *CachingDB) invalidateAll() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	clear(c.cache)
+	c.generation++
+}
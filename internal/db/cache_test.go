@@ -0,0 +1,200 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"products-api/internal/models"
+
+	"github.com/blugnu/time"
+)
+
+// countingDB is a Database counting the products retrieved by ID
+type countingDB struct {
+	Database
+	gets atomic.Int32
+}
+
+func (c *countingDB) GetProductByID(ctx context.Context, id int) (*models.Product, error) {
+	c.gets.Add(1)
+	return c.Database.GetProductByID(ctx, id)
+}
+
+func TestCachingDB(t *testing.T) {
+	// newCache returns a CachingDB with a TTL of a minute, decorating a
+	// database of sample products, with the mock clock used for expiry
+	newCache := func() (*CachingDB, *countingDB, time.MockClock) {
+		clock := time.NewMockClock()
+		underlying := &countingDB{Database: NewInMemoryDB(WithSampleData())}
+		return NewCachingDB(time.ContextWithClock(context.Background(), clock), underlying, time.Minute), underlying, clock
+	}
+
+	// get retrieves a product by ID, failing the test if it cannot be
+	get := func(t *testing.T, db Database, id int) *models.Product {
+		t.Helper()
+		product, err := db.GetProductByID(context.Background(), id)
+		if err != nil {
+			t.Fatalf("GetProductByID(%d) failed: %v", id, err)
+		}
+		return product
+	}
+
+	t.Run("Hit", func(t *testing.T) {
+		cache, underlying, _ := newCache()
+
+		first := get(t, cache, 1)
+		second := get(t, cache, 1)
+
+		if n := underlying.gets.Load(); n != 1 {
+			t.Errorf("Expected 1 retrieval from the underlying database, got %d", n)
+		}
+		if second.Name != "Laptop" || !reflect.DeepEqual(first, second) {
+			t.Errorf("Expected the cached product %+v, got %+v", first, second)
+		}
+
+		// the cached product is a copy
+		second.Name = "Modified"
+		if product := get(t, cache, 1); product.Name != "Laptop" {
+			t.Errorf("Expected the cached product to be unmodified, got name %q", product.Name)
+		}
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		cache, underlying, clock := newCache()
+
+		get(t, cache, 1)
+		clock.AdvanceBy(time.Minute - time.Nanosecond)
+		get(t, cache, 1)
+		if n := underlying.gets.Load(); n != 1 {
+			t.Errorf("Expected 1 retrieval before expiry, got %d", n)
+		}
+
+		clock.AdvanceBy(time.Nanosecond)
+		get(t, cache, 1)
+		if n := underlying.gets.Load(); n != 2 {
+			t.Errorf("Expected 2 retrievals after expiry, got %d", n)
+		}
+	})
+
+	t.Run("Not found is not cached", func(t *testing.T) {
+		cache, underlying, _ := newCache()
+
+		for range 2 {
+			if _, err := cache.GetProductByID(context.Background(), 999); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Expected %v, got %v", ErrNotFound, err)
+			}
+		}
+		if n := underlying.gets.Load(); n != 2 {
+			t.Errorf("Expected 2 retrievals from the underlying database, got %d", n)
+		}
+	})
+
+	t.Run("Update invalidates", func(t *testing.T) {
+		cache, _, _ := newCache()
+		name := "Updated Laptop"
+
+		get(t, cache, 1)
+		if _, err := cache.UpdateProduct(context.Background(), 1, models.UpdateProductRequest{Name: &name}); err != nil {
+			t.Fatalf("UpdateProduct() failed: %v", err)
+		}
+
+		if product := get(t, cache, 1); product.Name != name {
+			t.Errorf("Expected name %q, got %q", name, product.Name)
+		}
+	})
+
+	t.Run("Bulk update invalidates", func(t *testing.T) {
+		cache, _, _ := newCache()
+		price := 1.0
+
+		get(t, cache, 1)
+		get(t, cache, 2)
+		if _, err := cache.UpdateWhere(context.Background(), []ProductFilter{ByCategory("Electronics")}, models.UpdateProductRequest{Price: &price}); err != nil {
+			t.Fatalf("UpdateWhere() failed: %v", err)
+		}
+
+		for _, id := range []int{1, 2} {
+			if product := get(t, cache, id); product.Price != price {
+				t.Errorf("Expected product %d to have price %g, got %g", id, price, product.Price)
+			}
+		}
+	})
+
+	t.Run("Upsert invalidates", func(t *testing.T) {
+		cache, _, _ := newCache()
+
+		get(t, cache, 1)
+		if _, _, err := cache.UpsertBySKU(context.Background(), "LAP-001", models.CreateProductRequest{Name: "Replaced Laptop", Price: 1}); err != nil {
+			t.Fatalf("UpsertBySKU() failed: %v", err)
+		}
+
+		if product := get(t, cache, 1); product.Name != "Replaced Laptop" {
+			t.Errorf("Expected name %q, got %q", "Replaced Laptop", product.Name)
+		}
+	})
+
+	t.Run("Delete invalidates", func(t *testing.T) {
+		cache, _, _ := newCache()
+
+		get(t, cache, 1)
+		if err := cache.DeleteProduct(context.Background(), 1); err != nil {
+			t.Fatalf("DeleteProduct() failed: %v", err)
+		}
+
+		if _, err := cache.GetProductByID(context.Background(), 1); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected %v, got %v", ErrNotFound, err)
+		}
+	})
+
+	t.Run("Expired reservation invalidates", func(t *testing.T) {
+		clock := time.NewMockClock()
+		ctx, cancel := context.WithCancel(time.ContextWithClock(context.Background(), clock))
+		defer cancel()
+		cache := NewCachingDB(ctx, NewInMemoryDB(WithClock(clock), WithSampleData()), time.Hour)
+		cache.StartReservationSweep(ctx, time.Minute)
+
+		if _, err := cache.ReserveStock(ctx, 1, 5, time.Minute); err != nil {
+			t.Fatalf("ReserveStock() failed: %v", err)
+		}
+		if product := get(t, cache, 1); product.Quantity != 10 {
+			t.Fatalf("Expected quantity 10 while reserved, got %d", product.Quantity)
+		}
+
+		clock.AdvanceBy(time.Minute)
+		if product := get(t, cache, 1); product.Quantity != 15 {
+			t.Errorf("Expected the restored quantity 15 once the reservation has expired, got %d", product.Quantity)
+		}
+	})
+
+	t.Run("Concurrent reads and updates", func(t *testing.T) {
+		cache, _, _ := newCache()
+
+		var wg sync.WaitGroup
+		for i := range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 100 {
+					if i%2 == 0 {
+						price := float64(i)
+						_, _ = cache.UpdateProduct(context.Background(), 1, models.UpdateProductRequest{Price: &price})
+					} else {
+						_, _ = cache.GetProductByID(context.Background(), 1)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		// once updates are complete, the product retrieved by ID is the
+		// product in the underlying database
+		stored, _ := cache.Database.GetProductByID(context.Background(), 1)
+		if product := get(t, cache, 1); product.Price != stored.Price {
+			t.Errorf("Expected price %g, got %g", stored.Price, product.Price)
+		}
+	})
+}
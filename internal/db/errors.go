@@ -1,7 +1,26 @@
 package db
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
-	ErrNotFound = errors.New("not found")
+	ErrNotFound     = errors.New("not found")
+	ErrDuplicateSKU = errors.New("duplicate sku")
+
+	// ErrGone is returned for a product that has been deleted, as distinct
+	// from one that never existed; it wraps ErrNotFound, so that callers not
+	// concerned with the distinction may treat both alike
+	ErrGone = fmt.Errorf("%w: deleted", ErrNotFound)
+
+	ErrDuplicateName = errors.New("duplicate name")
+
+	ErrTooManyCategories = errors.New("too many categories")
+
+	ErrCapacityExceeded = errors.New("capacity exceeded")
+
+	ErrInvalidBackup = errors.New("invalid backup")
+
+	ErrInsufficientStock = errors.New("insufficient stock")
 )
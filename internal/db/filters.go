@@ -0,0 +1,176 @@
+package db
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"products-api/internal/models"
+)
+
+// InStock returns a filter satisfied by products that are (or, if inStock
+// is false, are not) in stock; a product is in stock only if it is marked as
+// in stock and has a quantity greater than zero
+func InStock(inStock bool) ProductFilter {
+	return func(product *models.Product) bool {
+		return (product.InStock && product.Quantity > 0) == inStock
+	}
+}
+
+// HasDescription returns a filter satisfied by products with (or, if has is
+// false, without) a description; a description that is only whitespace is
+// not a description
+func HasDescription(has bool) ProductFilter {
+	return func(product *models.Product) bool {
+		return (strings.TrimSpace(product.Description) != "") == has
+	}
+}
+
+// ByCategory returns a filter satisfied by products in a category (compared
+// case-insensitively)
+func ByCategory(category string) ProductFilter {
+	return func(product *models.Product) bool {
+		return strings.EqualFold(product.Category, category)
+	}
+}
+
+// NotInCategories returns a filter satisfied by products in none of the
+// specified categories (compared case-insensitively).  The filter is
+// satisfied by all products if no categories are specified.
+func NotInCategories(categories ...string) ProductFilter {
+	categories = slices.Clone(categories)
+	return func(product *models.Product) bool {
+		return !slices.ContainsFunc(categories, func(c string) bool { return strings.EqualFold(product.Category, c) })
+	}
+}
+
+// HasTags returns a filter satisfied by products with all of the specified
+// tags (compared case-insensitively).  The filter is satisfied by all
+// products if no tags are specified.
+func HasTags(tags ...string) ProductFilter {
+	tags = slices.Clone(tags)
+	return func(product *models.Product) bool {
+		for _, tag := range tags {
+			if !slices.ContainsFunc(product.Tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// NameContains returns a filter satisfied by products with a name containing
+// a substring (case-insensitive)
+func NameContains(s string) ProductFilter {
+	s = strings.ToLower(s)
+	return func(product *models.Product) bool {
+		return strings.Contains(strings.ToLower(product.Name), s)
+	}
+}
+
+// PriceEpsilon is the difference within which prices are equal (see
+// PriceEquals); prices are compared to within half a cent, since they are
+// floating point values usually specified to 2 decimal places
+const PriceEpsilon = 0.005
+
+// PriceEquals returns a filter satisfied by products with a price equal to a
+// value, to within PriceEpsilon
+func PriceEquals(price float64) ProductFilter {
+	return func(product *models.Product) bool {
+		return math.Abs(product.Price-price) < PriceEpsilon
+	}
+}
+
+// PriceAtLeast returns a filter satisfied by products with a price greater
+// than or equal to a minimum
+func PriceAtLeast(price float64) ProductFilter {
+	return func(product *models.Product) bool {
+		return product.Price >= price
+	}
+}
+
+// PriceAtMost returns a filter satisfied by products with a price less than
+// or equal to a maximum
+func PriceAtMost(price float64) ProductFilter {
+	return func(product *models.Product) bool {
+		return product.Price <= price
+	}
+}
+
+// QuantityAtLeast returns a filter satisfied by products with a quantity
+// greater than or equal to a minimum
+func QuantityAtLeast(quantity int) ProductFilter {
+	return func(product *models.Product) bool {
+		return product.Quantity >= quantity
+	}
+}
+
+// QuantityAtMost returns a filter satisfied by products with a quantity less
+// than or equal to a maximum
+func QuantityAtMost(quantity int) ProductFilter {
+	return func(product *models.Product) bool {
+		return product.Quantity <= quantity
+	}
+}
+
+// CreatedAfter returns a filter satisfied by products created after a time
+func CreatedAfter(t time.Time) ProductFilter {
+	return func(product *models.Product) bool {
+		return product.CreatedAt.After(t)
+	}
+}
+
+// CreatedBefore returns a filter satisfied by products created before a time
+func CreatedBefore(t time.Time) ProductFilter {
+	return func(product *models.Product) bool {
+		return product.CreatedAt.Before(t)
+	}
+}
+
+// CreatedSince returns a filter satisfied by products created at or after a
+// time
+func CreatedSince(t time.Time) ProductFilter {
+	return func(product *models.Product) bool {
+		return !product.CreatedAt.Before(t)
+	}
+}
+
+// UpdatedAfter returns a filter satisfied by products last updated after a
+// time
+func UpdatedAfter(t time.Time) ProductFilter {
+	return func(product *models.Product) bool {
+		return product.UpdatedAt.After(t)
+	}
+}
+
+// UpdatedBefore returns a filter satisfied by products last updated before
+// a time
+func UpdatedBefore(t time.Time) ProductFilter {
+	return func(product *models.Product) bool {
+		return product.UpdatedAt.Before(t)
+	}
+}
+
+// ModifiedSince returns a filter satisfied by products last updated at or
+// after a time
+func ModifiedSince(t time.Time) ProductFilter {
+	return func(product *models.Product) bool {
+		return !product.UpdatedAt.Before(t)
+	}
+}
+
+// AnyOf returns a filter satisfied by products satisfying any of a number of
+// filters.  The filter is satisfied by no products if no filters are
+// specified.
+func AnyOf(filters ...ProductFilter) ProductFilter {
+	filters = slices.Clone(filters)
+	return func(product *models.Product) bool {
+		for _, filter := range filters {
+			if filter(product) {
+				return true
+			}
+		}
+		return false
+	}
+}
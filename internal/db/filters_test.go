@@ -0,0 +1,95 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"products-api/internal/models"
+)
+
+func TestFilters(t *testing.T) {
+	// the sample products, created an hour apart and each updated a day
+	// after being created; the laptop and smartphone are tagged, the
+	// description of the desk chair is blank and the smartphone is marked as
+	// in stock but has a quantity of zero
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	products := make([]models.Product, len(sampleProducts))
+	for i, req := range sampleProducts {
+		products[i] = models.Product{
+			ID:          i + 1,
+			SKU:         req.SKU,
+			Name:        req.Name,
+			Description: req.Description,
+			Price:       req.Price,
+			Category:    req.Category,
+			InStock:     req.InStock,
+			Quantity:    req.Quantity,
+			CreatedAt:   base.Add(time.Duration(i) * time.Hour),
+			UpdatedAt:   base.Add(time.Duration(i)*time.Hour + 24*time.Hour),
+		}
+	}
+	products[0].Tags = []string{"portable", "Premium"}
+	products[4].Tags = []string{"portable"}
+	products[3].Description = "  "
+	products[4].Quantity = 0
+
+	tests := []struct {
+		name        string
+		filter      ProductFilter
+		expectedIDs string
+	}{
+		{name: "In stock", filter: InStock(true), expectedIDs: "[1 2 4]"},
+		{name: "Not in stock", filter: InStock(false), expectedIDs: "[3 5]"},
+		{name: "Has description", filter: HasDescription(true), expectedIDs: "[1 2 3 5]"},
+		{name: "Has no description", filter: HasDescription(false), expectedIDs: "[4]"},
+		{name: "By category", filter: ByCategory("electronics"), expectedIDs: "[1 2 5]"},
+		{name: "By unknown category", filter: ByCategory("Toys"), expectedIDs: "[]"},
+		{name: "Not in category", filter: NotInCategories("office supplies"), expectedIDs: "[1 2 4 5]"},
+		{name: "Not in categories", filter: NotInCategories("Electronics", "FURNITURE"), expectedIDs: "[3]"},
+		{name: "Not in no categories specified", filter: NotInCategories(), expectedIDs: "[1 2 3 4 5]"},
+		{name: "Has tag", filter: HasTags("PORTABLE"), expectedIDs: "[1 5]"},
+		{name: "Has all tags", filter: HasTags("portable", "premium"), expectedIDs: "[1]"},
+		{name: "Has no tags specified", filter: HasTags(), expectedIDs: "[1 2 3 4 5]"},
+		{name: "Name contains", filter: NameContains("MOUSE"), expectedIDs: "[2]"},
+		{name: "Price equals", filter: PriceEquals(29.99), expectedIDs: "[2]"},
+		{name: "Price equals (within epsilon)", filter: PriceEquals(29.994), expectedIDs: "[2]"},
+		{name: "Price equals (outside epsilon)", filter: PriceEquals(29.98), expectedIDs: "[]"},
+		{name: "Price at least (inclusive)", filter: PriceAtLeast(199.99), expectedIDs: "[1 4 5]"},
+		{name: "Price at most (inclusive)", filter: PriceAtMost(29.99), expectedIDs: "[2 3]"},
+		{name: "Quantity at least (inclusive)", filter: QuantityAtLeast(15), expectedIDs: "[1 2]"},
+		{name: "Quantity at most (inclusive)", filter: QuantityAtMost(8), expectedIDs: "[3 4 5]"},
+		{name: "Created after (exclusive)", filter: CreatedAfter(base.Add(3 * time.Hour)), expectedIDs: "[5]"},
+		{name: "Created before (exclusive)", filter: CreatedBefore(base.Add(time.Hour)), expectedIDs: "[1]"},
+		{name: "Created since (inclusive)", filter: CreatedSince(base.Add(3 * time.Hour)), expectedIDs: "[4 5]"},
+		{name: "Updated after (exclusive)", filter: UpdatedAfter(base.Add(27 * time.Hour)), expectedIDs: "[5]"},
+		{name: "Updated before (exclusive)", filter: UpdatedBefore(base.Add(25 * time.Hour)), expectedIDs: "[1]"},
+		{name: "Modified since (inclusive)", filter: ModifiedSince(base.Add(27 * time.Hour)), expectedIDs: "[4 5]"},
+		{name: "Any of", filter: AnyOf(InStock(false), NameContains("chair")), expectedIDs: "[3 4 5]"},
+		{name: "Any of none", filter: AnyOf(), expectedIDs: "[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := []int{}
+			for i := range products {
+				if tt.filter(&products[i]) {
+					ids = append(ids, products[i].ID)
+				}
+			}
+			if fmt.Sprint(ids) != tt.expectedIDs {
+				t.Errorf("Expected products %s, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+
+	t.Run("Tags are copied", func(t *testing.T) {
+		tags := []string{"premium"}
+		filter := HasTags(tags...)
+		tags[0] = "missing"
+
+		if !filter(&products[0]) {
+			t.Error("Expected the filter to be unaffected by changes to the specified tags")
+		}
+	})
+}
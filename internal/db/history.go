@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"slices"
+
+	"products-api/internal/models"
+)
+
+// ProductHistory returns the changes to a product by its ID, oldest change
+// first; a product that has not been changed since it was created has an
+// empty history.  Returns ErrGone if the product has been deleted or
+// ErrNotFound if there has never been such a product.
+func (db *InMemoryDB) ProductHistory(ctx context.Context, id int) ([]models.ProductChange, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	if _, exists := db.products[id]; !exists {
+		if _, deleted := db.deleted[id]; deleted {
+			return nil, ErrGone
+		}
+		return nil, ErrNotFound
+	}
+
+	return append([]models.ProductChange{}, db.history[id]...), nil
+}
+
+// recordChange records a change to a product in its history, at the time at
+// which it was updated, identifying the fields that changed.  An operation
+// that changes no fields is not recorded.  The caller must hold the write
+// lock.
+func (db *InMemoryDB) recordChange(before, after *models.Product, operation string) {
+	fields := changedFields(before, after)
+	if len(fields) == 0 {
+		return
+	}
+
+	db.history[after.ID] = append(db.history[after.ID], models.ProductChange{
+		Timestamp: after.UpdatedAt,
+		Operation: operation,
+		Fields:    fields,
+	})
+}
+
+// changedFields returns the (JSON) names of the fields of a product that
+// differ between two versions of the product, in the order in which they are
+// declared; the ID and timestamps of the product are not compared
+func changedFields(before, after *models.Product) []string {
+	var fields []string
+	for _, field := range []struct {
+		name    string
+		changed bool
+	}{
+		{"sku", before.SKU != after.SKU},
+		{"name", before.Name != after.Name},
+		{"description", before.Description != after.Description},
+		{"price", before.Price != after.Price},
+		{"currency", before.Currency != after.Currency},
+		{"category", before.Category != after.Category},
+		{"in_stock", before.InStock != after.InStock},
+		{"quantity", before.Quantity != after.Quantity},
+		{"tags", !slices.Equal(before.Tags, after.Tags)},
+		{"images", !slices.Equal(before.Images, after.Images)},
+	} {
+		if field.changed {
+			fields = append(fields, field.name)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"products-api/internal/models"
+
+	"github.com/blugnu/time"
+)
+
+func TestProductHistory(t *testing.T) {
+	clock := time.NewMockClock()
+	db := NewInMemoryDB(WithClock(clock), WithSampleData())
+	ctx := context.Background()
+
+	// history returns the history of a product as operations and the fields
+	// changed, failing the test if it cannot be retrieved
+	history := func(t *testing.T, id int) string {
+		t.Helper()
+		changes, err := db.ProductHistory(ctx, id)
+		if err != nil {
+			t.Fatalf("ProductHistory(%d) failed: %v", id, err)
+		}
+		s := fmt.Sprint(len(changes))
+		for _, change := range changes {
+			s += fmt.Sprintf(" %s%v", change.Operation, change.Fields)
+		}
+		return s
+	}
+
+	t.Run("Unchanged", func(t *testing.T) {
+		changes, err := db.ProductHistory(ctx, 1)
+		if err != nil {
+			t.Fatalf("ProductHistory() failed: %v", err)
+		}
+		if changes == nil || len(changes) != 0 {
+			t.Errorf("Expected an empty history, got %v", changes)
+		}
+	})
+
+	t.Run("Changes are recorded", func(t *testing.T) {
+		name := "Updated Mouse"
+		price := 19.99
+		quantity := 20
+
+		clock.AdvanceBy(time.Hour)
+		updated := clock.Now()
+		if _, err := db.UpdateProduct(ctx, 2, models.UpdateProductRequest{Name: &name, Price: &price}); err != nil {
+			t.Fatalf("UpdateProduct() failed: %v", err)
+		}
+		clock.AdvanceBy(time.Hour)
+		if _, err := db.UpdateWhere(ctx, []ProductFilter{ByCategory("electronics")}, models.UpdateProductRequest{Quantity: &quantity}); err != nil {
+			t.Fatalf("UpdateWhere() failed: %v", err)
+		}
+
+		if got, expected := history(t, 2), "2 update[name price] bulk_update[quantity]"; got != expected {
+			t.Errorf("Expected history %q, got %q", expected, got)
+		}
+
+		changes, _ := db.ProductHistory(ctx, 2)
+		if !changes[0].Timestamp.Equal(updated) || !changes[1].Timestamp.Equal(updated.Add(time.Hour)) {
+			t.Errorf("Expected changes at %v and %v, got %v and %v", updated, updated.Add(time.Hour), changes[0].Timestamp, changes[1].Timestamp)
+		}
+	})
+
+	t.Run("Unchanged fields are not recorded", func(t *testing.T) {
+		name := "Desk Chair"
+		if _, err := db.UpdateProduct(ctx, 4, models.UpdateProductRequest{Name: &name}); err != nil {
+			t.Fatalf("UpdateProduct() failed: %v", err)
+		}
+
+		if got := history(t, 4); got != "0" {
+			t.Errorf("Expected an empty history, got %q", got)
+		}
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		product, _ := db.GetProductByID(ctx, 3)
+		if _, _, err := db.UpsertBySKU(ctx, product.SKU, models.CreateProductRequest{
+			Name:     product.Name,
+			Price:    product.Price,
+			Currency: product.Currency,
+			Category: product.Category,
+			InStock:  true,
+		}); err != nil {
+			t.Fatalf("UpsertBySKU() failed: %v", err)
+		}
+
+		if got, expected := history(t, 3), "1 replace[description in_stock]"; got != expected {
+			t.Errorf("Expected history %q, got %q", expected, got)
+		}
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		if _, err := db.ProductHistory(ctx, 999); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected %v, got %v", ErrNotFound, err)
+		}
+	})
+
+	t.Run("Deleted", func(t *testing.T) {
+		if err := db.DeleteProduct(ctx, 5); err != nil {
+			t.Fatalf("DeleteProduct() failed: %v", err)
+		}
+		if _, err := db.ProductHistory(ctx, 5); !errors.Is(err, ErrGone) {
+			t.Errorf("Expected %v, got %v", ErrGone, err)
+		}
+
+		// the history of a deleted product cannot be retrieved, so is not
+		// retained
+		if err := db.DeleteProduct(ctx, 2); err != nil {
+			t.Fatalf("DeleteProduct() failed: %v", err)
+		}
+		if changes, retained := db.history[2]; retained {
+			t.Errorf("Expected the history of a deleted product to be discarded, got %v", changes)
+		}
+	})
+}
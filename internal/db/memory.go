@@ -1,101 +1,339 @@
 package db
 
 import (
-	"sort"
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"strings"
 	"sync"
-	"time"
 
 	"products-api/internal/models"
+
+	"github.com/blugnu/time"
 )
 
 // Database interface defines the contract for our database operations
 type Database interface {
-	GetProducts(page, pageSize int, filters ...ProductFilter) ([]models.Product, int, error)
-	GetProductByID(id int) (*models.Product, error)
-	CreateProduct(req models.CreateProductRequest) (*models.Product, error)
-	UpdateProduct(id int, req models.UpdateProductRequest) (*models.Product, error)
-	DeleteProduct(id int) error
+	GetProducts(ctx context.Context, page, pageSize int, order ProductOrder, filters ...ProductFilter) ([]models.Product, int, error)
+	ListProducts(ctx context.Context, filters ...ProductFilter) ([]models.Product, error)
+	CountProducts(ctx context.Context, filters ...ProductFilter) (int, error)
+	PriceStats(ctx context.Context, filters ...ProductFilter) ([]models.CategoryStats, error)
+	ScanProducts(ctx context.Context, fn func(models.Product) error, filters ...ProductFilter) error
+	GetProductByID(ctx context.Context, id int) (*models.Product, error)
+	GetProductsByIDs(ctx context.Context, ids []int) ([]models.Product, error)
+	GetProductBySKU(ctx context.Context, sku string) (*models.Product, error)
+	CreateProduct(ctx context.Context, req models.CreateProductRequest) (*models.Product, error)
+	CreateProductWithUniqueName(ctx context.Context, req models.CreateProductRequest) (*models.Product, error)
+	UpdateProduct(ctx context.Context, id int, req models.UpdateProductRequest) (*models.Product, error)
+	UpdateWhere(ctx context.Context, filters []ProductFilter, req models.UpdateProductRequest) (int, error)
+	UpsertBySKU(ctx context.Context, sku string, req models.CreateProductRequest) (*models.Product, bool, error)
+	DeleteProduct(ctx context.Context, id int) error
+	ProductHistory(ctx context.Context, id int) ([]models.ProductChange, error)
+	ExportAll(ctx context.Context) (models.Backup, error)
+	ImportAll(ctx context.Context, backup models.Backup, replace bool) error
+	ReserveStock(ctx context.Context, id, quantity int, ttl time.Duration) (*models.Reservation, error)
 }
 
+// ProductFilter is satisfied by the products for which it returns true.
+// Filters for the properties of a product are returned by constructors (e.g.
+// ByCategory, PriceAtLeast) and may be combined using AnyOf.
 type ProductFilter func(product *models.Product) bool
 
-// InMemoryDB implements the Database interface using in-memory storage
+// ProductOrder compares two products, returning a negative number if a
+// should be ordered before b, a positive number if b should be ordered before
+// a, or zero if they are equivalent.  Equivalent products are ordered by ID.
+type ProductOrder func(a, b *models.Product) int
+
+// scanChunkSize is the number of products examined by ScanProducts each time
+// the read lock is acquired
+const scanChunkSize = 100
+
+// cancellationCheckInterval is the number of products scanned between checks
+// for cancellation of the context when filtering products
+const cancellationCheckInterval = 1024
+
+// InMemoryDB implements the Database interface using in-memory storage.
+//
+// Products are held in a map for O(1) lookup by ID and in a slice ordered by
+// ID, so that listings do not require sorting and an unfiltered page can be
+// obtained directly by offset.  Both are maintained under the write lock.
 type InMemoryDB struct {
-	products map[int]*models.Product
-	nextID   int
-	mutex    sync.RWMutex
+	products   map[int]*models.Product
+	ordered    []*models.Product // products ordered by ID
+	skus       map[string]int    // index of product IDs by SKU
+	categories map[string]int    // number of products in each (lowercase) category
+	names      map[string]int    // number of products with each (lowercase) name
+	deleted    map[int]struct{}  // IDs of the most recently deleted products (see WithMaxDeleted)
+	tombstones []int             // the IDs in deleted, in the order deleted
+	history    map[int][]models.ProductChange
+	nextID     int // greater than the ID of every product inserted
+	mutex      sync.RWMutex
+
+	reservations      map[int]models.Reservation // reservations by ID, until expired
+	nextReservationID int
+
+	clock         time.Clock // provides the times at which products change and reservations expire
+	maxCategories int
+	maxDeleted    int
+	maxProducts   int
+	sampleData    bool
+}
+
+// sampleProducts are added to a database created WithSampleData
+var sampleProducts = []models.CreateProductRequest{
+	{
+		SKU:         "LAP-001",
+		Name:        "Laptop",
+		Description: "High-performance laptop for professional use",
+		Price:       1299.99,
+		Category:    "Electronics",
+		InStock:     true,
+		Quantity:    15,
+	},
+	{
+		SKU:         "MOU-001",
+		Name:        "Wireless Mouse",
+		Description: "Ergonomic wireless mouse with long battery life",
+		Price:       29.99,
+		Category:    "Electronics",
+		InStock:     true,
+		Quantity:    50,
+	},
+	{
+		SKU:         "MUG-001",
+		Name:        "Coffee Mug",
+		Description: "Ceramic coffee mug with company logo",
+		Price:       12.50,
+		Category:    "Office Supplies",
+		InStock:     false,
+		Quantity:    0,
+	},
+	{
+		SKU:         "CHR-001",
+		Name:        "Desk Chair",
+		Description: "Comfortable ergonomic office chair",
+		Price:       199.99,
+		Category:    "Furniture",
+		InStock:     true,
+		Quantity:    8,
+	},
+	{
+		SKU:         "PHN-001",
+		Name:        "Smartphone",
+		Description: "Latest smartphone with advanced camera",
+		Price:       899.99,
+		Category:    "Electronics",
+		InStock:     true,
+		Quantity:    25,
+	},
 }
 
-// NewInMemoryDB creates a new in-memory database with some sample data
-func NewInMemoryDB() *InMemoryDB {
+// NewInMemoryDB creates a new in-memory database, applying any specified
+// options.  The database is empty unless created WithSampleData.
+func NewInMemoryDB(opts ...Option) *InMemoryDB {
 	db := &InMemoryDB{
-		products: make(map[int]*models.Product),
-		nextID:   1,
-	}
-
-	// Add some sample products
-	sampleProducts := []models.CreateProductRequest{
-		{
-			Name:        "Laptop",
-			Description: "High-performance laptop for professional use",
-			Price:       1299.99,
-			Category:    "Electronics",
-			InStock:     true,
-		},
-		{
-			Name:        "Wireless Mouse",
-			Description: "Ergonomic wireless mouse with long battery life",
-			Price:       29.99,
-			Category:    "Electronics",
-			InStock:     true,
-		},
-		{
-			Name:        "Coffee Mug",
-			Description: "Ceramic coffee mug with company logo",
-			Price:       12.50,
-			Category:    "Office Supplies",
-			InStock:     false,
-		},
-		{
-			Name:        "Desk Chair",
-			Description: "Comfortable ergonomic office chair",
-			Price:       199.99,
-			Category:    "Furniture",
-			InStock:     true,
-		},
-		{
-			Name:        "Smartphone",
-			Description: "Latest smartphone with advanced camera",
-			Price:       899.99,
-			Category:    "Electronics",
-			InStock:     true,
-		},
-	}
-
-	for _, req := range sampleProducts {
-		_, _ = db.CreateProduct(req)
+		products:   make(map[int]*models.Product),
+		skus:       make(map[string]int),
+		categories: make(map[string]int),
+		names:      make(map[string]int),
+		deleted:    make(map[int]struct{}),
+		history:    make(map[int][]models.ProductChange),
+		nextID:     1,
+		clock:      time.SystemClock(),
+		maxDeleted: DefaultMaxDeleted,
+
+		reservations:      make(map[int]models.Reservation),
+		nextReservationID: 1,
+	}
+
+	for _, opt := range opts {
+		opt(db)
+	}
+
+	if db.sampleData {
+		for _, req := range sampleProducts {
+			_, _ = db.CreateProduct(context.Background(), req)
+		}
 	}
 
 	return db
 }
 
-// GetProducts returns a paginated list of products
-func (db *InMemoryDB) GetProducts(page, pageSize int, filters ...ProductFilter) ([]models.Product, int, error) {
+// GetProducts returns a paginated list of products in the specified order
+// (by ID if order is nil), with equivalent products ordered by ID
+func (db *InMemoryDB) GetProducts(ctx context.Context, page, pageSize int, order ProductOrder, filters ...ProductFilter) ([]models.Product, int, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	// without filters or ordering, the page is obtained directly from the
+	// ordered slice
+	if len(filters) == 0 && order == nil {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+
+		total := len(db.ordered)
+		start, end := pageBounds(page, pageSize, total)
+
+		products := make([]models.Product, 0, end-start)
+		for _, product := range db.ordered[start:end] {
+			products = append(products, *product)
+		}
+		return products, total, nil
+	}
+
+	products, err := db.filteredProducts(ctx, filters)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	products, total := Paginate(products, page, pageSize, order)
+	return products, total, nil
+}
+
+// ListProducts returns all products matching the specified filters,
+// sorted by ID
+func (db *InMemoryDB) ListProducts(ctx context.Context, filters ...ProductFilter) ([]models.Product, error) {
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 
-	if page < 1 {
-		page = 1
+	return db.filteredProducts(ctx, filters)
+}
+
+// CountProducts returns the number of products matching the specified
+// filters
+func (db *InMemoryDB) CountProducts(ctx context.Context, filters ...ProductFilter) (int, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(filters) == 0 {
+		return len(db.ordered), nil
+	}
+
+	count := 0
+productLoop:
+	for n, product := range db.ordered {
+		if n%cancellationCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+		}
+
+		for _, filter := range filters {
+			if !filter(product) {
+				continue productLoop
+			}
+		}
+		count++
 	}
-	if pageSize < 1 {
-		pageSize = 10
+
+	return count, nil
+}
+
+// PriceStats returns the number of products, and their minimum, maximum and
+// average price, in each category with products matching any filters (see
+// CategoryPriceStats)
+func (db *InMemoryDB) PriceStats(ctx context.Context, filters ...ProductFilter) ([]models.CategoryStats, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	// Convert map to slice and sort by ID, removing products that don't
+	stats := newPriceStats()
+productLoop:
+	for n, product := range db.ordered {
+		if n%cancellationCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, filter := range filters {
+			if !filter(product) {
+				continue productLoop
+			}
+		}
+		stats.add(product)
+	}
+
+	return stats.result(), nil
+}
+
+// ScanProducts calls fn for each product matching the specified filters, in
+// ID order, stopping at (and returning) the first error returned by fn.
+//
+// The IDs of all products are first snapshotted; products are then examined
+// in chunks, holding the read lock only while each chunk is filtered and
+// copied.  fn is called without the lock held, so may safely modify the
+// database.  Products deleted after the snapshot (before their chunk is
+// examined) are skipped and products created after the snapshot are not
+// included.
+func (db *InMemoryDB) ScanProducts(ctx context.Context, fn func(models.Product) error, filters ...ProductFilter) error {
+	db.mutex.RLock()
+	ids := make([]int, len(db.ordered))
+	for i, product := range db.ordered {
+		ids[i] = product.ID
+	}
+	db.mutex.RUnlock()
+
+	chunk := make([]models.Product, 0, scanChunkSize)
+	for ids := range slices.Chunk(ids, scanChunkSize) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		chunk = chunk[:0]
+		db.mutex.RLock()
+	productLoop:
+		for _, id := range ids {
+			product, exists := db.products[id]
+			if !exists {
+				continue
+			}
+			for _, filter := range filters {
+				if !filter(product) {
+					continue productLoop
+				}
+			}
+			chunk = append(chunk, *product)
+		}
+		db.mutex.RUnlock()
+
+		for _, product := range chunk {
+			if err := fn(product); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// filteredProducts returns copies of all products matching the specified
+// filters, sorted by ID.  The caller must hold the read lock.
+//
+// The context is checked periodically during the scan; if it is cancelled
+// (or exceeds its deadline) the scan is abandoned and the context error
+// returned.
+func (db *InMemoryDB) filteredProducts(ctx context.Context, filters []ProductFilter) ([]models.Product, error) {
+	// Copy products (already ordered by ID), removing products that don't
 	// match filters
-	products := make([]models.Product, 0, len(db.products))
+	products := make([]models.Product, 0, len(db.ordered))
 productLoop:
-	for _, product := range db.products {
+	for n, product := range db.ordered {
+		if n%cancellationCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
 		if len(filters) > 0 {
 			for _, filter := range filters {
 				if !filter(product) {
@@ -106,32 +344,103 @@ productLoop:
 		products = append(products, *product)
 	}
 
-	sort.Slice(products, func(i, j int) bool {
-		return products[i].ID < products[j].ID
-	})
+	return products, nil
+}
 
-	total := len(products)
-	start := (page - 1) * pageSize
-	end := start + pageSize
+// insert adds a product to the database, maintaining the ordered slice, SKU
+// index and counts of categories and names, and ensuring that the next ID
+// allocated is greater than the ID of the product.  The caller must hold the
+// write lock.
+func (db *InMemoryDB) insert(product *models.Product) {
+	i, _ := slices.BinarySearchFunc(db.ordered, product.ID, compareID)
+	db.ordered = slices.Insert(db.ordered, i, product)
+
+	db.products[product.ID] = product
+	if product.SKU != "" {
+		db.skus[product.SKU] = product.ID
+	}
+	db.addCategory(product.Category)
+	db.addName(product.Name)
+	db.nextID = max(db.nextID, product.ID+1)
+}
 
-	if start >= total {
-		return []models.Product{}, total, nil
+// remove removes a product from the database, maintaining the ordered slice,
+// SKU index and counts of categories and names.  The caller must hold the
+// write lock.
+func (db *InMemoryDB) remove(product *models.Product) {
+	if i, found := slices.BinarySearchFunc(db.ordered, product.ID, compareID); found {
+		db.ordered = slices.Delete(db.ordered, i, i+1)
 	}
 
-	if end > total {
-		end = total
+	delete(db.skus, product.SKU)
+	delete(db.products, product.ID)
+	db.removeCategory(product.Category)
+	db.removeName(product.Name)
+}
+
+// allowsCategory returns true if a product may be added to a category; the
+// category must already exist or the maximum number of categories (if any)
+// must not have been reached.  The caller must hold the read lock.
+func (db *InMemoryDB) allowsCategory(category string) bool {
+	if category == "" || db.maxCategories <= 0 {
+		return true
+	}
+	_, exists := db.categories[strings.ToLower(category)]
+	return exists || len(db.categories) < db.maxCategories
+}
+
+// addCategory counts a product in a category.  The caller must hold the
+// write lock.
+func (db *InMemoryDB) addCategory(category string) {
+	if category != "" {
+		db.categories[strings.ToLower(category)]++
+	}
+}
+
+// removeCategory uncounts a product from a category, removing the category
+// if it has no remaining products.  The caller must hold the write lock.
+func (db *InMemoryDB) removeCategory(category string) {
+	if category == "" {
+		return
+	}
+	key := strings.ToLower(category)
+	if db.categories[key]--; db.categories[key] <= 0 {
+		delete(db.categories, key)
+	}
+}
+
+// addName counts a product with a name.  The caller must hold the write
+// lock.
+func (db *InMemoryDB) addName(name string) {
+	db.names[strings.ToLower(name)]++
+}
+
+// removeName uncounts a product with a name.  The caller must hold the write
+// lock.
+func (db *InMemoryDB) removeName(name string) {
+	key := strings.ToLower(name)
+	if db.names[key]--; db.names[key] <= 0 {
+		delete(db.names, key)
 	}
+}
 
-	return products[start:end], total, nil
+// compareID compares the ID of a product with a target ID, for binary
+// searches of the ordered slice
+func compareID(product *models.Product, id int) int {
+	return cmp.Compare(product.ID, id)
 }
 
-// GetProductByID returns a product by its ID
-func (db *InMemoryDB) GetProductByID(id int) (*models.Product, error) {
+// GetProductByID returns a product by its ID, or ErrGone if the product
+// has been deleted
+func (db *InMemoryDB) GetProductByID(ctx context.Context, id int) (*models.Product, error) {
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 
 	product, exists := db.products[id]
 	if !exists {
+		if _, deleted := db.deleted[id]; deleted {
+			return nil, ErrGone
+		}
 		return nil, ErrNotFound
 	}
 
@@ -140,33 +449,116 @@ func (db *InMemoryDB) GetProductByID(id int) (*models.Product, error) {
 	return &productCopy, nil
 }
 
+// GetProductsByIDs returns the products with the specified IDs, in the order
+// of the IDs; IDs that are not the ID of a product are skipped and a product
+// is returned for each occurrence of its ID
+func (db *InMemoryDB) GetProductsByIDs(ctx context.Context, ids []int) ([]models.Product, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	products := make([]models.Product, 0, len(ids))
+	for _, id := range ids {
+		if product, exists := db.products[id]; exists {
+			products = append(products, *product)
+		}
+	}
+	return products, nil
+}
+
+// GetProductBySKU returns a product by its SKU
+func (db *InMemoryDB) GetProductBySKU(ctx context.Context, sku string) (*models.Product, error) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	id, exists := db.skus[sku]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	// Return a copy to prevent external modifications
+	productCopy := *db.products[id]
+	return &productCopy, nil
+}
+
 // CreateProduct creates a new product
-func (db *InMemoryDB) CreateProduct(req models.CreateProductRequest) (*models.Product, error) {
+func (db *InMemoryDB) CreateProduct(ctx context.Context, req models.CreateProductRequest) (*models.Product, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return db.create(req)
+}
+
+// CreateProductWithUniqueName creates a new product, as CreateProduct,
+// unless a product with the same name (compared case-insensitively) already
+// exists, in which case ErrDuplicateName is returned.  The check and the
+// write are performed atomically, under the write lock.
+func (db *InMemoryDB) CreateProductWithUniqueName(ctx context.Context, req models.CreateProductRequest) (*models.Product, error) {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
 
-	now := time.Now()
+	if db.names[strings.ToLower(req.Name)] > 0 {
+		return nil, ErrDuplicateName
+	}
+	return db.create(req)
+}
+
+// create creates a product.  The caller must hold the write lock.
+func (db *InMemoryDB) create(req models.CreateProductRequest) (*models.Product, error) {
+	if _, exists := db.skus[req.SKU]; req.SKU != "" && exists {
+		return nil, ErrDuplicateSKU
+	}
+	if !db.allowsCategory(req.Category) {
+		return nil, ErrTooManyCategories
+	}
+	if db.maxProducts > 0 && len(db.products) >= db.maxProducts {
+		return nil, ErrCapacityExceeded
+	}
+
+	now := db.now()
 	product := &models.Product{
 		ID:          db.nextID,
+		SKU:         req.SKU,
 		Name:        req.Name,
 		Description: req.Description,
 		Price:       req.Price,
+		Currency:    currencyOrDefault(req.Currency),
 		Category:    req.Category,
 		InStock:     req.InStock,
+		Quantity:    req.Quantity,
+		Tags:        mergeTags(nil, req.Tags),
+		Images:      slices.Clone(req.Images),
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
 
-	db.products[db.nextID] = product
-	db.nextID++
+	db.insert(product)
 
 	// Return a copy
 	productCopy := *product
 	return &productCopy, nil
 }
 
+// now returns the current time of the clock of the database in UTC; the
+// times at which products are created and updated are stored in UTC,
+// whatever the local time zone
+func (db *InMemoryDB) now() time.Time {
+	return db.clock.Now().UTC()
+}
+
+// currencyOrDefault returns a currency or, if empty, the default currency
+func currencyOrDefault(currency string) string {
+	if currency == "" {
+		return models.DefaultCurrency
+	}
+	return currency
+}
+
 // UpdateProduct updates an existing product
-func (db *InMemoryDB) UpdateProduct(id int, req models.UpdateProductRequest) (*models.Product, error) {
+func (db *InMemoryDB) UpdateProduct(ctx context.Context, id int, req models.UpdateProductRequest) (*models.Product, error) {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
 
@@ -175,9 +567,93 @@ func (db *InMemoryDB) UpdateProduct(id int, req models.UpdateProductRequest) (*m
 		return nil, ErrNotFound
 	}
 
-	// Update fields if provided
+	if err := db.checkUpdate(product, req); err != nil {
+		return nil, err
+	}
+	db.update(product, req, models.OperationUpdate, db.now())
+
+	// Return a copy
+	productCopy := *product
+	return &productCopy, nil
+}
+
+// UpdateWhere applies an update to all products matching the specified
+// filters (all products, if there are none), returning the number of
+// products updated.  The update is applied atomically, under the write lock:
+// if the update cannot be applied to any of the products, no product is
+// updated.  Since SKUs are unique, a (non-empty) SKU cannot be applied to
+// more than one product (ErrDuplicateSKU).
+func (db *InMemoryDB) UpdateWhere(ctx context.Context, filters []ProductFilter, req models.UpdateProductRequest) (int, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	var matched []*models.Product
+productLoop:
+	for n, product := range db.ordered {
+		if n%cancellationCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+		}
+
+		for _, filter := range filters {
+			if !filter(product) {
+				continue productLoop
+			}
+		}
+		matched = append(matched, product)
+	}
+
+	if req.SKU != nil && *req.SKU != "" && len(matched) > 1 {
+		return 0, ErrDuplicateSKU
+	}
+	for _, product := range matched {
+		if err := db.checkUpdate(product, req); err != nil {
+			return 0, err
+		}
+	}
+
+	now := db.now()
+	for _, product := range matched {
+		db.update(product, req, models.OperationBulkUpdate, now)
+	}
+	return len(matched), nil
+}
+
+// checkUpdate returns an error if an update cannot be applied to a product:
+// ErrDuplicateSKU if the update would give the product the SKU of another
+// product, or ErrTooManyCategories if it would introduce a category beyond
+// the maximum.  The caller must hold the read (or write) lock.
+func (db *InMemoryDB) checkUpdate(product *models.Product, req models.UpdateProductRequest) error {
+	if req.SKU != nil && *req.SKU != product.SKU {
+		if _, exists := db.skus[*req.SKU]; *req.SKU != "" && exists {
+			return ErrDuplicateSKU
+		}
+	}
+	if req.Category != nil && !strings.EqualFold(*req.Category, product.Category) && !db.allowsCategory(*req.Category) {
+		return ErrTooManyCategories
+	}
+	return nil
+}
+
+// update applies an update (that has been checked using checkUpdate) to a
+// product, maintaining the SKU index and counts of categories and names and
+// recording the change in the history of the product.  The caller must hold
+// the write lock.
+func (db *InMemoryDB) update(product *models.Product, req models.UpdateProductRequest, operation string, now time.Time) {
+	before := *product
+
+	if req.SKU != nil && *req.SKU != product.SKU {
+		delete(db.skus, product.SKU)
+		product.SKU = *req.SKU
+		if product.SKU != "" {
+			db.skus[product.SKU] = product.ID
+		}
+	}
 	if req.Name != nil {
+		db.removeName(product.Name)
 		product.Name = *req.Name
+		db.addName(product.Name)
 	}
 	if req.Description != nil {
 		product.Description = *req.Description
@@ -185,30 +661,127 @@ func (db *InMemoryDB) UpdateProduct(id int, req models.UpdateProductRequest) (*m
 	if req.Price != nil {
 		product.Price = *req.Price
 	}
+	if req.PriceMultiplier != nil {
+		product.Price = math.Round(product.Price*(*req.PriceMultiplier)*100) / 100
+	}
+	if req.Currency != nil {
+		product.Currency = *req.Currency
+	}
 	if req.Category != nil {
+		db.removeCategory(product.Category)
 		product.Category = *req.Category
+		db.addCategory(product.Category)
 	}
 	if req.InStock != nil {
 		product.InStock = *req.InStock
 	}
+	if req.Quantity != nil {
+		product.Quantity = *req.Quantity
+	}
+	if req.Tags != nil {
+		if req.MergeTags {
+			product.Tags = mergeTags(product.Tags, req.Tags)
+		} else {
+			product.Tags = mergeTags(nil, req.Tags)
+		}
+	}
+	if req.Images != nil {
+		product.Images = slices.Clone(req.Images)
+	}
 
-	product.UpdatedAt = time.Now()
+	product.UpdatedAt = now
+	db.recordChange(&before, product, operation)
+}
+
+// mergeTags returns a new slice containing the existing tags followed by any
+// of the specified tags not already present; tags are compared
+// case-insensitively, so tags are stored de-duplicated (retaining the case
+// with which a tag was first added).  The tags of a stored product are never
+// modified in place, since copies of the product share the slice.
+func mergeTags(existing, tags []string) []string {
+	merged := slices.Clone(existing)
+	for _, tag := range tags {
+		if !slices.ContainsFunc(merged, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+// UpsertBySKU creates a product with a specified SKU (replacing any SKU in
+// the request) or, if a product with the SKU already exists, replaces all
+// fields of that product (other than its ID and creation time) with those of
+// the request.  Returns the product and true if it was created, or false if
+// it was updated.  The lookup and the write are performed atomically, under
+// the write lock.
+//
+// A product without a SKU cannot be found, so an empty SKU creates a product.
+func (db *InMemoryDB) UpsertBySKU(ctx context.Context, sku string, req models.CreateProductRequest) (*models.Product, bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	req.SKU = sku
+	id, exists := db.skus[sku]
+	if sku == "" || !exists {
+		product, err := db.create(req)
+		return product, err == nil, err
+	}
+
+	product := db.products[id]
+	if !strings.EqualFold(req.Category, product.Category) && !db.allowsCategory(req.Category) {
+		return nil, false, ErrTooManyCategories
+	}
+	before := *product
+
+	db.removeCategory(product.Category)
+	db.removeName(product.Name)
+	product.Name = req.Name
+	product.Description = req.Description
+	product.Price = req.Price
+	product.Currency = currencyOrDefault(req.Currency)
+	product.Category = req.Category
+	product.InStock = req.InStock
+	product.Quantity = req.Quantity
+	product.Tags = mergeTags(nil, req.Tags)
+	product.Images = slices.Clone(req.Images)
+	product.UpdatedAt = db.now()
+	db.addCategory(product.Category)
+	db.addName(product.Name)
+	db.recordChange(&before, product, models.OperationReplace)
 
 	// Return a copy
 	productCopy := *product
-	return &productCopy, nil
+	return &productCopy, false, nil
 }
 
-// DeleteProduct deletes a product by its ID
-func (db *InMemoryDB) DeleteProduct(id int) error {
+// DeleteProduct deletes a product by its ID, discarding its history (which
+// cannot be retrieved once the product is deleted).  The ID of the product
+// is retained, so that the product is reported as gone (ErrGone) rather than
+// not found, until it is one of more than the maximum number of deleted
+// products retained (see WithMaxDeleted).
+func (db *InMemoryDB) DeleteProduct(ctx context.Context, id int) error {
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
 
-	_, exists := db.products[id]
+	product, exists := db.products[id]
 	if !exists {
 		return ErrNotFound
 	}
 
-	delete(db.products, id)
+	db.remove(product)
+	db.deleted[id] = struct{}{}
+	db.tombstones = append(db.tombstones, id)
+	db.trimDeleted()
+	delete(db.history, id)
 	return nil
 }
+
+// trimDeleted discards the IDs of the least recently deleted products in
+// excess of the maximum number retained.  The caller must hold the write
+// lock.
+func (db *InMemoryDB) trimDeleted() {
+	for len(db.tombstones) > db.maxDeleted {
+		delete(db.deleted, db.tombstones[0])
+		db.tombstones = db.tombstones[1:]
+	}
+}
@@ -1,8 +1,15 @@
 package db
 
 import (
+	"cmp"
+	"context"
 	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
 	"testing"
+	"time"
 
 	"products-api/internal/models"
 )
@@ -14,6 +21,22 @@ func TestNewInMemoryDB(t *testing.T) {
 		t.Fatal("NewInMemoryDB() should not return nil")
 	}
 
+	if db.nextID != 1 {
+		t.Errorf("Expected nextID to be 1, got %d", db.nextID)
+	}
+
+	if len(db.products) != 0 {
+		t.Errorf("Expected no products, got %d", len(db.products))
+	}
+}
+
+func TestNewInMemoryDBWithSampleData(t *testing.T) {
+	db := NewInMemoryDB(WithSampleData())
+
+	if db == nil {
+		t.Fatal("NewInMemoryDB(WithSampleData()) should not return nil")
+	}
+
 	if db.nextID != 6 { // Should be 6 after adding 5 sample products
 		t.Errorf("Expected nextID to be 6, got %d", db.nextID)
 	}
@@ -24,7 +47,8 @@ func TestNewInMemoryDB(t *testing.T) {
 }
 
 func TestCreateProduct(t *testing.T) {
-	db := NewInMemoryDB()
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
 	initialCount := len(db.products)
 
 	req := models.CreateProductRequest{
@@ -35,7 +59,7 @@ func TestCreateProduct(t *testing.T) {
 		InStock:     true,
 	}
 
-	product, err := db.CreateProduct(req)
+	product, err := db.CreateProduct(ctx, req)
 	if err != nil {
 		t.Fatalf("CreateProduct() failed: %v", err)
 	}
@@ -52,6 +76,10 @@ func TestCreateProduct(t *testing.T) {
 		t.Errorf("Expected price %f, got %f", req.Price, product.Price)
 	}
 
+	if product.Currency != models.DefaultCurrency {
+		t.Errorf("Expected default currency %s, got %s", models.DefaultCurrency, product.Currency)
+	}
+
 	if product.CreatedAt.IsZero() {
 		t.Error("CreatedAt should be set")
 	}
@@ -65,7 +93,7 @@ func TestCreateProduct(t *testing.T) {
 	}
 
 	// Verify the product is actually stored
-	stored, err := db.GetProductByID(product.ID)
+	stored, err := db.GetProductByID(ctx, product.ID)
 	if err != nil {
 		t.Fatalf("Failed to retrieve created product: %v", err)
 	}
@@ -75,11 +103,39 @@ func TestCreateProduct(t *testing.T) {
 	}
 }
 
+func TestCreateProductAfterSeededID(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
+
+	// seed a product with an ID beyond those allocated so far
+	db.mutex.Lock()
+	db.insert(&models.Product{ID: 100, Name: "Seeded Product", Price: 1})
+	db.mutex.Unlock()
+
+	product, err := db.CreateProduct(ctx, models.CreateProductRequest{Name: "New Product", Price: 1})
+	if err != nil {
+		t.Fatalf("CreateProduct() failed: %v", err)
+	}
+	if product.ID != 101 {
+		t.Errorf("Expected ID 101, got %d", product.ID)
+	}
+
+	// seeding a product with a lower ID does not reuse IDs
+	db.mutex.Lock()
+	db.insert(&models.Product{ID: 50, Name: "Seeded Product", Price: 1})
+	db.mutex.Unlock()
+
+	if product, _ = db.CreateProduct(ctx, models.CreateProductRequest{Name: "Another Product", Price: 1}); product.ID != 102 {
+		t.Errorf("Expected ID 102, got %d", product.ID)
+	}
+}
+
 func TestGetProductByID(t *testing.T) {
-	db := NewInMemoryDB()
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
 
 	// Test getting existing product
-	product, err := db.GetProductByID(1)
+	product, err := db.GetProductByID(ctx, 1)
 	if err != nil {
 		t.Fatalf("GetProductByID(1) failed: %v", err)
 	}
@@ -93,7 +149,7 @@ func TestGetProductByID(t *testing.T) {
 	}
 
 	// Test getting non-existent product
-	_, err = db.GetProductByID(999)
+	_, err = db.GetProductByID(ctx, 999)
 	if err == nil {
 		t.Error("Expected error for non-existent product")
 	}
@@ -106,17 +162,102 @@ func TestGetProductByID(t *testing.T) {
 	originalName := product.Name
 	product.Name = "Modified Name"
 
-	retrievedAgain, _ := db.GetProductByID(1)
+	retrievedAgain, _ := db.GetProductByID(ctx, 1)
 	if retrievedAgain.Name != originalName {
 		t.Error("Product should be returned as a copy to prevent external modifications")
 	}
 }
 
+func TestGetProductsByIDs(t *testing.T) {
+	db := NewInMemoryDB(WithSampleData())
+
+	products, err := db.GetProductsByIDs(context.Background(), []int{4, 99, 2, 4})
+	if err != nil {
+		t.Fatalf("GetProductsByIDs() failed: %v", err)
+	}
+
+	ids := make([]int, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	if expected := "[4 2 4]"; fmt.Sprint(ids) != expected {
+		t.Errorf("Expected products %s, got %v", expected, ids)
+	}
+
+	// the products are copies
+	products[0].Name = "Modified"
+	if product, _ := db.GetProductByID(context.Background(), 4); product.Name != "Desk Chair" {
+		t.Errorf("Expected the stored product to be unmodified, got name %q", product.Name)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.GetProductsByIDs(ctx, []int{1}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestGetProductBySKU(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
+
+	// Test getting existing product
+	product, err := db.GetProductBySKU(ctx, "LAP-001")
+	if err != nil {
+		t.Fatalf("GetProductBySKU(LAP-001) failed: %v", err)
+	}
+
+	if product.Name != "Laptop" {
+		t.Errorf("Expected product name 'Laptop', got %s", product.Name)
+	}
+
+	// Test getting non-existent product
+	_, err = db.GetProductBySKU(ctx, "XXX-999")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected 'not found' error, got %v", err)
+	}
+
+	// Test creating a product with a duplicate SKU
+	_, err = db.CreateProduct(ctx, models.CreateProductRequest{SKU: "LAP-001", Name: "Laptop 2", Price: 1})
+	if !errors.Is(err, ErrDuplicateSKU) {
+		t.Errorf("Expected 'duplicate sku' error, got %v", err)
+	}
+
+	// Test updating a product to a duplicate SKU
+	_, err = db.UpdateProduct(ctx, 2, models.UpdateProductRequest{SKU: stringPtr("LAP-001")})
+	if !errors.Is(err, ErrDuplicateSKU) {
+		t.Errorf("Expected 'duplicate sku' error, got %v", err)
+	}
+
+	// Test changing the SKU of a product
+	if _, err = db.UpdateProduct(ctx, 1, models.UpdateProductRequest{SKU: stringPtr("LAP-002")}); err != nil {
+		t.Fatalf("UpdateProduct() failed: %v", err)
+	}
+
+	if _, err = db.GetProductBySKU(ctx, "LAP-001"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected previous SKU to be 'not found', got %v", err)
+	}
+
+	if product, err = db.GetProductBySKU(ctx, "LAP-002"); err != nil || product.ID != 1 {
+		t.Errorf("Expected product 1 by updated SKU, got %v (error: %v)", product, err)
+	}
+
+	// Test deleted products are removed from the SKU index
+	if err = db.DeleteProduct(ctx, 1); err != nil {
+		t.Fatalf("DeleteProduct() failed: %v", err)
+	}
+
+	if _, err = db.GetProductBySKU(ctx, "LAP-002"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected deleted product SKU to be 'not found', got %v", err)
+	}
+}
+
 func TestGetProducts(t *testing.T) {
-	db := NewInMemoryDB()
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
 
 	// Test getting all products (first page)
-	products, total, err := db.GetProducts(1, 10)
+	products, total, err := db.GetProducts(ctx, 1, 10, nil)
 	if err != nil {
 		t.Fatalf("GetProducts() failed: %v", err)
 	}
@@ -134,7 +275,7 @@ func TestGetProducts(t *testing.T) {
 		return product.InStock
 	}
 
-	products, total, err = db.GetProducts(1, 10, inStockFilter)
+	products, total, err = db.GetProducts(ctx, 1, 10, nil, inStockFilter)
 	if err != nil {
 		t.Fatalf("GetProducts() with in-stock filter failed: %v", err)
 	}
@@ -148,7 +289,7 @@ func TestGetProducts(t *testing.T) {
 	}
 
 	// Test pagination
-	products, total, err = db.GetProducts(1, 2)
+	products, total, err = db.GetProducts(ctx, 1, 2, nil)
 	if err != nil {
 		t.Fatalf("GetProducts() with pagination failed: %v", err)
 	}
@@ -162,7 +303,7 @@ func TestGetProducts(t *testing.T) {
 	}
 
 	// Test second page
-	products, _, err = db.GetProducts(2, 2)
+	products, _, err = db.GetProducts(ctx, 2, 2, nil)
 	if err != nil {
 		t.Fatalf("GetProducts() second page failed: %v", err)
 	}
@@ -172,7 +313,7 @@ func TestGetProducts(t *testing.T) {
 	}
 
 	// Test page beyond available data
-	products, total, err = db.GetProducts(10, 10)
+	products, total, err = db.GetProducts(ctx, 10, 10, nil)
 	if err != nil {
 		t.Fatalf("GetProducts() beyond available data failed: %v", err)
 	}
@@ -186,7 +327,7 @@ func TestGetProducts(t *testing.T) {
 	}
 
 	// Test invalid page/pageSize
-	products, _, err = db.GetProducts(0, 0)
+	products, _, err = db.GetProducts(ctx, 0, 0, nil)
 	if err != nil {
 		t.Fatalf("GetProducts() with invalid params failed: %v", err)
 	}
@@ -205,8 +346,262 @@ func TestGetProducts(t *testing.T) {
 	}
 }
 
-func TestUpdateProduct(t *testing.T) {
+func TestGetProductsFilteredTotal(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
+	for i := range 20 {
+		_, _ = db.CreateProduct(ctx, models.CreateProductRequest{Name: fmt.Sprintf("Product %d", i), Price: float64(i + 1), InStock: i%2 == 0})
+	}
+
+	inStock := func(product *models.Product) bool { return product.InStock }
+	cheap := func(product *models.Product) bool { return product.Price <= 10 }
+
+	tests := []struct {
+		name    string
+		filters []ProductFilter
+	}{
+		{name: "In stock", filters: []ProductFilter{inStock}},
+		{name: "In stock and cheap", filters: []ProductFilter{inStock, cheap}},
+		{name: "No filters", filters: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected, _ := db.ListProducts(ctx, tt.filters...)
+
+			// every page reports the total of the filtered products, not of
+			// the whole store, and the pages together list exactly those
+			var listed []models.Product
+			for page := 1; page <= len(expected)/4+2; page++ {
+				products, total, err := db.GetProducts(ctx, page, 4, nil, tt.filters...)
+				if err != nil {
+					t.Fatalf("GetProducts() failed: %v", err)
+				}
+				if total != len(expected) {
+					t.Errorf("Page %d: expected total %d, got %d", page, len(expected), total)
+				}
+				listed = append(listed, products...)
+			}
+
+			if !slices.EqualFunc(listed, expected, func(a, b models.Product) bool { return a.ID == b.ID }) {
+				t.Errorf("Expected pages to list %d filtered products, got %d", len(expected), len(listed))
+			}
+		})
+	}
+}
+
+func TestGetProductsFilteredTotalConcurrentModification(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
+	inStock := func(product *models.Product) bool { return product.InStock }
+
+	// a writer repeatedly changes which (and how many) products are in stock
+	// while products are listed; the total and page of each listing must be
+	// taken from the same state
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_, _ = db.UpdateProduct(ctx, i%5+1, models.UpdateProductRequest{InStock: boolPtr(i%3 == 0)})
+			if i%7 == 0 {
+				product, _ := db.CreateProduct(ctx, models.CreateProductRequest{Name: "Transient", Price: 1, InStock: true})
+				_ = db.DeleteProduct(ctx, product.ID)
+			}
+		}
+	}()
+
+	for range 1000 {
+		products, total, err := db.GetProducts(ctx, 2, 2, nil, inStock)
+		if err != nil {
+			t.Fatalf("GetProducts() failed: %v", err)
+		}
+
+		if expected := min(2, max(0, total-2)); len(products) != expected {
+			t.Fatalf("Expected %d products on page 2 of %d, got %d", expected, total, len(products))
+		}
+		for _, product := range products {
+			if !product.InStock {
+				t.Fatalf("Expected only products in stock, got %+v", product)
+			}
+		}
+	}
+
+	close(stop)
+	<-done
+}
+
+func TestGetProductsOrdered(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
+
+	// an additional product priced the same as the Chair (ID 4)
+	if _, err := db.CreateProduct(ctx, models.CreateProductRequest{Name: "Stool", Price: 199.99}); err != nil {
+		t.Fatalf("CreateProduct() failed: %v", err)
+	}
+
+	byPriceDesc := func(a, b *models.Product) int {
+		return cmp.Compare(b.Price, a.Price)
+	}
+
+	products, total, err := db.GetProducts(ctx, 1, 4, byPriceDesc)
+	if err != nil {
+		t.Fatalf("GetProducts() failed: %v", err)
+	}
+
+	if total != 6 {
+		t.Errorf("Expected total 6, got %d", total)
+	}
+
+	// equally priced products are ordered by ID
+	ids := make([]int, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	if expected := []int{1, 5, 4, 6}; !slices.Equal(ids, expected) {
+		t.Errorf("Expected products %v, got %v", expected, ids)
+	}
+
+	// ordering is applied before filtering and pagination
+	inElectronics := func(p *models.Product) bool { return p.Category == "Electronics" }
+	products, total, err = db.GetProducts(ctx, 2, 1, byPriceDesc, inElectronics)
+	if err != nil {
+		t.Fatalf("GetProducts() failed: %v", err)
+	}
+	if total != 3 || len(products) != 1 || products[0].ID != 5 {
+		t.Errorf("Expected second page of electronics to be product 5 (of 3), got %v (of %d)", products, total)
+	}
+}
+
+func TestListProducts(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
+
+	products, err := db.ListProducts(ctx)
+	if err != nil {
+		t.Fatalf("ListProducts() failed: %v", err)
+	}
+
+	if len(products) != 5 {
+		t.Errorf("Expected 5 products, got %d", len(products))
+	}
+
+	products, err = db.ListProducts(ctx, func(product *models.Product) bool {
+		return !product.InStock
+	})
+	if err != nil {
+		t.Fatalf("ListProducts() with filter failed: %v", err)
+	}
+
+	if len(products) != 1 || products[0].Name != "Coffee Mug" {
+		t.Errorf("Expected only the out of stock Coffee Mug, got %v", products)
+	}
+}
+
+func TestCountProducts(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
+
+	count, err := db.CountProducts(ctx)
+	if err != nil {
+		t.Fatalf("CountProducts() failed: %v", err)
+	}
+	if count != 5 {
+		t.Errorf("Expected 5 products, got %d", count)
+	}
+
+	count, err = db.CountProducts(ctx, func(p *models.Product) bool { return p.Category == "Electronics" })
+	if err != nil {
+		t.Fatalf("CountProducts() with filter failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 electronics products, got %d", count)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := db.CountProducts(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestPriceStats(t *testing.T) {
+	ctx := context.Background()
 	db := NewInMemoryDB()
+	for _, req := range []models.CreateProductRequest{
+		{Name: "Pen", Price: 1.5, Category: "Stationery", InStock: true},
+		{Name: "Desk", Price: 30, Category: "Furniture", InStock: true},
+		{Name: "Paper", Price: 2.5, Category: "stationery"},
+		{Name: "Chair", Price: 10, Category: "Furniture", InStock: true},
+		{Name: "Lamp", Price: 20, Category: "Furniture"},
+	} {
+		if _, err := db.CreateProduct(ctx, req); err != nil {
+			t.Fatalf("CreateProduct() failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		filters  []ProductFilter
+		expected []models.CategoryStats
+	}{
+		{
+			name: "All products",
+			expected: []models.CategoryStats{
+				{Category: "Furniture", Count: 3, MinPrice: 10, MaxPrice: 30, AvgPrice: 20},
+				{Category: "Stationery", Count: 2, MinPrice: 1.5, MaxPrice: 2.5, AvgPrice: 2},
+			},
+		},
+		{
+			name:    "Filtered",
+			filters: []ProductFilter{func(p *models.Product) bool { return p.InStock }},
+			expected: []models.CategoryStats{
+				{Category: "Furniture", Count: 2, MinPrice: 10, MaxPrice: 30, AvgPrice: 20},
+				{Category: "Stationery", Count: 1, MinPrice: 1.5, MaxPrice: 1.5, AvgPrice: 1.5},
+			},
+		},
+		{
+			name:    "Categories with no matching products omitted",
+			filters: []ProductFilter{func(p *models.Product) bool { return p.Price < 15 }},
+			expected: []models.CategoryStats{
+				{Category: "Furniture", Count: 1, MinPrice: 10, MaxPrice: 10, AvgPrice: 10},
+				{Category: "Stationery", Count: 2, MinPrice: 1.5, MaxPrice: 2.5, AvgPrice: 2},
+			},
+		},
+		{
+			name:     "No matching products",
+			filters:  []ProductFilter{func(p *models.Product) bool { return false }},
+			expected: []models.CategoryStats{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := db.PriceStats(ctx, tt.filters...)
+			if err != nil {
+				t.Fatalf("PriceStats() failed: %v", err)
+			}
+			if !slices.Equal(stats, tt.expected) {
+				t.Errorf("Expected stats %+v, got %+v", tt.expected, stats)
+			}
+		})
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := db.PriceStats(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestUpdateProduct(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
 
 	// Test updating existing product
 	updateReq := models.UpdateProductRequest{
@@ -214,7 +609,7 @@ func TestUpdateProduct(t *testing.T) {
 		Price: float64Ptr(1499.99),
 	}
 
-	product, err := db.UpdateProduct(1, updateReq)
+	product, err := db.UpdateProduct(ctx, 1, updateReq)
 	if err != nil {
 		t.Fatalf("UpdateProduct() failed: %v", err)
 	}
@@ -233,13 +628,13 @@ func TestUpdateProduct(t *testing.T) {
 	}
 
 	// UpdatedAt should be changed
-	originalProduct, _ := db.GetProductByID(1)
+	originalProduct, _ := db.GetProductByID(ctx, 1)
 	if !originalProduct.UpdatedAt.After(originalProduct.CreatedAt) {
 		t.Error("UpdatedAt should be after CreatedAt after update")
 	}
 
 	// Test updating non-existent product
-	_, err = db.UpdateProduct(999, updateReq)
+	_, err = db.UpdateProduct(ctx, 999, updateReq)
 	if err == nil {
 		t.Error("Expected error when updating non-existent product")
 	}
@@ -255,7 +650,7 @@ func TestUpdateProduct(t *testing.T) {
 		Category:    stringPtr("Updated Category"),
 	}
 
-	product, err = db.UpdateProduct(1, partialUpdate)
+	product, err = db.UpdateProduct(ctx, 1, partialUpdate)
 	if err != nil {
 		t.Fatalf("Partial update failed: %v", err)
 	}
@@ -277,12 +672,377 @@ func TestUpdateProduct(t *testing.T) {
 	}
 }
 
+func TestUpdateWhere(t *testing.T) {
+	ctx := context.Background()
+	electronics := func(product *models.Product) bool { return product.Category == "Electronics" }
+
+	t.Run("Matching products", func(t *testing.T) {
+		db := NewInMemoryDB(WithSampleData())
+		before, _ := db.ListProducts(ctx)
+
+		updated, err := db.UpdateWhere(ctx, []ProductFilter{electronics}, models.UpdateProductRequest{
+			InStock:         boolPtr(false),
+			PriceMultiplier: float64Ptr(0.9),
+		})
+		if err != nil {
+			t.Fatalf("UpdateWhere() failed: %v", err)
+		}
+		if updated != 3 {
+			t.Errorf("Expected 3 products updated, got %d", updated)
+		}
+
+		after, _ := db.ListProducts(ctx)
+		for i, product := range after {
+			original := before[i]
+			if !electronics(&original) {
+				if product.Price != original.Price || product.InStock != original.InStock || !product.UpdatedAt.Equal(original.UpdatedAt) {
+					t.Errorf("Expected product %d to be untouched, got %+v", product.ID, product)
+				}
+				continue
+			}
+
+			if expected := math.Round(original.Price*0.9*100) / 100; product.Price != expected {
+				t.Errorf("Expected price of product %d to be %.2f, got %v", product.ID, expected, product.Price)
+			}
+			if product.InStock || !product.UpdatedAt.After(original.UpdatedAt) {
+				t.Errorf("Expected product %d to be updated, got %+v", product.ID, product)
+			}
+		}
+	})
+
+	t.Run("No matching products", func(t *testing.T) {
+		db := NewInMemoryDB(WithSampleData())
+		none := func(product *models.Product) bool { return false }
+
+		if updated, err := db.UpdateWhere(ctx, []ProductFilter{none}, models.UpdateProductRequest{Price: float64Ptr(1)}); err != nil || updated != 0 {
+			t.Errorf("Expected no products updated, got %d (error %v)", updated, err)
+		}
+	})
+
+	// an update that cannot be applied to every matching product is applied
+	// to none of them
+	tests := []struct {
+		name        string
+		opts        []Option
+		req         models.UpdateProductRequest
+		expectedErr error
+	}{
+		{name: "SKU of several products", req: models.UpdateProductRequest{SKU: stringPtr("NEW-001"), Price: float64Ptr(1)}, expectedErr: ErrDuplicateSKU},
+		{name: "Too many categories", opts: []Option{WithMaxCategories(3)}, req: models.UpdateProductRequest{Category: stringPtr("Gadgets"), Price: float64Ptr(1)}, expectedErr: ErrTooManyCategories},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := NewInMemoryDB(append(tt.opts, WithSampleData())...)
+
+			updated, err := db.UpdateWhere(ctx, []ProductFilter{electronics}, tt.req)
+			if !errors.Is(err, tt.expectedErr) || updated != 0 {
+				t.Fatalf("Expected error %v with no products updated, got %v with %d updated", tt.expectedErr, err, updated)
+			}
+
+			products, _ := db.ListProducts(ctx)
+			for _, product := range products {
+				if product.Price == 1 {
+					t.Errorf("Expected product %d not to be updated, got %+v", product.ID, product)
+				}
+			}
+		})
+	}
+}
+
+func TestUpsertBySKU(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
+
+	t.Run("Creates a new SKU", func(t *testing.T) {
+		product, created, err := db.UpsertBySKU(ctx, "KBD-001", models.CreateProductRequest{Name: "Keyboard", Price: 49.99, Category: "Electronics"})
+		if err != nil {
+			t.Fatalf("UpsertBySKU() failed: %v", err)
+		}
+		if !created {
+			t.Error("Expected product to be created")
+		}
+		if product.ID != 6 || product.SKU != "KBD-001" || product.Currency != models.DefaultCurrency {
+			t.Errorf("Expected product 6 with SKU KBD-001 and currency %s, got %+v", models.DefaultCurrency, product)
+		}
+	})
+
+	t.Run("Updates an existing SKU", func(t *testing.T) {
+		existing, _ := db.GetProductBySKU(ctx, "MUG-001")
+
+		product, created, err := db.UpsertBySKU(ctx, "MUG-001", models.CreateProductRequest{SKU: "IGNORED", Name: "Tea Mug", Price: 9.99, Tags: []string{"tea"}})
+		if err != nil {
+			t.Fatalf("UpsertBySKU() failed: %v", err)
+		}
+		if created {
+			t.Error("Expected product to be updated")
+		}
+		if product.ID != existing.ID || product.SKU != "MUG-001" || !product.CreatedAt.Equal(existing.CreatedAt) {
+			t.Errorf("Expected product %d with SKU MUG-001 and original creation time, got %+v", existing.ID, product)
+		}
+		if product.Name != "Tea Mug" || product.Price != 9.99 || product.Category != "" || !slices.Equal(product.Tags, []string{"tea"}) {
+			t.Errorf("Expected all fields to be replaced, got %+v", product)
+		}
+
+		if count, _ := db.CountProducts(ctx); count != 6 {
+			t.Errorf("Expected 6 products, got %d", count)
+		}
+	})
+
+	t.Run("Concurrent upserts of a new SKU", func(t *testing.T) {
+		const n = 10
+		results := make(chan bool, n)
+		for range n {
+			go func() {
+				_, created, err := db.UpsertBySKU(ctx, "CAB-001", models.CreateProductRequest{Name: "Cable", Price: 5})
+				if err != nil {
+					t.Errorf("UpsertBySKU() failed: %v", err)
+				}
+				results <- created
+			}()
+		}
+
+		created := 0
+		for range n {
+			if <-results {
+				created++
+			}
+		}
+		if created != 1 {
+			t.Errorf("Expected product to be created once, was created %d times", created)
+		}
+	})
+}
+
+func TestMaxCategories(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData(), WithMaxCategories(5))
+
+	// sample data has 3 categories (Electronics, Office Supplies, Furniture)
+	for _, category := range []string{"Books", "Toys"} {
+		if _, err := db.CreateProduct(ctx, models.CreateProductRequest{Name: category, Price: 1, Category: category}); err != nil {
+			t.Fatalf("CreateProduct() in new category %q failed: %v", category, err)
+		}
+	}
+
+	// Test a new category beyond the maximum is rejected
+	if _, err := db.CreateProduct(ctx, models.CreateProductRequest{Name: "Garden", Price: 1, Category: "Garden"}); !errors.Is(err, ErrTooManyCategories) {
+		t.Errorf("Expected 'too many categories' error, got %v", err)
+	}
+
+	// Test existing categories (and products with no category) are accepted
+	for _, category := range []string{"Electronics", "books", ""} {
+		if _, err := db.CreateProduct(ctx, models.CreateProductRequest{Name: "Existing", Price: 1, Category: category}); err != nil {
+			t.Errorf("CreateProduct() in existing category %q failed: %v", category, err)
+		}
+	}
+
+	// Test updating a product to a new category beyond the maximum is rejected
+	if _, err := db.UpdateProduct(ctx, 1, models.UpdateProductRequest{Category: stringPtr("Garden")}); !errors.Is(err, ErrTooManyCategories) {
+		t.Errorf("Expected 'too many categories' error, got %v", err)
+	}
+
+	// Test updating a product to an existing category is accepted
+	if _, err := db.UpdateProduct(ctx, 1, models.UpdateProductRequest{Category: stringPtr("Toys")}); err != nil {
+		t.Errorf("UpdateProduct() to existing category failed: %v", err)
+	}
+
+	// Test a category is removed when it has no remaining products (product 4
+	// is the only Furniture product), allowing a new category
+	if err := db.DeleteProduct(ctx, 4); err != nil {
+		t.Fatalf("DeleteProduct() failed: %v", err)
+	}
+	if _, err := db.CreateProduct(ctx, models.CreateProductRequest{Name: "Garden", Price: 1, Category: "Garden"}); err != nil {
+		t.Errorf("CreateProduct() in new category after removing a category failed: %v", err)
+	}
+
+	// Test upserts creating or updating a product in a new category beyond the
+	// maximum are rejected
+	for _, sku := range []string{"NEW-001", "LAP-001"} {
+		if _, _, err := db.UpsertBySKU(ctx, sku, models.CreateProductRequest{Name: "Pond", Price: 1, Category: "Pond"}); !errors.Is(err, ErrTooManyCategories) {
+			t.Errorf("Expected 'too many categories' error upserting %s, got %v", sku, err)
+		}
+	}
+}
+
+func TestMaxProducts(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData(), WithMaxProducts(7))
+
+	// sample data has 5 products, so 2 more fill the database to capacity
+	for _, name := range []string{"Book", "Toy"} {
+		if _, err := db.CreateProduct(ctx, models.CreateProductRequest{Name: name, Price: 1}); err != nil {
+			t.Fatalf("CreateProduct() %q within capacity failed: %v", name, err)
+		}
+	}
+
+	// Test creating a product beyond capacity is rejected
+	if _, err := db.CreateProduct(ctx, models.CreateProductRequest{Name: "Garden", Price: 1}); !errors.Is(err, ErrCapacityExceeded) {
+		t.Errorf("Expected 'capacity exceeded' error, got %v", err)
+	}
+	if _, _, err := db.UpsertBySKU(ctx, "NEW-001", models.CreateProductRequest{Name: "Garden", Price: 1}); !errors.Is(err, ErrCapacityExceeded) {
+		t.Errorf("Expected 'capacity exceeded' error upserting a new product, got %v", err)
+	}
+
+	// Test updating and replacing products at capacity is accepted
+	if _, err := db.UpdateProduct(ctx, 1, models.UpdateProductRequest{Price: float64Ptr(999.99)}); err != nil {
+		t.Errorf("UpdateProduct() at capacity failed: %v", err)
+	}
+	if _, _, err := db.UpsertBySKU(ctx, "LAP-001", models.CreateProductRequest{Name: "Laptop", Price: 1}); err != nil {
+		t.Errorf("UpsertBySKU() replacing a product at capacity failed: %v", err)
+	}
+
+	// Test deleting a product at capacity is accepted, allowing a new product
+	if err := db.DeleteProduct(ctx, 2); err != nil {
+		t.Fatalf("DeleteProduct() at capacity failed: %v", err)
+	}
+	if _, err := db.CreateProduct(ctx, models.CreateProductRequest{Name: "Garden", Price: 1}); err != nil {
+		t.Errorf("CreateProduct() after deleting a product failed: %v", err)
+	}
+}
+
+func TestCreateProductWithUniqueName(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
+
+	// Test names are compared case-insensitively
+	if _, err := db.CreateProductWithUniqueName(ctx, models.CreateProductRequest{Name: "LAPTOP", Price: 1}); !errors.Is(err, ErrDuplicateName) {
+		t.Errorf("Expected 'duplicate name' error, got %v", err)
+	}
+
+	// Test a product with a new name is created
+	if _, err := db.CreateProductWithUniqueName(ctx, models.CreateProductRequest{Name: "Tablet", Price: 1}); err != nil {
+		t.Errorf("CreateProductWithUniqueName() with a new name failed: %v", err)
+	}
+
+	// Test CreateProduct does not require unique names
+	if _, err := db.CreateProduct(ctx, models.CreateProductRequest{Name: "Laptop", Price: 1}); err != nil {
+		t.Errorf("CreateProduct() with an existing name failed: %v", err)
+	}
+
+	// Test a name is available once no product has the name, whether the
+	// products are renamed, replaced or deleted
+	if _, err := db.UpdateProduct(ctx, 2, models.UpdateProductRequest{Name: stringPtr("Mouse")}); err != nil {
+		t.Fatalf("UpdateProduct() failed: %v", err)
+	}
+	if _, _, err := db.UpsertBySKU(ctx, "MUG-001", models.CreateProductRequest{Name: "Mug", Price: 1}); err != nil {
+		t.Fatalf("UpsertBySKU() failed: %v", err)
+	}
+	if err := db.DeleteProduct(ctx, 6); err != nil {
+		t.Fatalf("DeleteProduct() failed: %v", err)
+	}
+	for _, name := range []string{"Wireless Mouse", "Coffee Mug", "tablet"} {
+		if _, err := db.CreateProductWithUniqueName(ctx, models.CreateProductRequest{Name: name, Price: 1}); err != nil {
+			t.Errorf("CreateProductWithUniqueName() with available name %q failed: %v", name, err)
+		}
+	}
+
+	// Test names given by renaming and replacing products are not available
+	for _, name := range []string{"mouse", "MUG"} {
+		if _, err := db.CreateProductWithUniqueName(ctx, models.CreateProductRequest{Name: name, Price: 1}); !errors.Is(err, ErrDuplicateName) {
+			t.Errorf("Expected 'duplicate name' error for %q, got %v", name, err)
+		}
+	}
+
+	// Test a name remains unavailable while any product has the name (the
+	// sample Laptop and a second Laptop were both created)
+	if err := db.DeleteProduct(ctx, 1); err != nil {
+		t.Fatalf("DeleteProduct() failed: %v", err)
+	}
+	if _, err := db.CreateProductWithUniqueName(ctx, models.CreateProductRequest{Name: "Laptop", Price: 1}); !errors.Is(err, ErrDuplicateName) {
+		t.Errorf("Expected 'duplicate name' error while another product has the name, got %v", err)
+	}
+}
+
+func TestProductTagsDeduplicated(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
+
+	product, err := db.CreateProduct(ctx, models.CreateProductRequest{Name: "Tagged", Price: 1.0, Tags: []string{"Sale", "new", "sale", "NEW"}})
+	if err != nil {
+		t.Fatalf("CreateProduct() failed: %v", err)
+	}
+	if !slices.Equal(product.Tags, []string{"Sale", "new"}) {
+		t.Errorf("Expected de-duplicated tags [Sale new], got %v", product.Tags)
+	}
+
+	// replacing tags
+	product, err = db.UpdateProduct(ctx, product.ID, models.UpdateProductRequest{Tags: []string{"a", "A", "b"}})
+	if err != nil {
+		t.Fatalf("UpdateProduct() failed: %v", err)
+	}
+	if !slices.Equal(product.Tags, []string{"a", "b"}) {
+		t.Errorf("Expected de-duplicated tags [a b], got %v", product.Tags)
+	}
+
+	// merging tags
+	product, err = db.UpdateProduct(ctx, product.ID, models.UpdateProductRequest{Tags: []string{"B", "c"}, MergeTags: true})
+	if err != nil {
+		t.Fatalf("UpdateProduct() failed: %v", err)
+	}
+	if !slices.Equal(product.Tags, []string{"a", "b", "c"}) {
+		t.Errorf("Expected merged tags [a b c], got %v", product.Tags)
+	}
+}
+
+func TestUpdateProductTags(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
+
+	product, err := db.CreateProduct(ctx, models.CreateProductRequest{Name: "Tagged", Price: 1.0, Tags: []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("CreateProduct() failed: %v", err)
+	}
+	id := product.ID
+
+	// merging adds only tags not already present
+	product, err = db.UpdateProduct(ctx, id, models.UpdateProductRequest{Tags: []string{"b", "c"}, MergeTags: true})
+	if err != nil {
+		t.Fatalf("UpdateProduct() failed: %v", err)
+	}
+	if !slices.Equal(product.Tags, []string{"a", "b", "c"}) {
+		t.Errorf("Expected merged tags [a b c], got %v", product.Tags)
+	}
+
+	// tags are unchanged if not specified
+	product, err = db.UpdateProduct(ctx, id, models.UpdateProductRequest{Name: stringPtr("Renamed")})
+	if err != nil {
+		t.Fatalf("UpdateProduct() failed: %v", err)
+	}
+	if !slices.Equal(product.Tags, []string{"a", "b", "c"}) {
+		t.Errorf("Expected tags to be unchanged, got %v", product.Tags)
+	}
+
+	// replacing discards existing tags; a copy obtained earlier is unaffected
+	earlier := product
+	product, err = db.UpdateProduct(ctx, id, models.UpdateProductRequest{Tags: []string{"d"}})
+	if err != nil {
+		t.Fatalf("UpdateProduct() failed: %v", err)
+	}
+	if !slices.Equal(product.Tags, []string{"d"}) {
+		t.Errorf("Expected replaced tags [d], got %v", product.Tags)
+	}
+	if !slices.Equal(earlier.Tags, []string{"a", "b", "c"}) {
+		t.Errorf("Expected earlier copy to be unaffected, got %v", earlier.Tags)
+	}
+
+	// an empty list removes all tags
+	product, err = db.UpdateProduct(ctx, id, models.UpdateProductRequest{Tags: []string{}})
+	if err != nil {
+		t.Fatalf("UpdateProduct() failed: %v", err)
+	}
+	if len(product.Tags) != 0 {
+		t.Errorf("Expected no tags, got %v", product.Tags)
+	}
+}
+
 func TestDeleteProduct(t *testing.T) {
-	db := NewInMemoryDB()
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
 	initialCount := len(db.products)
 
 	// Test deleting existing product
-	err := db.DeleteProduct(1)
+	err := db.DeleteProduct(ctx, 1)
 	if err != nil {
 		t.Fatalf("DeleteProduct() failed: %v", err)
 	}
@@ -291,14 +1051,20 @@ func TestDeleteProduct(t *testing.T) {
 		t.Errorf("Expected %d products after deletion, got %d", initialCount-1, len(db.products))
 	}
 
-	// Verify product is actually deleted
-	_, err = db.GetProductByID(1)
-	if err == nil {
-		t.Error("Expected error when getting deleted product")
+	// Verify product is actually deleted (and is gone, rather than never
+	// having existed)
+	_, err = db.GetProductByID(ctx, 1)
+	if !errors.Is(err, ErrGone) || !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected %v getting deleted product, got %v", ErrGone, err)
+	}
+
+	_, err = db.GetProductByID(ctx, 999)
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrGone) {
+		t.Errorf("Expected %v getting non-existent product, got %v", ErrNotFound, err)
 	}
 
 	// Test deleting non-existent product
-	err = db.DeleteProduct(999)
+	err = db.DeleteProduct(ctx, 999)
 	if err == nil {
 		t.Error("Expected error when deleting non-existent product")
 	}
@@ -308,20 +1074,21 @@ func TestDeleteProduct(t *testing.T) {
 	}
 
 	// Test deleting same product twice
-	err = db.DeleteProduct(1)
+	err = db.DeleteProduct(ctx, 1)
 	if err == nil {
 		t.Error("Expected error when deleting already deleted product")
 	}
 }
 
 func TestConcurrentAccess(t *testing.T) {
-	db := NewInMemoryDB()
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
 	done := make(chan bool, 4)
 
 	// Test concurrent reads
 	go func() {
 		for i := 0; i < 100; i++ {
-			_, _, err := db.GetProducts(1, 10)
+			_, _, err := db.GetProducts(ctx, 1, 10, nil)
 			if err != nil {
 				t.Errorf("Concurrent read failed: %v", err)
 			}
@@ -339,7 +1106,7 @@ func TestConcurrentAccess(t *testing.T) {
 				Category:    "Test",
 				InStock:     true,
 			}
-			_, err := db.CreateProduct(req)
+			_, err := db.CreateProduct(ctx, req)
 			if err != nil {
 				t.Errorf("Concurrent create failed: %v", err)
 			}
@@ -353,7 +1120,7 @@ func TestConcurrentAccess(t *testing.T) {
 			updateReq := models.UpdateProductRequest{
 				Price: float64Ptr(float64(i + 100)),
 			}
-			_, err := db.UpdateProduct(2, updateReq)
+			_, err := db.UpdateProduct(ctx, 2, updateReq)
 			if err != nil && !errors.Is(err, ErrNotFound) {
 				t.Errorf("Concurrent update failed: %v", err)
 			}
@@ -365,7 +1132,7 @@ func TestConcurrentAccess(t *testing.T) {
 	go func() {
 		for i := 0; i < 25; i++ {
 			// Try to delete (might fail if already deleted)
-			if err := db.DeleteProduct(3); err != nil && !errors.Is(err, ErrNotFound) {
+			if err := db.DeleteProduct(ctx, 3); err != nil && !errors.Is(err, ErrNotFound) {
 				t.Errorf("Concurrent delete failed: %v", err)
 			}
 
@@ -377,7 +1144,7 @@ func TestConcurrentAccess(t *testing.T) {
 				Category:    "Temp",
 				InStock:     true,
 			}
-			if _, err := db.CreateProduct(req); err != nil {
+			if _, err := db.CreateProduct(ctx, req); err != nil {
 				t.Errorf("Concurrent create failed: %v", err)
 			}
 		}
@@ -390,7 +1157,7 @@ func TestConcurrentAccess(t *testing.T) {
 	}
 
 	// Verify database is still in a consistent state
-	products, total, err := db.GetProducts(1, 100)
+	products, total, err := db.GetProducts(ctx, 1, 100, nil)
 	if err != nil {
 		t.Fatalf("Database inconsistent after concurrent access: %v", err)
 	}
@@ -400,6 +1167,217 @@ func TestConcurrentAccess(t *testing.T) {
 	}
 }
 
+func TestGetProductsCancellation(t *testing.T) {
+	db := NewInMemoryDB(WithSampleData())
+
+	// a large dataset ensures the scan takes long enough for a cancellation
+	// to be observed mid-scan
+	for i := range 100_000 {
+		req := models.CreateProductRequest{Name: "Product", Price: float64(i)}
+		if _, err := db.CreateProduct(context.Background(), req); err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
+	}
+
+	// the filter cancels the context on the first product it sees, so the
+	// cancellation occurs during the scan
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	filtered := 0
+	cancelling := func(product *models.Product) bool {
+		filtered++
+		cancel()
+		return true
+	}
+
+	_, _, err := db.GetProducts(ctx, 1, 10, nil, cancelling)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	if filtered > cancellationCheckInterval {
+		t.Errorf("Expected scan to be abandoned within %d products, filtered %d", cancellationCheckInterval, filtered)
+	}
+
+	// an already cancelled context is returned without scanning
+	filtered = 0
+	_, err = db.ListProducts(ctx, cancelling)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	if filtered != 0 {
+		t.Errorf("Expected no products to be filtered, filtered %d", filtered)
+	}
+}
+
+func TestOrderedProducts(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
+
+	// insert products with IDs in arbitrary order and delete some, including
+	// the first and last
+	for _, id := range []int{42, 7, 100, 8, 23, 64, 9} {
+		db.insert(&models.Product{ID: id, Name: "Product", Price: 1})
+	}
+	for _, id := range []int{1, 8, 100, 23} {
+		if err := db.DeleteProduct(ctx, id); err != nil {
+			t.Fatalf("DeleteProduct(%d) failed: %v", id, err)
+		}
+	}
+	if _, err := db.CreateProduct(ctx, models.CreateProductRequest{Name: "Product", Price: 1}); err != nil {
+		t.Fatalf("CreateProduct() failed: %v", err)
+	}
+
+	// the ordered slice and map must be consistent
+	if len(db.ordered) != len(db.products) {
+		t.Fatalf("Expected %d ordered products, got %d", len(db.products), len(db.ordered))
+	}
+	for i, product := range db.ordered {
+		if db.products[product.ID] != product {
+			t.Errorf("Ordered product %d is not the product in the map", product.ID)
+		}
+		if i > 0 && db.ordered[i-1].ID >= product.ID {
+			t.Errorf("Products should be ordered by ID, got %d before %d", db.ordered[i-1].ID, product.ID)
+		}
+	}
+
+	// listings (filtered and unfiltered) must be ordered by ID
+	expected := "[2 3 4 5 7 9 42 64 101]"
+	all := func(*models.Product) bool { return true }
+
+	for name, filters := range map[string][]ProductFilter{"unfiltered": nil, "filtered": {all}} {
+		products, total, err := db.GetProducts(ctx, 1, 5, nil, filters...)
+		if err != nil {
+			t.Fatalf("GetProducts() failed: %v", err)
+		}
+		page2, _, err := db.GetProducts(ctx, 2, 5, nil, filters...)
+		if err != nil {
+			t.Fatalf("GetProducts() failed: %v", err)
+		}
+
+		ids := []int{}
+		for _, product := range append(products, page2...) {
+			ids = append(ids, product.ID)
+		}
+
+		if fmt.Sprint(ids) != expected || total != 9 {
+			t.Errorf("%s: expected IDs %s (total 9), got %v (total %d)", name, expected, ids, total)
+		}
+	}
+}
+
+func TestScanProducts(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData())
+	for i := range 3 * scanChunkSize {
+		req := models.CreateProductRequest{Name: "Product", Price: float64(i), InStock: i%3 == 0}
+		if _, err := db.CreateProduct(ctx, req); err != nil {
+			t.Fatalf("Failed to create test product: %v", err)
+		}
+	}
+
+	inStock := func(product *models.Product) bool { return product.InStock }
+
+	buffered, err := db.ListProducts(ctx, inStock)
+	if err != nil {
+		t.Fatalf("ListProducts() failed: %v", err)
+	}
+
+	// writes made while scanning must not deadlock; timeout if they do
+	done := make(chan error, 1)
+	var streamed []models.Product
+	go func() {
+		done <- db.ScanProducts(ctx, func(product models.Product) error {
+			streamed = append(streamed, product)
+
+			if _, err := db.UpdateProduct(ctx, product.ID, models.UpdateProductRequest{Name: stringPtr("Scanned")}); err != nil {
+				return err
+			}
+			_, err := db.CreateProduct(ctx, models.CreateProductRequest{Name: "Created during scan", Price: 1, InStock: true})
+			return err
+		}, inStock)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ScanProducts() failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for ScanProducts(); writes during the scan may have deadlocked")
+	}
+
+	// the streamed products are the buffered products; products created
+	// during the scan are not included
+	if len(streamed) != len(buffered) {
+		t.Fatalf("Expected %d streamed products, got %d", len(buffered), len(streamed))
+	}
+	for i := range buffered {
+		if streamed[i].ID != buffered[i].ID {
+			t.Errorf("Expected streamed product %d to have ID %d, got %d", i, buffered[i].ID, streamed[i].ID)
+		}
+	}
+
+	// an error returned by fn stops the scan
+	errStop := errors.New("stop")
+	calls := 0
+	err = db.ScanProducts(ctx, func(models.Product) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || calls != 1 {
+		t.Errorf("Expected scan to stop with error after 1 call, got %v after %d calls", err, calls)
+	}
+}
+
+// newBenchmarkDB returns a database with n products
+func newBenchmarkDB(b *testing.B, n int) *InMemoryDB {
+	db := NewInMemoryDB(WithSampleData())
+	for i := range n {
+		req := models.CreateProductRequest{Name: "Product", Price: float64(i)}
+		if _, err := db.CreateProduct(context.Background(), req); err != nil {
+			b.Fatalf("Failed to create product: %v", err)
+		}
+	}
+	return db
+}
+
+// BenchmarkGetProducts measures listing a page of products from the ordered
+// slice
+func BenchmarkGetProducts(b *testing.B) {
+	ctx := context.Background()
+	db := newBenchmarkDB(b, 10_000)
+
+	b.ResetTimer()
+	for range b.N {
+		if _, _, err := db.GetProducts(ctx, 50, 10, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGetProductsMapSort measures listing a page of products by sorting
+// the products in the map, as a baseline for BenchmarkGetProducts
+func BenchmarkGetProductsMapSort(b *testing.B) {
+	db := newBenchmarkDB(b, 10_000)
+
+	b.ResetTimer()
+	for range b.N {
+		db.mutex.RLock()
+		products := make([]models.Product, 0, len(db.products))
+		for _, product := range db.products {
+			products = append(products, *product)
+		}
+		sort.Slice(products, func(i, j int) bool {
+			return products[i].ID < products[j].ID
+		})
+		_ = products[490:500]
+		db.mutex.RUnlock()
+	}
+}
+
 // Helper functions for creating pointers
 func stringPtr(s string) *string {
 	return &s
@@ -0,0 +1,67 @@
+package db
+
+import "github.com/blugnu/time"
+
+// Option configures optional behaviour of an InMemoryDB
+type Option func(*InMemoryDB)
+
+// WithClock sets the clock providing the times at which products are created
+// and updated.  If not specified, the system clock is used; specifying a mock
+// clock is useful for testing.
+func WithClock(clock time.Clock) Option {
+	return func(db *InMemoryDB) {
+		if clock != nil {
+			db.clock = clock
+		}
+	}
+}
+
+// WithMaxCategories sets the maximum number of distinct categories of
+// products in the database.  Creating or updating a product to introduce a
+// new category beyond the maximum fails with ErrTooManyCategories; products
+// may always be added to existing categories.  Categories are distinct if
+// they differ other than by case.
+//
+// A max of zero (the default) allows any number of categories.
+func WithMaxCategories(max int) Option {
+	return func(db *InMemoryDB) {
+		db.maxCategories = max
+	}
+}
+
+// DefaultMaxDeleted is the maximum number of deleted products whose IDs are
+// retained, if not specified by WithMaxDeleted
+const DefaultMaxDeleted = 10000
+
+// WithMaxDeleted sets the maximum number of deleted products whose IDs are
+// retained, so that they are reported as gone (ErrGone) rather than not
+// found.  The IDs of the least recently deleted products are discarded in
+// excess of the maximum, bounding the memory used; IDs are never reused, so
+// a discarded ID is simply not found.  If not specified, the maximum is
+// DefaultMaxDeleted.  Values less than 1 are ignored.
+func WithMaxDeleted(max int) Option {
+	return func(db *InMemoryDB) {
+		if max > 0 {
+			db.maxDeleted = max
+		}
+	}
+}
+
+// WithMaxProducts sets the maximum number of products in the database.
+// Creating a product when the database holds the maximum fails with
+// ErrCapacityExceeded; products may always be updated or deleted.
+//
+// A max of zero (the default) allows any number of products.
+func WithMaxProducts(max int) Option {
+	return func(db *InMemoryDB) {
+		db.maxProducts = max
+	}
+}
+
+// WithSampleData adds some sample products to a new database, for
+// demonstration and testing
+func WithSampleData() Option {
+	return func(db *InMemoryDB) {
+		db.sampleData = true
+	}
+}
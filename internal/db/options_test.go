@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"products-api/internal/models"
+
+	"github.com/blugnu/time"
+)
+
+func TestWithClock(t *testing.T) {
+	clock := time.NewMockClock()
+	db := NewInMemoryDB(WithClock(clock))
+	created := clock.Now()
+
+	product, err := db.CreateProduct(context.Background(), models.CreateProductRequest{Name: "Clocked Product", Price: 1})
+	if err != nil {
+		t.Fatalf("CreateProduct() failed: %v", err)
+	}
+	if !product.CreatedAt.Equal(created) || !product.UpdatedAt.Equal(created) {
+		t.Errorf("Expected product created and updated at %v, got %v and %v", created, product.CreatedAt, product.UpdatedAt)
+	}
+
+	clock.AdvanceBy(time.Hour)
+	name := "Updated Product"
+	if product, err = db.UpdateProduct(context.Background(), product.ID, models.UpdateProductRequest{Name: &name}); err != nil {
+		t.Fatalf("UpdateProduct() failed: %v", err)
+	}
+	if !product.CreatedAt.Equal(created) {
+		t.Errorf("Expected product created at %v, got %v", created, product.CreatedAt)
+	}
+	if updated := created.Add(time.Hour); !product.UpdatedAt.Equal(updated) {
+		t.Errorf("Expected product updated at %v, got %v", updated, product.UpdatedAt)
+	}
+}
+
+// zonedClock is a mock clock providing times in the location of a zone
+// other than UTC, as the system clock does on a server in that zone
+type zonedClock struct {
+	time.MockClock
+	zone time.Time
+}
+
+func (c zonedClock) Now() time.Time {
+	return c.MockClock.Now().In(c.zone.Location())
+}
+
+func TestTimestampsInUTC(t *testing.T) {
+	zone, _ := time.Parse(time.RFC3339, "2025-07-12T10:00:00+12:00")
+	clock := zonedClock{MockClock: time.NewMockClock(time.AtTime(zone)), zone: zone}
+	db := NewInMemoryDB(WithClock(clock))
+	ctx := context.Background()
+
+	// assertUTC fails the test if the timestamps of a product are not UTC
+	assertUTC := func(t *testing.T, product *models.Product) {
+		t.Helper()
+		if product.CreatedAt.Location().String() != "UTC" || product.UpdatedAt.Location().String() != "UTC" {
+			t.Errorf("Expected timestamps in UTC, got %v and %v", product.CreatedAt, product.UpdatedAt)
+		}
+		if !product.UpdatedAt.Equal(clock.Now()) {
+			t.Errorf("Expected product updated at %v, got %v", clock.Now(), product.UpdatedAt)
+		}
+	}
+
+	product, err := db.CreateProduct(ctx, models.CreateProductRequest{SKU: "UTC-001", Name: "Zoned Product", Price: 1})
+	if err != nil {
+		t.Fatalf("CreateProduct() failed: %v", err)
+	}
+	assertUTC(t, product)
+
+	clock.AdvanceBy(time.Hour)
+	price := 2.0
+	if product, err = db.UpdateProduct(ctx, product.ID, models.UpdateProductRequest{Price: &price}); err != nil {
+		t.Fatalf("UpdateProduct() failed: %v", err)
+	}
+	assertUTC(t, product)
+
+	clock.AdvanceBy(time.Hour)
+	price = 3.0
+	if _, err = db.UpdateWhere(ctx, nil, models.UpdateProductRequest{Price: &price}); err != nil {
+		t.Fatalf("UpdateWhere() failed: %v", err)
+	}
+	if product, err = db.GetProductByID(ctx, product.ID); err != nil {
+		t.Fatalf("GetProductByID() failed: %v", err)
+	}
+	assertUTC(t, product)
+
+	clock.AdvanceBy(time.Hour)
+	if product, _, err = db.UpsertBySKU(ctx, "UTC-001", models.CreateProductRequest{Name: "Replaced Product", Price: 4}); err != nil {
+		t.Fatalf("UpsertBySKU() failed: %v", err)
+	}
+	assertUTC(t, product)
+
+	changes, _ := db.ProductHistory(ctx, product.ID)
+	for _, change := range changes {
+		if change.Timestamp.Location().String() != "UTC" {
+			t.Errorf("Expected change timestamps in UTC, got %v", change.Timestamp)
+		}
+	}
+}
+
+func TestWithMaxDeleted(t *testing.T) {
+	ctx := context.Background()
+	db := NewInMemoryDB(WithSampleData(), WithMaxDeleted(2))
+
+	for _, id := range []int{3, 1, 2} {
+		if err := db.DeleteProduct(ctx, id); err != nil {
+			t.Fatalf("DeleteProduct(%d) failed: %v", id, err)
+		}
+	}
+
+	// the ID of the least recently deleted product is discarded
+	if _, err := db.GetProductByID(ctx, 3); !errors.Is(err, ErrNotFound) || errors.Is(err, ErrGone) {
+		t.Errorf("Expected %v for the least recently deleted product, got %v", ErrNotFound, err)
+	}
+	for _, id := range []int{1, 2} {
+		if _, err := db.GetProductByID(ctx, id); !errors.Is(err, ErrGone) {
+			t.Errorf("Expected %v for product %d, got %v", ErrGone, id, err)
+		}
+	}
+	if len(db.deleted) != 2 || len(db.tombstones) != 2 {
+		t.Errorf("Expected 2 deleted IDs, got %v (%v)", db.deleted, db.tombstones)
+	}
+
+	// a discarded ID is not reused
+	product, err := db.CreateProduct(ctx, models.CreateProductRequest{Name: "New Product", Price: 1})
+	if err != nil {
+		t.Fatalf("CreateProduct() failed: %v", err)
+	}
+	if product.ID != 6 {
+		t.Errorf("Expected ID 6, got %d", product.ID)
+	}
+
+	t.Run("Restore", func(t *testing.T) {
+		if err := db.ImportAll(ctx, models.Backup{DeletedIDs: []int{7, 8, 9}}, true); err != nil {
+			t.Fatalf("ImportAll() failed: %v", err)
+		}
+		if _, err := db.GetProductByID(ctx, 7); errors.Is(err, ErrGone) {
+			t.Errorf("Expected the least deleted ID to be discarded, got %v", err)
+		}
+		if product, _ := db.CreateProduct(ctx, models.CreateProductRequest{Name: "Restored Product", Price: 1}); product == nil || product.ID != 10 {
+			t.Errorf("Expected ID 10, got %v", product)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"cmp"
+	"slices"
+
+	"products-api/internal/models"
+)
+
+// DefaultPageSize is the page size used if a page size less than 1 is
+// requested.  It is also the default page size of product listings served
+// by the API, unless configured otherwise.
+const DefaultPageSize = 10
+
+// Paginate sorts products and returns the requested page of them together
+// with the total number of products.  It is provided for use by Database
+// implementations in GetProducts.
+//
+// Products are sorted in the specified order with equivalent products
+// ordered by ID (or by ID alone if order is nil).  This guarantees that a
+// listing of the same products is ordered identically by all implementations
+// using Paginate, regardless of the order in which they hold (or iterate)
+// products.  The products slice is sorted in place.
+//
+// A page less than 1 is treated as the first page, and a page size less than
+// 1 as DefaultPageSize.
+func Paginate(products []models.Product, page, pageSize int, order ProductOrder) ([]models.Product, int) {
+	slices.SortFunc(products, func(a, b models.Product) int {
+		if order != nil {
+			if c := order(&a, &b); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	total := len(products)
+	start, end := pageBounds(page, pageSize, total)
+	if start >= end {
+		return []models.Product{}, total
+	}
+	return products[start:end], total
+}
+
+// pageBounds returns the start and end indices of the requested page of a
+// listing of total products, treating a page or page size less than 1 as
+// described for Paginate
+func pageBounds(page, pageSize, total int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = DefaultPageSize
+	}
+
+	start := min((page-1)*pageSize, total)
+	end := min(start+pageSize, total)
+	return start, end
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"products-api/internal/models"
+)
+
+func TestPaginate(t *testing.T) {
+	products := []models.Product{
+		{ID: 3, Price: 10},
+		{ID: 1, Price: 20},
+		{ID: 4, Price: 10},
+		{ID: 2, Price: 20},
+		{ID: 5, Price: 5},
+	}
+	byPrice := func(a, b *models.Product) int { return cmp.Compare(a.Price, b.Price) }
+
+	tests := []struct {
+		name        string
+		page        int
+		pageSize    int
+		order       ProductOrder
+		expectedIDs string
+	}{
+		{name: "By ID", page: 1, pageSize: 10, expectedIDs: "[1 2 3 4 5]"},
+		{name: "Ordered with ID tiebreak", page: 1, pageSize: 10, order: byPrice, expectedIDs: "[5 3 4 1 2]"},
+		{name: "Second page", page: 2, pageSize: 2, order: byPrice, expectedIDs: "[4 1]"},
+		{name: "Partial last page", page: 3, pageSize: 2, order: byPrice, expectedIDs: "[2]"},
+		{name: "Beyond last page", page: 4, pageSize: 2, expectedIDs: "[]"},
+		{name: "Invalid page and page size", page: 0, pageSize: 0, expectedIDs: "[1 2 3 4 5]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, total := Paginate(append([]models.Product{}, products...), tt.page, tt.pageSize, tt.order)
+
+			if total != len(products) {
+				t.Errorf("Expected total %d, got %d", len(products), total)
+			}
+
+			ids := make([]int, len(page))
+			for i, product := range page {
+				ids[i] = product.ID
+			}
+			if fmt.Sprint(ids) != tt.expectedIDs {
+				t.Errorf("Expected products %s, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+}
+
+func TestGetProductsStableOrdering(t *testing.T) {
+	ctx := context.Background()
+
+	// products with many duplicate prices and categories, so that orders by
+	// those fields rely on the ID tiebreak
+	now := time.Now()
+	products := make([]*models.Product, 50)
+	for i := range products {
+		products[i] = &models.Product{
+			ID:        i + 1,
+			Name:      fmt.Sprintf("Product %d", i+1),
+			Price:     float64(i % 4),
+			Category:  fmt.Sprintf("Category %d", i%3),
+			InStock:   i%2 == 0,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+	}
+
+	// two databases holding the same products, inserted in different orders
+	newDB := func(order []int) *InMemoryDB {
+		db := &InMemoryDB{products: map[int]*models.Product{}, skus: map[string]int{}, categories: map[string]int{}, names: map[string]int{}}
+		for _, i := range order {
+			product := *products[i]
+			db.insert(&product)
+		}
+		return db
+	}
+	ascending := make([]int, len(products))
+	for i := range ascending {
+		ascending[i] = i
+	}
+	dbA := newDB(ascending)
+	dbB := newDB(rand.New(rand.NewPCG(1, 2)).Perm(len(products)))
+
+	byPrice := func(a, b *models.Product) int { return cmp.Compare(a.Price, b.Price) }
+	byCategoryDesc := func(a, b *models.Product) int { return cmp.Compare(b.Category, a.Category) }
+	inStock := func(p *models.Product) bool { return p.InStock }
+
+	tests := []struct {
+		name    string
+		order   ProductOrder
+		filters []ProductFilter
+	}{
+		{name: "By ID"},
+		{name: "By ID, filtered", filters: []ProductFilter{inStock}},
+		{name: "By price", order: byPrice},
+		{name: "By category descending, filtered", order: byCategoryDesc, filters: []ProductFilter{inStock}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for page := 1; page <= 6; page++ {
+				productsA, totalA, err := dbA.GetProducts(ctx, page, 10, tt.order, tt.filters...)
+				if err != nil {
+					t.Fatalf("GetProducts() failed: %v", err)
+				}
+				productsB, totalB, err := dbB.GetProducts(ctx, page, 10, tt.order, tt.filters...)
+				if err != nil {
+					t.Fatalf("GetProducts() failed: %v", err)
+				}
+
+				// a backend iterating products in (random) map order
+				var unordered []models.Product
+			productLoop:
+				for _, product := range dbB.products {
+					for _, filter := range tt.filters {
+						if !filter(product) {
+							continue productLoop
+						}
+					}
+					unordered = append(unordered, *product)
+				}
+				productsC, totalC := Paginate(unordered, page, 10, tt.order)
+
+				jsonA, _ := json.Marshal(productsA)
+				jsonB, _ := json.Marshal(productsB)
+				jsonC, _ := json.Marshal(productsC)
+				if totalA != totalB || string(jsonA) != string(jsonB) {
+					t.Errorf("page %d: listings differ:\n%s (of %d)\n%s (of %d)", page, jsonA, totalA, jsonB, totalB)
+				}
+				if totalA != totalC || string(jsonA) != string(jsonC) {
+					t.Errorf("page %d: listings differ:\n%s (of %d)\n%s (of %d)", page, jsonA, totalA, jsonC, totalC)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"products-api/internal/models"
+
+	"github.com/blugnu/time"
+)
+
+// ReserveStock reserves a (positive) quantity of the stock of a product by
+// its ID for a time-to-live, decrementing the quantity of the product.  The
+// quantity is restored to the product when the reservation expires (see
+// StartReservationSweep).  Returns ErrInsufficientStock if the quantity
+// exceeds that of the product, ErrGone if the product has been deleted or
+// ErrNotFound if there has never been such a product.
+func (db *InMemoryDB) ReserveStock(ctx context.Context, id, quantity int, ttl time.Duration) (*models.Reservation, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	product, exists := db.products[id]
+	switch {
+	case !exists:
+		if _, deleted := db.deleted[id]; deleted {
+			return nil, ErrGone
+		}
+		return nil, ErrNotFound
+
+	case quantity > product.Quantity:
+		return nil, fmt.Errorf("%w: %d requested, %d available", ErrInsufficientStock, quantity, product.Quantity)
+	}
+
+	now := db.now()
+	remaining := product.Quantity - quantity
+	db.update(product, models.UpdateProductRequest{Quantity: &remaining}, models.OperationReserve, now)
+
+	reservation := models.Reservation{
+		ID:        db.nextReservationID,
+		ProductID: id,
+		Quantity:  quantity,
+		ExpiresAt: now.Add(ttl),
+	}
+	db.reservations[reservation.ID] = reservation
+	db.nextReservationID++
+
+	return &reservation, nil
+}
+
+// StartReservationSweep starts a goroutine that, at each interval of the
+// clock of the database, expires reservations (see ReserveStock) whose
+// time-to-live has passed, restoring their quantities to the products
+// reserved.  The goroutine runs until the context is cancelled.
+func (db *InMemoryDB) StartReservationSweep(ctx context.Context, interval time.Duration) {
+	db.startReservationSweep(ctx, interval, nil)
+}
+
+// startReservationSweep starts the goroutine of StartReservationSweep,
+// calling any restored function with the ID of each product whose quantity
+// is restored by a sweep (e.g. to invalidate a cached product; see
+// CachingDB.StartReservationSweep)
+func (db *InMemoryDB) startReservationSweep(ctx context.Context, interval time.Duration, restored func(id int)) {
+	ticker := db.clock.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case now := <-ticker.C:
+				ids := db.expireReservations(now)
+				if restored != nil {
+					for _, id := range ids {
+						restored(id)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// expireReservations removes the reservations that have expired at a time,
+// restoring their quantities to the products reserved (if they still exist).
+// Returns the IDs of the products whose quantities are restored.
+func (db *InMemoryDB) expireReservations(now time.Time) []int {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	var restored []int
+	now = now.UTC()
+	for id, reservation := range db.reservations {
+		if now.Before(reservation.ExpiresAt) {
+			continue
+		}
+		delete(db.reservations, id)
+
+		if product, exists := db.products[reservation.ProductID]; exists {
+			quantity := product.Quantity + reservation.Quantity
+			db.update(product, models.UpdateProductRequest{Quantity: &quantity}, models.OperationRelease, now)
+			restored = append(restored, product.ID)
+		}
+	}
+	return restored
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"products-api/internal/models"
+
+	"github.com/blugnu/time"
+)
+
+func TestReserveStock(t *testing.T) {
+	ctx := context.Background()
+
+	// quantity returns the quantity of a product, failing the test if it
+	// cannot be retrieved
+	quantity := func(t *testing.T, db *InMemoryDB, id int) int {
+		t.Helper()
+		product, err := db.GetProductByID(ctx, id)
+		if err != nil {
+			t.Fatalf("GetProductByID(%d) failed: %v", id, err)
+		}
+		return product.Quantity
+	}
+
+	t.Run("Reserve", func(t *testing.T) {
+		clock := time.NewMockClock()
+		db := NewInMemoryDB(WithClock(clock), WithSampleData())
+
+		reservation, err := db.ReserveStock(ctx, 1, 2, 5*time.Minute)
+		if err != nil {
+			t.Fatalf("ReserveStock() failed: %v", err)
+		}
+
+		expected := models.Reservation{ID: 1, ProductID: 1, Quantity: 2, ExpiresAt: clock.Now().UTC().Add(5 * time.Minute)}
+		if *reservation != expected {
+			t.Errorf("Expected reservation %+v, got %+v", expected, *reservation)
+		}
+		if n := quantity(t, db, 1); n != 13 {
+			t.Errorf("Expected quantity 13, got %d", n)
+		}
+	})
+
+	t.Run("Reserve all", func(t *testing.T) {
+		db := NewInMemoryDB(WithSampleData())
+
+		if _, err := db.ReserveStock(ctx, 4, 8, time.Minute); err != nil {
+			t.Fatalf("ReserveStock() failed: %v", err)
+		}
+		if n, _ := db.CountProducts(ctx, InStock(true)); n != 3 {
+			t.Errorf("Expected 3 products in stock once all of a product is reserved, got %d", n)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		db := NewInMemoryDB(WithSampleData())
+		if err := db.DeleteProduct(ctx, 5); err != nil {
+			t.Fatalf("DeleteProduct() failed: %v", err)
+		}
+
+		for _, tt := range []struct {
+			name     string
+			id       int
+			quantity int
+			err      error
+		}{
+			{name: "Insufficient stock", id: 1, quantity: 16, err: ErrInsufficientStock},
+			{name: "Out of stock", id: 3, quantity: 1, err: ErrInsufficientStock},
+			{name: "Deleted product", id: 5, quantity: 1, err: ErrGone},
+			{name: "Unknown product", id: 99, quantity: 1, err: ErrNotFound},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				if _, err := db.ReserveStock(ctx, tt.id, tt.quantity, time.Minute); !errors.Is(err, tt.err) {
+					t.Errorf("Expected %v, got %v", tt.err, err)
+				}
+			})
+		}
+
+		if n := quantity(t, db, 1); n != 15 {
+			t.Errorf("Expected quantity 15 to be unchanged, got %d", n)
+		}
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		clock := time.NewMockClock()
+		db := NewInMemoryDB(WithClock(clock), WithSampleData())
+
+		sweepCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		db.StartReservationSweep(sweepCtx, time.Minute)
+
+		if _, err := db.ReserveStock(ctx, 1, 2, 5*time.Minute); err != nil {
+			t.Fatalf("ReserveStock() failed: %v", err)
+		}
+		if _, err := db.ReserveStock(ctx, 1, 3, 10*time.Minute); err != nil {
+			t.Fatalf("ReserveStock() failed: %v", err)
+		}
+
+		clock.AdvanceBy(4 * time.Minute)
+		if n := quantity(t, db, 1); n != 10 {
+			t.Errorf("Expected quantity 10 before expiry, got %d", n)
+		}
+
+		clock.AdvanceBy(time.Minute)
+		if n := quantity(t, db, 1); n != 12 {
+			t.Errorf("Expected quantity 12 once the first reservation has expired, got %d", n)
+		}
+
+		clock.AdvanceBy(5 * time.Minute)
+		if n := quantity(t, db, 1); n != 15 {
+			t.Errorf("Expected quantity 15 once both reservations have expired, got %d", n)
+		}
+
+		changes, _ := db.ProductHistory(ctx, 1)
+		operations := []string{}
+		for _, change := range changes {
+			operations = append(operations, change.Operation)
+		}
+		if expected := "[reserve reserve release release]"; fmt.Sprint(operations) != expected {
+			t.Errorf("Expected operations %s, got %v", expected, operations)
+		}
+	})
+
+	t.Run("Expiry of deleted product", func(t *testing.T) {
+		clock := time.NewMockClock()
+		db := NewInMemoryDB(WithClock(clock), WithSampleData())
+
+		if _, err := db.ReserveStock(ctx, 1, 2, time.Minute); err != nil {
+			t.Fatalf("ReserveStock() failed: %v", err)
+		}
+		if err := db.DeleteProduct(ctx, 1); err != nil {
+			t.Fatalf("DeleteProduct() failed: %v", err)
+		}
+
+		db.expireReservations(clock.Now().Add(time.Minute))
+		if len(db.reservations) != 0 {
+			t.Errorf("Expected the reservation to be removed, got %v", db.reservations)
+		}
+	})
+}
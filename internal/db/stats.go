@@ -0,0 +1,76 @@
+package db
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"products-api/internal/models"
+)
+
+// CategoryPriceStats returns the number of products, and their minimum,
+// maximum and average price, in each category of the specified products.  It
+// is provided for use by Database implementations in PriceStats.
+//
+// Categories are compared case-insensitively; the statistics of a category
+// are reported with the category of the first of its products.  Categories
+// are ordered by name (case-insensitively) and categories with no products
+// are omitted.
+func CategoryPriceStats(products []models.Product) []models.CategoryStats {
+	stats := newPriceStats()
+	for i := range products {
+		stats.add(&products[i])
+	}
+	return stats.result()
+}
+
+// priceStats accumulates the price statistics of products in each category
+type priceStats struct {
+	categories map[string]*categoryTotals
+}
+
+// categoryTotals holds the statistics of the products in a category, with
+// the sum of their prices from which the average is derived
+type categoryTotals struct {
+	models.CategoryStats
+	total float64
+}
+
+func newPriceStats() *priceStats {
+	return &priceStats{categories: map[string]*categoryTotals{}}
+}
+
+// add includes a product in the statistics of its category
+func (s *priceStats) add(product *models.Product) {
+	key := strings.ToLower(product.Category)
+
+	c, ok := s.categories[key]
+	if !ok {
+		c = &categoryTotals{CategoryStats: models.CategoryStats{
+			Category: product.Category,
+			MinPrice: product.Price,
+			MaxPrice: product.Price,
+		}}
+		s.categories[key] = c
+	}
+
+	c.Count++
+	c.total += product.Price
+	c.MinPrice = min(c.MinPrice, product.Price)
+	c.MaxPrice = max(c.MaxPrice, product.Price)
+}
+
+// result returns the statistics of each category, ordered by category
+func (s *priceStats) result() []models.CategoryStats {
+	result := make([]models.CategoryStats, 0, len(s.categories))
+	for _, c := range s.categories {
+		stats := c.CategoryStats
+		stats.AvgPrice = c.total / float64(c.Count)
+		result = append(result, stats)
+	}
+
+	slices.SortFunc(result, func(a, b models.CategoryStats) int {
+		return cmp.Compare(strings.ToLower(a.Category), strings.ToLower(b.Category))
+	})
+	return result
+}
@@ -1,50 +1,423 @@
 package models
 
 import (
+	"encoding/json"
+	"encoding/xml"
+	"maps"
+	"slices"
+	"strings"
 	"time"
 )
 
+// DefaultCurrency is the currency of a product price if no currency is
+// specified when the product is created
+const DefaultCurrency = "USD"
+
 // Product represents a product in our system
 type Product struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name" validate:"required"`
-	Description string    `json:"description"`
-	Price       float64   `json:"price" validate:"required,min=0"`
-	Category    string    `json:"category"`
-	InStock     bool      `json:"in_stock"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	XMLName     xml.Name  `json:"-" xml:"product"`
+	ID          int       `json:"id" xml:"id"`
+	SKU         string    `json:"sku,omitempty" xml:"sku,omitempty"`
+	Name        string    `json:"name" xml:"name" validate:"required"`
+	Description string    `json:"description" xml:"description"`
+	Price       float64   `json:"price" xml:"price" validate:"required,min=0"`
+	Currency    string    `json:"currency" xml:"currency"`
+	Category    string    `json:"category" xml:"category"`
+	InStock     bool      `json:"in_stock" xml:"in_stock"`
+	Quantity    int       `json:"quantity" xml:"quantity"`
+	Tags        []string  `json:"tags,omitempty" xml:"tags>tag,omitempty"`
+	Images      []string  `json:"images,omitempty" xml:"images>image,omitempty"` // URLs of images of the product
+	CreatedAt   time.Time `json:"created_at" xml:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" xml:"updated_at"`
+}
+
+// MarshalJSON marshals a product with its timestamps in UTC (RFC 3339 with a
+// Z suffix), whatever the location of the times
+func (p Product) MarshalJSON() ([]byte, error) {
+	type product Product // a Product without this method
+	p.CreatedAt = p.CreatedAt.UTC()
+	p.UpdatedAt = p.UpdatedAt.UTC()
+	return json.Marshal(product(p))
 }
 
 // CreateProductRequest represents the request body for creating a product
 type CreateProductRequest struct {
-	Name        string  `json:"name" validate:"required"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price" validate:"required,min=0"`
-	Category    string  `json:"category"`
-	InStock     bool    `json:"in_stock"`
+	SKU         string   `json:"sku,omitempty" validate:"omitempty,sku"`
+	Name        string   `json:"name" validate:"required,notblank,min=2,max=200"`
+	Description string   `json:"description"`
+	Price       float64  `json:"price" validate:"required,min=0"`
+	Currency    string   `json:"currency,omitempty" validate:"omitempty,iso4217"` // ISO 4217 code (default: DefaultCurrency)
+	Category    string   `json:"category"`
+	InStock     bool     `json:"in_stock"`
+	Quantity    int      `json:"quantity" validate:"min=0"`
+	Tags        []string `json:"tags,omitempty" validate:"omitempty,dive,required"`
+	Images      []string `json:"images,omitempty" validate:"omitempty,dive,http_url"` // http or https URLs
+}
+
+// TrimSpace removes leading and trailing whitespace from the name,
+// description and category of the request
+func (req *CreateProductRequest) TrimSpace() {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = strings.TrimSpace(req.Description)
+	req.Category = strings.TrimSpace(req.Category)
 }
 
 // UpdateProductRequest represents the request body for updating a product
 type UpdateProductRequest struct {
-	Name        *string  `json:"name,omitempty"`
+	SKU         *string  `json:"sku,omitempty" validate:"omitempty,sku"`
+	Name        *string  `json:"name,omitempty" validate:"omitnil,notblank,min=2,max=200"`
 	Description *string  `json:"description,omitempty"`
 	Price       *float64 `json:"price,omitempty" validate:"omitempty,min=0"`
+	Currency    *string  `json:"currency,omitempty" validate:"omitnil,iso4217"`
 	Category    *string  `json:"category,omitempty"`
 	InStock     *bool    `json:"in_stock,omitempty"`
+	Quantity    *int     `json:"quantity,omitempty" validate:"omitnil,min=0"`
+
+	// Tags, if not nil, replaces the tags of the product or, if MergeTags is
+	// set, is merged with them (adding any tags not already present).  An
+	// empty (non-nil) list removes all tags (unless merging).
+	Tags      []string `json:"tags,omitempty" validate:"omitempty,dive,required"`
+	MergeTags bool     `json:"-"`
+
+	// Images, if not nil, replaces the image URLs (http or https) of the
+	// product; an empty (non-nil) list removes all images
+	Images []string `json:"images,omitempty" validate:"omitempty,dive,http_url"`
+
+	// PriceMultiplier, if not nil, multiplies the price of the product (after
+	// any Price is applied), rounding to 2 decimal places; it is specified by
+	// a bulk update (see BulkUpdateRequest) rather than by the body of an
+	// update
+	PriceMultiplier *float64 `json:"-" validate:"omitnil,gt=0"`
+}
+
+// TrimSpace removes leading and trailing whitespace from the name,
+// description and category of the request (those that are specified)
+func (req *UpdateProductRequest) TrimSpace() {
+	for _, s := range []*string{req.Name, req.Description, req.Category} {
+		if s != nil {
+			*s = strings.TrimSpace(*s)
+		}
+	}
+}
+
+// SetNull sets the field of the request with a specified (JSON) name to clear
+// the corresponding field of the product: the SKU, description and category
+// are cleared to empty and tags and images are removed.  Returns false if
+// the field is required and so cannot be cleared (name, price, currency,
+// in_stock and quantity).  Names that are not fields of the request are
+// ignored.
+func (req *UpdateProductRequest) SetNull(field string) bool {
+	empty := ""
+	switch strings.ToLower(field) {
+	case "sku":
+		req.SKU = &empty
+	case "description":
+		req.Description = &empty
+	case "category":
+		req.Category = &empty
+	case "tags":
+		req.Tags = []string{}
+		req.MergeTags = false
+	case "images":
+		req.Images = []string{}
+	case "name", "price", "currency", "in_stock", "quantity":
+		return false
+	}
+	return true
 }
 
 // PaginatedResponse represents a paginated response
 type PaginatedResponse struct {
-	Data       []Product `json:"data"`
-	Page       int       `json:"page"`
-	PageSize   int       `json:"page_size"`
-	Total      int       `json:"total"`
-	TotalPages int       `json:"total_pages"`
+	XMLName    xml.Name  `json:"-" xml:"products"`
+	Data       []Product `json:"data" xml:"data>product"`
+	Page       int       `json:"page" xml:"page"`
+	PageSize   int       `json:"page_size" xml:"page_size"`
+	Total      int       `json:"total" xml:"total"`
+	TotalPages int       `json:"total_pages" xml:"total_pages"`
+
+	// Links are the URLs of other pages of the listing
+	Links PaginationLinks `json:"links" xml:"links"`
+
+	// AppliedFilters and Suggestions are only provided for an empty result
+	// when the API is configured to offer hints for empty results
+	AppliedFilters FilterValues `json:"applied_filters,omitempty" xml:"applied_filters,omitempty"`
+	Suggestions    []string     `json:"suggestions,omitempty" xml:"suggestions>suggestion,omitempty"`
+}
+
+// PaginationLinks holds the URLs of the first, previous, next and last pages
+// of a listing, with the filters and sort order of the listing.  Prev and
+// Next are omitted on the first and last page respectively.
+type PaginationLinks struct {
+	First string `json:"first" xml:"first"`
+	Prev  string `json:"prev,omitempty" xml:"prev,omitempty"`
+	Next  string `json:"next,omitempty" xml:"next,omitempty"`
+	Last  string `json:"last" xml:"last"`
+}
+
+// FilterValues maps the names of query parameters to the values specified
+// for them.  In XML, each is represented as a filter element with a param
+// attribute, ordered by param.
+type FilterValues map[string]string
+
+// MarshalXML implements xml.Marshaler; encoding/xml does not support maps
+func (fv FilterValues) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, param := range slices.Sorted(maps.Keys(fv)) {
+		filter := xml.StartElement{
+			Name: xml.Name{Local: "filter"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "param"}, Value: param}},
+		}
+		if err := e.EncodeElement(fv[param], filter); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// ProductListResponse represents an unpaginated list of products
+type ProductListResponse struct {
+	XMLName xml.Name  `json:"-" xml:"products"`
+	Data    []Product `json:"data" xml:"data>product"`
+}
+
+// UncategorizedGroup is the key of the group of products without a category
+// in GroupedProducts
+const UncategorizedGroup = "_uncategorized"
+
+// GroupedProducts maps categories to the products in each category; products
+// without a category are in the UncategorizedGroup.  In XML, each category is
+// represented as a group element with a category attribute, ordered by
+// category.
+type GroupedProducts map[string][]Product
+
+// MarshalXML implements xml.Marshaler; encoding/xml does not support maps
+func (gp GroupedProducts) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Local: "groups"}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, category := range slices.Sorted(maps.Keys(gp)) {
+		group := xml.StartElement{
+			Name: xml.Name{Local: "group"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "category"}, Value: category}},
+		}
+		if err := e.EncodeToken(group); err != nil {
+			return err
+		}
+		for _, product := range gp[category] {
+			if err := e.EncodeElement(product, xml.StartElement{Name: xml.Name{Local: "product"}}); err != nil {
+				return err
+			}
+		}
+		if err := e.EncodeToken(group.End()); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// ProductsByIDsResponse represents the products requested by ID, in the
+// order requested, with the requested IDs that are not the ID of a product
+type ProductsByIDsResponse struct {
+	XMLName    xml.Name  `json:"-" xml:"products"`
+	Data       []Product `json:"data" xml:"data>product"`
+	MissingIDs []int     `json:"missing_ids" xml:"missing_ids>id"`
+}
+
+// ImportResult represents the result of importing a single line of a bulk
+// import; either the ID of the created product or an error is provided
+type ImportResult struct {
+	Line  int    `json:"line" xml:"line"`
+	ID    int    `json:"id,omitempty" xml:"id,omitempty"`
+	Error string `json:"error,omitempty" xml:"error,omitempty"`
+}
+
+// ImportResponse represents a summary of the results of a bulk import
+type ImportResponse struct {
+	XMLName xml.Name       `json:"-" xml:"import"`
+	Created int            `json:"created" xml:"created"`
+	Failed  int            `json:"failed" xml:"failed"`
+	Results []ImportResult `json:"results" xml:"results>result"`
+}
+
+// BulkUpdateRequest represents a request to update all products matching a
+// filter
+type BulkUpdateRequest struct {
+	// Filter selects the products to update, by the names and values of
+	// the query parameters filtering a product listing (e.g.
+	// {"category": "Electronics", "price_max": 20}); a parameter that may be
+	// repeated (i.e. tag) may be given a list of values
+	Filter map[string]any `json:"filter"`
+
+	// Update, if not nil, is applied to each product as for an update of
+	// the product (PUT /api/v1/products/{id})
+	Update *UpdateProductRequest `json:"update,omitempty"`
+
+	// PriceMultiplier, if not nil, multiplies the price of each product
+	// (e.g. 0.9 for 10% off); it cannot be combined with a price in Update
+	PriceMultiplier *float64 `json:"price_multiplier,omitempty"`
+}
+
+// BulkUpdateResponse represents the result of a bulk update
+type BulkUpdateResponse struct {
+	XMLName xml.Name `json:"-" xml:"bulk_update"`
+	Updated int      `json:"updated" xml:"updated"`
+}
+
+// CountResponse represents the number of products matching any filters
+type CountResponse struct {
+	XMLName xml.Name `json:"-" xml:"count"`
+	Count   int      `json:"count" xml:",chardata"`
+}
+
+// CategoryStats represents aggregate prices of the products in a category
+type CategoryStats struct {
+	Category string  `json:"category" xml:"category,attr"`
+	Count    int     `json:"count" xml:"count"`
+	MinPrice float64 `json:"min_price" xml:"min_price"`
+	MaxPrice float64 `json:"max_price" xml:"max_price"`
+	AvgPrice float64 `json:"avg_price" xml:"avg_price"`
+}
+
+// PriceStatsResponse represents the price statistics of the products in each
+// category
+type PriceStatsResponse struct {
+	XMLName    xml.Name        `json:"-" xml:"stats"`
+	Categories []CategoryStats `json:"categories" xml:"category"`
+}
+
+// The operations by which a product may be changed, in the history of the
+// product (see ProductChange)
+const (
+	OperationUpdate     = "update"      // an update of the product
+	OperationBulkUpdate = "bulk_update" // an update of products matching a filter
+	OperationReplace    = "replace"     // an upsert replacing the product
+	OperationReserve    = "reserve"     // a reservation of stock of the product
+	OperationRelease    = "release"     // the restoration of the stock of an expired reservation
+)
+
+// ProductChange represents a change to a product, in the history of the
+// product: the time and operation of the change and the (JSON) names of the
+// fields that changed
+type ProductChange struct {
+	Timestamp time.Time `json:"timestamp" xml:"timestamp"`
+	Operation string    `json:"operation" xml:"operation"`
+	Fields    []string  `json:"fields" xml:"fields>field"`
+}
+
+// ProductHistoryResponse represents the history of a product, oldest change
+// first
+type ProductHistoryResponse struct {
+	XMLName xml.Name        `json:"-" xml:"history"`
+	Data    []ProductChange `json:"data" xml:"data>change"`
+}
+
+// ReserveStockRequest represents a request to reserve a quantity of the stock
+// of a product
+type ReserveStockRequest struct {
+	Quantity int `json:"quantity" xml:"quantity" validate:"required,min=1"`
+}
+
+// Reservation represents a temporary hold on a quantity of the stock of a
+// product; the quantity is restored to the product when the reservation
+// expires
+type Reservation struct {
+	XMLName   xml.Name  `json:"-" xml:"reservation"`
+	ID        int       `json:"id" xml:"id"`
+	ProductID int       `json:"product_id" xml:"product_id"`
+	Quantity  int       `json:"quantity" xml:"quantity"`
+	ExpiresAt time.Time `json:"expires_at" xml:"expires_at"`
+}
+
+// Backup represents the entire catalog, for restoring a database: all of the
+// products, ordered by ID, and the (ascending) IDs of deleted products
+type Backup struct {
+	XMLName    xml.Name  `json:"-" xml:"backup"`
+	Products   []Product `json:"products" xml:"products>product" validate:"dive"`
+	DeletedIDs []int     `json:"deleted_ids" xml:"deleted_ids>id"`
+}
+
+// RestoreResponse represents the result of restoring a backup: the number
+// of products restored and the number of products in the catalog as a result
+type RestoreResponse struct {
+	XMLName  xml.Name `json:"-" xml:"restore"`
+	Restored int      `json:"restored" xml:"restored"`
+	Total    int      `json:"total" xml:"total"`
+}
+
+// RateLimitReset identifies the client whose rate limit is reset, in both
+// the request and the response of a rate limit reset
+type RateLimitReset struct {
+	XMLName xml.Name `json:"-" xml:"ratelimit_reset"`
+	Client  string   `json:"client" xml:"client" validate:"required"`
+}
+
+// MaintenanceMode is whether the service is in maintenance mode, in both the
+// request and the response of setting it
+type MaintenanceMode struct {
+	XMLName xml.Name `json:"-" xml:"maintenance"`
+	Enabled *bool    `json:"enabled" xml:"enabled" validate:"required"`
+}
+
+// VersionResponse identifies the build of the service
+type VersionResponse struct {
+	XMLName   xml.Name `json:"-" xml:"version"`
+	Version   string   `json:"version" xml:"version"`
+	Commit    string   `json:"commit" xml:"commit"`
+	BuildTime string   `json:"build_time" xml:"build_time"`
+}
+
+// HealthResponse represents the response of a health or readiness check
+//
+// ProductCount is omitted if the number of products could not be determined.
+type HealthResponse struct {
+	XMLName       xml.Name `json:"-" xml:"health"`
+	Service       string   `json:"service" xml:"service"`
+	Status        string   `json:"status" xml:"status"`
+	ProductCount  *int     `json:"product_count,omitempty" xml:"product_count,omitempty"`
+	UptimeSeconds float64  `json:"uptime_seconds" xml:"uptime_seconds"`
 }
 
 // ErrorResponse represents an error response
+//
+// Code identifies the error and is stable; Error and Message are human
+// readable and may change.
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message,omitempty"`
+	XMLName   xml.Name `json:"-" xml:"error"`
+	Code      string   `json:"code" xml:"code"`
+	Error     string   `json:"error" xml:"error"`
+	Message   string   `json:"message,omitempty" xml:"message,omitempty"`
+	RequestID string   `json:"request_id,omitempty" xml:"request_id,omitempty"`
+
+	// RetryAfterSeconds is the number of seconds after which a request
+	// rejected with CodeRateLimited may be retried, if known
+	RetryAfterSeconds int `json:"retry_after_seconds,omitempty" xml:"retry_after_seconds,omitempty"`
 }
+
+// Error codes identify the error reported by an ErrorResponse; clients
+// should rely on the code of an error rather than its message
+const (
+	CodeCapacityExceeded    = "CAPACITY_EXCEEDED"
+	CodeDatabaseUnavailable = "DATABASE_UNAVAILABLE"
+	CodeDuplicateSKU        = "DUPLICATE_SKU"
+	CodeInsufficientStock   = "INSUFFICIENT_STOCK"
+	CodeInternalError       = "INTERNAL_ERROR"
+	CodeInvalidCategory     = "INVALID_CATEGORY"
+	CodeInvalidImport       = "INVALID_IMPORT"
+	CodeInvalidJSON         = "INVALID_JSON"
+	CodeInvalidProductID    = "INVALID_PRODUCT_ID"
+	CodeInvalidQuery        = "INVALID_QUERY"
+	CodeMaintenance         = "MAINTENANCE"
+	CodeMethodNotAllowed    = "METHOD_NOT_ALLOWED"
+	CodeNameConflict        = "NAME_CONFLICT"
+	CodeNotSupported        = "NOT_SUPPORTED"
+	CodeProductGone         = "PRODUCT_GONE"
+	CodeProductNotFound     = "PRODUCT_NOT_FOUND"
+	CodeRateLimited         = "RATE_LIMITED"
+	CodeRequestTimeout      = "REQUEST_TIMEOUT"
+	CodeTooManyCategories   = "TOO_MANY_CATEGORIES"
+	CodeUnsupportedMedia    = "UNSUPPORTED_MEDIA_TYPE"
+	CodeValidationFailed    = "VALIDATION_FAILED"
+)
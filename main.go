@@ -2,49 +2,193 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"products-api/internal/api"
+	"products-api/internal/api/ratelimiter"
 	"products-api/internal/db"
+	"products-api/internal/models"
 )
 
 func main() {
 	var err error
 
+	log.Printf("products-api %s (commit: %s, built: %s)", api.Version, api.Commit, api.BuildTime)
+
 	// Create a context for the application
 	ctx := context.Background()
 
 	// Initialize the in-memory database
-	database := db.NewInMemoryDB()
+	var dbOpts []db.Option
+	if os.Getenv("SEED_DATA") == "true" {
+		log.Println("SEED_DATA: adding sample products")
+		dbOpts = append(dbOpts, db.WithSampleData())
+	}
+	if s := os.Getenv("MAX_CATEGORIES"); s != "" {
+		maxCategories, err := strconv.Atoi(s)
+		if err != nil {
+			log.Fatalf("Invalid MAX_CATEGORIES: %v", err)
+		}
+		log.Println("MAX_CATEGORIES:", maxCategories)
+		dbOpts = append(dbOpts, db.WithMaxCategories(maxCategories))
+	}
+
+	// Products cannot be created beyond a maximum number of products, if set
+	// (capacity warnings are also given as the maximum is approached)
+	maxProducts := 0
+	if s := os.Getenv("MAX_PRODUCTS"); s != "" {
+		var err error
+		if maxProducts, err = strconv.Atoi(s); err != nil {
+			log.Fatalf("Invalid MAX_PRODUCTS: %v", err)
+		}
+		log.Println("MAX_PRODUCTS:", maxProducts)
+		dbOpts = append(dbOpts, db.WithMaxProducts(maxProducts))
+	}
+	database := db.NewInMemoryDB(dbOpts...)
+
+	if path := os.Getenv("SEED_FILE"); path != "" {
+		n, err := seedProducts(ctx, database, path)
+		if err != nil {
+			log.Fatalf("Invalid SEED_FILE: %v", err)
+		}
+		log.Printf("SEED_FILE: added %d product(s) from %s", n, path)
+	}
 
 	// Initialize a rate limiter with a cancellable context
 	ctx, cancelRateLimiter := context.WithCancel(ctx)
 	defer cancelRateLimiter()
 
-	var rateLimit = 100
-	if s := os.Getenv("RATE_LIMIT"); s != "" {
-		var err error
-		rateLimit, err = strconv.Atoi(s)
-		if err != nil {
-			log.Fatalf("Invalid RATE_LIMIT: %v", err)
-		}
+	rateLimitConfig, err := rateLimiterConfig()
+	if err != nil {
+		log.Fatalf("Invalid rate limiter configuration: %v", err)
 	}
-	log.Println("RATE_LIMIT:", rateLimit, "requests/sec")
 
-	rateLimiter, err := api.NewRateLimiter(ctx, rateLimit)
+	rateLimiter, err := api.NewRateLimiter(ctx, rateLimitConfig)
 	if err != nil {
 		log.Fatalf("Failed to create rate limiter: %v", err)
 	}
 
+	logLevel := parseLogLevel(os.Getenv("LOG_LEVEL"))
+	log.Println("LOG_LEVEL:", logLevel)
+	opts := []api.Option{
+		api.WithLogger(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))),
+	}
+
+	// Internal error details are hidden from clients unless explicitly enabled
+	if os.Getenv("SHOW_INTERNAL_ERRORS") != "true" {
+		opts = append(opts, api.WithHideInternalErrors())
+	}
+
+	if os.Getenv("ADMIN_ENDPOINTS") == "true" {
+		log.Println("ADMIN_ENDPOINTS: administration endpoints are enabled")
+		opts = append(opts, api.WithAdminEndpoints())
+	}
+	if os.Getenv("SCHEMA_VALIDATION") == "true" {
+		opts = append(opts, api.WithSchemaValidation())
+	}
+	if os.Getenv("MAINTENANCE_MODE") == "true" {
+		log.Println("MAINTENANCE_MODE: requests modifying products are rejected")
+		opts = append(opts, api.WithMaintenance())
+	}
+	if os.Getenv("UNIQUE_NAMES") == "true" {
+		opts = append(opts, api.WithUniqueNames())
+	}
+	if s := os.Getenv("ALLOWED_CATEGORIES"); s != "" {
+		var categories []string
+		for _, category := range strings.Split(s, ",") {
+			if category = strings.TrimSpace(category); category != "" {
+				categories = append(categories, category)
+			}
+		}
+		log.Println("ALLOWED_CATEGORIES:", strings.Join(categories, ", "))
+		opts = append(opts, api.WithAllowedCategories(categories...))
+	}
+
+	if os.Getenv("RATE_LIMIT_HEADERS") == "true" {
+		opts = append(opts, api.WithRateLimitHeaders())
+	}
+	if s := os.Getenv("RATE_LIMIT_WRITE_COST"); s != "" {
+		writeCost, err := strconv.Atoi(s)
+		if err != nil {
+			log.Fatalf("Invalid RATE_LIMIT_WRITE_COST: %v", err)
+		}
+		log.Println("RATE_LIMIT_WRITE_COST:", writeCost)
+		opts = append(opts, api.WithWriteCost(writeCost))
+	}
+
+	if s := os.Getenv("DEFAULT_PAGE_SIZE"); s != "" {
+		pageSize, err := strconv.Atoi(s)
+		if err != nil {
+			log.Fatalf("Invalid DEFAULT_PAGE_SIZE: %v", err)
+		}
+		log.Println("DEFAULT_PAGE_SIZE:", pageSize)
+		opts = append(opts, api.WithDefaultPageSize(pageSize))
+	}
+
+	if spec := os.Getenv("DEFAULT_SORT"); spec != "" {
+		if err := api.ValidateSort(spec); err != nil {
+			log.Fatalf("Invalid DEFAULT_SORT: %v", err)
+		}
+		log.Println("DEFAULT_SORT:", spec)
+		opts = append(opts, api.WithDefaultSort(spec))
+	}
+
+	requestTimeout := parseDuration("REQUEST_TIMEOUT", os.Getenv("REQUEST_TIMEOUT"), defaultRequestTimeout)
+	log.Println("REQUEST_TIMEOUT:", requestTimeout)
+	opts = append(opts, api.WithRequestTimeout(requestTimeout))
+
+	if s := os.Getenv("RESERVATION_TTL"); s != "" {
+		if ttl := parseDuration("RESERVATION_TTL", s, 0); ttl > 0 {
+			log.Println("RESERVATION_TTL:", ttl)
+			opts = append(opts, api.WithReservationTTL(ttl))
+		}
+	}
+
+	if maxProducts > 0 {
+		opts = append(opts, api.WithMaxProducts(maxProducts))
+	}
+	if s := os.Getenv("CAPACITY_WARNING_THRESHOLD"); s != "" {
+		threshold, err := strconv.Atoi(s)
+		if err != nil {
+			log.Fatalf("Invalid CAPACITY_WARNING_THRESHOLD: %v", err)
+		}
+		log.Println("CAPACITY_WARNING_THRESHOLD:", threshold, "%")
+		opts = append(opts, api.WithCapacityWarningThreshold(threshold))
+	}
+
+	// Products retrieved by ID are cached if a cache TTL is set
+	var store db.Database = database
+	var sweeper interface {
+		StartReservationSweep(context.Context, time.Duration)
+	} = database
+	if s := os.Getenv("CACHE_TTL"); s != "" {
+		if ttl := parseDuration("CACHE_TTL", s, 0); ttl > 0 {
+			log.Println("CACHE_TTL:", ttl)
+			cache := db.NewCachingDB(ctx, database, ttl)
+			store, sweeper = cache, cache
+		}
+	}
+
+	// Expired stock reservations are swept (restoring their quantities) at
+	// an interval, until the context is cancelled; the sweep is through any
+	// cache, so that restored quantities are not hidden by cached products
+	sweepInterval := parseDuration("RESERVATION_SWEEP_INTERVAL", os.Getenv("RESERVATION_SWEEP_INTERVAL"), defaultReservationSweepInterval)
+	log.Println("RESERVATION_SWEEP_INTERVAL:", sweepInterval)
+	sweeper.StartReservationSweep(ctx, sweepInterval)
+
 	// Create the API handler with the database
-	handler := api.NewHandler(database, rateLimiter)
+	handler := api.NewHandler(store, rateLimiter, opts...)
 
 	// Set up routes
 	mux := handler.SetupRoutes()
@@ -55,6 +199,10 @@ func main() {
 		port = "8080"
 	}
 
+	// Time allowed for in-flight requests to complete on shutdown
+	timeout := parseDuration("SHUTDOWN_TIMEOUT", os.Getenv("SHUTDOWN_TIMEOUT"), defaultShutdownTimeout)
+	log.Println("SHUTDOWN_TIMEOUT:", timeout)
+
 	// Channel to listen for interrupt signals
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
@@ -79,10 +227,198 @@ func main() {
 
 	<-stop // wait for stop signal
 
-	ctx, cancelShutdown := context.WithTimeout(ctx, 15*time.Second)
+	log.Printf("Shutting down with %d request(s) in flight (timeout %s)", handler.InFlight(), timeout)
+
+	ctx, cancelShutdown := context.WithTimeout(ctx, timeout)
 	defer cancelShutdown()
 
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server Shutdown Failed: %+v", err)
 	}
 }
+
+const (
+	// defaultShutdownTimeout is the time allowed for in-flight requests to
+	// complete when the server is shut down, if SHUTDOWN_TIMEOUT is not set
+	defaultShutdownTimeout = 15 * time.Second
+
+	// defaultRequestTimeout is the time allowed to handle a request, if
+	// REQUEST_TIMEOUT is not set
+	defaultRequestTimeout = 30 * time.Second
+
+	// defaultReservationSweepInterval is the interval at which expired stock
+	// reservations are swept, if RESERVATION_SWEEP_INTERVAL is not set
+	defaultReservationSweepInterval = time.Minute
+)
+
+// rateLimiterConfig returns the configuration of the rate limiter specified
+// by environment variables: RATE_LIMIT (default 100), RATE_LIMIT_ALGORITHM,
+// RATE_LIMIT_BURST, RATE_LIMIT_BUCKET_SIZE, RATE_LIMIT_MAX_CLIENTS,
+// RATE_LIMIT_EXEMPT, RATE_LIMIT_TRUST_PROXY (and RATE_LIMIT_CLIENT_IP_HEADER)
+// and the LIMIT_INTERVAL and CLIENT_TIMEOUT durations (defaults are applied
+// by api.NewRateLimiter).  An error is returned if a value is not valid; the
+// configuration (including the exempt addresses) is validated when the rate
+// limiter is created.
+func rateLimiterConfig() (ratelimiter.Config, error) {
+	cfg := ratelimiter.Config{Limit: 100}
+
+	if s := os.Getenv("RATE_LIMIT"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid RATE_LIMIT: %w", err)
+		}
+		cfg.Limit = limit
+	}
+	log.Println("RATE_LIMIT:", cfg.Limit, "requests per interval")
+
+	cfg.Algorithm = ratelimiter.Algorithm(os.Getenv("RATE_LIMIT_ALGORITHM"))
+	if cfg.Algorithm != "" {
+		log.Println("RATE_LIMIT_ALGORITHM:", cfg.Algorithm)
+	}
+
+	if s := os.Getenv("RATE_LIMIT_BURST"); s != "" {
+		burst, err := strconv.Atoi(s)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid RATE_LIMIT_BURST: %w", err)
+		}
+		cfg.Burst = burst
+		log.Println("RATE_LIMIT_BURST:", cfg.Burst, "requests per interval")
+	}
+
+	if s := os.Getenv("RATE_LIMIT_BUCKET_SIZE"); s != "" {
+		bucketSize, err := strconv.Atoi(s)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid RATE_LIMIT_BUCKET_SIZE: %w", err)
+		}
+		cfg.BucketSize = bucketSize
+		log.Println("RATE_LIMIT_BUCKET_SIZE:", cfg.BucketSize, "requests")
+	}
+
+	if s := os.Getenv("RATE_LIMIT_MAX_CLIENTS"); s != "" {
+		maxClients, err := strconv.Atoi(s)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid RATE_LIMIT_MAX_CLIENTS: %w", err)
+		}
+		cfg.MaxClients = maxClients
+		log.Println("RATE_LIMIT_MAX_CLIENTS:", cfg.MaxClients)
+	}
+
+	if s := os.Getenv("RATE_LIMIT_EXEMPT"); s != "" {
+		for _, entry := range strings.Split(s, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				cfg.Exempt = append(cfg.Exempt, entry)
+			}
+		}
+		log.Println("RATE_LIMIT_EXEMPT:", strings.Join(cfg.Exempt, ", "))
+	}
+
+	// clients are identified by X-Forwarded-For (or a client IP header) only
+	// if requests are received via a proxy that sets it, since it is
+	// otherwise trivially forged
+	if os.Getenv("RATE_LIMIT_TRUST_PROXY") == "true" {
+		cfg.TrustProxy = true
+		log.Println("RATE_LIMIT_TRUST_PROXY: clients are identified by X-Forwarded-For")
+
+		if header := strings.TrimSpace(os.Getenv("RATE_LIMIT_CLIENT_IP_HEADER")); header != "" {
+			cfg.ClientIPHeader = header
+			log.Println("RATE_LIMIT_CLIENT_IP_HEADER:", header)
+		}
+	}
+
+	for _, env := range []struct {
+		name string
+		dur  *time.Duration
+	}{
+		{"LIMIT_INTERVAL", &cfg.LimitInterval},
+		{"CLIENT_TIMEOUT", &cfg.ClientTimeout},
+	} {
+		s := os.Getenv(env.name)
+		if s == "" {
+			continue
+		}
+		d, err := time.ParseDuration(s)
+		switch {
+		case err != nil:
+			return cfg, fmt.Errorf("invalid %s: %w", env.name, err)
+		case d <= 0:
+			return cfg, fmt.Errorf("invalid %s: must be positive", env.name)
+		}
+		*env.dur = d
+		log.Println(env.name+":", d)
+	}
+
+	return cfg, nil
+}
+
+// parseDuration parses the value of a duration environment variable (e.g.
+// "30s"), returning a default if the value is empty or is not a valid
+// positive duration (in which case a warning is logged)
+func parseDuration(name, s string, def time.Duration) time.Duration {
+	if s == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(s)
+	switch {
+	case err != nil:
+		log.Printf("WARNING: Invalid %s (using %s): %v", name, def, err)
+		return def
+
+	case d <= 0:
+		log.Printf("WARNING: Invalid %s (using %s): must be positive", name, def)
+		return def
+	}
+	return d
+}
+
+// parseLogLevel parses the value of the LOG_LEVEL environment variable
+// ("debug", "info", "warn" or "error", case-insensitive), returning the info
+// level if the value is empty or is not valid (in which case a warning is
+// logged)
+func parseLogLevel(s string) slog.Level {
+	if s == "" {
+		return slog.LevelInfo
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		log.Printf("WARNING: Invalid LOG_LEVEL (using %s): %v", slog.LevelInfo, err)
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// seedProducts creates the products in a seed file (a JSON array of product
+// creation requests), returning the number of products created.  An error is
+// returned if the file cannot be read, is not a valid array of requests
+// (including requests with unknown fields or that fail the validation of the
+// API) or any product cannot be created.  No products are created if any
+// request is invalid.
+func seedProducts(ctx context.Context, database db.Database, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var reqs []models.CreateProductRequest
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&reqs); err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for i := range reqs {
+		reqs[i].TrimSpace()
+		if err := api.ValidateCreateRequest(reqs[i]); err != nil {
+			return 0, fmt.Errorf("%s: product %d: %w", path, i+1, err)
+		}
+	}
+
+	for i, req := range reqs {
+		if _, err := database.CreateProduct(ctx, req); err != nil {
+			return i, fmt.Errorf("%s: product %d: %w", path, i+1, err)
+		}
+	}
+	return len(reqs), nil
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,7 +21,7 @@ import (
 
 func TestMainIntegration(t *testing.T) {
 	// Test that we can create a complete application setup
-	database := db.NewInMemoryDB()
+	database := db.NewInMemoryDB(db.WithSampleData())
 	limiter := ratelimiter.NewNoopLimiter() // Use NoopLimiter for integration tests
 	handler := api.NewHandler(database, limiter)
 	mux := handler.SetupRoutes()
@@ -91,7 +97,7 @@ func TestEnvironmentVariables(t *testing.T) {
 
 func TestServerCanStart(t *testing.T) {
 	// Test that the server can be initialized without errors
-	database := db.NewInMemoryDB()
+	database := db.NewInMemoryDB(db.WithSampleData())
 	limiter := ratelimiter.NewNoopLimiter()
 	handler := api.NewHandler(database, limiter)
 	mux := handler.SetupRoutes()
@@ -114,7 +120,7 @@ func TestServerCanStart(t *testing.T) {
 
 func TestConcurrentRequests(t *testing.T) {
 	// Test that the application can handle concurrent requests
-	database := db.NewInMemoryDB()
+	database := db.NewInMemoryDB(db.WithSampleData())
 	limiter := ratelimiter.NewNoopLimiter()
 	handler := api.NewHandler(database, limiter)
 	mux := handler.SetupRoutes()
@@ -163,3 +169,251 @@ func TestConcurrentRequests(t *testing.T) {
 		}
 	}
 }
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+	}{
+		{name: "Default when not set", value: "", expected: 15 * time.Second},
+		{name: "Seconds", value: "30s", expected: 30 * time.Second},
+		{name: "Compound duration", value: "1m30s", expected: 90 * time.Second},
+		{name: "Milliseconds", value: "500ms", expected: 500 * time.Millisecond},
+		{name: "Default when invalid", value: "soon", expected: 15 * time.Second},
+		{name: "Default when missing units", value: "30", expected: 15 * time.Second},
+		{name: "Default when zero", value: "0s", expected: 15 * time.Second},
+		{name: "Default when negative", value: "-5s", expected: 15 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseDuration("SHUTDOWN_TIMEOUT", tt.value, 15*time.Second); got != tt.expected {
+				t.Errorf("Expected timeout %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected slog.Level
+	}{
+		{name: "Default when not set", value: "", expected: slog.LevelInfo},
+		{name: "Debug", value: "debug", expected: slog.LevelDebug},
+		{name: "Warn (case-insensitive)", value: "WARN", expected: slog.LevelWarn},
+		{name: "Error", value: "error", expected: slog.LevelError},
+		{name: "Default when invalid", value: "verbose", expected: slog.LevelInfo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseLogLevel(tt.value); got != tt.expected {
+				t.Errorf("Expected level %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSeedProducts(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		expectedCount int
+		expectedError bool
+	}{
+		{
+			name:          "Valid seed file",
+			content:       `[{"name":"Pen","price":1.5,"category":"Stationery"},{"sku":"PAD-001","name":"Notepad","price":3,"tags":["paper"]}]`,
+			expectedCount: 2,
+		},
+		{name: "Empty array", content: `[]`, expectedCount: 0},
+		{name: "Malformed JSON", content: `[{"name":"Pen","price":1.5}`, expectedError: true},
+		{name: "Not an array", content: `{"name":"Pen","price":1.5}`, expectedError: true},
+		{name: "Unknown field", content: `[{"name":"Pen","cost":1.5}]`, expectedError: true},
+		{name: "Duplicate SKU", content: `[{"sku":"PAD-001","name":"Notepad","price":3},{"sku":"PAD-001","name":"Notepad","price":3}]`, expectedError: true},
+
+		{name: "Blank name", content: `[{"name":"Pen","price":1.5},{"name":"  ","price":3}]`, expectedError: true},
+		{name: "Negative price", content: `[{"name":"Pen","price":-1}]`, expectedError: true},
+		{name: "Invalid currency", content: `[{"name":"Pen","price":1.5,"currency":"XYZ"}]`, expectedError: true},
+		{name: "Invalid SKU", content: `[{"sku":"PAD 001","name":"Notepad","price":3}]`, expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "seed.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("Failed to write seed file: %v", err)
+			}
+
+			database := db.NewInMemoryDB()
+			n, err := seedProducts(context.Background(), database, path)
+
+			if tt.expectedError {
+				if err == nil {
+					t.Errorf("Expected an error loading seed file, got %d products", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to load seed file: %v", err)
+			}
+
+			count, _ := database.CountProducts(context.Background())
+			if n != tt.expectedCount || count != tt.expectedCount {
+				t.Errorf("Expected %d products, got %d (%d in database)", tt.expectedCount, n, count)
+			}
+		})
+	}
+
+	t.Run("Invalid product", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "seed.json")
+		if err := os.WriteFile(path, []byte(`[{"name":"Pen","price":1.5},{"name":"Notepad","price":-3}]`), 0o600); err != nil {
+			t.Fatalf("Failed to write seed file: %v", err)
+		}
+
+		database := db.NewInMemoryDB()
+		_, err := seedProducts(context.Background(), database, path)
+		if err == nil || !strings.Contains(err.Error(), "product 2") {
+			t.Errorf("Expected an error identifying product 2, got %v", err)
+		}
+		if count, _ := database.CountProducts(context.Background()); count != 0 {
+			t.Errorf("Expected no products to be created, got %d", count)
+		}
+	})
+
+	t.Run("Missing seed file", func(t *testing.T) {
+		if _, err := seedProducts(context.Background(), db.NewInMemoryDB(), filepath.Join(t.TempDir(), "missing.json")); err == nil {
+			t.Error("Expected an error loading a missing seed file")
+		}
+	})
+}
+
+func TestRateLimiterConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		expected    ratelimiter.Config
+		expectError bool
+		limiterErr  error
+	}{
+		{
+			name:     "Defaults",
+			expected: ratelimiter.Config{Limit: 100},
+		},
+		{
+			name:     "Limit interval and client timeout",
+			env:      map[string]string{"RATE_LIMIT": "50", "LIMIT_INTERVAL": "10s", "CLIENT_TIMEOUT": "5m"},
+			expected: ratelimiter.Config{Limit: 50, LimitInterval: 10 * time.Second, ClientTimeout: 5 * time.Minute},
+		},
+		{
+			name:     "Algorithm and max clients",
+			env:      map[string]string{"RATE_LIMIT_ALGORITHM": "token-bucket", "RATE_LIMIT_MAX_CLIENTS": "1000"},
+			expected: ratelimiter.Config{Limit: 100, Algorithm: ratelimiter.TokenBucket, MaxClients: 1000},
+		},
+		{
+			name:     "Burst",
+			env:      map[string]string{"RATE_LIMIT_BURST": "5"},
+			expected: ratelimiter.Config{Limit: 100, Burst: 5},
+		},
+		{
+			name:     "Exemptions",
+			env:      map[string]string{"RATE_LIMIT_EXEMPT": "10.0.0.0/8, 192.0.2.1,,"},
+			expected: ratelimiter.Config{Limit: 100, Exempt: []string{"10.0.0.0/8", "192.0.2.1"}},
+		},
+		{
+			name:       "Invalid exemption",
+			env:        map[string]string{"RATE_LIMIT_EXEMPT": "10.0.0.0/33"},
+			expected:   ratelimiter.Config{Limit: 100, Exempt: []string{"10.0.0.0/33"}},
+			limiterErr: ratelimiter.ErrInvalidExemption,
+		},
+		{
+			name:     "Trust proxy",
+			env:      map[string]string{"RATE_LIMIT_TRUST_PROXY": "true"},
+			expected: ratelimiter.Config{Limit: 100, TrustProxy: true},
+		},
+		{
+			name:     "Client IP header",
+			env:      map[string]string{"RATE_LIMIT_TRUST_PROXY": "true", "RATE_LIMIT_CLIENT_IP_HEADER": "CF-Connecting-IP"},
+			expected: ratelimiter.Config{Limit: 100, TrustProxy: true, ClientIPHeader: "CF-Connecting-IP"},
+		},
+		{
+			name:     "Client IP header without trust proxy",
+			env:      map[string]string{"RATE_LIMIT_CLIENT_IP_HEADER": "CF-Connecting-IP"},
+			expected: ratelimiter.Config{Limit: 100},
+		},
+		{
+			name:     "Trust proxy not enabled",
+			env:      map[string]string{"RATE_LIMIT_TRUST_PROXY": "yes"},
+			expected: ratelimiter.Config{Limit: 100},
+		},
+		{
+			name:     "Bucket size",
+			env:      map[string]string{"RATE_LIMIT_ALGORITHM": "token-bucket", "RATE_LIMIT_BUCKET_SIZE": "250"},
+			expected: ratelimiter.Config{Limit: 100, Algorithm: ratelimiter.TokenBucket, BucketSize: 250},
+		},
+		{name: "Invalid bucket size", env: map[string]string{"RATE_LIMIT_BUCKET_SIZE": "big"}, expectError: true},
+		{
+			name:       "Negative bucket size",
+			env:        map[string]string{"RATE_LIMIT_ALGORITHM": "token-bucket", "RATE_LIMIT_BUCKET_SIZE": "-1"},
+			expected:   ratelimiter.Config{Limit: 100, Algorithm: ratelimiter.TokenBucket, BucketSize: -1},
+			limiterErr: ratelimiter.ErrInvalidBucketSize,
+		},
+		{name: "Invalid burst", env: map[string]string{"RATE_LIMIT_BURST": "some"}, expectError: true},
+		{
+			name:       "Negative burst",
+			env:        map[string]string{"RATE_LIMIT_BURST": "-1"},
+			expected:   ratelimiter.Config{Limit: 100, Burst: -1},
+			limiterErr: ratelimiter.ErrInvalidBurst,
+		},
+		{name: "Invalid limit interval", env: map[string]string{"LIMIT_INTERVAL": "often"}, expectError: true},
+		{name: "Limit interval missing units", env: map[string]string{"LIMIT_INTERVAL": "10"}, expectError: true},
+		{name: "Zero client timeout", env: map[string]string{"CLIENT_TIMEOUT": "0s"}, expectError: true},
+		{name: "Invalid rate limit", env: map[string]string{"RATE_LIMIT": "lots"}, expectError: true},
+		{
+			name:       "Limit interval less than a second",
+			env:        map[string]string{"LIMIT_INTERVAL": "500ms"},
+			expected:   ratelimiter.Config{Limit: 100, LimitInterval: 500 * time.Millisecond},
+			limiterErr: ratelimiter.ErrInvalidLimitInterval,
+		},
+		{
+			name:       "Client timeout not greater than limit interval",
+			env:        map[string]string{"LIMIT_INTERVAL": "1m", "CLIENT_TIMEOUT": "1m"},
+			expected:   ratelimiter.Config{Limit: 100, LimitInterval: time.Minute, ClientTimeout: time.Minute},
+			limiterErr: ratelimiter.ErrInvalidClientTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"RATE_LIMIT", "RATE_LIMIT_ALGORITHM", "RATE_LIMIT_BURST", "RATE_LIMIT_BUCKET_SIZE", "RATE_LIMIT_MAX_CLIENTS", "RATE_LIMIT_EXEMPT", "RATE_LIMIT_TRUST_PROXY", "RATE_LIMIT_CLIENT_IP_HEADER", "LIMIT_INTERVAL", "CLIENT_TIMEOUT"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			cfg, err := rateLimiterConfig()
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, got config %+v", cfg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if cfg.Limit != tt.expected.Limit || cfg.Algorithm != tt.expected.Algorithm || cfg.Burst != tt.expected.Burst || cfg.BucketSize != tt.expected.BucketSize || cfg.MaxClients != tt.expected.MaxClients || !slices.Equal(cfg.Exempt, tt.expected.Exempt) ||
+				cfg.TrustProxy != tt.expected.TrustProxy || cfg.ClientIPHeader != tt.expected.ClientIPHeader || cfg.LimitInterval != tt.expected.LimitInterval || cfg.ClientTimeout != tt.expected.ClientTimeout {
+				t.Errorf("Expected config %+v, got %+v", tt.expected, cfg)
+			}
+
+			// the configuration is validated when the rate limiter is created
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if _, err := api.NewRateLimiter(ctx, cfg); !errors.Is(err, tt.limiterErr) {
+				t.Errorf("Expected rate limiter error %v, got %v", tt.limiterErr, err)
+			}
+		})
+	}
+}